@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"filesystem-mcp-server/pkg/mcpfiles"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// BenchCall is a single tool call replayed by the bench subcommand
+type BenchCall struct {
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// benchSample is the outcome of one timed call
+type benchSample struct {
+	tool     string
+	duration time.Duration
+	failed   bool
+}
+
+// runBench implements the `bench` subcommand: it replays recorded or synthetic
+// tool calls against a server and reports latency percentiles and memory
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	target := fs.String("target", "", "MCP endpoint of a running server, e.g. http://localhost:3001/mcp (default: in-process server)")
+	authToken := fs.String("auth-token", os.Getenv("MCP_AUTH_TOKEN"), "Bearer token of the -target server, if it requires one (default: $MCP_AUTH_TOKEN)")
+	basePath := fs.String("base-path", ".", "Base path served by the in-process server")
+	replay := fs.String("replay", "", "JSONL file of recorded tool calls to replay")
+	stateKeyFile := fs.String("state-key-file", "", "Key the replay file was encrypted with, if any")
+	workload := fs.String("workload", "mixed", "Synthetic workload when not replaying: tree, grep, read or mixed")
+	pattern := fs.String("pattern", "TODO", "Pattern used by synthetic grep calls")
+	syntheticFiles := fs.Int("synthetic-files", 0, "Generate a temporary tree with this many files for the in-process server")
+	requests := fs.Int("requests", 100, "Total number of calls for synthetic workloads")
+	concurrency := fs.Int("concurrency", 8, "Number of concurrent clients")
+	fs.Parse(args)
+
+	if *concurrency <= 0 {
+		*concurrency = 1
+	}
+
+	// The in-process server shares this process, so its memory use is measurable
+	var newClient func() (*client.Client, error)
+	if *target != "" {
+		if *syntheticFiles > 0 {
+			return fmt.Errorf("-synthetic-files requires the in-process server")
+		}
+		var opts []transport.StreamableHTTPCOption
+		if *authToken != "" {
+			opts = append(opts, transport.WithHTTPHeaders(map[string]string{"Authorization": "Bearer " + *authToken}))
+		}
+		newClient = func() (*client.Client, error) {
+			return client.NewStreamableHttpClient(*target, opts...)
+		}
+	} else {
+		if *syntheticFiles > 0 {
+			dir, err := generateSyntheticTree(*syntheticFiles, *pattern)
+			if err != nil {
+				return fmt.Errorf("failed to generate synthetic tree: %w", err)
+			}
+			defer os.RemoveAll(dir)
+			*basePath = dir
+		}
+
+		config := &mcpfiles.Config{BasePath: *basePath}
+		if err := mcpfiles.ValidateConfig(config); err != nil {
+			return err
+		}
+		fileServer := mcpfiles.NewServer(config)
+		fileServer.RegisterTools()
+		newClient = func() (*client.Client, error) {
+			return client.NewInProcessClient(fileServer.MCPServer())
+		}
+	}
+
+	ctx := context.Background()
+
+	// Build the call list
+	var calls []BenchCall
+	if *replay != "" {
+		stateCipher, err := loadStateCipher(*stateKeyFile)
+		if err != nil {
+			return err
+		}
+		loaded, err := loadBenchCalls(*replay, stateCipher)
+		if err != nil {
+			return err
+		}
+		calls = loaded
+	} else {
+		c, err := startBenchClient(ctx, newClient)
+		if err != nil {
+			return err
+		}
+		calls, err = syntheticCalls(ctx, c, *workload, *pattern, *requests)
+		c.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if len(calls) == 0 {
+		return fmt.Errorf("no calls to run")
+	}
+
+	// Sample memory while the benchmark runs
+	memDone := make(chan struct{})
+	var peakHeap uint64
+	var memWG sync.WaitGroup
+	memWG.Add(1)
+	go func() {
+		defer memWG.Done()
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		var stats runtime.MemStats
+		for {
+			runtime.ReadMemStats(&stats)
+			if stats.HeapInuse > peakHeap {
+				peakHeap = stats.HeapInuse
+			}
+			select {
+			case <-memDone:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	// Fan calls out to concurrent clients
+	work := make(chan BenchCall)
+	samples := make(chan benchSample, len(calls))
+	errs := make(chan error, *concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := startBenchClient(ctx, newClient)
+			if err != nil {
+				errs <- err
+				for range work {
+				}
+				return
+			}
+			defer c.Close()
+
+			for call := range work {
+				request := mcp.CallToolRequest{}
+				request.Params.Name = call.Tool
+				request.Params.Arguments = call.Arguments
+
+				callStart := time.Now()
+				result, err := c.CallTool(ctx, request)
+				samples <- benchSample{
+					tool:     call.Tool,
+					duration: time.Since(callStart),
+					failed:   err != nil || result.IsError,
+				}
+			}
+		}()
+	}
+	for _, call := range calls {
+		work <- call
+	}
+	close(work)
+	wg.Wait()
+	elapsed := time.Since(start)
+	close(samples)
+	close(memDone)
+	memWG.Wait()
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("failed to start client: %w", err)
+	default:
+	}
+
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+
+	printBenchReport(samples, elapsed, *concurrency)
+	if *target == "" {
+		fmt.Printf("Memory (in-process server): peak heap %.2f MB, allocated %.2f MB\n",
+			float64(peakHeap)/1024/1024, float64(after.TotalAlloc-before.TotalAlloc)/1024/1024)
+	}
+
+	return nil
+}
+
+// startBenchClient creates and initializes a client
+func startBenchClient(ctx context.Context, newClient func() (*client.Client, error)) (*client.Client, error) {
+	c, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Start(ctx); err != nil {
+		return nil, err
+	}
+
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initRequest.Params.ClientInfo = mcp.Implementation{Name: "filesystem-mcp-bench", Version: "1.0.0"}
+	if _, err := c.Initialize(ctx, initRequest); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to initialize: %w", err)
+	}
+
+	return c, nil
+}
+
+// loadBenchCalls reads one BenchCall per line, decrypting sealed lines
+func loadBenchCalls(path string, stateCipher *mcpfiles.StateCipher) ([]BenchCall, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replay file: %w", err)
+	}
+	defer file.Close()
+
+	var calls []BenchCall
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		plain, err := stateCipher.Open([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("invalid call on line %d: %w", lineNum, err)
+		}
+		var call BenchCall
+		if err := json.Unmarshal(plain, &call); err != nil {
+			return nil, fmt.Errorf("invalid call on line %d: %w", lineNum, err)
+		}
+		calls = append(calls, call)
+	}
+
+	return calls, scanner.Err()
+}
+
+// syntheticCalls builds a workload of n calls
+func syntheticCalls(ctx context.Context, c *client.Client, workload, pattern string, n int) ([]BenchCall, error) {
+	treeCall := BenchCall{Tool: "read_file_structure", Arguments: map[string]interface{}{}}
+	grepCall := BenchCall{Tool: "grep_search", Arguments: map[string]interface{}{"queries": []mcpfiles.GrepQuery{{Pattern: pattern}}}}
+
+	var readCalls []BenchCall
+	if workload == "read" || workload == "mixed" {
+		files, err := benchSampleFiles(ctx, c, 100)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			readCalls = append(readCalls, BenchCall{Tool: "read_file_contents", Arguments: map[string]interface{}{"file_path": file}})
+		}
+		if len(readCalls) == 0 {
+			return nil, fmt.Errorf("no files found to read")
+		}
+	}
+
+	calls := make([]BenchCall, 0, n)
+	for i := 0; i < n; i++ {
+		switch workload {
+		case "tree":
+			calls = append(calls, treeCall)
+		case "grep":
+			calls = append(calls, grepCall)
+		case "read":
+			calls = append(calls, readCalls[i%len(readCalls)])
+		case "mixed":
+			switch i % 3 {
+			case 0:
+				calls = append(calls, treeCall)
+			case 1:
+				calls = append(calls, grepCall)
+			default:
+				calls = append(calls, readCalls[i%len(readCalls)])
+			}
+		default:
+			return nil, fmt.Errorf("unknown workload: %s", workload)
+		}
+	}
+
+	return calls, nil
+}
+
+// benchSampleFiles collects up to limit file paths from the server's tree
+func benchSampleFiles(ctx context.Context, c *client.Client, limit int) ([]string, error) {
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "read_file_structure"
+	result, err := c.CallTool(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if result.IsError || len(result.Content) == 0 {
+		return nil, fmt.Errorf("read_file_structure failed")
+	}
+	text, ok := result.Content[0].(mcp.TextContent)
+	if !ok {
+		return nil, fmt.Errorf("unexpected read_file_structure result")
+	}
+
+	var tree struct {
+		Structure *mcpfiles.FileNode `json:"structure"`
+	}
+	if err := json.Unmarshal([]byte(text.Text), &tree); err != nil {
+		return nil, err
+	}
+
+	var files []string
+	var collect func(node *mcpfiles.FileNode)
+	collect = func(node *mcpfiles.FileNode) {
+		if node == nil || len(files) >= limit {
+			return
+		}
+		if node.Type == "file" {
+			files = append(files, node.Path)
+		}
+		for _, child := range node.Children {
+			collect(child)
+		}
+	}
+	collect(tree.Structure)
+
+	return files, nil
+}
+
+// generateSyntheticTree writes n small source files into a temporary directory,
+// 100 files per subdirectory, with pattern appearing on some lines
+func generateSyntheticTree(n int, pattern string) (string, error) {
+	dir, err := os.MkdirTemp("", "mcp-bench-")
+	if err != nil {
+		return "", err
+	}
+
+	for i := 0; i < n; i++ {
+		subDir := filepath.Join(dir, fmt.Sprintf("pkg%04d", i/100))
+		if i%100 == 0 {
+			if err := os.MkdirAll(subDir, 0o755); err != nil {
+				return dir, err
+			}
+		}
+
+		var b strings.Builder
+		for line := 0; line < 50; line++ {
+			if line%10 == i%10 {
+				fmt.Fprintf(&b, "// %s: synthetic line %d\n", pattern, line)
+			} else {
+				fmt.Fprintf(&b, "func synthetic%d_%d() int { return %d }\n", i, line, line)
+			}
+		}
+		if err := os.WriteFile(filepath.Join(subDir, fmt.Sprintf("file%d.go", i)), []byte(b.String()), 0o644); err != nil {
+			return dir, err
+		}
+	}
+
+	return dir, nil
+}
+
+// printBenchReport prints per-tool latency percentiles
+func printBenchReport(samples <-chan benchSample, elapsed time.Duration, concurrency int) {
+	byTool := make(map[string][]time.Duration)
+	var all []time.Duration
+	failures := 0
+	for sample := range samples {
+		byTool[sample.tool] = append(byTool[sample.tool], sample.duration)
+		all = append(all, sample.duration)
+		if sample.failed {
+			failures++
+		}
+	}
+
+	fmt.Printf("Benchmark: %d calls, concurrency %d, %s (%.1f calls/s), %d errors\n",
+		len(all), concurrency, elapsed.Round(time.Millisecond), float64(len(all))/elapsed.Seconds(), failures)
+	fmt.Printf("%-24s %8s %10s %10s %10s %10s\n", "tool", "calls", "p50", "p90", "p99", "max")
+
+	tools := make([]string, 0, len(byTool))
+	for tool := range byTool {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+	for _, tool := range tools {
+		printBenchRow(tool, byTool[tool])
+	}
+	printBenchRow("all", all)
+}
+
+func printBenchRow(name string, durations []time.Duration) {
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	fmt.Printf("%-24s %8d %10s %10s %10s %10s\n", name, len(durations),
+		percentile(durations, 50), percentile(durations, 90), percentile(durations, 99), durations[len(durations)-1].Round(time.Microsecond))
+}
+
+// percentile returns the p-th percentile of sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	index := (len(sorted)*p+99)/100 - 1
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index].Round(time.Microsecond)
+}
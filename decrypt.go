@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runDecrypt implements the `decrypt` subcommand: it prints recordings and
+// audit logs written with -state-key-file as plain JSONL
+func runDecrypt(args []string) error {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	stateKeyFile := fs.String("state-key-file", "", "Key the files were encrypted with")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s decrypt -state-key-file key file.jsonl...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *stateKeyFile == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("a state key file and at least one file are required")
+	}
+	stateCipher, err := loadStateCipher(*stateKeyFile)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	for _, path := range fs.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+		for lineNum := 1; scanner.Scan(); lineNum++ {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			plain, err := stateCipher.Open(scanner.Bytes())
+			if err != nil {
+				file.Close()
+				return fmt.Errorf("%s line %d: %w", path, lineNum, err)
+			}
+			out.Write(plain)
+			out.WriteByte('\n')
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"filesystem-mcp-server/pkg/mcpfiles"
+)
+
+// exportManifest describes an archive written by the export subcommand
+type exportManifest struct {
+	Created time.Time      `json:"created"`
+	Since   *time.Time     `json:"since,omitempty"`
+	Until   *time.Time     `json:"until,omitempty"`
+	Files   []exportedFile `json:"files"`
+}
+
+// exportedFile is one file of an export archive
+type exportedFile struct {
+	Name    string `json:"name"`
+	Source  string `json:"source"`
+	Records int    `json:"records"`
+	Sealed  int    `json:"sealed"` // records still encrypted with the state key
+	SHA256  string `json:"sha256"`
+}
+
+// runExport implements the `export` subcommand: it copies the records of
+// audit logs and recordings in a time range into a tar.gz archive, with a
+// manifest of what it holds
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	auditLog := fs.String("audit-log", "", "Audit log written with -audit-log")
+	record := fs.String("record", "", "Recording written with -record")
+	stateKeyFile := fs.String("state-key-file", "", "Key the files were encrypted with, if any")
+	since := fs.String("since", "", "Only export records from this time on: RFC 3339, YYYY-MM-DD or a duration ago such as 720h")
+	until := fs.String("until", "", "Only export records before this time, in the same forms as -since")
+	output := fs.String("o", "", "Archive file to write (.tar.gz)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s export [-audit-log file] [-record file] [flags] -o archive.tar.gz\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *output == "" || (*auditLog == "" && *record == "") || fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("an output file and an audit log or recording are required")
+	}
+	stateCipher, err := loadStateCipher(*stateKeyFile)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	manifest := exportManifest{Created: now.UTC()}
+	for _, bound := range []struct {
+		value string
+		time  **time.Time
+	}{{*since, &manifest.Since}, {*until, &manifest.Until}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := parseExportTime(bound.value, now)
+		if err != nil {
+			return err
+		}
+		t = t.UTC()
+		*bound.time = &t
+	}
+	if manifest.Since != nil && manifest.Until != nil && !manifest.Since.Before(*manifest.Until) {
+		return fmt.Errorf("-since must be earlier than -until")
+	}
+
+	// Select the records before creating the archive, so a bad file leaves nothing behind
+	var contents [][]byte
+	for _, source := range []struct{ name, path string }{{"audit.jsonl", *auditLog}, {"recording.jsonl", *record}} {
+		if source.path == "" {
+			continue
+		}
+		content, file, err := exportRecords(source.path, stateCipher, manifest.Since, manifest.Until)
+		if err != nil {
+			return err
+		}
+		file.Name = source.name
+		manifest.Files = append(manifest.Files, file)
+		contents = append(contents, content)
+	}
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	archive, err := os.OpenFile(*output, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	err = writeExportArchive(archive, manifest, manifestJSON, contents)
+	if closeErr := archive.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*output)
+		return fmt.Errorf("failed to write %s: %w", *output, err)
+	}
+
+	for _, file := range manifest.Files {
+		fmt.Fprintf(os.Stderr, "Exported %d records of %s\n", file.Records, file.Source)
+	}
+	return nil
+}
+
+// exportRecords reads the records of a JSONL file whose time is in the
+// range, as they are stored. Sealed records are decrypted only to read their
+// time and stay encrypted in the export.
+func exportRecords(path string, stateCipher *mcpfiles.StateCipher, since, until *time.Time) ([]byte, exportedFile, error) {
+	file := exportedFile{Source: path}
+	data, err := os.Open(path)
+	if err != nil {
+		return nil, file, err
+	}
+	defer data.Close()
+
+	var content bytes.Buffer
+	scanner := bufio.NewScanner(data)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		plain, err := stateCipher.Open(line)
+		if err != nil {
+			return nil, file, fmt.Errorf("%s line %d: %w", path, lineNum, err)
+		}
+		var record struct {
+			Time time.Time `json:"time"`
+		}
+		if err := json.Unmarshal(plain, &record); err != nil {
+			return nil, file, fmt.Errorf("%s line %d: %w", path, lineNum, err)
+		}
+		if (since != nil && record.Time.Before(*since)) || (until != nil && !record.Time.Before(*until)) {
+			continue
+		}
+		content.Write(line)
+		content.WriteByte('\n')
+		file.Records++
+		if !bytes.Equal(plain, line) {
+			file.Sealed++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, file, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	sum := sha256.Sum256(content.Bytes())
+	file.SHA256 = hex.EncodeToString(sum[:])
+	return content.Bytes(), file, nil
+}
+
+// writeExportArchive writes the manifest and the exported files as a tar.gz
+func writeExportArchive(archive *os.File, manifest exportManifest, manifestJSON []byte, contents [][]byte) error {
+	gz := gzip.NewWriter(archive)
+	tw := tar.NewWriter(gz)
+	add := func(name string, content []byte) error {
+		header := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(content)), ModTime: manifest.Created}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(content)
+		return err
+	}
+
+	if err := add("manifest.json", append(manifestJSON, '\n')); err != nil {
+		return err
+	}
+	for i, file := range manifest.Files {
+		if err := add(file.Name, contents[i]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// parseExportTime accepts an RFC 3339 timestamp, a date, or a duration
+// meaning that long ago, as the grep_search scope filters do
+func parseExportTime(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not an RFC 3339 time, YYYY-MM-DD date or duration such as 720h", value)
+}
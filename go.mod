@@ -4,7 +4,11 @@ go 1.23
 
 toolchain go1.23.4
 
-require github.com/mark3labs/mcp-go v0.36.0
+require (
+	github.com/fsnotify/fsnotify v1.8.0
+	github.com/mark3labs/mcp-go v0.36.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/bahlo/generic-list-go v0.2.0 // indirect
@@ -15,5 +19,5 @@ require (
 	github.com/spf13/cast v1.7.1 // indirect
 	github.com/wk8/go-ordered-map/v2 v2.1.8 // indirect
 	github.com/yosida95/uritemplate/v3 v3.0.2 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 )
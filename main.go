@@ -1,417 +1,176 @@
 package main
 
 import (
-	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"regexp"
-	"strconv"
+	"runtime"
 	"strings"
+	"time"
 
-	"github.com/mark3labs/mcp-go/mcp"
-	"github.com/mark3labs/mcp-go/server"
+	"filesystem-mcp-server/pkg/mcpfiles"
 )
 
-// Config holds server configuration
-type Config struct {
-	Port        string `json:"port"`
-	BasePath    string `json:"base_path"`
-	MaxFileSize int64  `json:"max_file_size"`
+// rootsFlag collects repeated -base-path values, each a path or name=path
+type rootsFlag struct {
+	roots *[]mcpfiles.Root
 }
 
-// GrepQuery represents a single grep search query
-type GrepQuery struct {
-	Pattern     string  `json:"pattern"`
-	FilePattern *string `json:"file_pattern,omitempty"`
-	IgnoreCase  *bool   `json:"ignore_case,omitempty"`
-}
-
-// FileNode represents a file or directory in the tree structure
-type FileNode struct {
-	Name     string      `json:"name"`
-	Type     string      `json:"type"` // "file" or "directory"
-	Size     *int64      `json:"size,omitempty"`
-	Children []*FileNode `json:"children,omitempty"`
-	Path     string      `json:"path"`
-}
-
-// GrepResult represents a grep search result
-type GrepResult struct {
-	Query   string            `json:"query"`
-	Matches []GrepMatchResult `json:"matches"`
-	Error   *string           `json:"error,omitempty"`
-}
-
-// GrepMatchResult represents a single file match
-type GrepMatchResult struct {
-	FilePath string     `json:"file_path"`
-	Lines    []GrepLine `json:"lines"`
-}
-
-// GrepLine represents a line in grep results
-type GrepLine struct {
-	LineNumber int    `json:"line_number"`
-	Content    string `json:"content"`
-	IsMatch    bool   `json:"is_match"`
-}
-
-// Server represents our MCP server
-type MCPFileServer struct {
-	config *Config
-	server *server.MCPServer
-}
-
-// NewMCPFileServer creates a new MCP server instance
-func NewMCPFileServer(config *Config) *MCPFileServer {
-	// Create MCP server with proper capabilities
-	mcpServer := server.NewMCPServer(
-		"filesystem-mcp-server",
-		"1.0.0",
-		server.WithToolCapabilities(true), // Enable tool capabilities
-		server.WithRecovery(),             // Add error recovery
-		server.WithLogging(),              // Add logging
-	)
-
-	return &MCPFileServer{
-		config: config,
-		server: mcpServer,
-	}
-}
-
-// RegisterTools registers all available tools with the MCP server
-func (s *MCPFileServer) RegisterTools() {
-	// 1. Register read_file_structure tool
-	fileStructureTool := mcp.NewTool(
-		"read_file_structure",
-		mcp.WithDescription("Read and return the file structure of the configured filesystem path"),
-	)
-	s.server.AddTool(fileStructureTool, s.handleReadFileStructure)
-
-	// 2. Register read_file_contents tool
-	fileContentsTool := mcp.NewTool(
-		"read_file_contents",
-		mcp.WithDescription("Read and return the contents of a specific file"),
-		mcp.WithString("file_path", mcp.Required(), mcp.Description("Path to the file relative to the configured base path")),
-	)
-	s.server.AddTool(fileContentsTool, s.handleReadFileContents)
-
-	// 3. Register grep_search tool
-	grepTool := mcp.NewTool(
-		"grep_search",
-		mcp.WithDescription("Search for patterns in files using grep with context lines. Supports up to 20 search queries."),
-		mcp.WithString("queries", mcp.Required(), mcp.Description("JSON string containing array of search queries (max 20)")),
-		mcp.WithNumber("context_lines", mcp.Description("Number of lines before and after each match (default: 5)")),
-	)
-	s.server.AddTool(grepTool, s.handleGrepSearch)
-
-	log.Println("Registered 3 filesystem tools: read_file_structure, read_file_contents, grep_search")
-}
-
-// Start starts the HTTP MCP server
-func (s *MCPFileServer) Start() error {
-	// Register all tools
-	s.RegisterTools()
-
-	// Create streamable HTTP server for modern MCP transport
-	httpServer := server.NewStreamableHTTPServer(s.server)
-
-	log.Printf("Starting MCP File Server on port %s", s.config.Port)
-	log.Printf("Configured base path: %s", s.config.BasePath)
-	log.Printf("Server endpoint will be: http://localhost%s/mcp", s.config.Port)
-
-	// Start the server
-	return httpServer.Start(s.config.Port)
-}
-
-// handleReadFileContents handles the read_file_contents tool
-func (s *MCPFileServer) handleReadFileContents(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	filePath, err := request.RequireString("file_path")
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
-	}
-
-	// Validate and resolve path
-	fullPath, err := s.validateFilePath(filePath)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Invalid file path: %v", err)), nil
-	}
-
-	// Check file size
-	stat, err := os.Stat(fullPath)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("File not found: %v", err)), nil
+func (f rootsFlag) String() string {
+	if f.roots == nil {
+		return ""
 	}
-
-	if stat.Size() > s.config.MaxFileSize {
-		return mcp.NewToolResultError(fmt.Sprintf("File too large (%.2f MB > %.2f MB)",
-			float64(stat.Size())/1024/1024, float64(s.config.MaxFileSize)/1024/1024)), nil
-	}
-
-	// Read file contents
-	content, err := os.ReadFile(fullPath)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to read file: %v", err)), nil
-	}
-
-	// Create result as JSON text
-	result := map[string]interface{}{
-		"file_path":  filePath,
-		"size_bytes": stat.Size(),
-		"content":    string(content),
-	}
-
-	resultJSON, err := json.Marshal(result)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
-	}
-
-	return mcp.NewToolResultText(string(resultJSON)), nil
-}
-
-// handleGrepSearch handles the grep_search tool
-func (s *MCPFileServer) handleGrepSearch(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	args := request.GetArguments()
-
-	// Parse queries JSON string
-	queriesStr, ok := args["queries"].(string)
-	if !ok {
-		return mcp.NewToolResultError("queries parameter must be a JSON string"), nil
-	}
-
-	var queries []GrepQuery
-	if err := json.Unmarshal([]byte(queriesStr), &queries); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Invalid queries JSON: %v", err)), nil
-	}
-
-	// Validate number of queries
-	if len(queries) == 0 {
-		return mcp.NewToolResultError("At least one search query is required"), nil
-	}
-	if len(queries) > 20 {
-		return mcp.NewToolResultError("Maximum 20 search queries allowed"), nil
-	}
-
-	// Set default context lines
-	contextLines := 5
-	if val, ok := args["context_lines"]; ok && val != nil {
-		if cl, ok := val.(float64); ok {
-			contextLines = int(cl)
-		}
-	}
-
-	// Execute searches
-	results := make([]GrepResult, len(queries))
-	for i, query := range queries {
-		result, err := s.executeGrepQuery(query, contextLines)
-		if err != nil {
-			errorMsg := err.Error()
-			results[i] = GrepResult{
-				Query: query.Pattern,
-				Error: &errorMsg,
-			}
-		} else {
-			results[i] = *result
+	values := make([]string, len(*f.roots))
+	for i, root := range *f.roots {
+		values[i] = root.Path
+		if root.Name != "" {
+			values[i] = root.Name + "=" + root.Path
 		}
 	}
-
-	// Create result as JSON text
-	result := map[string]interface{}{
-		"base_path":     s.config.BasePath,
-		"context_lines": contextLines,
-		"results":       results,
-	}
-
-	resultJSON, err := json.Marshal(result)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
-	}
-
-	return mcp.NewToolResultText(string(resultJSON)), nil
+	return strings.Join(values, ",")
 }
 
-// Helper methods
-
-// validateFilePath validates and resolves a file path relative to base path
-func (s *MCPFileServer) validateFilePath(filePath string) (string, error) {
-	// Clean the path
-	cleanPath := filepath.Clean(filePath)
-
-	// Prevent directory traversal attacks
-	if strings.Contains(cleanPath, "..") {
-		return "", fmt.Errorf("path traversal not allowed")
+func (f rootsFlag) Set(value string) error {
+	root := mcpfiles.Root{Path: value}
+	if name, path, ok := strings.Cut(value, "="); ok {
+		root = mcpfiles.Root{Name: name, Path: path}
 	}
-
-	// Build full path
-	fullPath := filepath.Join(s.config.BasePath, cleanPath)
-
-	// Ensure the resolved path is still within base path
-	relPath, err := filepath.Rel(s.config.BasePath, fullPath)
-	if err != nil || strings.HasPrefix(relPath, "..") {
-		return "", fmt.Errorf("path outside of allowed directory")
-	}
-
-	return fullPath, nil
-}
-
-// executeGrepQuery executes a single grep query with context
-func (s *MCPFileServer) executeGrepQuery(query GrepQuery, contextLines int) (*GrepResult, error) {
-	// Build grep command
-	args := []string{}
-
-	// Add context lines
-	if contextLines > 0 {
-		args = append(args, "-C", strconv.Itoa(contextLines))
-	}
-
-	// Add line numbers
-	args = append(args, "-n")
-
-	// Add ignore case if specified
-	if query.IgnoreCase != nil && *query.IgnoreCase {
-		args = append(args, "-i")
-	}
-
-	// Add recursive search
-	args = append(args, "-r")
-
-	// Add pattern
-	args = append(args, query.Pattern)
-
-	// Add file pattern or search path
-	if query.FilePattern != nil {
-		args = append(args, "--include="+*query.FilePattern)
-	}
-	args = append(args, s.config.BasePath)
-
-	// Execute grep command
-	cmd := exec.Command("grep", args...)
-	output, err := cmd.Output()
-
-	// Handle case where grep finds no matches (exit code 1)
-	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
-			if exitError.ExitCode() == 1 {
-				// No matches found, return empty result
-				return &GrepResult{
-					Query:   query.Pattern,
-					Matches: []GrepMatchResult{},
-				}, nil
-			}
-		}
-		return nil, fmt.Errorf("grep command failed: %v", err)
-	}
-
-	// Parse grep output
-	matches, err := s.parseGrepOutput(string(output))
-	if err != nil {
-		return nil, err
-	}
-
-	return &GrepResult{
-		Query:   query.Pattern,
-		Matches: matches,
-	}, nil
+	*f.roots = append(*f.roots, root)
+	return nil
 }
 
-// parseGrepOutput parses grep output with context lines
-func (s *MCPFileServer) parseGrepOutput(output string) ([]GrepMatchResult, error) {
-	if output == "" {
-		return []GrepMatchResult{}, nil
-	}
-
-	lines := strings.Split(strings.TrimSpace(output), "\n")
-	matches := make(map[string][]GrepLine)
-
-	// Regex to parse grep output: filename:line_number:content or filename:line_number-content
-	lineRegex := regexp.MustCompile(`^([^:]+):(\d+)([:|-])(.*)$`)
-
-	for _, line := range lines {
-		if line == "--" {
-			continue // Skip separator lines
+// configFileArg finds the value of -config in command line arguments, which
+// must be read before the other flags are parsed
+func configFileArg(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
 		}
-
-		matchesFound := lineRegex.FindStringSubmatch(line)
-		if len(matchesFound) != 5 {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
 			continue
 		}
-
-		filePath := matchesFound[1]
-		lineNumStr := matchesFound[2]
-		separator := matchesFound[3]
-		content := matchesFound[4]
-
-		// Convert absolute path to relative path
-		relPath, err := filepath.Rel(s.config.BasePath, filePath)
-		if err != nil {
-			relPath = filePath
+		if hasValue {
+			return value
 		}
-
-		lineNum, err := strconv.Atoi(lineNumStr)
-		if err != nil {
-			continue
+		if i+1 < len(args) {
+			return args[i+1]
 		}
+	}
+	return ""
+}
 
-		isMatch := separator == ":"
+// loadConfig loads configuration from an optional config file and command
+// line flags
+func loadConfig() (*mcpfiles.Config, error) {
+	config := &mcpfiles.Config{}
 
-		grepLine := GrepLine{
-			LineNumber: lineNum,
-			Content:    content,
-			IsMatch:    isMatch,
+	flag.String("config", "", "JSON or YAML file of settings; flags given as well override its values")
+	flag.StringVar(&config.Transport, "transport", mcpfiles.TransportHTTP, "Transport to serve on: http, sse or stdio")
+	flag.StringVar(&config.AlsoServe, "also-serve", "", "With -transport stdio, also serve http or sse on -port, with the same tools")
+	flag.StringVar(&config.Port, "port", ":3001", "Address to listen on: a port such as 3001, or host:port such as localhost:3001")
+	flag.StringVar(&config.TLSCertFile, "tls-cert", "", "PEM certificate file to serve HTTPS with, together with -tls-key")
+	flag.StringVar(&config.TLSKeyFile, "tls-key", "", "PEM private key file of the -tls-cert certificate")
+	flag.StringVar(&config.AuthToken, "auth-token", os.Getenv("MCP_AUTH_TOKEN"), "Bearer token every HTTP request must carry, except /readyz (default: $MCP_AUTH_TOKEN)")
+	flag.StringVar(&config.AuthTokenFile, "auth-token-file", "", "File holding the bearer token HTTP requests must carry, in place of -auth-token")
+	flag.StringVar(&config.APIKeyConfigPath, "api-key-config", "", "JSON file of API keys, each with its own access and paths")
+	flag.Var(rootsFlag{&config.Roots}, "base-path", "Base filesystem path to serve (default: .); repeat to serve several roots, each as path or name=path")
+	flag.Int64Var(&config.MaxFileSize, "max-file-size", 10*1024*1024, "Maximum file size in bytes (default: 10MB)")
+	flag.Int64Var(&config.MaxWriteSize, "max-write-size", 10*1024*1024, "Maximum size in bytes of content written by write_file (default: 10MB)")
+	flag.BoolVar(&config.AllowDelete, "allow-delete", false, "Enable the delete_file and delete_directory tools")
+	flag.StringVar(&config.Mode, "mode", mcpfiles.ModeReadWrite, "ro registers no tool that can change files; rw registers them all")
+	flag.IntVar(&config.WalkConcurrency, "walk-concurrency", 4*runtime.NumCPU(), "Maximum parallel directory reads when walking trees, and files searched at once per grep query")
+	flag.IntVar(&config.MaxTreeDepth, "max-tree-depth", 64, "Maximum directory depth walked by read_file_structure")
+	flag.IntVar(&config.MaxTreeNodes, "max-tree-nodes", 100000, "Maximum entries returned by read_file_structure")
+	flag.IntVar(&config.MaxWatchDirs, "max-watch-dirs", 8192, "Maximum directories all watch_path watches follow at once")
+	flag.StringVar(&config.WatchBackend, "watch-backend", mcpfiles.WatchBackendAuto, "watch_path backend: auto (polling on network and FUSE filesystems), fsnotify or poll")
+	flag.DurationVar(&config.WatchPollInterval, "watch-poll-interval", 2*time.Second, "How often watch_path reads the directories it polls")
+	flag.StringVar(&config.RecordPath, "record", "", "Append sanitized tool calls to this JSONL file for later replay")
+	flag.StringVar(&config.AuditLogPath, "audit-log", "", "Append an audit record of every tool call to this JSONL file")
+	flag.BoolVar(&config.SessionReports, "session-reports", false, "Keep a report of what each session accessed, served at /sessions")
+	flag.BoolVar(&config.ApproveWrites, "approve-writes", false, "Hold calls to write tools until a reviewer approves them at /approvals")
+	flag.StringVar(&config.ApprovalToken, "approval-token", os.Getenv("MCP_APPROVAL_TOKEN"), "Bearer token required by /approvals and /grants (default: $MCP_APPROVAL_TOKEN)")
+	flag.BoolVar(&config.AccessGrants, "access-grants", false, "Let reviewers grant a session temporary access to refused paths at /grants")
+	flag.Float64Var(&config.RateLimit, "rate-limit", 0, "Maximum tool calls per second per session (0 = unlimited)")
+	flag.DurationVar(&config.SessionIdleTimeout, "session-idle-timeout", 0, "End sessions that make no tool calls for this long, dropping their state (0 = never)")
+	flag.BoolVar(&config.RedactSecrets, "redact-secrets", false, "Mask private keys and access tokens in tool results")
+	flag.StringVar(&config.FaultConfigPath, "fault-config", "", "JSON file of filesystem faults to inject (for client testing)")
+	flag.StringVar(&config.TagConfigPath, "tag-config", "", "JSON file of file tag rules, applied over the built-in ones")
+	flag.StringVar(&config.HashAlgorithm, "hash-algorithm", mcpfiles.HashSHA256, "Hash algorithm for checksums such as recorded result digests: sha256, sha384, sha512, or sha1/md5 with -allow-weak-hashes")
+	flag.BoolVar(&config.AllowWeakHashes, "allow-weak-hashes", false, "Allow the sha1 and md5 hash algorithms")
+	flag.StringVar(&config.StateKeyFile, "state-key-file", "", "File holding a hex-encoded 256-bit key that encrypts recordings and audit logs")
+	flag.StringVar(&config.ExtensionConfigPath, "extension-config", "", "JSON file of handling overrides by file extension: binary, extractor, max_size and encoding")
+	flag.StringVar(&config.ViewConfigPath, "view-config", "", "JSON file of named views: filter expressions that tools can select by name")
+	flag.StringVar(&config.Locale, "locale", mcpfiles.LocaleEnglish, "Language of error messages and result notes: en, de, es, fr, or another with -locale-config")
+	flag.StringVar(&config.LocaleConfigPath, "locale-config", "", "JSON file of message translations, applied over the built-in ones of -locale")
+	flag.StringVar(&config.SummarizeEndpoint, "summarize-endpoint", "", "Base URL of an OpenAI-compatible API, such as https://api.openai.com/v1, that the summarize_file tool sends file contents to")
+	flag.StringVar(&config.SummarizeModel, "summarize-model", "", "Model -summarize-endpoint is asked for summaries")
+	flag.StringVar(&config.SummarizeAPIKey, "summarize-api-key", os.Getenv("MCP_SUMMARIZE_API_KEY"), "API key of -summarize-endpoint (default: $MCP_SUMMARIZE_API_KEY)")
+	flag.StringVar(&config.SummarizeAPIKeyFile, "summarize-api-key-file", "", "File holding the API key of -summarize-endpoint, in place of -summarize-api-key")
+	flag.StringVar(&config.WritePolicyPath, "write-policy", "", "JSON file of limits on what write tools may change")
+	flag.Func("ignore", "Gitignore pattern of paths to hide from every tool, on top of .mcpignore files; repeat for several", func(pattern string) error {
+		config.Ignore = append(config.Ignore, pattern)
+		return nil
+	})
+	flag.Func("allow-path", "Glob of paths to serve, such as src/**; once given, other paths are refused; repeat for several", func(glob string) error {
+		config.AllowPaths = append(config.AllowPaths, glob)
+		return nil
+	})
+	flag.Func("deny-path", "Glob of paths to refuse, such as **/*.env or **/id_rsa, whatever -allow-path says; repeat for several", func(glob string) error {
+		config.DenyPaths = append(config.DenyPaths, glob)
+		return nil
+	})
+	flag.Func("var", "Variable NAME=VALUE that ${NAME} in paths and path patterns expands to, over the config file's; repeat for several", func(value string) error {
+		name, text, ok := strings.Cut(value, "=")
+		if !ok {
+			return fmt.Errorf("expected NAME=VALUE, got %q", value)
+		}
+		if config.Variables == nil {
+			config.Variables = map[string]string{}
+		}
+		config.Variables[name] = text
+		return nil
+	})
+	flag.DurationVar(&config.FSTimeout, "fs-timeout", 10*time.Second, "Deadline for individual filesystem operations (default: 10s)")
+	flag.DurationVar(&config.GrepTimeout, "grep-timeout", 30*time.Second, "Deadline for a single grep query")
+	flag.Int64Var(&config.MaxGrepOutput, "max-grep-output", 16*1024*1024, "Maximum output in bytes per grep query before results are truncated")
+	flag.IntVar(&config.MaxMatches, "max-matches", 10000, "Maximum matching lines per grep query; the search stops once reached")
+	flag.IntVar(&config.MaxMatchesPerFile, "max-matches-per-file", 1000, "Maximum matching lines read from each file by a grep query")
+	flag.StringVar(&config.Prefetch, "prefetch", "", "Comma-separated heuristics for reading ahead after read_file_contents: outline, imports, siblings")
+	flag.StringVar(&config.Profile, "profile", mcpfiles.ProfileDefault, "Resource profile: default, or low-memory for small hosts, which lowers concurrency and limits and keeps no caches")
+	flag.StringVar(&config.SearchBackend, "search-backend", mcpfiles.SearchBackendAuto, "grep_search backend: auto (ripgrep when installed), native or ripgrep")
+
+	// A config file replaces the defaults the flags were declared with, and
+	// flags on the command line replace its values; repeatable flags replace
+	// the file's list rather than adding to it
+	if path := configFileArg(os.Args[1:]); path != "" {
+		if err := mcpfiles.LoadConfigFile(path, config); err != nil {
+			return nil, fmt.Errorf("failed to load config file %s: %w", path, err)
 		}
-
-		matches[relPath] = append(matches[relPath], grepLine)
 	}
+	fileRoots, fileIgnore := config.Roots, config.Ignore
+	fileAllow, fileDeny := config.AllowPaths, config.DenyPaths
+	config.Roots, config.Ignore, config.AllowPaths, config.DenyPaths = nil, nil, nil, nil
 
-	// Convert map to slice
-	result := make([]GrepMatchResult, 0, len(matches))
-	for filePath, lines := range matches {
-		result = append(result, GrepMatchResult{
-			FilePath: filePath,
-			Lines:    lines,
-		})
+	flag.Parse()
+	if len(config.Roots) == 0 {
+		config.Roots = fileRoots
 	}
-
-	return result, nil
-}
-
-// validateConfig validates the server configuration
-func validateConfig(config *Config) error {
-	// Check if base path exists and is readable
-	if _, err := os.Stat(config.BasePath); os.IsNotExist(err) {
-		return fmt.Errorf("base path does not exist: %s", config.BasePath)
+	if len(config.Ignore) == 0 {
+		config.Ignore = fileIgnore
 	}
-
-	// Convert to absolute path
-	absPath, err := filepath.Abs(config.BasePath)
-	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
+	if len(config.AllowPaths) == 0 {
+		config.AllowPaths = fileAllow
 	}
-	config.BasePath = absPath
-
-	// Validate max file size
-	if config.MaxFileSize <= 0 {
-		config.MaxFileSize = 10 * 1024 * 1024 // Default: 10MB
+	if len(config.DenyPaths) == 0 {
+		config.DenyPaths = fileDeny
+	}
+	if len(config.Roots) == 0 && config.BasePath == "" {
+		config.BasePath = "."
 	}
 
-	return nil
-}
-
-// loadConfig loads configuration from command line flags
-func loadConfig() (*Config, error) {
-	config := &Config{}
-
-	flag.StringVar(&config.Port, "port", ":3001", "Port to listen on (e.g., :3001)")
-	flag.StringVar(&config.BasePath, "base-path", ".", "Base filesystem path to serve")
-	flag.Int64Var(&config.MaxFileSize, "max-file-size", 10*1024*1024, "Maximum file size in bytes (default: 10MB)")
-
-	flag.Parse()
-
-	if err := validateConfig(config); err != nil {
+	if err := mcpfiles.ValidateConfig(config); err != nil {
 		return nil, err
 	}
 
@@ -419,6 +178,32 @@ func loadConfig() (*Config, error) {
 }
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "bench":
+			if err := runBench(os.Args[2:]); err != nil {
+				log.Fatalf("Benchmark failed: %v", err)
+			}
+			return
+		case "replay":
+			if err := runReplay(os.Args[2:]); err != nil {
+				log.Fatalf("Replay failed: %v", err)
+			}
+			return
+		case "decrypt":
+			if err := runDecrypt(os.Args[2:]); err != nil {
+				log.Fatalf("Decrypt failed: %v", err)
+			}
+			return
+		case "export":
+			if err := runExport(os.Args[2:]); err != nil {
+				log.Fatalf("Export failed: %v", err)
+			}
+			return
+		}
+	}
+
 	// Load configuration
 	config, err := loadConfig()
 	if err != nil {
@@ -426,7 +211,7 @@ func main() {
 	}
 
 	// Create and start server
-	mcpServer := NewMCPFileServer(config)
+	mcpServer := mcpfiles.NewServer(config)
 
 	if err := mcpServer.Start(); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
@@ -0,0 +1,200 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Kinds of file access counted by the access tracker
+const (
+	accessRead   = "read"
+	accessSearch = "search"
+)
+
+// accessTracker counts how often each file under the base path is read or
+// returned by a search, since the server started
+type accessTracker struct {
+	mu      sync.Mutex
+	started time.Time
+	counts  map[string]*accessCount
+}
+
+// accessCount is the access of one file
+type accessCount struct {
+	Path       string `json:"path"`
+	Reads      int    `json:"reads"`
+	SearchHits int    `json:"search_hits"`
+	last       time.Time
+}
+
+func newAccessTracker() *accessTracker {
+	return &accessTracker{started: time.Now(), counts: make(map[string]*accessCount)}
+}
+
+// recordAccess counts an access to a file given relative to the base path
+func (s *Server) recordAccess(kind, relPath string) {
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	if relPath == "." || strings.HasPrefix(relPath, "../") {
+		return
+	}
+
+	t := s.access
+	t.mu.Lock()
+	count, ok := t.counts[relPath]
+	if !ok {
+		count = &accessCount{Path: relPath}
+		t.counts[relPath] = count
+	}
+	if kind == accessRead {
+		count.Reads++
+	} else {
+		count.SearchHits++
+	}
+	count.last = time.Now()
+	t.mu.Unlock()
+
+	// Label by top-level directory to keep the number of series small
+	dir, _, nested := strings.Cut(relPath, "/")
+	if !nested {
+		dir = "."
+	}
+	s.metrics.Add("mcp_file_access_total", 1, "kind", kind, "dir", dir)
+}
+
+// recentDirs returns, for each directory with files that were accessed, the
+// time of the latest access to one of them, by path relative to the base path
+func (t *accessTracker) recentDirs() map[string]time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	dirs := make(map[string]time.Time)
+	for relPath, count := range t.counts {
+		if dir := path.Dir(relPath); count.last.After(dirs[dir]) {
+			dirs[dir] = count.last
+		}
+	}
+	return dirs
+}
+
+// snapshot returns a copy of the counts, most accessed first
+func (t *accessTracker) snapshot() []accessCount {
+	t.mu.Lock()
+	counts := make([]accessCount, 0, len(t.counts))
+	for _, count := range t.counts {
+		counts = append(counts, *count)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(counts, func(i, j int) bool {
+		a, b := counts[i], counts[j]
+		if a.Reads+a.SearchHits != b.Reads+b.SearchHits {
+			return a.Reads+a.SearchHits > b.Reads+b.SearchHits
+		}
+		return a.Path < b.Path
+	})
+	return counts
+}
+
+// untouchedDirectory is a directory none of whose files were accessed
+type untouchedDirectory struct {
+	Path  string `json:"path"`
+	Files int    `json:"files"`
+}
+
+// untouchedDirectories lists the topmost directories under node with no
+// accessed files, and returns whether any file under node was accessed
+func untouchedDirectories(node *FileNode, touched map[string]bool, found *[]untouchedDirectory) bool {
+	if node.Type != "directory" {
+		return touched[filepath.ToSlash(node.Path)]
+	}
+	var untouched []untouchedDirectory
+	accessed := false
+	for _, child := range node.Children {
+		var below []untouchedDirectory
+		if untouchedDirectories(child, touched, &below) {
+			accessed = true
+			untouched = append(untouched, below...)
+		} else if child.Type == "directory" {
+			untouched = append(untouched, untouchedDirectory{Path: filepath.ToSlash(child.Path), Files: countFiles(child)})
+		}
+	}
+	if accessed {
+		*found = append(*found, untouched...)
+	}
+	return accessed
+}
+
+// countFiles counts the files in a tree
+func countFiles(node *FileNode) int {
+	if node.Type != "directory" {
+		return 1
+	}
+	n := 0
+	for _, child := range node.Children {
+		n += countFiles(child)
+	}
+	return n
+}
+
+// handleAccessStats handles the access_stats tool
+func (s *Server) handleAccessStats(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	limit := request.GetInt("limit", 20)
+	if limit <= 0 {
+		return mcp.NewToolResultError("limit must be positive"), nil
+	}
+
+	counts := s.access.snapshot()
+	touched := make(map[string]bool, len(counts))
+	reads, searchHits := 0, 0
+	for _, count := range counts {
+		touched[count.Path] = true
+		reads += count.Reads
+		searchHits += count.SearchHits
+	}
+
+	// Find directories no accessed file is under
+	root, truncated, err := s.buildFileTreeWithFilter(ctx, s.config.BasePath, s.config.MaxTreeDepth, s.pathFilter())
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read file structure: %v", err)), nil
+	}
+	untouched := []untouchedDirectory{}
+	if root != nil && !untouchedDirectories(root, touched, &untouched) && len(root.Children) > 0 {
+		// Nothing accessed yet, so every top-level directory is untouched
+		for _, child := range root.Children {
+			if child.Type == "directory" {
+				untouched = append(untouched, untouchedDirectory{Path: filepath.ToSlash(child.Path), Files: countFiles(child)})
+			}
+		}
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"since":                 s.access.started.UTC().Format(time.RFC3339),
+		"reads":                 reads,
+		"search_hits":           searchHits,
+		"files_accessed":        len(counts),
+		"top_files":             counts[:min(limit, len(counts))],
+		"untouched_directories": untouched,
+	}
+	if truncated {
+		result["truncated"] = true
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
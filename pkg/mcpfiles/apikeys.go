@@ -0,0 +1,282 @@
+package mcpfiles
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Access levels of an API key
+const (
+	AccessReadOnly  = "read-only"
+	AccessReadWrite = "read-write"
+)
+
+// APIKey is a bearer token given to one agent, with what it may do. Keys
+// that name paths see nothing else of the served roots.
+type APIKey struct {
+	Name      string `json:"name"`
+	Key       string `json:"key,omitempty"`
+	KeySHA256 string `json:"key_sha256,omitempty"` // hex digest, to keep the key itself out of the config
+	Access    string `json:"access,omitempty"`     // read-only (the default) or read-write
+	// Paths the key is limited to, relative to the base path; with several
+	// roots they start with the root name
+	Paths []string `json:"paths,omitempty"`
+
+	digest [sha256.Size]byte
+}
+
+// apiKeyContextKey holds the API key an HTTP request was authorized with
+type apiKeyContextKey struct{}
+
+// loadAPIKeys reads an API key file of the form {"api_keys": [...]}
+func loadAPIKeys(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		APIKeys []APIKey `json:"api_keys"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid API key config: %w", err)
+	}
+
+	return file.APIKeys, nil
+}
+
+// validateAPIKeys checks the keys, filling in their defaults, digests and
+// cleaned paths
+func validateAPIKeys(keys []APIKey, roots []Root, authToken string) error {
+	names := map[string]bool{}
+	digests := map[[sha256.Size]byte]string{}
+	for i := range keys {
+		key := &keys[i]
+		if key.Name == "" {
+			return fmt.Errorf("API key %d has no name", i+1)
+		}
+		if names[key.Name] {
+			return fmt.Errorf("duplicate API key %q", key.Name)
+		}
+		names[key.Name] = true
+
+		switch {
+		case (key.Key == "") == (key.KeySHA256 == ""):
+			return fmt.Errorf("API key %q needs either a key or its key_sha256", key.Name)
+		case key.Key != "":
+			key.digest = sha256.Sum256([]byte(key.Key))
+		default:
+			digest, err := hex.DecodeString(key.KeySHA256)
+			if err != nil || len(digest) != sha256.Size {
+				return fmt.Errorf("API key %q: key_sha256 must be %d hex digits", key.Name, 2*sha256.Size)
+			}
+			copy(key.digest[:], digest)
+		}
+		if other, ok := digests[key.digest]; ok {
+			return fmt.Errorf("API keys %q and %q are the same", other, key.Name)
+		}
+		digests[key.digest] = key.Name
+		if authToken != "" && key.digest == sha256.Sum256([]byte(authToken)) {
+			return fmt.Errorf("API key %q is the same as the auth token", key.Name)
+		}
+
+		if key.Access == "" {
+			key.Access = AccessReadOnly
+		}
+		if key.Access != AccessReadOnly && key.Access != AccessReadWrite {
+			return fmt.Errorf("API key %q: unknown access %q (use %s or %s)", key.Name, key.Access, AccessReadOnly, AccessReadWrite)
+		}
+
+		for j, p := range key.Paths {
+			cleaned := path.Clean(filepath.ToSlash(p))
+			if p == "" || path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+				return fmt.Errorf("API key %q: paths must be relative to the base path, got %q", key.Name, p)
+			}
+			if len(roots) > 1 {
+				name, _, _ := strings.Cut(cleaned, "/")
+				if !rootNamed(roots, name) {
+					return fmt.Errorf("API key %q: path %q must start with a root name", key.Name, p)
+				}
+			}
+			key.Paths[j] = cleaned
+		}
+	}
+	return nil
+}
+
+func rootNamed(roots []Root, name string) bool {
+	for _, root := range roots {
+		if root.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// writable reports whether the key may change files
+func (k *APIKey) writable() bool {
+	return k.Access == AccessReadWrite
+}
+
+// rootScope returns the paths the key may see in a root, relative to it, or
+// nil when it sees the whole root
+func (k *APIKey) rootScope(root string, multiRoot bool) []string {
+	if !multiRoot {
+		for _, p := range k.Paths {
+			if p == "." {
+				return nil
+			}
+		}
+		return k.Paths
+	}
+	scope := []string{}
+	for _, p := range k.Paths {
+		name, rest, _ := strings.Cut(p, "/")
+		if name != root {
+			continue
+		}
+		if rest == "" {
+			return nil
+		}
+		scope = append(scope, rest)
+	}
+	return scope
+}
+
+// requestAPIKey returns the key an HTTP request was authorized with, if any
+func (s *Server) requestAPIKey(r *http.Request) *APIKey {
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil
+	}
+	digest := sha256.Sum256([]byte(given))
+	var found *APIKey
+	for i := range s.config.APIKeys {
+		key := &s.config.APIKeys[i]
+		if subtle.ConstantTimeCompare(digest[:], key.digest[:]) == 1 {
+			found = key
+		}
+	}
+	return found
+}
+
+// callAPIKey returns the key a tool call was authorized with, or nil when it
+// came with the auth token, over stdio or from a server without API keys
+func callAPIKey(ctx context.Context) *APIKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*APIKey)
+	return key
+}
+
+// scopeFilter hides everything outside a set of paths relative to the base
+// path, except the directories leading to them
+type scopeFilter struct {
+	basePath string
+	allowed  []string
+}
+
+func (f scopeFilter) ShouldIgnore(fullPath string) bool {
+	relPath, err := filepath.Rel(f.basePath, fullPath)
+	if err != nil || relPath == "." || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return false
+	}
+	relPath = filepath.ToSlash(relPath)
+	for _, p := range f.allowed {
+		if pathsOverlap(p, relPath) {
+			return false
+		}
+	}
+	return true
+}
+
+// openKeyScopes serves each API key limited to paths from servers of its
+// own, which see only those paths but share everything else with the
+// servers of the roots
+func (s *Server) openKeyScopes(fsys FileSystem) {
+	roots := s.roots
+	if len(roots) == 0 {
+		roots = []*Server{s}
+	}
+	for i := range s.config.APIKeys {
+		key := &s.config.APIKeys[i]
+		if len(key.Paths) == 0 {
+			continue
+		}
+		scoped := make([]*Server, len(roots))
+		for j, rs := range roots {
+			ks := *rs
+			ks.scope, ks.keyScopes = key.rootScope(s.config.Roots[j].Name, len(roots) > 1), nil
+			ks.openRoot(fsys)
+			ks.access, ks.reservations, ks.artifacts, ks.repoMap, ks.watches = rs.access, rs.reservations, rs.artifacts, rs.repoMap, rs.watches
+			scoped[j] = &ks
+		}
+		if len(roots) > 1 {
+			for _, ks := range scoped {
+				ks.roots = scoped
+			}
+		}
+		if s.keyScopes == nil {
+			s.keyScopes = map[string]*Server{}
+		}
+		s.keyScopes[key.Name] = scoped[0]
+	}
+}
+
+// callServer returns the server of the caller's API key when it is limited
+// to paths, and s otherwise
+func (s *Server) callServer(ctx context.Context) *Server {
+	if key := callAPIKey(ctx); key != nil && s.keyScopes[key.Name] != nil {
+		return s.keyScopes[key.Name]
+	}
+	return s
+}
+
+// keyScopeTools routes the calls of keys limited to paths to the handlers of
+// their servers
+func (s *Server) keyScopeTools(tools []server.ServerTool) {
+	scoped := map[string]map[string]server.ToolHandlerFunc{}
+	for name, ks := range s.keyScopes {
+		keyTools := ks.toolDefinitions()
+		if len(ks.roots) > 1 {
+			keyTools = ks.rootTools()
+		}
+		scoped[name] = map[string]server.ToolHandlerFunc{}
+		for _, tool := range keyTools {
+			scoped[name][tool.Tool.Name] = tool.Handler
+		}
+	}
+
+	for i := range tools {
+		name, handler := tools[i].Tool.Name, tools[i].Handler
+		tools[i].Handler = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if key := callAPIKey(ctx); key != nil {
+				if keyHandler, ok := scoped[key.Name][name]; ok {
+					return keyHandler(ctx, request)
+				}
+			}
+			return handler(ctx, request)
+		}
+	}
+}
+
+// apiKeyMiddleware refuses changes asked for with read-only API keys, before
+// they are checked against the write policy or queued for approval
+func (s *Server) apiKeyMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if key := callAPIKey(ctx); key != nil && !key.writable() && changesFiles(request) {
+			return mcp.NewToolResultError(fmt.Sprintf("API key %q is read-only and cannot use %s", key.Name, request.Params.Name)), nil
+		}
+		return next(ctx, request)
+	}
+}
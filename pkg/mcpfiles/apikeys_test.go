@@ -0,0 +1,141 @@
+package mcpfiles
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadOnlyKeyRefusesWrites(t *testing.T) {
+	s := newTestServer(t, &Config{
+		APIKeys: []APIKey{{Name: "reader", Key: "k1"}},
+	}, map[string]string{"a.txt": "old\n", "b.txt": "b\n"})
+	ctx := context.WithValue(context.Background(), apiKeyContextKey{}, &s.config.APIKeys[0])
+
+	tests := []struct {
+		tool string
+		args map[string]interface{}
+		want bool // whether the key may make the call
+	}{
+		{"write_file", map[string]interface{}{"file_path": "a.txt", "content": "new\n"}, false},
+		// write_file has no dry run, so dry_run does not make it one
+		{"write_file", map[string]interface{}{"file_path": "a.txt", "content": "new\n", "dry_run": true}, false},
+		{"edit_file", map[string]interface{}{"file_path": "a.txt", "edits": `[{"old_text":"old","new_text":"new"}]`, "dry_run": true}, false},
+		{"rename_file", map[string]interface{}{"source": "a.txt", "destination": "c.txt", "apply": true, "dry_run": true}, false},
+		{"rename_file", map[string]interface{}{"source": "a.txt", "destination": "c.txt"}, true},
+		{"move_file", map[string]interface{}{"source": "b.txt", "destination": "c.txt", "dry_run": true}, true},
+		{"apply_patch", map[string]interface{}{"patch": "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-old\n+new\n", "dry_run": true}, true},
+	}
+	for _, tt := range tests {
+		text, _ := callTool(t, ctx, s, tt.tool, tt.args)
+		if refused := strings.Contains(text, "is read-only"); refused == tt.want {
+			t.Errorf("%s %v with a read-only key: %s", tt.tool, tt.args, text)
+		}
+	}
+	if got := readTestFile(t, s, "a.txt"); got != "old\n" {
+		t.Errorf("a.txt = %q after calls with a read-only key", got)
+	}
+	if got := readTestFile(t, s, "c.txt"); got != "" {
+		t.Errorf("c.txt = %q after calls with a read-only key", got)
+	}
+}
+
+func TestKeyPathsApplyToSymlinkTargets(t *testing.T) {
+	s := newTestServer(t, &Config{
+		APIKeys: []APIKey{{Name: "docs", Key: "k1", Paths: []string{"docs"}}},
+	}, map[string]string{"docs/guide.md": "guide\n", "secret.txt": "secret\n"})
+	if err := os.Symlink("../secret.txt", filepath.Join(s.config.BasePath, "docs", "secret.md")); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), apiKeyContextKey{}, &s.config.APIKeys[0])
+
+	if text, isError := callTool(t, ctx, s, "read_file_contents", map[string]interface{}{"file_path": "docs/guide.md"}); isError {
+		t.Errorf("read_file_contents inside the key's paths = %s", text)
+	}
+	text, isError := callTool(t, ctx, s, "read_file_contents", map[string]interface{}{"file_path": "docs/secret.md"})
+	if !isError || strings.Contains(text, "secret\\n") {
+		t.Errorf("read_file_contents through a link out of the key's paths = %s", text)
+	}
+}
+
+func TestKeyPathsScopeCalls(t *testing.T) {
+	s := newTestServer(t, &Config{
+		APIKeys: []APIKey{
+			{Name: "api", Key: "k1", Access: "read-write", Paths: []string{"src/api"}},
+			{Name: "all", Key: "k2"},
+		},
+	}, map[string]string{"src/api/h.go": "package api\n", "src/db/q.go": "package db\n", "README.md": "hi\n"})
+	ctx := context.WithValue(context.Background(), apiKeyContextKey{}, &s.config.APIKeys[0])
+
+	tests := []struct {
+		tool string
+		args map[string]interface{}
+		want bool // whether the call succeeds
+	}{
+		{"read_file_contents", map[string]interface{}{"file_path": "src/api/h.go"}, true},
+		{"read_file_contents", map[string]interface{}{"file_path": "src/db/q.go"}, false},
+		{"read_file_contents", map[string]interface{}{"file_path": "README.md"}, false},
+		{"write_file", map[string]interface{}{"file_path": "src/api/new.go", "content": "package api\n"}, true},
+		{"write_file", map[string]interface{}{"file_path": "src/db/new.go", "content": "package db\n"}, false},
+		{"move_file", map[string]interface{}{"source": "src/api/h.go", "destination": "src/db/h.go"}, false},
+	}
+	for _, tt := range tests {
+		text, isError := callTool(t, ctx, s, tt.tool, tt.args)
+		if isError == tt.want {
+			t.Errorf("%s %v with a key limited to src/api = %s", tt.tool, tt.args, text)
+		}
+	}
+	if got := readTestFile(t, s, "src/db/new.go"); got != "" {
+		t.Errorf("src/db/new.go = %q, written outside the key's paths", got)
+	}
+
+	// Directories leading to the key's paths list only what leads there
+	text, _ := callTool(t, ctx, s, "read_file_structure", map[string]interface{}{})
+	if !strings.Contains(text, "h.go") || strings.Contains(text, "q.go") || strings.Contains(text, "README.md") {
+		t.Errorf("read_file_structure with a key limited to src/api = %s", text)
+	}
+
+	// Calls with the other key see everything
+	ctx = context.WithValue(context.Background(), apiKeyContextKey{}, &s.config.APIKeys[1])
+	if text, isError := callTool(t, ctx, s, "read_file_contents", map[string]interface{}{"file_path": "src/db/q.go"}); isError {
+		t.Errorf("read_file_contents with an unlimited key = %s", text)
+	}
+}
+
+func TestRequestAPIKey(t *testing.T) {
+	s := newTestServer(t, &Config{
+		APIKeys: []APIKey{
+			{Name: "a", Key: "key-a"},
+			// The digest of key-b
+			{Name: "b", KeySHA256: "a30534a53b23547377ddccbd1ac85a8a84c13db43493c16e55a6abc7b0eba634"},
+		},
+	}, nil)
+
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"Bearer key-a", "a"},
+		{"Bearer key-b", "b"},
+		{"Bearer key-c", ""},
+		{"key-a", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		got := ""
+		if key := s.requestAPIKey(r); key != nil {
+			got = key.Name
+		}
+		if got != tt.want {
+			t.Errorf("requestAPIKey with %q = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
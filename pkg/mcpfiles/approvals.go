@@ -0,0 +1,337 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// maxPendingChanges bounds the changes waiting for approval; further writes
+// are refused until some are approved or rejected
+const maxPendingChanges = 100
+
+// maxDecidedChanges bounds the decided changes kept for review history; the
+// oldest are forgotten first
+const maxDecidedChanges = 1000
+
+// Statuses of a queued change
+const (
+	changePending  = "pending"
+	changeApproved = "approved" // approved and applied
+	changeFailed   = "failed"   // approved, but the tool returned an error
+	changeRejected = "rejected"
+)
+
+// QueuedChange is a call to a write tool held until a reviewer decides on it
+type QueuedChange struct {
+	ID        string                 `json:"id"`
+	Session   string                 `json:"session,omitempty"`
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Queued    time.Time              `json:"queued"`
+	Preview   string                 `json:"preview"`          // unified diff, or what the call would do
+	Impact    json.RawMessage        `json:"impact,omitempty"` // what a move or delete would affect
+	Status    string                 `json:"status"`
+	Reviewer  string                 `json:"reviewer,omitempty"`
+	Comment   string                 `json:"comment,omitempty"`
+	Decided   *time.Time             `json:"decided,omitempty"`
+	Result    string                 `json:"result,omitempty"` // the tool's result once applied
+
+	ctx     context.Context
+	request mcp.CallToolRequest
+	next    server.ToolHandlerFunc
+}
+
+// approvalQueue holds the changes of a server started with ApproveWrites,
+// pending and recently decided
+type approvalQueue struct {
+	mu      sync.Mutex
+	nextID  int
+	changes map[string]*QueuedChange
+	pending int
+	decided []string // IDs of decided changes, oldest first
+
+	// decide serializes decisions, so each change is checked and applied
+	// before the next one
+	decide sync.Mutex
+}
+
+func newApprovalQueue() *approvalQueue {
+	return &approvalQueue{changes: make(map[string]*QueuedChange)}
+}
+
+// approvalMiddleware queues calls to write tools instead of running them.
+// Renames without apply only preview the change and run directly.
+func (s *Server) approvalMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if !changesFiles(request) {
+			return next(ctx, request)
+		}
+		tool := request.Params.Name
+
+		// Refuse changes that would fail anyway rather than queue them
+		plan, errResult := s.planChange(ctx, request, next)
+		if errResult != nil {
+			return errResult, nil
+		}
+		preview := plan.preview
+
+		change := &QueuedChange{
+			Session:   sessionID(ctx),
+			Tool:      tool,
+			Arguments: sanitizeArguments(request.GetArguments()),
+			Queued:    time.Now().UTC(),
+			Preview:   preview,
+			Impact:    s.changeImpact(ctx, request),
+			ctx:       context.WithoutCancel(ctx),
+			request:   request,
+			next:      next,
+		}
+		if !s.approvals.add(change) {
+			return mcp.NewToolResultError(fmt.Sprintf("Too many changes waiting for approval (%d); retry once some are reviewed", maxPendingChanges)), nil
+		}
+		s.metrics.Add("mcp_approvals_total", 1, "decision", "queued")
+
+		// Create result as JSON text
+		result := map[string]interface{}{
+			"status":    "pending_approval",
+			"change_id": change.ID,
+			"tool":      tool,
+			"preview":   preview,
+			"message":   s.localize("The change was queued and takes effect once a reviewer approves it"),
+		}
+		if change.Impact != nil {
+			result["impact"] = change.Impact
+		}
+
+		resultJSON, err := json.Marshal(result)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+		}
+
+		return mcp.NewToolResultText(string(resultJSON)), nil
+	}
+}
+
+// add queues a change and assigns its ID, unless too many are pending
+func (q *approvalQueue) add(change *QueuedChange) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending >= maxPendingChanges {
+		return false
+	}
+	q.nextID++
+	change.ID = strconv.Itoa(q.nextID)
+	change.Status = changePending
+	q.changes[change.ID] = change
+	q.pending++
+	return true
+}
+
+// get returns a copy of a change
+func (q *approvalQueue) get(id string) (QueuedChange, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	change, ok := q.changes[id]
+	if !ok {
+		return QueuedChange{}, false
+	}
+	return *change, true
+}
+
+// record sets the decision on a pending change and forgets the oldest
+// decided changes past maxDecidedChanges
+func (q *approvalQueue) record(id, status, reviewer, comment, result string) QueuedChange {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	change := q.changes[id]
+	decided := time.Now().UTC()
+	change.Status, change.Reviewer, change.Comment, change.Result = status, reviewer, comment, result
+	change.Decided = &decided
+	q.pending--
+
+	q.decided = append(q.decided, id)
+	for len(q.decided) > maxDecidedChanges {
+		delete(q.changes, q.decided[0])
+		q.decided = q.decided[1:]
+	}
+	return *change
+}
+
+// list returns copies of the changes with a status, or of all changes when
+// status is empty, optionally only those of one session, oldest first
+func (q *approvalQueue) list(status, session string) []QueuedChange {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	changes := make([]QueuedChange, 0, len(q.changes))
+	for _, change := range q.changes {
+		if (status == "" || change.Status == status) && (session == "" || change.Session == session) {
+			changes = append(changes, *change)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		a, _ := strconv.Atoi(changes[i].ID)
+		b, _ := strconv.Atoi(changes[j].ID)
+		return a < b
+	})
+	return changes
+}
+
+// decideChange approves or rejects a pending change. Approved changes are
+// applied once their preview still describes what they would do.
+func (s *Server) decideChange(id string, approve bool, reviewer, comment string) (QueuedChange, int, error) {
+	s.approvals.decide.Lock()
+	defer s.approvals.decide.Unlock()
+
+	change, ok := s.approvals.get(id)
+	switch {
+	case !ok:
+		return QueuedChange{}, http.StatusNotFound, fmt.Errorf("unknown change")
+	case change.Status != changePending:
+		return QueuedChange{}, http.StatusConflict, fmt.Errorf("change already %s", change.Status)
+	case !approve:
+		s.metrics.Add("mcp_approvals_total", 1, "decision", changeRejected)
+		return s.approvals.record(id, changeRejected, reviewer, comment, ""), http.StatusOK, nil
+	}
+
+	// Files may have changed since the change was queued
+	plan, errResult := s.planChange(change.ctx, change.request, change.next)
+	if errResult != nil || plan.preview != change.Preview {
+		return QueuedChange{}, http.StatusConflict, fmt.Errorf("the files changed since the change was queued; reject it and have it redone")
+	}
+
+	result, err := change.next(change.ctx, change.request)
+	if err != nil {
+		return QueuedChange{}, http.StatusInternalServerError, err
+	}
+	status := changeApproved
+	if result.IsError {
+		status = changeFailed
+	}
+	s.metrics.Add("mcp_approvals_total", 1, "decision", status)
+	log.Printf("Applied approved change %s: %s", id, change.Tool)
+	return s.approvals.record(id, status, reviewer, comment, resultText(result)), http.StatusOK, nil
+}
+
+// Decision is the optional body of an approve or reject request
+type Decision struct {
+	Reviewer string `json:"reviewer"`
+	Comment  string `json:"comment"`
+}
+
+// handleApprovals serves the review API:
+//
+//	GET  /approvals                 changes, filtered by ?status= (default pending) and ?session=
+//	GET  /approvals/<id>            one change
+//	GET  /approvals/<id>/diff       its preview as plain text
+//	POST /approvals/<id>/approve    apply it, with an optional Decision body
+//	POST /approvals/<id>/reject     discard it, with an optional Decision body
+func (s *Server) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	// Reviewers have a token of their own, so agents cannot approve their
+	// own changes; ValidateConfig requires one whenever agents need a
+	// credential
+	if token := s.config.ApprovalToken; token != "" && !hasBearerToken(r, token) {
+		s.unauthorized(w, r)
+		return
+	}
+
+	id, action, _ := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/approvals"), "/"), "/")
+	wantMethod := http.MethodGet
+	if action == "approve" || action == "reject" {
+		wantMethod = http.MethodPost
+	}
+	if r.Method != wantMethod {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body interface{}
+	switch action {
+	case "", "diff":
+		if id == "" {
+			status := r.URL.Query().Get("status")
+			switch status {
+			case "":
+				status = changePending
+			case "all":
+				status = ""
+			case changePending, changeApproved, changeFailed, changeRejected:
+			default:
+				http.Error(w, "unknown status (use pending, approved, failed, rejected or all)", http.StatusBadRequest)
+				return
+			}
+			body = map[string]interface{}{"changes": s.approvals.list(status, r.URL.Query().Get("session"))}
+			break
+		}
+		change, ok := s.approvals.get(id)
+		if !ok {
+			http.Error(w, "unknown change", http.StatusNotFound)
+			return
+		}
+		if action == "diff" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			io.WriteString(w, change.Preview)
+			return
+		}
+		body = change
+	case "approve", "reject":
+		var decision Decision
+		if err := json.NewDecoder(r.Body).Decode(&decision); err != nil && err != io.EOF {
+			http.Error(w, fmt.Sprintf("invalid decision: %v", err), http.StatusBadRequest)
+			return
+		}
+		change, status, err := s.decideChange(id, action == "approve", decision.Reviewer, decision.Comment)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		body = change
+	default:
+		http.Error(w, "unknown action (use diff, approve or reject)", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(body)
+}
+
+// handleChangeStatus handles the change_status tool. Sessions only see the
+// changes they queued.
+func (s *Server) handleChangeStatus(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	session := sessionID(ctx)
+	var changes []QueuedChange
+	if id := request.GetString("change_id", ""); id != "" {
+		change, ok := s.approvals.get(id)
+		if !ok || change.Session != session {
+			return mcp.NewToolResultError(fmt.Sprintf("Unknown change: %s", id)), nil
+		}
+		changes = []QueuedChange{change}
+	} else {
+		changes = s.approvals.list("", session)
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"changes": changes,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
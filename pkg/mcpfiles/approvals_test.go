@@ -0,0 +1,115 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApprovalQueuesWritesWithDryRun(t *testing.T) {
+	s := newTestServer(t, &Config{Transport: TransportHTTP, ApproveWrites: true}, map[string]string{"a.txt": "old\n"})
+	ctx := context.Background()
+
+	// write_file ignores dry_run, so the call must still wait for approval
+	text, _ := callTool(t, ctx, s, "write_file", map[string]interface{}{"file_path": "a.txt", "content": "new\n", "dry_run": true})
+	if !strings.Contains(text, "pending_approval") {
+		t.Errorf("write_file with dry_run = %s, want it queued", text)
+	}
+	if got := readTestFile(t, s, "a.txt"); got != "old\n" {
+		t.Errorf("a.txt = %q before approval", got)
+	}
+
+	// A dry run of a tool that has one changes nothing and runs directly
+	text, _ = callTool(t, ctx, s, "move_file", map[string]interface{}{"source": "a.txt", "destination": "b.txt", "dry_run": true})
+	if strings.Contains(text, "pending_approval") || !strings.Contains(text, `"dry_run":true`) {
+		t.Errorf("move_file with dry_run = %s, want it run", text)
+	}
+	if pending := s.approvals.list(changePending, ""); len(pending) != 1 {
+		t.Errorf("%d changes pending, want 1", len(pending))
+	}
+}
+
+// reviewChange posts a decision on a queued change as a reviewer would
+func reviewChange(t *testing.T, s *Server, token, id, action string) (int, QueuedChange) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/approvals/"+id+"/"+action, strings.NewReader(`{"reviewer":"ana"}`))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.handleApprovals(w, r)
+	var change QueuedChange
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &change); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, change
+}
+
+func TestApprovalGate(t *testing.T) {
+	s := newTestServer(t, &Config{Transport: TransportHTTP, ApproveWrites: true, ApprovalToken: "review"}, map[string]string{"a.txt": "old\n"})
+	ctx := context.Background()
+	queue := func(content string) string {
+		t.Helper()
+		text, _ := callTool(t, ctx, s, "write_file", map[string]interface{}{"file_path": "a.txt", "content": content})
+		var queued struct {
+			Status   string `json:"status"`
+			ChangeID string `json:"change_id"`
+			Preview  string `json:"preview"`
+		}
+		if err := json.Unmarshal([]byte(text), &queued); err != nil || queued.Status != "pending_approval" {
+			t.Fatalf("write_file = %s, want it queued", text)
+		}
+		if !strings.Contains(queued.Preview, "+"+strings.TrimSuffix(content, "\n")) {
+			t.Errorf("preview = %q, want the diff of the write", queued.Preview)
+		}
+		return queued.ChangeID
+	}
+
+	// Agents cannot decide without the reviewers' token
+	id := queue("new\n")
+	for _, token := range []string{"", "agent"} {
+		if code, _ := reviewChange(t, s, token, id, "approve"); code != http.StatusUnauthorized {
+			t.Errorf("approve with token %q = %d, want %d", token, code, http.StatusUnauthorized)
+		}
+	}
+	if got := readTestFile(t, s, "a.txt"); got != "old\n" {
+		t.Fatalf("a.txt = %q before approval", got)
+	}
+
+	code, change := reviewChange(t, s, "review", id, "approve")
+	if code != http.StatusOK || change.Status != changeApproved || change.Reviewer != "ana" {
+		t.Fatalf("approve = %d, %+v", code, change)
+	}
+	if got := readTestFile(t, s, "a.txt"); got != "new\n" {
+		t.Errorf("a.txt = %q after approval", got)
+	}
+	if code, _ := reviewChange(t, s, "review", id, "reject"); code != http.StatusConflict {
+		t.Errorf("rejecting an approved change = %d, want %d", code, http.StatusConflict)
+	}
+
+	// Rejected changes are never applied
+	id = queue("rejected\n")
+	if code, change := reviewChange(t, s, "review", id, "reject"); code != http.StatusOK || change.Status != changeRejected {
+		t.Errorf("reject = %d, %+v", code, change)
+	}
+	if got := readTestFile(t, s, "a.txt"); got != "new\n" {
+		t.Errorf("a.txt = %q after a rejection", got)
+	}
+
+	// A change whose file moved on since it was queued is refused, since
+	// the reviewer approved a different diff
+	id = queue("stale\n")
+	writeTestFile(t, filepath.Join(s.config.BasePath, "a.txt"), "edited elsewhere\n")
+	if code, _ := reviewChange(t, s, "review", id, "approve"); code != http.StatusConflict {
+		t.Errorf("approving a stale change = %d, want %d", code, http.StatusConflict)
+	}
+	if got := readTestFile(t, s, "a.txt"); got != "edited elsewhere\n" {
+		t.Errorf("a.txt = %q after approving a stale change", got)
+	}
+}
@@ -0,0 +1,291 @@
+package mcpfiles
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// defaultArchiveEntries is how many members read_archive_member lists by default
+const defaultArchiveEntries = 1000
+
+// archiveFormats maps the file name endings read_archive_member reads, longest first, to their format
+var archiveFormats = []struct{ suffix, format string }{
+	{".tar.gz", "tar.gz"},
+	{".tgz", "tar.gz"},
+	{".tar", "tar"},
+	{".zip", "zip"},
+	{".jar", "zip"},
+	{".whl", "zip"},
+}
+
+// errMemberFound stops the walk of an archive once the member was read
+var errMemberFound = errors.New("member found")
+
+// ArchiveEntry is one member of an archive, as listed by read_archive_member
+type ArchiveEntry struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Modified string `json:"modified,omitempty"`
+	IsDir    bool   `json:"is_dir,omitempty"`
+}
+
+// archiveFormat returns the format of an archive by its name
+func archiveFormat(name string) (string, bool) {
+	lower := strings.ToLower(name)
+	for _, f := range archiveFormats {
+		if strings.HasSuffix(lower, f.suffix) {
+			return f.format, true
+		}
+	}
+	return "", false
+}
+
+// cleanMember normalizes a member name, which archives may store with a
+// leading ./ or /
+func cleanMember(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, "\\", "/")), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// walkArchive calls visit with each member of an archive in turn, with a
+// function that opens the member's content, until visit fails
+func walkArchive(ctx context.Context, r io.Reader, size int64, format string, visit func(ArchiveEntry, func() (io.ReadCloser, error)) error) error {
+	if format == "zip" {
+		at, ok := r.(io.ReaderAt)
+		if !ok {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			at, size = bytes.NewReader(data), int64(len(data))
+		}
+		zr, err := zip.NewReader(at, size)
+		if err != nil {
+			return err
+		}
+		for _, f := range zr.File {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			entry := ArchiveEntry{Name: cleanMember(f.Name), Size: int64(f.UncompressedSize64), IsDir: f.FileInfo().IsDir()}
+			if !f.Modified.IsZero() {
+				entry.Modified = f.Modified.UTC().Format(time.RFC3339)
+			}
+			if err := visit(entry, f.Open); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if format == "tar.gz" {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(contextReader{ctx, r})
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// Links and special files have no content of their own
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeDir {
+			continue
+		}
+		entry := ArchiveEntry{Name: cleanMember(hdr.Name), Size: hdr.Size, IsDir: hdr.Typeflag == tar.TypeDir}
+		if !hdr.ModTime.IsZero() {
+			entry.Modified = hdr.ModTime.UTC().Format(time.RFC3339)
+		}
+		open := func() (io.ReadCloser, error) { return io.NopCloser(tr), nil }
+		if err := visit(entry, open); err != nil {
+			return err
+		}
+	}
+}
+
+// handleReadArchiveMember handles the read_archive_member tool
+func (s *Server) handleReadArchiveMember(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	filePath, err := request.RequireString("file_path")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	// A member may also be named in the path, as in dist.zip!/app/config.json
+	member := request.GetString("member", "")
+	if i := strings.Index(filePath, "!/"); i >= 0 && member == "" {
+		filePath, member = filePath[:i], filePath[i+2:]
+	}
+	maxResults := request.GetInt("max_results", defaultArchiveEntries)
+	if maxResults <= 0 {
+		return mcp.NewToolResultError("max_results must be positive"), nil
+	}
+
+	// Validate and resolve path
+	fullPath, err := s.validateFilePath(filePath)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid file path: %v", err)), nil
+	}
+	format, ok := archiveFormat(fullPath)
+	if !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("Unsupported archive format: %s (supported: .zip, .jar, .whl, .tar, .tar.gz, .tgz)", filePath)), nil
+	}
+	stat, err := s.guard.Stat(fullPath)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("File not found: %v", err)), nil
+	}
+	if stat.IsDir() {
+		return mcp.NewToolResultError(fmt.Sprintf("Cannot read archive: %s is a directory", filePath)), nil
+	}
+	if relPath, err := filepath.Rel(s.config.BasePath, fullPath); err == nil {
+		s.recordAccess(accessRead, relPath)
+	}
+	if member == "" {
+		return s.listArchive(ctx, filePath, fullPath, format, maxResults)
+	}
+
+	// Read the member, refusing members over the size limit before reading
+	// them, and reading one byte past the limit in case the archive lies
+	want := cleanMember(member)
+	maxSize := s.config.maxFileSize(want)
+	var found ArchiveEntry
+	var content []byte
+	err = s.guard.ReadWith(ctx, fullPath, func(r io.Reader, size int64) error {
+		return walkArchive(ctx, r, size, format, func(entry ArchiveEntry, open func() (io.ReadCloser, error)) error {
+			if entry.Name != want {
+				return nil
+			}
+			found = entry
+			if entry.IsDir || entry.Size > maxSize {
+				return errMemberFound
+			}
+			rc, err := open()
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+			if content, err = io.ReadAll(io.LimitReader(rc, maxSize+1)); err != nil {
+				return err
+			}
+			return errMemberFound
+		})
+	})
+	if err != nil && !errors.Is(err, errMemberFound) {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read archive: %v", err)), nil
+	}
+	switch {
+	case err == nil:
+		return mcp.NewToolResultError(fmt.Sprintf("Member not found: %s in %s", member, filePath)), nil
+	case found.IsDir:
+		return mcp.NewToolResultError(fmt.Sprintf("Cannot read archive member: %s is a directory; list it by leaving out member", member)), nil
+	case found.Size > maxSize || int64(len(content)) > maxSize:
+		return mcp.NewToolResultError(fmt.Sprintf("File too large (%.2f MB > %.2f MB)",
+			float64(max(found.Size, int64(len(content))))/1024/1024, float64(maxSize)/1024/1024)), nil
+	}
+
+	// Decode legacy encodings to UTF-8 so the content survives JSON encoding,
+	// as read_file_contents does
+	text := string(content)
+	encoding := TextEncoding{Name: EncodingUTF8}
+	mimeType := ""
+	if enc, ok := s.config.textEncoding(want, content); ok {
+		decoded, err := decodeText(content, enc)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to decode file: %v", err)), nil
+		}
+		text = decoded
+		encoding = enc
+	} else {
+		text = base64.StdEncoding.EncodeToString(content)
+		encoding = TextEncoding{Name: EncodingBase64}
+		mimeType = detectMIMEType(want, content)
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"file_path":  filePath,
+		"member":     found.Name,
+		"size_bytes": len(content),
+		"encoding":   encoding.Name,
+		"bom":        encoding.BOM,
+		"content":    text,
+	}
+	if found.Modified != "" {
+		result["modified"] = found.Modified
+	}
+	if mimeType != "" {
+		result["mime_type"] = mimeType
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// listArchive lists the members of an archive in the order it stores them
+func (s *Server) listArchive(ctx context.Context, filePath, fullPath, format string, maxResults int) (*mcp.CallToolResult, error) {
+	entries := []ArchiveEntry{}
+	count := 0
+	err := s.guard.ReadWith(ctx, fullPath, func(r io.Reader, size int64) error {
+		return walkArchive(ctx, r, size, format, func(entry ArchiveEntry, _ func() (io.ReadCloser, error)) error {
+			count++
+			if len(entries) < maxResults {
+				entries = append(entries, entry)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read archive: %v", err)), nil
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"file_path": filePath,
+		"format":    format,
+		"entries":   entries,
+		"count":     count,
+		"truncated": count > len(entries),
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
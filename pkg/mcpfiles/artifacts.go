@@ -0,0 +1,425 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	// maxArtifacts bounds the artifacts registered per root
+	maxArtifacts = 100000
+	// defaultArtifactResults is how many artifacts artifact_status lists
+	// unless asked for more
+	defaultArtifactResults = 1000
+)
+
+// States of a registered artifact
+const (
+	artifactFresh   = "fresh"
+	artifactStale   = "stale"
+	artifactMissing = "missing" // its file no longer exists
+)
+
+// artifactKind matches artifact kinds, such as outline, chunks or embeddings
+var artifactKind = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// Artifact is something a client derived from a file, such as its outline,
+// chunks or embeddings, registered with the hash of the content it was
+// derived from so the client can tell when to derive it again
+type Artifact struct {
+	Path        string    `json:"path"`
+	Kind        string    `json:"kind"`
+	ContentHash string    `json:"content_hash"`
+	Ref         string    `json:"ref,omitempty"` // where the client keeps it
+	Registered  time.Time `json:"registered"`
+	State       string    `json:"state,omitempty"`
+	Reason      string    `json:"reason,omitempty"` // why it is stale or missing
+
+	invalidated string // set when a change or the client invalidated it
+}
+
+// artifactHash is the content hash of a file, or only its fingerprint, valid
+// while its size and modification time are unchanged
+type artifactHash struct {
+	size        int64
+	modTime     time.Time
+	hash        string
+	fingerprint string
+}
+
+// artifactStore holds the artifacts registered for the files of one root,
+// by path and kind
+type artifactStore struct {
+	mu        sync.Mutex
+	artifacts map[string]map[string]*Artifact
+	count     int
+	hashes    map[string]artifactHash // by path, for files with artifacts
+}
+
+func newArtifactStore() *artifactStore {
+	return &artifactStore{artifacts: make(map[string]map[string]*Artifact), hashes: make(map[string]artifactHash)}
+}
+
+// register records an artifact, replacing the one of the same path and kind
+func (a *artifactStore) register(artifact Artifact) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	kinds := a.artifacts[artifact.Path]
+	if _, ok := kinds[artifact.Kind]; !ok {
+		if a.count >= maxArtifacts {
+			return fmt.Errorf("too many artifacts (%d); invalidate some with forget first", maxArtifacts)
+		}
+		if kinds == nil {
+			kinds = map[string]*Artifact{}
+			a.artifacts[artifact.Path] = kinds
+		}
+		a.count++
+	}
+	kinds[artifact.Kind] = &artifact
+	return nil
+}
+
+// matching calls fn for every artifact of a kind, or of every kind when it is
+// empty, whose file is relPath or inside it; the caller holds the lock
+func (a *artifactStore) matching(relPath, kind string, fn func(*Artifact)) {
+	for p, kinds := range a.artifacts {
+		if relPath != "." && p != relPath && !strings.HasPrefix(p, relPath+"/") {
+			continue
+		}
+		for k, artifact := range kinds {
+			if kind == "" || k == kind {
+				fn(artifact)
+			}
+		}
+	}
+}
+
+// invalidate marks artifacts stale, or drops them with forget, and reports
+// how many it touched
+func (a *artifactStore) invalidate(relPath, kind, reason string, forget bool) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := 0
+	a.matching(relPath, kind, func(artifact *Artifact) {
+		n++
+		delete(a.hashes, artifact.Path)
+		if !forget {
+			artifact.invalidated = reason
+			return
+		}
+		delete(a.artifacts[artifact.Path], artifact.Kind)
+		if len(a.artifacts[artifact.Path]) == 0 {
+			delete(a.artifacts, artifact.Path)
+		}
+		a.count--
+	})
+	return n
+}
+
+// list copies the artifacts of the paths, or of every path when there are
+// none, ordered by path and kind
+func (a *artifactStore) list(relPaths []string, kind string) []Artifact {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(relPaths) == 0 {
+		relPaths = []string{"."}
+	}
+	seen := map[*Artifact]bool{}
+	var artifacts []Artifact
+	for _, relPath := range relPaths {
+		a.matching(relPath, kind, func(artifact *Artifact) {
+			if !seen[artifact] {
+				seen[artifact] = true
+				artifacts = append(artifacts, *artifact)
+			}
+		})
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		if artifacts[i].Path != artifacts[j].Path {
+			return artifacts[i].Path < artifacts[j].Path
+		}
+		return artifacts[i].Kind < artifacts[j].Kind
+	})
+	return artifacts
+}
+
+// contentHash returns the current hash of a file under the base path with the
+// configured algorithm, hashing it again only when its size or modification
+// time changed. Files that do not exist report false.
+func (s *Server) contentHash(ctx context.Context, relPath string) (string, bool, error) {
+	return s.cachedDigest(ctx, relPath, func(cached artifactHash) string { return cached.hash },
+		func(fullPath string, size int64) (artifactHash, error) {
+			hash, err := s.guard.Hash(ctx, fullPath, hashAlgorithms[s.config.HashAlgorithm])
+			entry := artifactHash{hash: hash}
+			if size <= 2*fingerprintSampleSize {
+				entry.fingerprint = hash
+			}
+			return entry, err
+		})
+}
+
+// contentFingerprint returns the current fingerprint of a file under the base
+// path, as RootGuard.Fingerprint computes it, from the same cache as
+// contentHash. Files small enough to be hashed in full get their hash cached
+// along with it.
+func (s *Server) contentFingerprint(ctx context.Context, relPath string) (string, bool, error) {
+	return s.cachedDigest(ctx, relPath, func(cached artifactHash) string { return cached.fingerprint },
+		func(fullPath string, size int64) (artifactHash, error) {
+			fingerprint, err := s.guard.Fingerprint(ctx, fullPath, size, hashAlgorithms[s.config.HashAlgorithm])
+			entry := artifactHash{fingerprint: fingerprint}
+			if size <= 2*fingerprintSampleSize {
+				entry.hash = fingerprint
+			}
+			return entry, err
+		})
+}
+
+// cachedDigest returns the digest of a file that get takes from its cache
+// entry, computing it again only when the entry lacks it or the file's size or
+// modification time changed
+func (s *Server) cachedDigest(ctx context.Context, relPath string, get func(artifactHash) string, compute func(fullPath string, size int64) (artifactHash, error)) (string, bool, error) {
+	fullPath := filepath.Join(s.config.BasePath, filepath.FromSlash(relPath))
+	stat, err := s.guard.Stat(fullPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if !stat.Mode().IsRegular() {
+		return "", false, fmt.Errorf("%s is not a regular file", relPath)
+	}
+
+	a := s.artifacts
+	a.mu.Lock()
+	cached, ok := a.hashes[relPath]
+	a.mu.Unlock()
+	valid := ok && cached.size == stat.Size() && cached.modTime.Equal(stat.ModTime())
+	if valid && get(cached) != "" {
+		return get(cached), true, nil
+	}
+
+	entry, err := compute(fullPath, stat.Size())
+	if err != nil {
+		return "", false, err
+	}
+	// Keep what the entry already knew of the same content
+	if valid {
+		if entry.hash == "" {
+			entry.hash = cached.hash
+		}
+		if entry.fingerprint == "" {
+			entry.fingerprint = cached.fingerprint
+		}
+	}
+	entry.size, entry.modTime = stat.Size(), stat.ModTime()
+	a.mu.Lock()
+	a.hashes[relPath] = entry
+	a.mu.Unlock()
+	return get(entry), true, nil
+}
+
+// invalidateChanged marks the artifacts of files changed through the write
+// tools stale, so clients rebuild them without having to hash the files first
+func (s *Server) invalidateChanged(tool, op, fullPath, from string) {
+	relPath := func(p string) string {
+		rel, _ := filepath.Rel(s.config.BasePath, p)
+		return filepath.ToSlash(rel)
+	}
+	switch op {
+	case changeMoved:
+		s.artifacts.invalidate(relPath(from), "", fmt.Sprintf("moved to %s by %s", s.changePath(fullPath), tool), false)
+		s.artifacts.invalidate(relPath(fullPath), "", fmt.Sprintf("replaced by %s", tool), false)
+	default:
+		s.artifacts.invalidate(relPath(fullPath), "", fmt.Sprintf("%s by %s", op, tool), false)
+	}
+}
+
+// artifactState fills in whether an artifact still matches its file
+func (s *Server) artifactState(ctx context.Context, artifact *Artifact) {
+	hash, exists, err := s.contentHash(ctx, artifact.Path)
+	switch {
+	case err != nil:
+		artifact.State, artifact.Reason = artifactStale, fmt.Sprintf("cannot hash file: %v", err)
+	case !exists:
+		artifact.State, artifact.Reason = artifactMissing, "file no longer exists"
+		if artifact.invalidated != "" {
+			artifact.Reason = artifact.invalidated
+		}
+	case artifact.invalidated != "":
+		artifact.State, artifact.Reason = artifactStale, artifact.invalidated
+	case hash != artifact.ContentHash:
+		artifact.State, artifact.Reason = artifactStale, "file content changed"
+	default:
+		artifact.State = artifactFresh
+	}
+}
+
+// handleRegisterArtifact handles the register_artifact tool
+func (s *Server) handleRegisterArtifact(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	filePath, err := request.RequireString("file_path")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	kind, err := request.RequireString("kind")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	if !artifactKind.MatchString(kind) {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid kind %q: use lowercase letters, digits, '.', '_' and '-', such as embeddings", kind)), nil
+	}
+	relPath, err := s.relativePath(filePath)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid file path: %v", err)), nil
+	}
+
+	current, exists, err := s.contentHash(ctx, relPath)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to hash file: %v", err)), nil
+	}
+	if !exists {
+		return mcp.NewToolResultError(fmt.Sprintf("File not found: %s", filePath)), nil
+	}
+
+	// Artifacts derived from content that has changed since are registered
+	// stale, so the client sees it has to derive them again
+	contentHash := current
+	if given := strings.ToLower(request.GetString("content_hash", "")); given != "" {
+		if digest, err := hex.DecodeString(given); err != nil || len(digest) != hashAlgorithms[s.config.HashAlgorithm]().Size() {
+			return mcp.NewToolResultError(fmt.Sprintf("content_hash must be a hex %s digest", s.config.HashAlgorithm)), nil
+		}
+		contentHash = given
+	}
+
+	artifact := Artifact{
+		Path:        relPath,
+		Kind:        kind,
+		ContentHash: contentHash,
+		Ref:         request.GetString("ref", ""),
+		Registered:  time.Now().UTC(),
+	}
+	if err := s.artifacts.register(artifact); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	s.artifactState(ctx, &artifact)
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"artifact":       artifact,
+		"hash_algorithm": s.config.HashAlgorithm,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// handleArtifactStatus handles the artifact_status tool
+func (s *Server) handleArtifactStatus(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	paths, err := s.relativePaths(request.GetString("paths", ""))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid path: %v", err)), nil
+	}
+	kind := request.GetString("kind", "")
+	state := request.GetString("state", "")
+	switch state {
+	case "", artifactFresh, artifactStale, artifactMissing:
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid state %q: use %s, %s or %s", state, artifactFresh, artifactStale, artifactMissing)), nil
+	}
+	maxResults := request.GetInt("max_results", defaultArtifactResults)
+	if maxResults <= 0 {
+		return mcp.NewToolResultError("max_results must be positive"), nil
+	}
+
+	counts := map[string]int{artifactFresh: 0, artifactStale: 0, artifactMissing: 0}
+	artifacts := []Artifact{}
+	truncated := false
+	for _, artifact := range s.artifacts.list(paths, kind) {
+		if s.hidden.ShouldIgnore(filepath.Join(s.config.BasePath, filepath.FromSlash(artifact.Path))) {
+			continue
+		}
+		s.artifactState(ctx, &artifact)
+		counts[artifact.State]++
+		if state != "" && artifact.State != state {
+			continue
+		}
+		if len(artifacts) == maxResults {
+			truncated = true
+			continue
+		}
+		artifacts = append(artifacts, artifact)
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"artifacts":      artifacts,
+		"counts":         counts,
+		"truncated":      truncated,
+		"hash_algorithm": s.config.HashAlgorithm,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// handleInvalidateArtifacts handles the invalidate_artifacts tool
+func (s *Server) handleInvalidateArtifacts(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	list, err := request.RequireString("paths")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	paths, err := s.relativePaths(list)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid path: %v", err)), nil
+	}
+	if len(paths) == 0 {
+		return mcp.NewToolResultError("paths must name at least one file or directory"), nil
+	}
+	kind := request.GetString("kind", "")
+	forget := request.GetBool("forget", false)
+
+	reason := "invalidated by a client"
+	if note := request.GetString("reason", ""); note != "" {
+		reason = note
+	}
+	invalidated := 0
+	for _, p := range paths {
+		invalidated += s.artifacts.invalidate(p, kind, reason, forget)
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"invalidated": invalidated,
+		"forgotten":   forget,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
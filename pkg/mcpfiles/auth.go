@@ -0,0 +1,59 @@
+package mcpfiles
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// loadAuthToken reads a bearer token from a file, ignoring surrounding space
+func loadAuthToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return token, nil
+}
+
+// hasBearerToken reports whether a request's Authorization header carries
+// the token, compared in constant time
+func hasBearerToken(r *http.Request, token string) bool {
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// unauthorized answers a request that lacks a valid bearer token
+func (s *Server) unauthorized(w http.ResponseWriter, r *http.Request) {
+	s.metrics.Add("mcp_auth_failures_total", 1, "endpoint", strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0])
+	w.Header().Set("WWW-Authenticate", `Bearer realm="`+serverName+`"`)
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
+
+// requireAuth refuses requests without the AuthToken or one of the APIKeys,
+// if any are set, and passes the key a request carries on to its tool calls.
+// /readyz stays open for health checks, and /approvals and /grants check
+// their own token.
+func (s *Server) requireAuth(next http.Handler) http.Handler {
+	token := s.config.AuthToken
+	if token == "" && len(s.config.APIKeys) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/readyz" || strings.HasPrefix(r.URL.Path, "/approvals") || strings.HasPrefix(r.URL.Path, "/grants") || (token != "" && hasBearerToken(r, token)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if key := s.requestAPIKey(r); key != nil {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+			return
+		}
+		s.unauthorized(w, r)
+	})
+}
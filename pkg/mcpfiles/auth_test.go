@@ -0,0 +1,84 @@
+package mcpfiles
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRequireAuth(t *testing.T) {
+	s := newTestServer(t, &Config{AuthToken: "s3cr3t"}, nil)
+	handler := s.requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		path   string
+		header string
+		want   int
+	}{
+		{"/mcp", "Bearer s3cr3t", http.StatusOK},
+		{"/mcp", "", http.StatusUnauthorized},
+		{"/mcp", "Bearer wrong", http.StatusUnauthorized},
+		{"/mcp", "Bearer s3cr3t ", http.StatusUnauthorized},
+		{"/mcp", "s3cr3t", http.StatusUnauthorized},
+		{"/mcp", "Basic s3cr3t", http.StatusUnauthorized},
+		{"/metrics", "", http.StatusUnauthorized},
+		{"/sessions/x", "", http.StatusUnauthorized},
+
+		// Health checks stay open, and reviewers' endpoints check their own token
+		{"/readyz", "", http.StatusOK},
+		{"/approvals", "", http.StatusOK},
+		{"/grants/g1", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("GET %s with %q = %d, want %d", tt.path, tt.header, w.Code, tt.want)
+		}
+		if w.Code == http.StatusUnauthorized && !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Bearer ") {
+			t.Errorf("GET %s with %q: WWW-Authenticate = %q", tt.path, tt.header, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestRequireAuthOpenWithoutToken(t *testing.T) {
+	s := newTestServer(t, &Config{}, nil)
+	w := httptest.NewRecorder()
+	s.requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/mcp", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /mcp without a configured token = %d", w.Code)
+	}
+}
+
+func TestLoadAuthToken(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "token"), "  s3cr3t\n")
+	writeTestFile(t, filepath.Join(dir, "empty"), "\n")
+
+	if token, err := loadAuthToken(filepath.Join(dir, "token")); err != nil || token != "s3cr3t" {
+		t.Errorf("loadAuthToken = %q, %v", token, err)
+	}
+	if _, err := loadAuthToken(filepath.Join(dir, "empty")); err == nil || !strings.Contains(err.Error(), "is empty") {
+		t.Errorf("loadAuthToken of an empty file: error = %v", err)
+	}
+	if _, err := loadAuthToken(filepath.Join(dir, "missing")); err == nil {
+		t.Error("loadAuthToken of a missing file succeeded")
+	}
+}
+
+func TestApprovalTokenMustDifferFromAuthToken(t *testing.T) {
+	config := &Config{BasePath: t.TempDir(), AuthToken: "same", ApprovalToken: "same", ApproveWrites: true}
+	if err := ValidateConfig(config); err == nil || !strings.Contains(err.Error(), "must differ from the auth token") {
+		t.Errorf("ValidateConfig = %v", err)
+	}
+	config = &Config{BasePath: t.TempDir(), AuthToken: "agent", ApproveWrites: true}
+	if err := ValidateConfig(config); err == nil || !strings.Contains(err.Error(), "need an approval token of their own") {
+		t.Errorf("ValidateConfig without an approval token = %v", err)
+	}
+}
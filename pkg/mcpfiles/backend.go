@@ -0,0 +1,116 @@
+package mcpfiles
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FileSystem is the backend tools use to access files under the base path
+type FileSystem interface {
+	Stat(path string) (os.FileInfo, error)
+	Lstat(path string) (os.FileInfo, error)
+	ReadDir(path string) ([]fs.DirEntry, error)
+	ReadFile(path string) ([]byte, error)
+	WriteFile(path string, data []byte, perm fs.FileMode) error
+	MkdirAll(path string, perm fs.FileMode) error
+	Remove(path string) error
+	RemoveAll(path string) error
+	Rename(oldPath, newPath string) error
+}
+
+// FileOpener is implemented by backends that can stream a file, so line
+// ranges of files over MaxFileSize can be read without loading them whole
+type FileOpener interface {
+	Open(path string) (io.ReadCloser, error)
+}
+
+// PathFilter decides which paths are hidden from tools
+type PathFilter interface {
+	ShouldIgnore(path string) bool
+}
+
+// OSFileSystem accesses the local filesystem directly
+type OSFileSystem struct{}
+
+func (OSFileSystem) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (OSFileSystem) Lstat(path string) (os.FileInfo, error) {
+	return os.Lstat(path)
+}
+
+func (OSFileSystem) ReadDir(path string) ([]fs.DirEntry, error) {
+	return os.ReadDir(path)
+}
+
+func (OSFileSystem) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func (OSFileSystem) Open(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+// WriteFile replaces path atomically by renaming a temporary file over it, so
+// readers never see a partial write. Symlinks are followed and the target replaced.
+func (OSFileSystem) WriteFile(path string, data []byte, perm fs.FileMode) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (OSFileSystem) MkdirAll(path string, perm fs.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (OSFileSystem) Remove(path string) error {
+	return os.Remove(path)
+}
+
+func (OSFileSystem) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (OSFileSystem) Rename(oldPath, newPath string) error {
+	return os.Rename(oldPath, newPath)
+}
+
+// multiFilter ignores a path if any of its filters does
+type multiFilter []PathFilter
+
+func (m multiFilter) ShouldIgnore(path string) bool {
+	for _, filter := range m {
+		if filter.ShouldIgnore(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package mcpfiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// methodCancelled is the notification a client sends to cancel a request it
+// made earlier
+const methodCancelled = "notifications/cancelled"
+
+// callKey names a tool call the way a client cancels it: by its session and
+// the JSON-RPC ID of its request
+type callKey struct {
+	session string
+	id      string
+}
+
+// cancelledError is the cause of a call's context once its client cancels it
+type cancelledError struct {
+	reason string
+}
+
+func (e *cancelledError) Error() string {
+	if e.reason == "" {
+		return "cancelled by the client"
+	}
+	return "cancelled by the client: " + e.reason
+}
+
+// callRegistry tracks the tool calls in flight, so a notifications/cancelled
+// from a client can stop the one it names. Tool handlers are not given the
+// request ID, so a hook that sees it notes it against the call's context,
+// which the handler then receives.
+type callRegistry struct {
+	mu      sync.Mutex
+	pending map[context.Context]callKey
+	running map[callKey]context.CancelCauseFunc
+}
+
+func newCallRegistry() *callRegistry {
+	return &callRegistry{
+		pending: make(map[context.Context]callKey),
+		running: make(map[callKey]context.CancelCauseFunc),
+	}
+}
+
+// note records the request ID of a call about to run with ctx
+func (r *callRegistry) note(ctx context.Context, id any, request *mcp.CallToolRequest) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending[ctx] = callKey{session: sessionID(ctx), id: fmt.Sprint(id)}
+}
+
+// forget drops what was noted for a call that failed before its handler
+// ran, such as one of an unknown tool
+func (r *callRegistry) forget(ctx context.Context, id any, method mcp.MCPMethod, message any, err error) {
+	if method != mcp.MethodToolsCall {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, ctx)
+}
+
+// start makes the context a call runs with, which cancel stops. Calls
+// whose request ID was not noted, as when the tools are served by another
+// MCP server, cannot be cancelled and run with ctx itself.
+func (r *callRegistry) start(ctx context.Context) (context.Context, func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key, ok := r.pending[ctx]
+	if !ok {
+		return ctx, func() {}
+	}
+	delete(r.pending, ctx)
+	callCtx, cancel := context.WithCancelCause(ctx)
+	r.running[key] = cancel
+	return callCtx, func() {
+		r.mu.Lock()
+		delete(r.running, key)
+		r.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// cancel stops a call in flight. Returns false if it already finished or
+// was never made.
+func (r *callRegistry) cancel(key callKey, reason string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cancel, ok := r.running[key]
+	if ok {
+		cancel(&cancelledError{reason: reason})
+	}
+	return ok
+}
+
+// handleCancelled handles notifications/cancelled, stopping the call of the
+// notifying session that it names
+func (s *Server) handleCancelled(ctx context.Context, notification mcp.JSONRPCNotification) {
+	id, ok := notification.Params.AdditionalFields["requestId"]
+	if !ok || id == nil {
+		return
+	}
+	reason, _ := notification.Params.AdditionalFields["reason"].(string)
+	if s.calls.cancel(callKey{session: sessionID(ctx), id: fmt.Sprint(id)}, reason) {
+		log.Printf("Cancelled request %v: %s", id, reason)
+	}
+}
+
+// cancelMiddleware runs each call with a context its client can cancel, and
+// answers a call that stopped with an error once cancelled with an error
+// saying so. Calls that finished anyway, such as writes already made, keep
+// their results.
+func (s *Server) cancelMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		callCtx, done := s.calls.start(ctx)
+		defer done()
+		result, err := next(callCtx, request)
+
+		var cancelled *cancelledError
+		stopped := err != nil || result == nil || result.IsError
+		if stopped && errors.As(context.Cause(callCtx), &cancelled) {
+			s.metrics.Add("mcp_tool_calls_cancelled_total", 1, "tool", request.Params.Name)
+			return mcp.NewToolResultError(fmt.Sprintf("Call %s", cancelled)), nil
+		}
+		return result, err
+	}
+}
@@ -0,0 +1,41 @@
+package mcpfiles
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestCancelKeepsFinishedResults(t *testing.T) {
+	s := newTestServer(t, &Config{}, nil)
+	ctx := sessionContext(s, "s1")
+	key := callKey{session: "s1", id: "7"}
+
+	tests := []struct {
+		name   string
+		result *mcp.CallToolResult
+		want   string
+	}{
+		{"finished", mcp.NewToolResultText(`{"created":true}`), `{"created":true}`},
+		{"stopped", mcp.NewToolResultError("Failed to walk: context canceled"), "Call cancelled by the client: gave up"},
+	}
+	for _, tt := range tests {
+		// The client cancels while the handler is still running
+		handler := s.cancelMiddleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if !s.calls.cancel(key, "gave up") {
+				t.Fatalf("%s: call was not running", tt.name)
+			}
+			return tt.result, nil
+		})
+		s.calls.note(ctx, 7, nil)
+		result, err := handler(ctx, mcp.CallToolRequest{})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := resultText(result); !strings.Contains(got, tt.want) {
+			t.Errorf("%s call cancelled midway = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
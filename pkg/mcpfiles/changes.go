@@ -0,0 +1,211 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	// maxChangeEvents bounds the events the change feed keeps; older ones are
+	// dropped and readers behind them are told to resync
+	maxChangeEvents = 10000
+	// defaultChangeLimit is how many events one read returns unless asked
+	defaultChangeLimit = 1000
+)
+
+// Operations of a change event
+const (
+	changeCreated  = "created"
+	changeModified = "modified"
+	changeDeleted  = "deleted"
+	changeMoved    = "moved"
+)
+
+// changeFeedURI is the template of the change feed resource
+const changeFeedURI = "changes://{?since,limit}"
+
+// ChangeEvent is one change made to the served files through the write
+// tools. Sequence numbers start at 1 and increase by one per event.
+type ChangeEvent struct {
+	Seq   uint64    `json:"seq"`
+	Time  time.Time `json:"time"`
+	Op    string    `json:"op"`
+	Path  string    `json:"path"`
+	From  string    `json:"from,omitempty"` // previous path of moves
+	IsDir bool      `json:"is_dir,omitempty"`
+	Tool  string    `json:"tool"`
+
+	root int // index of the root the paths are in
+}
+
+// changeFeed numbers the changes made by every root and session in the order
+// they were made
+type changeFeed struct {
+	epoch string // identifies this run, whose sequence numbers a restart reuses
+
+	mu     sync.Mutex
+	seq    uint64
+	events []ChangeEvent // oldest first, at most maxChangeEvents
+}
+
+func newChangeFeed() *changeFeed {
+	return &changeFeed{epoch: time.Now().UTC().Format(time.RFC3339Nano)}
+}
+
+// recordChange adds a change to the feed. Paths are full paths under the
+// base path; from is empty except for moves.
+func (s *Server) recordChange(tool, op, fullPath, from string, isDir bool) {
+	event := ChangeEvent{Op: op, Path: s.changePath(fullPath), IsDir: isDir, Tool: tool}
+	if s.root != "" {
+		event.root = s.rootIndex(s.root)
+	}
+	if from != "" {
+		event.From = s.changePath(from)
+	}
+	s.invalidateChanged(tool, op, fullPath, from)
+
+	f := s.changes
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	event.Seq, event.Time = f.seq, time.Now().UTC()
+	if len(f.events) == maxChangeEvents {
+		f.events = f.events[1:]
+	}
+	f.events = append(f.events, event)
+	s.metrics.Add("mcp_changes_total", 1, "op", op)
+}
+
+// changePath returns a full path as the feed shows it: relative to the base
+// path, slash-separated, and starting with the root name when serving several
+func (s *Server) changePath(fullPath string) string {
+	relPath, _ := filepath.Rel(s.config.BasePath, fullPath)
+	relPath = filepath.ToSlash(relPath)
+	if s.root != "" {
+		relPath = s.root + "/" + relPath
+	}
+	return relPath
+}
+
+// since returns up to limit events after the cursor, and the sequence number
+// of the oldest event kept
+func (f *changeFeed) since(cursor uint64, limit int) ([]ChangeEvent, uint64, uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	oldest := f.seq + 1
+	if len(f.events) > 0 {
+		oldest = f.events[0].Seq
+	}
+	start := 0
+	if cursor >= oldest {
+		start = int(cursor - oldest + 1)
+	}
+	events := append([]ChangeEvent{}, f.events[min(start, len(f.events)):]...)
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, oldest, f.seq
+}
+
+// changeVisible reports whether a change may be shown to the caller, whose
+// API key may limit it to some paths
+func (s *Server) changeVisible(ctx context.Context) func(ChangeEvent) bool {
+	key := callAPIKey(ctx)
+	if key == nil || s.keyScopes[key.Name] == nil {
+		return func(ChangeEvent) bool { return true }
+	}
+	ks := s.keyScopes[key.Name]
+	return func(event ChangeEvent) bool {
+		rs := ks
+		if len(ks.roots) > 1 {
+			rs = ks.roots[event.root]
+		}
+		for _, p := range []string{event.Path, event.From} {
+			if p == "" {
+				continue
+			}
+			if rs.root != "" {
+				p = p[len(rs.root)+1:]
+			}
+			if rs.hidden.ShouldIgnore(filepath.Join(rs.config.BasePath, filepath.FromSlash(p))) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// handleChangeFeed reads the changes:// resource
+func (s *Server) handleChangeFeed(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	var cursor uint64
+	if value := resourceArgument(request, "since"); value != "" {
+		var err error
+		if cursor, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("since must be a sequence number, got %q", value)
+		}
+	}
+	limit := defaultChangeLimit
+	if value := resourceArgument(request, "limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxChangeEvents {
+			return nil, fmt.Errorf("limit must be between 1 and %d, got %q", maxChangeEvents, value)
+		}
+		limit = n
+	}
+
+	events, oldest, latest := s.changes.since(cursor, limit)
+	next := cursor
+	if len(events) > 0 {
+		next = events[len(events)-1].Seq
+	}
+	visible := s.changeVisible(ctx)
+	shown := make([]ChangeEvent, 0, len(events))
+	for _, event := range events {
+		if visible(event) {
+			shown = append(shown, event)
+		}
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"epoch":  s.changes.epoch,
+		"events": shown,
+		"cursor": next,
+		"latest": latest,
+		// Events after the cursor were dropped, or it is from an earlier run;
+		// either way derived state must be rebuilt
+		"truncated": cursor+1 < oldest || cursor > latest,
+		"more":      next < latest,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal result: %w", err)
+	}
+
+	return []mcp.ResourceContents{mcp.TextResourceContents{
+		URI:      request.Params.URI,
+		MIMEType: "application/json",
+		Text:     string(resultJSON),
+	}}, nil
+}
+
+// resourceArgument returns a variable of a resource template as a string
+func resourceArgument(request mcp.ReadResourceRequest, name string) string {
+	switch value := request.Params.Arguments[name].(type) {
+	case string:
+		return value
+	case []string:
+		if len(value) > 0 {
+			return value[0]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// FileChecksum is the digest of one file, as reported by checksum
+type FileChecksum struct {
+	FilePath  string `json:"file_path"`
+	Exists    bool   `json:"exists"`
+	Hash      string `json:"hash,omitempty"`
+	SizeBytes int64  `json:"size_bytes,omitempty"`
+	Modified  string `json:"modified,omitempty"`
+	Error     string `json:"error,omitempty"` // why the file could not be hashed
+}
+
+// handleChecksum handles the checksum tool
+func (s *Server) handleChecksum(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	list, err := request.RequireString("paths")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	paths, err := s.relativePaths(list)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid path: %v", err)), nil
+	}
+	if len(paths) == 0 {
+		return mcp.NewToolResultError("paths must name at least one file"), nil
+	}
+	algorithm := request.GetString("algorithm", s.config.HashAlgorithm)
+	if err := checkHashAlgorithm(algorithm, s.config.AllowWeakHashes); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid algorithm: %v", err)), nil
+	}
+
+	files := make([]FileChecksum, 0, len(paths))
+	for _, relPath := range paths {
+		if ctx.Err() != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to hash file: %v", ctx.Err())), nil
+		}
+		file, err := s.fileChecksum(ctx, relPath, algorithm)
+		if err != nil {
+			if result := unavailableResult(err); result != nil {
+				return result, nil
+			}
+			file.Error = err.Error()
+		}
+		files = append(files, file)
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"algorithm": algorithm,
+		"files":     files,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// fileChecksum hashes one file. Files that do not exist are reported as
+// such rather than as errors, since clients use checksums to notice changes.
+// Hashes with the server's algorithm come from the cache artifacts keep.
+func (s *Server) fileChecksum(ctx context.Context, relPath, algorithm string) (FileChecksum, error) {
+	file := FileChecksum{FilePath: relPath}
+	fullPath := filepath.Join(s.config.BasePath, filepath.FromSlash(relPath))
+	stat, err := s.guard.Stat(fullPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return file, nil
+	}
+	if err != nil {
+		return file, err
+	}
+	file.Exists = true
+	if !stat.Mode().IsRegular() {
+		return file, fmt.Errorf("%s is not a regular file", relPath)
+	}
+	file.SizeBytes = stat.Size()
+	file.Modified = stat.ModTime().UTC().Format(time.RFC3339)
+
+	if algorithm == s.config.HashAlgorithm {
+		file.Hash, file.Exists, err = s.contentHash(ctx, relPath)
+	} else {
+		file.Hash, err = s.guard.Hash(ctx, fullPath, hashAlgorithms[algorithm])
+	}
+	return file, err
+}
@@ -0,0 +1,166 @@
+package mcpfiles
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Limits for external search commands
+const (
+	commandKillAfter = 2 * time.Second // grace period between SIGTERM and SIGKILL
+	maxCommandStderr = 64 * 1024       // stderr kept for error reports
+)
+
+// CommandError describes a failed external search command
+type CommandError struct {
+	Command  string
+	ExitCode int    // -1 if the process did not exit normally
+	Stderr   string // trimmed and capped
+	TimedOut bool
+}
+
+func (e *CommandError) Error() string {
+	switch {
+	case e.TimedOut:
+		return fmt.Sprintf("%s command timed out", e.Command)
+	case e.Stderr != "":
+		return fmt.Sprintf("%s command failed (exit %d): %s", e.Command, e.ExitCode, e.Stderr)
+	}
+	return fmt.Sprintf("%s command failed (exit %d)", e.Command, e.ExitCode)
+}
+
+// commandOutput is the captured stdout of a search command
+type commandOutput struct {
+	Stdout    []byte
+	ExitCode  int
+	Truncated bool // stdout hit the output cap and the command was stopped
+}
+
+// commandLimits bound the work done by a search command
+type commandLimits struct {
+	Timeout   time.Duration
+	MaxOutput int64 // stdout bytes
+	// StopBefore, if set, sees each complete stdout line and reports whether
+	// output should end before it, e.g. once a match cap is reached
+	StopBefore func(line []byte) bool
+}
+
+// cappedBuffer keeps at most limit bytes and calls overflow once when more
+// arrive or stopBefore ends the output. Writes always succeed so the process is
+// never blocked on a full pipe while it is being stopped.
+type cappedBuffer struct {
+	buf        bytes.Buffer
+	limit      int64
+	scanned    int // bytes already passed to stopBefore
+	stopBefore func(line []byte) bool
+	overflowed bool
+	overflow   func()
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.overflowed {
+		return len(p), nil
+	}
+
+	room := b.limit - int64(b.buf.Len())
+	if int64(len(p)) <= room {
+		b.buf.Write(p)
+	} else {
+		b.buf.Write(p[:max(room, 0)])
+		b.stop()
+	}
+
+	// Check the lines completed by this write
+	if b.stopBefore != nil {
+		out := b.buf.Bytes()
+		for {
+			end := bytes.IndexByte(out[b.scanned:], '\n')
+			if end < 0 {
+				break
+			}
+			if b.stopBefore(out[b.scanned : b.scanned+end]) {
+				b.buf.Truncate(b.scanned)
+				b.stop()
+				break
+			}
+			b.scanned += end + 1
+		}
+	}
+
+	return len(p), nil
+}
+
+// stop discards all further output and stops the command
+func (b *cappedBuffer) stop() {
+	if !b.overflowed {
+		b.overflowed = true
+		if b.overflow != nil {
+			b.overflow()
+		}
+	}
+}
+
+// runCommand runs an external search command within limits. On timeout or
+// when output is cut short the process gets SIGTERM, then SIGKILL after
+// commandKillAfter. Exit codes other than 0 and 1 (no match) are returned as a
+// CommandError carrying stderr.
+func runCommand(ctx context.Context, limits commandLimits, name string, args ...string) (*commandOutput, error) {
+	runCtx, cancel := context.WithTimeout(ctx, limits.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(runCtx, name, args...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = commandKillAfter
+
+	stdout := &cappedBuffer{limit: limits.MaxOutput, stopBefore: limits.StopBefore, overflow: cancel}
+	stderr := &cappedBuffer{limit: maxCommandStderr}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+
+	// Output beyond the limits was discarded on purpose; keep whole lines only
+	if stdout.overflowed {
+		out := stdout.buf.Bytes()
+		if i := bytes.LastIndexByte(out, '\n'); i >= 0 {
+			out = out[:i+1]
+		} else {
+			out = nil
+		}
+		return &commandOutput{Stdout: out, ExitCode: -1, Truncated: true}, nil
+	}
+
+	if err != nil {
+		// The caller went away; report that rather than a killed process
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		cmdErr := &CommandError{
+			Command:  name,
+			ExitCode: -1,
+			Stderr:   strings.TrimSpace(stderr.buf.String()),
+			TimedOut: errors.Is(runCtx.Err(), context.DeadlineExceeded),
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			cmdErr.ExitCode = exitErr.ExitCode()
+			// Exit code 1 means no matches, not failure
+			if cmdErr.ExitCode == 1 && !cmdErr.TimedOut {
+				return &commandOutput{Stdout: stdout.buf.Bytes(), ExitCode: 1}, nil
+			}
+		} else if !cmdErr.TimedOut {
+			cmdErr.Stderr = err.Error()
+		}
+		return nil, cmdErr
+	}
+
+	return &commandOutput{Stdout: stdout.buf.Bytes()}, nil
+}
@@ -0,0 +1,76 @@
+package mcpfiles
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfigFile reads a JSON or YAML config file into config, told apart
+// by the .yaml or .yml extension. Keys are the JSON names of the Config
+// fields; fields the file leaves out keep their values, so the caller can
+// fill in defaults first and apply flags afterwards. Durations may be
+// written as strings such as "30s". Unknown keys are an error.
+func LoadConfigFile(path string, config *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var values map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	default:
+		err = json.Unmarshal(data, &values)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid config file: %w", err)
+	}
+	if err := parseDurations(values); err != nil {
+		return fmt.Errorf("invalid config file: %w", err)
+	}
+
+	// Decode through JSON so the fields keep their JSON names
+	normalized, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("invalid config file: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(normalized))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return fmt.Errorf("invalid config file: %w", err)
+	}
+	return nil
+}
+
+// parseDurations replaces duration strings for the time.Duration fields of
+// Config with nanoseconds, as JSON decodes them
+func parseDurations(values map[string]interface{}) error {
+	configType := reflect.TypeOf(Config{})
+	durationType := reflect.TypeOf(time.Duration(0))
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		if field.Type != durationType {
+			continue
+		}
+		key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		text, ok := values[key].(string)
+		if !ok {
+			continue
+		}
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		values[key] = int64(d)
+	}
+	return nil
+}
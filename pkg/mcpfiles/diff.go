@@ -0,0 +1,210 @@
+package mcpfiles
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContextLines is the number of unchanged lines around each hunk
+const diffContextLines = 3
+
+// maxDiffEdits bounds the Myers search; beyond it the changed region is
+// reported as a single replacement
+const maxDiffEdits = 2000
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed, '+' added
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// splitLines splits text into lines that keep their terminators, so a
+// missing final newline survives the round trip
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns an edit script turning a into b
+func diffLines(a, b []string) []diffOp {
+	// Common prefix and suffix never need the search
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// myers computes a shortest edit script with Myers' O(ND) algorithm
+func myers(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	replace := func() []diffOp {
+		ops := make([]diffOp, 0, n+m)
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+		return ops
+	}
+	if n == 0 || m == 0 {
+		return replace()
+	}
+
+	// trace[d] holds the furthest x reached on each diagonal k in [-d, d]
+	// after d edits, indexed by k+d
+	var trace [][]int
+	v := []int{0}
+	found := false
+	for d := 0; d <= min(n+m, maxDiffEdits) && !found; d++ {
+		next := make([]int, 2*d+1)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			// Step down (insertion) from diagonal k+1 or right (deletion) from k-1
+			if k == -d || k != d && v[k-1+(d-1)] < v[k+1+(d-1)] {
+				x = v[k+1+(d-1)]
+			} else {
+				x = v[k-1+(d-1)] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			next[k+d] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+		trace = append(trace, next)
+		v = next
+	}
+	if !found {
+		return replace()
+	}
+
+	// Walk the trace backwards to recover the script
+	var reversed []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		k := x - y
+		prev := trace[d-1]
+		var prevK int
+		if k == -d || k != d && prev[k-1+(d-1)] < prev[k+1+(d-1)] {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := prev[prevK+(d-1)]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, diffOp{' ', a[x]})
+		}
+		if x == prevX {
+			y--
+			reversed = append(reversed, diffOp{'+', b[y]})
+		} else {
+			x--
+			reversed = append(reversed, diffOp{'-', a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		reversed = append(reversed, diffOp{' ', a[x]})
+	}
+
+	ops := make([]diffOp, len(reversed))
+	for i, op := range reversed {
+		ops[len(reversed)-1-i] = op
+	}
+	return ops
+}
+
+// unifiedDiff renders the change from oldText to newText as a unified diff
+// of path. Returns "" if nothing changed.
+func unifiedDiff(path, oldText, newText string) string {
+	ops := diffLines(splitLines(oldText), splitLines(newText))
+
+	// oldAt[i] and newAt[i] are the line numbers ops[i] is at in each file
+	oldAt := make([]int, len(ops)+1)
+	newAt := make([]int, len(ops)+1)
+	oldAt[0], newAt[0] = 1, 1
+	for i, op := range ops {
+		oldAt[i+1], newAt[i+1] = oldAt[i], newAt[i]
+		if op.kind != '+' {
+			oldAt[i+1]++
+		}
+		if op.kind != '-' {
+			newAt[i+1]++
+		}
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(ops); i++ {
+		if ops[i].kind == ' ' {
+			continue
+		}
+
+		// A hunk runs until more than two contexts' worth of unchanged lines
+		// separate one change from the next
+		lastChange := i
+		for j := i; j < len(ops) && j-lastChange <= 2*diffContextLines; j++ {
+			if ops[j].kind != ' ' {
+				lastChange = j
+			}
+		}
+		start := max(i-diffContextLines, 0)
+		end := min(lastChange+1+diffContextLines, len(ops))
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", path, path)
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(oldAt[start], oldAt[end]-oldAt[start]),
+			hunkRange(newAt[start], newAt[end]-newAt[start]))
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end - 1
+	}
+	return out.String()
+}
+
+// hunkRange formats a hunk header range; empty ranges name the line before them
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
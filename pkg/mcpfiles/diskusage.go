@@ -0,0 +1,178 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Defaults of disk_usage
+const (
+	defaultUsageDepth   = 2
+	defaultUsageResults = 200
+)
+
+// DirUsage is the size of one directory and everything below it
+type DirUsage struct {
+	Path       string `json:"path"`
+	Depth      int    `json:"depth"` // below the directory reported on
+	Bytes      int64  `json:"bytes"`
+	Files      int    `json:"files"`
+	Gitignored bool   `json:"gitignored,omitempty"` // hidden from trees, but still searched
+}
+
+// handleDiskUsage handles the disk_usage tool
+func (s *Server) handleDiskUsage(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	dirPath := request.GetString("path", ".")
+	maxDepth := request.GetInt("max_depth", defaultUsageDepth)
+	if maxDepth <= 0 {
+		return mcp.NewToolResultError("max_depth must be positive"), nil
+	}
+	maxResults := request.GetInt("max_results", defaultUsageResults)
+	if maxResults <= 0 {
+		return mcp.NewToolResultError("max_results must be positive"), nil
+	}
+
+	// Validate and resolve path
+	fullPath, err := s.validateFilePath(dirPath)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid path: %v", err)), nil
+	}
+	stat, err := s.guard.Stat(fullPath)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Directory not found: %v", err)), nil
+	}
+	if !stat.IsDir() {
+		return mcp.NewToolResultError("Cannot list: path is a file"), nil
+	}
+	if fullPath != s.config.BasePath && s.hidden.ShouldIgnore(fullPath) {
+		return mcp.NewToolResultError("Cannot list: path is ignored"), nil
+	}
+
+	dirs, truncated, err := s.scanUsage(ctx, fullPath, maxDepth)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read directory: %v", err)), nil
+	}
+	total := dirs[0]
+
+	// Largest first, below the directory itself
+	sorted := dirs[1:]
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Bytes != sorted[j].Bytes {
+			return sorted[i].Bytes > sorted[j].Bytes
+		}
+		return sorted[i].Path < sorted[j].Path
+	})
+	if len(sorted) > maxResults {
+		sorted, truncated = sorted[:maxResults], true
+	}
+	directories := make([]DirUsage, len(sorted))
+	for i, dir := range sorted {
+		directories[i] = *dir
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"path":        total.Path,
+		"bytes":       total.Bytes,
+		"files":       total.Files,
+		"max_depth":   maxDepth,
+		"directories": directories,
+		"truncated":   truncated,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// scanUsage walks what agents can see below dir, up to MaxTreeNodes entries,
+// totalling each directory down to maxDepth; deeper directories count toward
+// their ancestor at maxDepth. The first directory returned is dir itself.
+func (s *Server) scanUsage(ctx context.Context, dir string, maxDepth int) ([]*DirUsage, bool, error) {
+	if err := s.guard.Check("walk", dir); err != nil {
+		return nil, false, err
+	}
+	relPath := func(p string) string {
+		rel, _ := filepath.Rel(s.config.BasePath, p)
+		return filepath.ToSlash(rel)
+	}
+	base := relPath(dir)
+	gitignore := NewGitignoreFilter(s.config.BasePath)
+	byPath := map[string]*DirUsage{base: {Path: base}}
+	dirs := []*DirUsage{byPath[base]}
+	entries, truncated := 0, false
+	err := s.guard.WalkDir(ctx, dir, func(p string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil || p == dir {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if s.hidden.ShouldIgnore(p) || s.pathLists != nil && s.pathLists.ShouldIgnore(p) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entries == s.config.MaxTreeNodes {
+			truncated = true
+			return filepath.SkipAll
+		}
+		entries++
+
+		rel := relPath(p)
+		if d.IsDir() {
+			if depth := usageDepth(base, rel); depth <= maxDepth {
+				usage := &DirUsage{Path: rel, Depth: depth, Gitignored: gitignore.ShouldIgnore(p)}
+				byPath[rel] = usage
+				dirs = append(dirs, usage)
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+
+		// Count the file toward every directory above it that is reported
+		for parent := path.Dir(rel); ; parent = path.Dir(parent) {
+			if usage, ok := byPath[parent]; ok {
+				usage.Bytes += info.Size()
+				usage.Files++
+			}
+			if parent == base || parent == "." {
+				break
+			}
+		}
+		return nil
+	})
+	return dirs, truncated, err
+}
+
+// usageDepth returns how many directories rel is below base
+func usageDepth(base, rel string) int {
+	if base != "." {
+		rel = strings.TrimPrefix(rel, base+"/")
+	}
+	return strings.Count(rel, "/") + 1
+}
@@ -0,0 +1,444 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxSignatureLines bounds how far a declaration header is followed
+const maxSignatureLines = 20
+
+// SymbolDoc is the documentation attached to one declaration
+type SymbolDoc struct {
+	Name       string `json:"name"` // qualified by its type or class, e.g. Server.Start
+	Kind       string `json:"kind"`
+	LineNumber int    `json:"line_number"`
+	Signature  string `json:"signature"`
+	Doc        string `json:"doc"`
+}
+
+// docExtractor returns a file's own documentation and every declaration in
+// it, documented or not
+type docExtractor func(src string) (string, []SymbolDoc)
+
+var (
+	pythonDefinition = regexp.MustCompile(`^(\s*)(?:async\s+)?(def|class)\s+([A-Za-z_]\w*)`)
+	pythonDocstring  = regexp.MustCompile(`^(?i:[rub]{0,2})("""|'''|"|')`)
+	jsDeclaration    = regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:declare\s+)?(?:abstract\s+)?(?:async\s+)?(function\*?|class|interface|type|enum|const|let|var|namespace)\s+([A-Za-z_$][\w$]*)`)
+	jsMember         = regexp.MustCompile(`^(?:(?:public|private|protected|static|readonly|async|get|set|override)\s+)*\*?([A-Za-z_$][\w$]*)\s*(\(|<|[?!]?:|=)`)
+	jsFileTag        = regexp.MustCompile(`@(file|fileoverview|module)\b`)
+)
+
+// docExtractors maps file extensions to their documentation conventions
+var docExtractors = map[string]docExtractor{
+	".go": goDocs,
+	".py": pythonDocs, ".pyi": pythonDocs,
+	".js": jsDocs, ".jsx": jsDocs, ".mjs": jsDocs, ".cjs": jsDocs,
+	".ts": jsDocs, ".tsx": jsDocs, ".mts": jsDocs, ".cts": jsDocs,
+}
+
+// handleReadDocs handles the read_docs tool
+func (s *Server) handleReadDocs(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	filePath, err := request.RequireString("file_path")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	symbol := request.GetString("symbol", "")
+
+	extract, ok := docExtractors[s.config.sourceExtension(filePath)]
+	if !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("Unsupported file type for docs: %q (supported: Go, Python, JavaScript/TypeScript)", filepath.Ext(filePath))), nil
+	}
+
+	// Validate and resolve path
+	fullPath, err := s.validateFilePath(filePath)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid file path: %v", err)), nil
+	}
+
+	// Check file size
+	stat, err := s.guard.Stat(fullPath)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("File not found: %v", err)), nil
+	}
+	if maxSize := s.config.maxFileSize(fullPath); stat.Size() > maxSize {
+		return mcp.NewToolResultError(fmt.Sprintf("File too large (%.2f MB > %.2f MB)",
+			float64(stat.Size())/1024/1024, float64(maxSize)/1024/1024)), nil
+	}
+
+	// Use docs parsed ahead of time when the file has not changed since
+	outline, ok := s.prefetch.cachedOutline(fullPath, stat)
+	if !ok {
+		content, err := s.guard.ReadFile(fullPath)
+		if err != nil {
+			if result := unavailableResult(err); result != nil {
+				return result, nil
+			}
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to read file: %v", err)), nil
+		}
+		doc, symbols := extract(string(content))
+		outline = &fileOutline{doc: doc, symbols: symbols}
+	}
+	fileDoc, symbols := outline.doc, outline.symbols
+
+	// Without a symbol, return the file's documentation and every
+	// documented declaration; with one, the declarations of that name
+	matched := []SymbolDoc{}
+	for _, sym := range symbols {
+		if symbol == "" && sym.Doc != "" || symbol != "" && (sym.Name == symbol || strings.HasSuffix(sym.Name, "."+symbol)) {
+			matched = append(matched, sym)
+		}
+	}
+	if symbol != "" && len(matched) == 0 {
+		return mcp.NewToolResultError(fmt.Sprintf("Symbol not found: %s", symbol)), nil
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"file_path": filePath,
+		"symbols":   matched,
+	}
+	if symbol == "" {
+		result["file_doc"] = fileDoc
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// goDocs reads Go doc comments: the package comment and the comment before
+// each top-level declaration
+func goDocs(src string) (string, []SymbolDoc) {
+	fset := token.NewFileSet()
+	file, _ := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if file == nil {
+		return "", nil
+	}
+
+	offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
+	// header is the declaration's source up to its body, on one line
+	header := func(from, to token.Pos) string {
+		text := src[offset(from):offset(to)]
+		return strings.Join(strings.Fields(text), " ")
+	}
+
+	var symbols []SymbolDoc
+	add := func(name, kind string, pos token.Pos, signature string, doc *ast.CommentGroup) {
+		symbols = append(symbols, SymbolDoc{
+			Name:       name,
+			Kind:       kind,
+			LineNumber: fset.Position(pos).Line,
+			Signature:  signature,
+			Doc:        strings.TrimSpace(doc.Text()),
+		})
+	}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			name, kind := d.Name.Name, "func"
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				name, kind = goReceiverName(d.Recv.List[0].Type)+"."+name, "method"
+			}
+			end := d.End()
+			if d.Body != nil {
+				end = d.Body.Pos()
+			}
+			add(name, kind, d.Pos(), header(d.Pos(), end), d.Doc)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch sp := spec.(type) {
+				case *ast.TypeSpec:
+					doc := sp.Doc
+					if doc == nil {
+						doc = d.Doc
+					}
+					signature := "type " + firstLine(src[offset(sp.Pos()):offset(sp.End())])
+					add(sp.Name.Name, "type", sp.Pos(), signature, doc)
+				case *ast.ValueSpec:
+					doc := sp.Doc
+					if doc == nil {
+						doc = d.Doc
+					}
+					signature := d.Tok.String() + " " + firstLine(src[offset(sp.Pos()):offset(sp.End())])
+					for _, ident := range sp.Names {
+						add(ident.Name, d.Tok.String(), ident.Pos(), signature, doc)
+					}
+				}
+			}
+		}
+	}
+	return strings.TrimSpace(file.Doc.Text()), symbols
+}
+
+// goReceiverName returns the type name of a method receiver such as *T[K]
+func goReceiverName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return goReceiverName(e.X)
+	case *ast.IndexExpr:
+		return goReceiverName(e.X)
+	case *ast.IndexListExpr:
+		return goReceiverName(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+// pythonDocs reads Python docstrings: the module's and those of each class,
+// function and method
+func pythonDocs(src string) (string, []SymbolDoc) {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	// The module docstring is the first statement
+	fileDoc := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		fileDoc = readDocstring(lines, i)
+		break
+	}
+
+	type scope struct {
+		indent int
+		name   string
+		class  bool
+	}
+	var stack []scope
+	var symbols []SymbolDoc
+	for i := 0; i < len(lines); i++ {
+		m := pythonDefinition.FindStringSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		indent := len(m[1])
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+
+		name, kind := m[3], "function"
+		if m[2] == "class" {
+			kind = "class"
+		} else if len(stack) > 0 && stack[len(stack)-1].class {
+			kind = "method"
+		}
+		if len(stack) > 0 {
+			name = stack[len(stack)-1].name + "." + name
+		}
+
+		// The header runs to the line ending in a colon
+		end := i
+		for end < len(lines)-1 && end-i < maxSignatureLines && !strings.HasSuffix(strings.TrimSpace(lines[end]), ":") {
+			end++
+		}
+		var header []string
+		for _, line := range lines[i : end+1] {
+			header = append(header, strings.TrimSpace(line))
+		}
+
+		doc := ""
+		for j := end + 1; j < len(lines); j++ {
+			if strings.TrimSpace(lines[j]) != "" {
+				doc = readDocstring(lines, j)
+				break
+			}
+		}
+
+		symbols = append(symbols, SymbolDoc{
+			Name:       name,
+			Kind:       kind,
+			LineNumber: i + 1,
+			Signature:  strings.TrimSuffix(strings.Join(header, " "), ":"),
+			Doc:        doc,
+		})
+		stack = append(stack, scope{indent: indent, name: name, class: kind == "class"})
+		i = end
+	}
+	return fileDoc, symbols
+}
+
+// readDocstring returns the cleaned string literal starting on lines[start],
+// or "" if the line does not start with one
+func readDocstring(lines []string, start int) string {
+	first := strings.TrimSpace(lines[start])
+	m := pythonDocstring.FindStringSubmatch(first)
+	if m == nil {
+		return ""
+	}
+	quote := m[1]
+	body := first[len(m[0]):]
+	if end := strings.Index(body, quote); end >= 0 {
+		return strings.TrimSpace(body[:end])
+	}
+	if len(quote) == 1 {
+		return "" // unterminated single-line string
+	}
+
+	docLines := []string{body}
+	for _, line := range lines[start+1:] {
+		if end := strings.Index(line, quote); end >= 0 {
+			docLines = append(docLines, line[:end])
+			break
+		}
+		docLines = append(docLines, line)
+	}
+	return cleanDoc(docLines)
+}
+
+// cleanDoc trims a docstring the way Python's inspect.cleandoc does: the
+// first line is stripped and the rest lose their common indentation
+func cleanDoc(lines []string) string {
+	indent := -1
+	for _, line := range lines[1:] {
+		if trimmed := strings.TrimLeft(line, " \t"); trimmed != "" {
+			if n := len(line) - len(trimmed); indent < 0 || n < indent {
+				indent = n
+			}
+		}
+	}
+	out := []string{strings.TrimSpace(lines[0])}
+	for _, line := range lines[1:] {
+		if len(line) >= indent && indent > 0 {
+			line = line[indent:]
+		}
+		out = append(out, strings.TrimRight(line, " \t"))
+	}
+	return strings.Trim(strings.Join(out, "\n"), "\n")
+}
+
+// jsDocs reads JSDoc comments: a leading @file/@module comment and the
+// /** ... */ comment before each declaration
+func jsDocs(src string) (string, []SymbolDoc) {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	fileDoc := ""
+	pending := ""     // JSDoc waiting for the declaration after it
+	seenCode := false // whether any code precedes, ruling out a file comment
+	class := ""       // enclosing top-level class, for naming members
+	var symbols []SymbolDoc
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			continue
+		case strings.HasPrefix(trimmed, "/**"):
+			end := i
+			if !strings.Contains(trimmed[3:], "*/") {
+				for end++; end < len(lines)-1 && !strings.Contains(lines[end], "*/"); end++ {
+				}
+				end = min(end, len(lines)-1)
+			}
+			doc := cleanJSDoc(lines[i : end+1])
+			i = end
+			if fileDoc == "" && !seenCode && (jsFileTag.MatchString(doc) || !jsFollowedByDeclaration(lines, end+1)) {
+				fileDoc = doc
+				continue
+			}
+			pending = doc
+			continue
+		case strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "/*") || strings.HasPrefix(trimmed, "*") || strings.HasPrefix(trimmed, "@"):
+			continue // other comments and decorators keep a JSDoc attached
+		}
+		seenCode = true
+
+		topLevel := len(line) == len(strings.TrimLeft(line, " \t"))
+		if topLevel && trimmed != "}" && !strings.HasPrefix(trimmed, "};") {
+			class = ""
+		}
+
+		if m := jsDeclaration.FindStringSubmatch(trimmed); m != nil && topLevel {
+			kind := strings.TrimSuffix(m[1], "*")
+			switch kind {
+			case "const", "let", "var":
+				kind = "variable"
+			}
+			symbols = append(symbols, SymbolDoc{Name: m[2], Kind: kind, LineNumber: i + 1, Signature: jsSignature(trimmed), Doc: pending})
+			if kind == "class" {
+				class = m[2]
+			}
+		} else if m := jsMember.FindStringSubmatch(trimmed); m != nil && class != "" && !topLevel && !jsKeyword(m[1]) {
+			kind := "property"
+			if m[2] == "(" || m[2] == "<" {
+				kind = "method"
+			}
+			symbols = append(symbols, SymbolDoc{Name: class + "." + m[1], Kind: kind, LineNumber: i + 1, Signature: jsSignature(trimmed), Doc: pending})
+		}
+		pending = ""
+	}
+	return fileDoc, symbols
+}
+
+// jsFollowedByDeclaration reports whether the next code line from start
+// declares something
+func jsFollowedByDeclaration(lines []string, start int) bool {
+	for _, line := range lines[min(start, len(lines)):] {
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			return jsDeclaration.MatchString(trimmed) || jsMember.MatchString(trimmed) && !jsKeyword(jsMember.FindStringSubmatch(trimmed)[1])
+		}
+	}
+	return false
+}
+
+// jsKeyword reports whether a would-be member name is a statement keyword
+func jsKeyword(name string) bool {
+	switch name {
+	case "if", "for", "while", "switch", "return", "catch", "import", "export", "throw", "new", "await", "yield", "super", "this":
+		return true
+	}
+	return false
+}
+
+// jsSignature trims a declaration line to its header
+func jsSignature(line string) string {
+	if i := strings.Index(line, "{"); i > 0 {
+		line = line[:i]
+	}
+	return strings.TrimRight(strings.TrimSpace(line), " ;=")
+}
+
+// cleanJSDoc strips comment delimiters and leading asterisks
+func cleanJSDoc(lines []string) string {
+	var out []string
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if i == 0 {
+			line = strings.TrimPrefix(line, "/**")
+		}
+		if i == len(lines)-1 {
+			line = strings.TrimSuffix(line, "*/")
+		}
+		if i > 0 {
+			line = strings.TrimPrefix(line, "*")
+		}
+		out = append(out, strings.TrimRight(strings.TrimPrefix(line, " "), " "))
+	}
+	return strings.Trim(strings.Join(out, "\n"), "\n")
+}
+
+// firstLine returns text up to its first newline
+func firstLine(text string) string {
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		return strings.TrimSpace(text[:i])
+	}
+	return strings.TrimSpace(text)
+}
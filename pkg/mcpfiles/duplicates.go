@@ -0,0 +1,163 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// defaultDuplicateGroups is how many groups find_duplicates lists by default
+const defaultDuplicateGroups = 100
+
+// DuplicateGroup is a set of files with identical content
+type DuplicateGroup struct {
+	Hash        string   `json:"hash"`
+	SizeBytes   int64    `json:"size_bytes"`
+	Files       []string `json:"files"`
+	WastedBytes int64    `json:"wasted_bytes"` // freed by keeping only one copy
+}
+
+// handleFindDuplicates handles the find_duplicates tool
+func (s *Server) handleFindDuplicates(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var globs []string
+	if patterns := request.GetString("patterns", ""); patterns != "" {
+		var err error
+		if globs, err = parseGlobs(patterns); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid patterns: %v", err)), nil
+		}
+	}
+	minSize := int64(request.GetInt("min_size", 1))
+	maxGroups := request.GetInt("max_results", defaultDuplicateGroups)
+	if maxGroups <= 0 {
+		return mcp.NewToolResultError("max_results must be positive"), nil
+	}
+	view, _, err := s.requestView(request)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid view: %v", err)), nil
+	}
+
+	root, truncated, err := s.buildFileTreeWithFilter(ctx, s.config.BasePath, s.config.MaxTreeDepth, s.pathFilter())
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read file structure: %v", err)), nil
+	}
+	files := []FoundFile{}
+	if root != nil {
+		if view != nil {
+			pruneByFilter(root, view)
+		}
+		if globs == nil {
+			globs = []string{"*"}
+		}
+		collectFiles(root, globs, -1, &files)
+	}
+
+	// Only files that share a size can share content, so only those are
+	// fingerprinted, and only those that share a fingerprint are hashed in
+	// full
+	bySize := map[int64][]string{}
+	for _, file := range files {
+		if file.Size >= minSize {
+			bySize[file.Size] = append(bySize[file.Size], file.Path)
+		}
+	}
+	groups := []DuplicateGroup{}
+	fingerprinted, hashed := 0, 0
+	for size, paths := range bySize {
+		if len(paths) < 2 {
+			continue
+		}
+		byFingerprint, err := s.groupByDigest(ctx, paths, s.contentFingerprint)
+		if err != nil {
+			if result := unavailableResult(err); result != nil {
+				return result, nil
+			}
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to hash file: %v", err)), nil
+		}
+		for _, candidates := range byFingerprint {
+			fingerprinted += len(candidates)
+			if len(candidates) < 2 {
+				continue
+			}
+			byHash, err := s.groupByDigest(ctx, candidates, s.contentHash)
+			if err != nil {
+				if result := unavailableResult(err); result != nil {
+					return result, nil
+				}
+				return mcp.NewToolResultError(fmt.Sprintf("Failed to hash file: %v", err)), nil
+			}
+			for hash, same := range byHash {
+				hashed += len(same)
+				if len(same) > 1 {
+					sort.Strings(same)
+					groups = append(groups, DuplicateGroup{Hash: hash, SizeBytes: size, Files: same, WastedBytes: size * int64(len(same)-1)})
+				}
+			}
+		}
+	}
+
+	// Largest savings first
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].WastedBytes != groups[j].WastedBytes {
+			return groups[i].WastedBytes > groups[j].WastedBytes
+		}
+		return groups[i].Files[0] < groups[j].Files[0]
+	})
+	duplicates, wasted := 0, int64(0)
+	for _, group := range groups {
+		duplicates += len(group.Files) - 1
+		wasted += group.WastedBytes
+	}
+	groupCount := len(groups)
+	if len(groups) > maxGroups {
+		groups, truncated = groups[:maxGroups], true
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"groups":              groups,
+		"group_count":         groupCount,
+		"duplicate_files":     duplicates,
+		"wasted_bytes":        wasted,
+		"files_scanned":       len(files),
+		"files_fingerprinted": fingerprinted,
+		"files_hashed":        hashed,
+		"hash_algorithm":      s.config.HashAlgorithm,
+		"truncated":           truncated,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// groupByDigest groups files by a digest of their content, leaving out files
+// that vanished or cannot be read. Only cancellation and an unavailable
+// backend fail it.
+func (s *Server) groupByDigest(ctx context.Context, relPaths []string, digest func(context.Context, string) (string, bool, error)) (map[string][]string, error) {
+	groups := map[string][]string{}
+	for _, relPath := range relPaths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		d, ok, err := digest(ctx, relPath)
+		if err != nil {
+			if unavailableResult(err) != nil {
+				return nil, err
+			}
+			continue
+		}
+		if ok {
+			groups[d] = append(groups[d], relPath)
+		}
+	}
+	return groups, nil
+}
@@ -0,0 +1,211 @@
+package mcpfiles
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Supported text encodings
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	EncodingLatin1  = "iso-8859-1"
+)
+
+// EncodingBase64 marks content returned base64-encoded because it is binary
+const EncodingBase64 = "base64"
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// TextEncoding describes how a text file is stored on disk
+type TextEncoding struct {
+	Name string `json:"name"`
+	BOM  bool   `json:"bom"`
+}
+
+// detectTextEncoding guesses the encoding of file contents.
+// Returns false if the data does not look like text in any supported encoding.
+func detectTextEncoding(data []byte) (TextEncoding, bool) {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return TextEncoding{Name: EncodingUTF8, BOM: true}, true
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return TextEncoding{Name: EncodingUTF16LE, BOM: true}, true
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return TextEncoding{Name: EncodingUTF16BE, BOM: true}, true
+	}
+
+	if enc, ok := detectUTF16(data); ok {
+		return enc, true
+	}
+
+	// Other NUL bytes almost always mean binary content, even in valid UTF-8
+	if bytes.IndexByte(data, 0) >= 0 {
+		return TextEncoding{}, false
+	}
+
+	if utf8.Valid(data) {
+		return TextEncoding{Name: EncodingUTF8}, true
+	}
+
+	// Latin-1 maps every byte to a code point
+	return TextEncoding{Name: EncodingLatin1}, true
+}
+
+// detectUTF16 recognizes UTF-16 without a BOM by the NUL bytes of mostly
+// ASCII text, which fall on every other byte: odd bytes in little-endian
+// order and even ones in big-endian order
+func detectUTF16(data []byte) (TextEncoding, bool) {
+	if len(data) < 2 || len(data)%2 != 0 {
+		return TextEncoding{}, false
+	}
+	var nuls [2]int
+	for i, b := range data {
+		if b == 0 {
+			nuls[i%2]++
+		}
+	}
+	units := len(data) / 2
+	enc, order := TextEncoding{Name: EncodingUTF16LE}, binary.ByteOrder(binary.LittleEndian)
+	switch {
+	case nuls[0] == 0 && 2*nuls[1] >= units:
+	case nuls[1] == 0 && 2*nuls[0] >= units:
+		enc, order = TextEncoding{Name: EncodingUTF16BE}, binary.BigEndian
+	default:
+		return TextEncoding{}, false
+	}
+
+	// Surrogates must come in pairs
+	for i := 0; i < units; i++ {
+		unit := order.Uint16(data[2*i:])
+		switch {
+		case unit >= 0xD800 && unit < 0xDC00:
+			if i+1 == units {
+				return TextEncoding{}, false
+			}
+			if next := order.Uint16(data[2*i+2:]); next < 0xDC00 || next >= 0xE000 {
+				return TextEncoding{}, false
+			}
+			i++
+		case unit >= 0xDC00 && unit < 0xE000:
+			return TextEncoding{}, false
+		}
+	}
+	return enc, true
+}
+
+// trimPartialRune drops a UTF-8 sequence cut short at the end of data, as
+// at the end of the first bytes of a file
+func trimPartialRune(data []byte) []byte {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return data[:i]
+			}
+			break
+		}
+	}
+	return data
+}
+
+// detectMIMEType guesses the media type of binary content from its leading
+// bytes, falling back to the file extension when they are not recognized
+func detectMIMEType(path string, data []byte) string {
+	sniffed := http.DetectContentType(data)
+	if sniffed != "application/octet-stream" {
+		return sniffed
+	}
+	if byExt := mime.TypeByExtension(filepath.Ext(path)); byExt != "" {
+		return byExt
+	}
+	return sniffed
+}
+
+// decodeText converts raw file contents in the given encoding to a UTF-8 string
+func decodeText(data []byte, enc TextEncoding) (string, error) {
+	switch enc.Name {
+	case EncodingUTF8:
+		if enc.BOM {
+			data = bytes.TrimPrefix(data, bomUTF8)
+		}
+		return string(data), nil
+
+	case EncodingUTF16LE, EncodingUTF16BE:
+		if enc.BOM {
+			data = data[2:]
+		}
+		if len(data)%2 != 0 {
+			return "", fmt.Errorf("invalid %s data: odd number of bytes", enc.Name)
+		}
+		var order binary.ByteOrder = binary.LittleEndian
+		if enc.Name == EncodingUTF16BE {
+			order = binary.BigEndian
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = order.Uint16(data[i*2:])
+		}
+		return string(utf16.Decode(units)), nil
+
+	case EncodingLatin1:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes), nil
+	}
+
+	return "", fmt.Errorf("unsupported encoding: %s", enc.Name)
+}
+
+// encodeText converts a UTF-8 string back to the given encoding, restoring the BOM if present.
+// Write tools use this so editing a legacy file does not silently convert it to UTF-8.
+func encodeText(text string, enc TextEncoding) ([]byte, error) {
+	switch enc.Name {
+	case EncodingUTF8:
+		if enc.BOM {
+			return append(append([]byte{}, bomUTF8...), text...), nil
+		}
+		return []byte(text), nil
+
+	case EncodingUTF16LE, EncodingUTF16BE:
+		var order binary.AppendByteOrder = binary.LittleEndian
+		bom := bomUTF16LE
+		if enc.Name == EncodingUTF16BE {
+			order = binary.BigEndian
+			bom = bomUTF16BE
+		}
+		units := utf16.Encode([]rune(text))
+		out := make([]byte, 0, len(bom)+len(units)*2)
+		if enc.BOM {
+			out = append(out, bom...)
+		}
+		for _, u := range units {
+			out = order.AppendUint16(out, u)
+		}
+		return out, nil
+
+	case EncodingLatin1:
+		out := make([]byte, 0, len(text))
+		for i, r := range text {
+			if r > 0xFF {
+				return nil, fmt.Errorf("character %q at byte %d cannot be represented in %s", r, i, enc.Name)
+			}
+			out = append(out, byte(r))
+		}
+		return out, nil
+	}
+
+	return nil, fmt.Errorf("unsupported encoding: %s", enc.Name)
+}
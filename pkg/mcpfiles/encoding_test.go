@@ -0,0 +1,127 @@
+package mcpfiles
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTextEncodingRoundTrip(t *testing.T) {
+	tests := []struct {
+		text string
+		enc  TextEncoding
+		data []byte
+	}{
+		{"héllo\n", TextEncoding{Name: EncodingUTF8}, []byte("héllo\n")},
+		{"héllo\n", TextEncoding{Name: EncodingUTF8, BOM: true}, []byte("\xEF\xBB\xBFhéllo\n")},
+		{"", TextEncoding{Name: EncodingUTF8, BOM: true}, []byte("\xEF\xBB\xBF")},
+		{"hi", TextEncoding{Name: EncodingUTF16LE, BOM: true}, []byte{0xFF, 0xFE, 'h', 0, 'i', 0}},
+		{"hi", TextEncoding{Name: EncodingUTF16BE, BOM: true}, []byte{0xFE, 0xFF, 0, 'h', 0, 'i'}},
+		{"hi", TextEncoding{Name: EncodingUTF16LE}, []byte{'h', 0, 'i', 0}},
+		{"é😀", TextEncoding{Name: EncodingUTF16LE, BOM: true}, []byte{0xFF, 0xFE, 0xE9, 0x00, 0x3D, 0xD8, 0x00, 0xDE}},
+		{"é😀", TextEncoding{Name: EncodingUTF16BE, BOM: true}, []byte{0xFE, 0xFF, 0x00, 0xE9, 0xD8, 0x3D, 0xDE, 0x00}},
+		{"café\n", TextEncoding{Name: EncodingLatin1}, []byte("caf\xE9\n")},
+		{"\u00a0ÿ£", TextEncoding{Name: EncodingLatin1}, []byte{0xA0, 0xFF, 0xA3}},
+	}
+	for _, tt := range tests {
+		data, err := encodeText(tt.text, tt.enc)
+		if err != nil || !bytes.Equal(data, tt.data) {
+			t.Errorf("encodeText(%q, %+v) = %x, %v; want %x", tt.text, tt.enc, data, err, tt.data)
+			continue
+		}
+		text, err := decodeText(data, tt.enc)
+		if err != nil || text != tt.text {
+			t.Errorf("decodeText(%x, %+v) = %q, %v; want %q", data, tt.enc, text, err, tt.text)
+		}
+	}
+}
+
+func TestDetectTextEncoding(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want TextEncoding
+		ok   bool
+	}{
+		{[]byte("plain"), TextEncoding{Name: EncodingUTF8}, true},
+		{[]byte("\xEF\xBB\xBFplain"), TextEncoding{Name: EncodingUTF8, BOM: true}, true},
+		{[]byte{0xFF, 0xFE, 'h', 0}, TextEncoding{Name: EncodingUTF16LE, BOM: true}, true},
+		{[]byte{0xFE, 0xFF, 0, 'h'}, TextEncoding{Name: EncodingUTF16BE, BOM: true}, true},
+		{[]byte("caf\xE9"), TextEncoding{Name: EncodingLatin1}, true},
+		{[]byte("a\x00b"), TextEncoding{}, false},
+
+		// UTF-16 without a BOM is told by where its NUL bytes fall
+		{[]byte{'h', 0, 'i', 0, 0xE9, 0}, TextEncoding{Name: EncodingUTF16LE}, true},
+		{[]byte{0, 'h', 0, 'i', 0x20, 0xAC}, TextEncoding{Name: EncodingUTF16BE}, true},
+		{[]byte{'a', 0, 'b', 0, 0x3D, 0xD8, 0x01, 0xDE}, TextEncoding{Name: EncodingUTF16LE}, true},
+		{[]byte{'a', 0, 'b', 0, 0x3D, 0xD8, 'c', 0}, TextEncoding{}, false},
+		{[]byte{'a', 0, 0, 'b'}, TextEncoding{}, false},
+		{[]byte{'a', 0, 'b', 'c', 'd', 'e'}, TextEncoding{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := detectTextEncoding(tt.data)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("detectTextEncoding(%x) = %+v, %v; want %+v, %v", tt.data, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestTextEncodingErrors(t *testing.T) {
+	if _, err := encodeText("5 €", TextEncoding{Name: EncodingLatin1}); err == nil || !strings.Contains(err.Error(), "at byte 2 cannot be represented") {
+		t.Errorf("encodeText of € in Latin-1: error = %v", err)
+	}
+	if _, err := decodeText([]byte{0xFF, 0xFE, 'h'}, TextEncoding{Name: EncodingUTF16LE, BOM: true}); err == nil || !strings.Contains(err.Error(), "odd number of bytes") {
+		t.Errorf("decodeText of odd UTF-16: error = %v", err)
+	}
+	if _, err := encodeText("x", TextEncoding{Name: "koi8-r"}); err == nil {
+		t.Error("encodeText in an unsupported encoding succeeded")
+	}
+	if _, err := decodeText([]byte("x"), TextEncoding{Name: "koi8-r"}); err == nil {
+		t.Error("decodeText in an unsupported encoding succeeded")
+	}
+}
+
+func TestWriteFileKeepsEncodingOfLargeFiles(t *testing.T) {
+	s := newTestServer(t, &Config{MaxFileSize: 16}, nil)
+	files := map[string]string{
+		"latin1.txt": strings.Repeat("caf\xE9 ", 8),
+		"utf16.txt":  strings.Repeat("h\x00i\x00", 8),
+	}
+	for name, content := range files {
+		writeTestFile(t, filepath.Join(s.config.BasePath, name), content)
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"latin1.txt", "\xE9t\xE9"},
+		{"utf16.txt", "\xE9\x00t\x00\xE9\x00"},
+	}
+	for _, tt := range tests {
+		text, isError := callTool(t, ctx, s, "write_file", map[string]interface{}{"file_path": tt.name, "content": "été"})
+		if isError {
+			t.Errorf("write_file %s = %s", tt.name, text)
+			continue
+		}
+		if got := readTestFile(t, s, tt.name); got != tt.want {
+			t.Errorf("%s = %q after write_file, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWriteFileRefusesWhenEncodingUnreadable(t *testing.T) {
+	s := newTestServer(t, &Config{
+		Faults: []FaultRule{{Path: "locked.txt", Ops: []string{"read"}, Error: "EIO"}},
+	}, map[string]string{"locked.txt": "caf\xE9\n"})
+
+	text, isError := callTool(t, context.Background(), s, "write_file", map[string]interface{}{"file_path": "locked.txt", "content": "été"})
+	if !isError || !strings.Contains(text, "keep its encoding") {
+		t.Errorf("write_file over a file that cannot be read = %s", text)
+	}
+	if got := readTestFile(t, s, "locked.txt"); got != "caf\xE9\n" {
+		t.Errorf("locked.txt = %q after a refused write", got)
+	}
+}
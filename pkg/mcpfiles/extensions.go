@@ -0,0 +1,160 @@
+package mcpfiles
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ExtensionHandling overrides how files with one extension are handled
+type ExtensionHandling struct {
+	// Binary treats the files as binary whatever their content: they are
+	// read base64-encoded, cannot be edited and are not searched
+	Binary bool `json:"binary,omitempty"`
+	// Extractor names the language whose docs and imports the files are
+	// read as, such as python for .pyw files
+	Extractor string `json:"extractor,omitempty"`
+	// MaxSize replaces MaxFileSize for the files, higher or lower
+	MaxSize int64 `json:"max_size,omitempty"`
+	// Encoding is the text encoding the files are read and written in,
+	// in place of detecting it
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// extractorExtensions maps the languages extractors know to an extension of
+// each, under which their doc and import extractors are registered
+var extractorExtensions = map[string]string{
+	"go":         ".go",
+	"python":     ".py",
+	"javascript": ".js",
+	"typescript": ".ts",
+	"c":          ".c",
+	"cpp":        ".cpp",
+	"objc":       ".m",
+	"java":       ".java",
+	"kotlin":     ".kt",
+	"scala":      ".scala",
+	"rust":       ".rs",
+	"csharp":     ".cs",
+	"php":        ".php",
+	"ruby":       ".rb",
+	"swift":      ".swift",
+}
+
+// loadExtensionHandling reads an extension configuration file of the form
+// {"extensions": {".ext": {...}}}
+func loadExtensionHandling(path string) (map[string]ExtensionHandling, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Extensions map[string]ExtensionHandling `json:"extensions"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid extension config: %w", err)
+	}
+
+	return file.Extensions, nil
+}
+
+// normalizeExtensionHandling checks configured extensions and keys them by
+// their lowercase name with a leading dot, as filepath.Ext returns it
+func normalizeExtensionHandling(configured map[string]ExtensionHandling) (map[string]ExtensionHandling, error) {
+	extensions := make(map[string]ExtensionHandling, len(configured))
+	for ext, handling := range configured {
+		name := strings.ToLower(strings.TrimSpace(ext))
+		if !strings.HasPrefix(name, ".") {
+			name = "." + name
+		}
+		if name == "." || strings.ContainsAny(name[1:], `./\`) {
+			return nil, fmt.Errorf("invalid extension %q (give the last extension, such as .log)", ext)
+		}
+		if _, ok := extensions[name]; ok {
+			return nil, fmt.Errorf("extension %s is configured twice", name)
+		}
+		if handling.MaxSize < 0 {
+			return nil, fmt.Errorf("extension %s: max_size must not be negative", name)
+		}
+		if handling.Extractor != "" {
+			if _, ok := extractorExtensions[handling.Extractor]; !ok {
+				return nil, fmt.Errorf("extension %s: unknown extractor %q (use %s)", name, handling.Extractor, strings.Join(extractorNames(), ", "))
+			}
+		}
+		switch handling.Encoding {
+		case "", EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE, EncodingLatin1:
+		default:
+			return nil, fmt.Errorf("extension %s: unsupported encoding %q (use %s, %s, %s or %s)", name, handling.Encoding, EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE, EncodingLatin1)
+		}
+		if handling.Binary && (handling.Encoding != "" || handling.Extractor != "") {
+			return nil, fmt.Errorf("extension %s: binary files take no encoding or extractor", name)
+		}
+		extensions[name] = handling
+	}
+	return extensions, nil
+}
+
+// extractorNames returns the sorted names of the known extractors
+func extractorNames() []string {
+	names := make([]string, 0, len(extractorExtensions))
+	for name := range extractorExtensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// extensionHandling returns the configured handling of a file's extension
+func (c *Config) extensionHandling(path string) ExtensionHandling {
+	return c.Extensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// maxFileSize returns the size limit of a file, which the low-memory profile
+// caps whatever the extension allows
+func (c *Config) maxFileSize(path string) int64 {
+	if handling := c.extensionHandling(path); handling.MaxSize > 0 {
+		if c.lowMemory() {
+			return min(handling.MaxSize, lowMemoryMaxFileSize)
+		}
+		return handling.MaxSize
+	}
+	return c.MaxFileSize
+}
+
+// sourceExtension returns the lowercase extension that selects the doc and
+// import extractors of a file
+func (c *Config) sourceExtension(path string) string {
+	if handling := c.extensionHandling(path); handling.Extractor != "" {
+		return extractorExtensions[handling.Extractor]
+	}
+	return strings.ToLower(filepath.Ext(path))
+}
+
+// sizeOrBinaryOverrides reports whether any extension changes which files a
+// search reads, which ripgrep cannot be told
+func (c *Config) sizeOrBinaryOverrides() bool {
+	for _, handling := range c.Extensions {
+		if handling.Binary || handling.MaxSize > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// textEncoding returns the encoding of file contents, as configured for its
+// extension or else detected. Returns false for binary content.
+func (c *Config) textEncoding(path string, data []byte) (TextEncoding, bool) {
+	handling := c.extensionHandling(path)
+	switch {
+	case handling.Binary:
+		return TextEncoding{}, false
+	case handling.Encoding != "":
+		detected, ok := detectTextEncoding(data)
+		return TextEncoding{Name: handling.Encoding, BOM: ok && detected.BOM && detected.Name == handling.Encoding}, true
+	}
+	return detectTextEncoding(data)
+}
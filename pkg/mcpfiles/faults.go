@@ -0,0 +1,244 @@
+package mcpfiles
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// FaultRule injects failures into filesystem operations on matching paths.
+// Used to let client authors exercise their handling of this server's errors.
+type FaultRule struct {
+	// Path is a glob matched against the path relative to the base path.
+	// A match on a directory also applies to everything beneath it.
+	Path string `json:"path"`
+	// Ops limits the rule to "stat", "readdir", "read", "write" and/or "delete" (default: all)
+	Ops []string `json:"ops,omitempty"`
+	// Latency is added before the operation runs, e.g. "2s"
+	Latency string `json:"latency,omitempty"`
+	// Error fails the operation: EACCES, ENOENT, EIO or EMFILE
+	Error string `json:"error,omitempty"`
+	// PartialRead truncates reads to this many bytes and returns io.ErrUnexpectedEOF
+	PartialRead *int `json:"partial_read,omitempty"`
+	// Probability of applying the rule per operation (default: 1)
+	Probability *float64 `json:"probability,omitempty"`
+
+	latency time.Duration
+	errno   error
+}
+
+// faultErrors maps configurable error names to syscall errors
+var faultErrors = map[string]error{
+	"EACCES": syscall.EACCES,
+	"ENOENT": syscall.ENOENT,
+	"EIO":    syscall.EIO,
+	"EMFILE": syscall.EMFILE,
+}
+
+// loadFaultRules reads a fault configuration file of the form {"faults": [...]}
+func loadFaultRules(path string) ([]FaultRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Faults []FaultRule `json:"faults"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid fault config: %w", err)
+	}
+
+	return file.Faults, nil
+}
+
+// validateFaultRules checks rules and resolves their latency and error in place
+func validateFaultRules(rules []FaultRule) error {
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compile validates a rule and resolves its latency and error
+func (r *FaultRule) compile() error {
+	if _, err := filepath.Match(r.Path, ""); err != nil {
+		return fmt.Errorf("invalid fault path %q: %w", r.Path, err)
+	}
+	for _, op := range r.Ops {
+		if op != "stat" && op != "readdir" && op != "read" && op != "write" && op != "delete" {
+			return fmt.Errorf("invalid fault op %q", op)
+		}
+	}
+	if r.Latency != "" {
+		latency, err := time.ParseDuration(r.Latency)
+		if err != nil {
+			return fmt.Errorf("invalid fault latency %q: %w", r.Latency, err)
+		}
+		r.latency = latency
+	}
+	if r.Error != "" {
+		errno, ok := faultErrors[strings.ToUpper(r.Error)]
+		if !ok {
+			return fmt.Errorf("unsupported fault error %q", r.Error)
+		}
+		r.errno = errno
+	}
+	return nil
+}
+
+// matches reports whether the rule applies to op on relPath
+func (r *FaultRule) matches(op, relPath string) bool {
+	if len(r.Ops) > 0 {
+		found := false
+		for _, ruleOp := range r.Ops {
+			if ruleOp == op {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if r.Probability != nil && rand.Float64() >= *r.Probability {
+		return false
+	}
+
+	// Match the path itself or any of its parent directories
+	for p := relPath; p != "." && p != "/" && p != ""; p = filepath.Dir(p) {
+		if matched, _ := filepath.Match(r.Path, p); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// FaultyFileSystem wraps a FileSystem and injects latency, errors and partial
+// reads according to its rules
+type FaultyFileSystem struct {
+	base     FileSystem
+	basePath string
+	rules    []FaultRule
+}
+
+// NewFaultyFileSystem creates a fault-injecting backend from rules already
+// checked by validateFaultRules. Rules are applied in order and the first rule
+// that fails an operation wins.
+func NewFaultyFileSystem(base FileSystem, basePath string, rules []FaultRule) *FaultyFileSystem {
+	return &FaultyFileSystem{
+		base:     base,
+		basePath: basePath,
+		rules:    rules,
+	}
+}
+
+// inject applies matching rules for op. Returns the partial read limit (-1
+// for none) and the error to fail with.
+func (f *FaultyFileSystem) inject(op, path string) (int, error) {
+	relPath, err := filepath.Rel(f.basePath, path)
+	if err != nil {
+		return -1, nil
+	}
+
+	for i := range f.rules {
+		rule := &f.rules[i]
+		if !rule.matches(op, relPath) {
+			continue
+		}
+		if rule.latency > 0 {
+			time.Sleep(rule.latency)
+		}
+		if rule.errno != nil {
+			return -1, &fs.PathError{Op: op, Path: path, Err: rule.errno}
+		}
+		if rule.PartialRead != nil && op == "read" {
+			return *rule.PartialRead, nil
+		}
+	}
+
+	return -1, nil
+}
+
+func (f *FaultyFileSystem) Stat(path string) (os.FileInfo, error) {
+	if _, err := f.inject("stat", path); err != nil {
+		return nil, err
+	}
+	return f.base.Stat(path)
+}
+
+func (f *FaultyFileSystem) Lstat(path string) (os.FileInfo, error) {
+	if _, err := f.inject("stat", path); err != nil {
+		return nil, err
+	}
+	return f.base.Lstat(path)
+}
+
+func (f *FaultyFileSystem) ReadDir(path string) ([]fs.DirEntry, error) {
+	if _, err := f.inject("readdir", path); err != nil {
+		return nil, err
+	}
+	return f.base.ReadDir(path)
+}
+
+func (f *FaultyFileSystem) ReadFile(path string) ([]byte, error) {
+	limit, err := f.inject("read", path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := f.base.ReadFile(path)
+	if err != nil || limit < 0 || limit >= len(data) {
+		return data, err
+	}
+	return data[:limit], &fs.PathError{Op: "read", Path: path, Err: io.ErrUnexpectedEOF}
+}
+
+func (f *FaultyFileSystem) WriteFile(path string, data []byte, perm fs.FileMode) error {
+	if _, err := f.inject("write", path); err != nil {
+		return err
+	}
+	return f.base.WriteFile(path, data, perm)
+}
+
+func (f *FaultyFileSystem) MkdirAll(path string, perm fs.FileMode) error {
+	if _, err := f.inject("write", path); err != nil {
+		return err
+	}
+	return f.base.MkdirAll(path, perm)
+}
+
+func (f *FaultyFileSystem) Remove(path string) error {
+	if _, err := f.inject("delete", path); err != nil {
+		return err
+	}
+	return f.base.Remove(path)
+}
+
+func (f *FaultyFileSystem) RemoveAll(path string) error {
+	if _, err := f.inject("delete", path); err != nil {
+		return err
+	}
+	return f.base.RemoveAll(path)
+}
+
+// Rename counts as a write to both paths
+func (f *FaultyFileSystem) Rename(oldPath, newPath string) error {
+	if _, err := f.inject("write", oldPath); err != nil {
+		return err
+	}
+	if _, err := f.inject("write", newPath); err != nil {
+		return err
+	}
+	return f.base.Rename(oldPath, newPath)
+}
@@ -0,0 +1,586 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// pathFilter returns .gitignore rules combined with .mcpignore rules and any
+// filter supplied via WithPathFilter
+func (s *Server) pathFilter() PathFilter {
+	filters := multiFilter{NewGitignoreFilter(s.config.BasePath), s.hidden}
+	if s.filter == nil {
+		return filters
+	}
+	return append(filters, s.filter)
+}
+
+// handleReadFileStructure handles the read_file_structure tool with filtering
+func (s *Server) handleReadFileStructure(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	// Requested depth may only tighten the configured safeguard
+	maxDepth := s.config.MaxTreeDepth
+	if requested := request.GetInt("max_depth", 0); requested > 0 && requested < maxDepth {
+		maxDepth = requested
+	}
+
+	// Parse the tag filter
+	wanted := map[string]bool{}
+	for _, tag := range strings.Split(request.GetString("tags", ""), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			if _, ok := s.config.Tags[tag]; !ok {
+				return mcp.NewToolResultError(fmt.Sprintf("Unknown tag: %q", tag)), nil
+			}
+			wanted[tag] = true
+		}
+	}
+
+	// Parse the filter expression
+	var expr fileFilter
+	if text := request.GetString("filter", ""); strings.TrimSpace(text) != "" {
+		var err error
+		if expr, err = parseFilter(text, s.config.Tags, time.Now()); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid filter: %v", err)), nil
+		}
+	}
+	view, _, err := s.requestView(request)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid view: %v", err)), nil
+	}
+
+	// Parse the page; the cursor is the offset of the page's first entry
+	cursor := request.GetString("cursor", "")
+	maxEntries := request.GetInt("max_entries", 0)
+	paged := cursor != "" || maxEntries != 0
+	if maxEntries < 0 {
+		return mcp.NewToolResultError("max_entries must be positive"), nil
+	}
+	if paged && maxEntries == 0 {
+		maxEntries = defaultPageEntries
+	}
+	offset := 0
+	if cursor != "" {
+		if offset, err = strconv.Atoi(cursor); err != nil || offset < 0 {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid cursor: %q", cursor)), nil
+		}
+	}
+
+	// Create gitignore filter
+	filter := s.pathFilter()
+
+	// Build file tree with filtering
+	root, truncated, err := s.buildFileTreeWithFilter(ctx, s.config.BasePath, maxDepth, filter)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read file structure: %v", err)), nil
+	}
+	if len(wanted) > 0 && root != nil {
+		pruneByTags(root, wanted)
+	}
+	if expr != nil && root != nil {
+		pruneByFilter(root, expr)
+	}
+	if view != nil && root != nil {
+		pruneByFilter(root, view)
+	}
+	total := 0
+	if paged && root != nil {
+		root, total = pageTree(root, offset, maxEntries)
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"base_path": s.config.BasePath,
+		"structure": root,
+		"note":      s.localize("Filtered out .git directory and .gitignore patterns"),
+	}
+	if paged {
+		result["total_entries"] = total
+		if offset+maxEntries < total {
+			result["next_cursor"] = strconv.Itoa(offset + maxEntries)
+		}
+	}
+	if truncated {
+		result["truncated"] = true
+		result["note"] = s.localize("Filtered out .git directory and .gitignore patterns") + "; " + fmt.Sprintf(s.localize("stopped after %d entries"), s.config.MaxTreeNodes)
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// defaultPageEntries is the page size of read_file_structure when a cursor
+// is given without max_entries
+const defaultPageEntries = 1000
+
+// pageTree returns a copy of the tree with only the entries at positions
+// offset through offset+limit-1 in depth-first order, under the directories
+// that hold them, and the number of entries in the whole tree. Directories
+// of earlier pages are repeated so that each page is a tree of its own.
+func pageTree(root *FileNode, offset, limit int) (*FileNode, int) {
+	pos := 0
+	var page func(node *FileNode) *FileNode
+	page = func(node *FileNode) *FileNode {
+		inPage := pos >= offset && pos < offset+limit
+		pos++
+		var children []*FileNode
+		for _, child := range node.Children {
+			if kept := page(child); kept != nil {
+				children = append(children, kept)
+			}
+		}
+		if !inPage && len(children) == 0 {
+			return nil
+		}
+		copied := *node
+		copied.Children = children
+		return &copied
+	}
+
+	// The root itself is not an entry
+	copied := *root
+	copied.Children = nil
+	for _, child := range root.Children {
+		if kept := page(child); kept != nil {
+			copied.Children = append(copied.Children, kept)
+		}
+	}
+	return &copied, pos
+}
+
+// DirectoryEntry is one immediate entry of a directory listing
+type DirectoryEntry struct {
+	Name     string   `json:"name"`
+	Path     string   `json:"path"`
+	Type     string   `json:"type"` // "file" or "directory"
+	Size     *int64   `json:"size,omitempty"`
+	Modified string   `json:"modified"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// handleListDirectory handles the list_directory tool, reading a single level
+func (s *Server) handleListDirectory(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	dirPath := request.GetString("path", "")
+
+	// Validate and resolve path
+	fullPath, err := s.validateFilePath(dirPath)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid file path: %v", err)), nil
+	}
+	stat, err := s.guard.Stat(fullPath)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Directory not found: %v", err)), nil
+	}
+	if !stat.IsDir() {
+		return mcp.NewToolResultError("Cannot list: path is a file"), nil
+	}
+
+	filter := s.pathFilter()
+	if fullPath != s.config.BasePath && filter.ShouldIgnore(fullPath) {
+		return mcp.NewToolResultError("Cannot list: path is ignored"), nil
+	}
+
+	dirEntries, err := s.guard.ReadDir(fullPath)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read directory: %v", err)), nil
+	}
+
+	entries := []DirectoryEntry{}
+	truncated := false
+	for _, dirEntry := range dirEntries {
+		childPath := filepath.Join(fullPath, dirEntry.Name())
+		if filter.ShouldIgnore(childPath) {
+			continue
+		}
+		if s.config.MaxTreeNodes > 0 && len(entries) >= s.config.MaxTreeNodes {
+			truncated = true
+			break
+		}
+
+		// Stat follows symlinks, as read_file_structure does
+		info, err := s.guard.Stat(childPath)
+		if err != nil {
+			if result := unavailableResult(err); result != nil {
+				return result, nil
+			}
+			continue // Skip entries that cause errors
+		}
+
+		relPath, _ := filepath.Rel(s.config.BasePath, childPath)
+		entry := DirectoryEntry{
+			Name:     dirEntry.Name(),
+			Path:     filepath.ToSlash(relPath),
+			Type:     "file",
+			Modified: info.ModTime().UTC().Format(time.RFC3339),
+		}
+		if info.IsDir() {
+			entry.Type = "directory"
+		} else {
+			size := info.Size()
+			entry.Size = &size
+			entry.Tags = fileTags(s.config.Tags, entry.Path)
+		}
+		entries = append(entries, entry)
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"path":      dirPath,
+		"entries":   entries,
+		"truncated": truncated,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// handleGetFileInfo handles the get_file_info tool
+func (s *Server) handleGetFileInfo(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	filePath, err := request.RequireString("path")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+
+	// Validate and resolve path
+	fullPath, err := s.validateFilePath(filePath)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid file path: %v", err)), nil
+	}
+	linkInfo, err := s.guard.Lstat(fullPath)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("File not found: %v", err)), nil
+	}
+
+	// Report what a symlink points to, as the other tools see it
+	isSymlink := linkInfo.Mode()&fs.ModeSymlink != 0
+	info := linkInfo
+	if isSymlink {
+		if info, err = s.guard.Stat(fullPath); err != nil {
+			if result := unavailableResult(err); result != nil {
+				return result, nil
+			}
+			return mcp.NewToolResultError(fmt.Sprintf("Broken symlink: %v", err)), nil
+		}
+	}
+
+	entryType := "file"
+	switch {
+	case info.IsDir():
+		entryType = "directory"
+	case !info.Mode().IsRegular():
+		entryType = "other"
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"path":        filePath,
+		"type":        entryType,
+		"is_dir":      info.IsDir(),
+		"is_symlink":  isSymlink,
+		"size_bytes":  info.Size(),
+		"modified":    info.ModTime().UTC().Format(time.RFC3339),
+		"mode":        fmt.Sprintf("%04o", info.Mode().Perm()),
+		"permissions": info.Mode().String(),
+		"ignored":     fullPath != s.config.BasePath && s.pathFilter().ShouldIgnore(fullPath),
+	}
+
+	// Guess text vs binary the way read_file_contents decodes, for files it
+	// would be willing to read
+	if info.Mode().IsRegular() && info.Size() <= s.config.maxFileSize(fullPath) {
+		content, err := s.guard.ReadFile(fullPath)
+		if err != nil {
+			if result := unavailableResult(err); result != nil {
+				return result, nil
+			}
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to read file: %v", err)), nil
+		}
+		encoding, isText := s.config.textEncoding(fullPath, content)
+		result["is_text"] = isText
+		if isText {
+			result["encoding"] = encoding.Name
+			result["bom"] = encoding.BOM
+		} else {
+			result["mime_type"] = detectMIMEType(fullPath, content)
+		}
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// pruneByTags drops files without any of the wanted tags, and directories
+// left empty by that. Returns whether node itself should be kept.
+func pruneByTags(node *FileNode, wanted map[string]bool) bool {
+	if node.Type != "directory" {
+		return hasAnyTag(node.Tags, wanted)
+	}
+	kept := node.Children[:0]
+	for _, child := range node.Children {
+		if pruneByTags(child, wanted) {
+			kept = append(kept, child)
+		}
+	}
+	node.Children = kept
+	return len(kept) > 0
+}
+
+// walkJob is a directory waiting to have its entries read
+type walkJob struct {
+	node  *FileNode
+	path  string
+	depth int
+}
+
+// walkListing is what was read of one directory: nodes for its visible
+// entries in directory order, with their paths and, for directories to
+// expand, their real paths
+type walkListing struct {
+	children  []*FileNode
+	paths     []string
+	realPaths []string // "" for entries not to expand
+}
+
+// treeWalker builds file trees one depth at a time, so deep trees cannot
+// exhaust the goroutine stack. A bounded pool of workers reads the
+// directories of a level; the listings are then added to the tree in order,
+// so which entries fit the node budget and which path to a symlinked
+// directory gets expanded do not depend on which worker finished first.
+type treeWalker struct {
+	ctx      context.Context
+	server   *Server
+	filter   PathFilter
+	maxDepth int
+	maxNodes int
+
+	nodes     int
+	truncated bool
+	visited   map[string]bool
+}
+
+// buildFileTreeWithFilter builds a file tree structure with gitignore filtering.
+// Directories deeper than maxDepth are listed without children, and the walk
+// stops once the configured node budget is spent, reporting truncated = true.
+// Entries are counted against the budget breadth-first, in directory order,
+// so a tree is cut short the same way on every walk. The walk stops with
+// ctx's error once ctx is done.
+func (s *Server) buildFileTreeWithFilter(ctx context.Context, dirPath string, maxDepth int, filter PathFilter) (*FileNode, bool, error) {
+	walker := &treeWalker{
+		ctx:      ctx,
+		server:   s,
+		filter:   filter,
+		maxDepth: maxDepth,
+		maxNodes: s.config.MaxTreeNodes,
+		visited:  make(map[string]bool),
+	}
+
+	// Check if this path should be ignored
+	if filter.ShouldIgnore(dirPath) {
+		return nil, false, nil
+	}
+
+	root, err := walker.newNode(dirPath)
+	if err != nil {
+		return nil, false, err
+	}
+	walker.nodes = 1
+	var level []walkJob
+	if root.Type == "directory" {
+		walker.visited[walker.realPath(dirPath)] = true
+		level = append(level, walkJob{node: root, path: dirPath, depth: 0})
+	}
+
+	for len(level) > 0 {
+		listings, err := walker.read(level)
+		if err != nil {
+			return nil, false, err
+		}
+		level = walker.add(level, listings)
+	}
+	return root, walker.truncated, nil
+}
+
+// read lists the directories of one level with up to WalkConcurrency
+// workers. Returns the first error that aborts the walk.
+func (w *treeWalker) read(level []walkJob) ([]walkListing, error) {
+	listings := make([]walkListing, len(level))
+	var next atomic.Int64
+	var stop atomic.Bool
+	var mu sync.Mutex
+	var firstErr error
+
+	var wg sync.WaitGroup
+	for range min(w.server.config.WalkConcurrency, len(level)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() {
+				i := int(next.Add(1) - 1)
+				if i >= len(level) {
+					return
+				}
+				listing, err := w.list(level[i])
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					stop.Store(true)
+					return
+				}
+				listings[i] = listing
+			}
+		}()
+	}
+	wg.Wait()
+
+	return listings, firstErr
+}
+
+// list reads one directory. Only errors that abort the walk are returned:
+// an unavailable root or a done ctx.
+func (w *treeWalker) list(job walkJob) (walkListing, error) {
+	var listing walkListing
+	entries, err := w.server.guard.ReadDir(job.path)
+	if err != nil {
+		// Abort the walk if the root stopped responding
+		var unavailable *UnavailableError
+		if errors.As(err, &unavailable) {
+			return listing, err
+		}
+		return listing, nil // Skip directories that cause errors
+	}
+
+	expand := w.maxDepth <= 0 || job.depth+1 < w.maxDepth
+	for _, entry := range entries {
+		if err := w.ctx.Err(); err != nil {
+			return listing, err
+		}
+		// No directory can add more entries than the whole budget
+		if w.maxNodes > 0 && len(listing.children) >= w.maxNodes {
+			break
+		}
+		childPath := filepath.Join(job.path, entry.Name())
+
+		// Skip if should be ignored
+		if w.filter.ShouldIgnore(childPath) {
+			continue
+		}
+
+		child, err := w.newNode(childPath)
+		if err != nil {
+			var unavailable *UnavailableError
+			if errors.As(err, &unavailable) {
+				return listing, err
+			}
+			continue // Skip entries that cause errors
+		}
+		realPath := ""
+		if child.Type == "directory" && expand {
+			realPath = w.realPath(childPath)
+		}
+		listing.children = append(listing.children, child)
+		listing.paths = append(listing.paths, childPath)
+		listing.realPaths = append(listing.realPaths, realPath)
+	}
+	return listing, nil
+}
+
+// add adds the listings of a level to the tree in order, within the node
+// budget, and returns the next level. Directories already reached through
+// another path are listed but not expanded again, which breaks symlink cycles.
+func (w *treeWalker) add(level []walkJob, listings []walkListing) []walkJob {
+	var next []walkJob
+	for i, job := range level {
+		listing := listings[i]
+		for j, child := range listing.children {
+			if w.maxNodes > 0 && w.nodes >= w.maxNodes {
+				w.truncated = true
+				return nil
+			}
+			w.nodes++
+			job.node.Children = append(job.node.Children, child)
+
+			if realPath := listing.realPaths[j]; realPath != "" && !w.visited[realPath] {
+				w.visited[realPath] = true
+				next = append(next, walkJob{node: child, path: listing.paths[j], depth: job.depth + 1})
+			}
+		}
+	}
+	return next
+}
+
+// realPath resolves the symlinks of a directory, or returns it as is when
+// they cannot be resolved
+func (w *treeWalker) realPath(path string) string {
+	realPath, err := w.server.guard.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+	return realPath
+}
+
+// newNode stats a path and creates its node without children
+func (w *treeWalker) newNode(path string) (*FileNode, error) {
+	s := w.server
+
+	stat, err := s.guard.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	relPath, _ := filepath.Rel(s.config.BasePath, path)
+	if relPath == "." {
+		relPath = ""
+	}
+
+	node := &FileNode{
+		Name:    filepath.Base(path),
+		Path:    relPath,
+		modTime: stat.ModTime(),
+	}
+
+	if stat.IsDir() {
+		node.Type = "directory"
+	} else {
+		node.Type = "file"
+		size := stat.Size()
+		node.Size = &size
+		node.Tags = fileTags(s.config.Tags, filepath.ToSlash(relPath))
+	}
+
+	return node, nil
+}
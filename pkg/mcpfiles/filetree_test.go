@@ -0,0 +1,53 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileTreeIsTheSameOnEveryWalk(t *testing.T) {
+	files := map[string]string{}
+	for _, dir := range []string{"a", "b", "c"} {
+		for _, name := range []string{"1", "2", "3", "4", "5"} {
+			files[dir+"/"+name+".txt"] = name
+		}
+	}
+	s := newTestServer(t, &Config{MaxTreeNodes: 9, WalkConcurrency: 8}, files)
+	if err := os.Symlink("a", filepath.Join(s.config.BasePath, "z")); err != nil {
+		t.Fatal(err)
+	}
+
+	var first []byte
+	for i := 0; i < 20; i++ {
+		root, truncated, err := s.buildFileTreeWithFilter(context.Background(), s.config.BasePath, 0, s.pathFilter())
+		if err != nil || !truncated {
+			t.Fatalf("buildFileTreeWithFilter = %v, %v; want a truncated tree", truncated, err)
+		}
+		got, _ := json.Marshal(root)
+		if i == 0 {
+			first = got
+			continue
+		}
+		if string(got) != string(first) {
+			t.Fatalf("walk %d = %s, want %s", i, got, first)
+		}
+	}
+
+	// The budget goes breadth-first, and a is expanded rather than its alias z
+	want := map[string]int{"a": 4, "b": 0, "c": 0, "z": 0}
+	var root FileNode
+	if err := json.Unmarshal(first, &root); err != nil {
+		t.Fatal(err)
+	}
+	if len(root.Children) != len(want) {
+		t.Fatalf("root has %d children, want %d: %s", len(root.Children), len(want), first)
+	}
+	for _, child := range root.Children {
+		if len(child.Children) != want[child.Name] {
+			t.Errorf("%s has %d children, want %d", child.Name, len(child.Children), want[child.Name])
+		}
+	}
+}
@@ -0,0 +1,415 @@
+package mcpfiles
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// filterEntry is what a filter expression sees of a file
+type filterEntry struct {
+	relPath string // slash-separated, relative to the base path
+	size    int64
+	modTime time.Time
+	tags    []string
+}
+
+// fileFilter is a parsed filter expression such as
+// `ext:go AND NOT path:vendor AND size<100kb AND modified>7d`
+type fileFilter interface {
+	match(e filterEntry) bool
+}
+
+type andFilter []fileFilter
+
+func (f andFilter) match(e filterEntry) bool {
+	for _, sub := range f {
+		if !sub.match(e) {
+			return false
+		}
+	}
+	return true
+}
+
+type orFilter []fileFilter
+
+func (f orFilter) match(e filterEntry) bool {
+	for _, sub := range f {
+		if sub.match(e) {
+			return true
+		}
+	}
+	return false
+}
+
+type notFilter struct{ inner fileFilter }
+
+func (f notFilter) match(e filterEntry) bool { return !f.inner.match(e) }
+
+// termFilter is a single field comparison
+type termFilter func(e filterEntry) bool
+
+func (f termFilter) match(e filterEntry) bool { return f(e) }
+
+// filterToken is a parenthesis or word of a filter, at a character offset
+type filterToken struct {
+	text string
+	pos  int
+}
+
+// tokenizeFilter splits a filter into parentheses and words. Double quotes
+// let a word hold spaces and parentheses.
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	var word strings.Builder
+	start, quoted := -1, false
+	flush := func() {
+		if start >= 0 {
+			tokens = append(tokens, filterToken{text: word.String(), pos: start})
+			word.Reset()
+			start = -1
+		}
+	}
+
+	pos := 0
+	for _, r := range expr {
+		switch {
+		case r == '"':
+			if start < 0 {
+				start = pos
+			}
+			quoted = !quoted
+			word.WriteRune(r)
+		case quoted:
+			word.WriteRune(r)
+		case unicode.IsSpace(r):
+			flush()
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, filterToken{text: string(r), pos: pos})
+		default:
+			if start < 0 {
+				start = pos
+			}
+			word.WriteRune(r)
+		}
+		pos++
+	}
+	if quoted {
+		return nil, fmt.Errorf("at position %d: unterminated quote", start)
+	}
+	flush()
+	return tokens, nil
+}
+
+// filterParser parses a filter by recursive descent. NOT binds tightest,
+// then AND (also implied between adjacent terms), then OR.
+type filterParser struct {
+	tokens []filterToken
+	next   int
+	length int // characters in the filter, for errors at the end
+	tags   map[string][]string
+	now    time.Time
+}
+
+// parseFilter parses a filter expression. Tags are checked against the
+// configured tag rules, and relative times are resolved against now.
+func parseFilter(expr string, tags map[string][]string, now time.Time) (fileFilter, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens, length: utf8.RuneCountInString(expr), tags: tags, now: now}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("filter is empty")
+	}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok, ok := p.peek(); ok {
+		return nil, fmt.Errorf("at position %d: unexpected %q", tok.pos, tok.text)
+	}
+	return f, nil
+}
+
+func (p *filterParser) peek() (filterToken, bool) {
+	if p.next >= len(p.tokens) {
+		return filterToken{}, false
+	}
+	return p.tokens[p.next], true
+}
+
+// keyword reports whether the next token is the given operator
+func (p *filterParser) keyword(word string) bool {
+	tok, ok := p.peek()
+	return ok && strings.EqualFold(tok.text, word)
+}
+
+func (p *filterParser) parseOr() (fileFilter, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	terms := orFilter{first}
+	for p.keyword("OR") {
+		p.next++
+		term, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) == 1 {
+		return first, nil
+	}
+	return terms, nil
+}
+
+func (p *filterParser) parseAnd() (fileFilter, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	terms := andFilter{first}
+	for {
+		if p.keyword("AND") {
+			p.next++
+		} else if tok, ok := p.peek(); !ok || tok.text == ")" || p.keyword("OR") {
+			break
+		}
+		term, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) == 1 {
+		return first, nil
+	}
+	return terms, nil
+}
+
+func (p *filterParser) parseUnary() (fileFilter, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("at position %d: expected a term", p.length)
+	}
+	switch {
+	case strings.EqualFold(tok.text, "NOT"):
+		p.next++
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notFilter{inner}, nil
+	case tok.text == "(":
+		p.next++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing, ok := p.peek(); !ok || closing.text != ")" {
+			return nil, fmt.Errorf("at position %d: missing ) for ( at position %d", p.position(), tok.pos)
+		}
+		p.next++
+		return inner, nil
+	case tok.text == ")" || strings.EqualFold(tok.text, "AND") || strings.EqualFold(tok.text, "OR"):
+		return nil, fmt.Errorf("at position %d: expected a term, found %q", tok.pos, tok.text)
+	}
+	p.next++
+	term, err := p.parseTerm(tok.text)
+	if err != nil {
+		return nil, fmt.Errorf("at position %d: %w", tok.pos, err)
+	}
+	return term, nil
+}
+
+// position returns the offset of the next token, or the end of the filter
+func (p *filterParser) position() int {
+	if tok, ok := p.peek(); ok {
+		return tok.pos
+	}
+	return p.length
+}
+
+// parseTerm parses a field comparison such as ext:go, size<100kb or modified>7d
+func (p *filterParser) parseTerm(word string) (fileFilter, error) {
+	i := strings.IndexFunc(word, isFilterOperator)
+	if i <= 0 {
+		return nil, fmt.Errorf("expected field:value or a comparison, found %q", word)
+	}
+	field, rest := strings.ToLower(word[:i]), word[i:]
+	op := ""
+	for _, candidate := range []string{"<=", ">=", ":", "<", ">", "="} {
+		if strings.HasPrefix(rest, candidate) {
+			op = candidate
+			break
+		}
+	}
+	value := strings.Trim(rest[len(op):], `"`)
+	if value == "" {
+		return nil, fmt.Errorf("%s has no value", field)
+	}
+
+	switch field {
+	case "ext", "name", "path", "tag":
+		if op != ":" {
+			return nil, fmt.Errorf("%s takes field:value, not %q", field, op)
+		}
+		return p.matchTerm(field, value)
+	case "size":
+		if op == ":" {
+			op = "="
+		}
+		size, err := parseFilterSize(value)
+		if err != nil {
+			return nil, err
+		}
+		return termFilter(func(e filterEntry) bool { return compareFilter(op, e.size, size) }), nil
+	case "modified":
+		if op != "<" && op != ">" {
+			return nil, fmt.Errorf("modified takes < or >, not %q", op)
+		}
+		t, err := parseFilterTime(value, p.now)
+		if err != nil {
+			return nil, err
+		}
+		// modified>7d means more recently than seven days ago
+		if op == ">" {
+			return termFilter(func(e filterEntry) bool { return e.modTime.After(t) }), nil
+		}
+		return termFilter(func(e filterEntry) bool { return e.modTime.Before(t) }), nil
+	}
+	return nil, fmt.Errorf("unknown field %q (use ext, name, path, tag, size or modified)", field)
+}
+
+// matchTerm builds the filters for fields compared by name
+func (p *filterParser) matchTerm(field, value string) (fileFilter, error) {
+	switch field {
+	case "ext":
+		ext := "." + strings.ToLower(strings.TrimPrefix(value, "."))
+		return termFilter(func(e filterEntry) bool { return strings.ToLower(path.Ext(e.relPath)) == ext }), nil
+	case "tag":
+		if _, ok := p.tags[value]; !ok {
+			return nil, fmt.Errorf("unknown tag %q", value)
+		}
+		return termFilter(func(e filterEntry) bool {
+			for _, tag := range e.tags {
+				if tag == value {
+					return true
+				}
+			}
+			return false
+		}), nil
+	}
+
+	if _, err := path.Match(value, ""); err != nil {
+		return nil, fmt.Errorf("invalid %s pattern %q: %v", field, value, err)
+	}
+	if field == "name" {
+		return termFilter(func(e filterEntry) bool {
+			ok, _ := path.Match(value, path.Base(e.relPath))
+			return ok
+		}), nil
+	}
+	// A path pattern matches any run of consecutive path segments, so
+	// path:vendor covers every file under a vendor directory
+	return termFilter(func(e filterEntry) bool {
+		segments := strings.Split(e.relPath, "/")
+		for i := range segments {
+			for j := i + 1; j <= len(segments); j++ {
+				if ok, _ := path.Match(value, strings.Join(segments[i:j], "/")); ok {
+					return true
+				}
+			}
+		}
+		return false
+	}), nil
+}
+
+// isFilterOperator reports whether r starts the operator of a term
+func isFilterOperator(r rune) bool {
+	return r == ':' || r == '<' || r == '>' || r == '='
+}
+
+// compareFilter applies a comparison operator
+func compareFilter(op string, a, b int64) bool {
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return a == b
+}
+
+// filterSizeUnits are the size suffixes a filter accepts, in powers of 1024
+var filterSizeUnits = []struct {
+	suffix string
+	scale  int64
+}{
+	{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30}, {"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30}, {"b", 1},
+}
+
+// parseFilterSize parses a size such as 512, 100kb or 1.5mb
+func parseFilterSize(value string) (int64, error) {
+	number, scale := strings.ToLower(value), int64(1)
+	for _, unit := range filterSizeUnits {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, scale = strings.TrimSuffix(number, unit.suffix), unit.scale
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (use bytes or a kb, mb or gb suffix)", value)
+	}
+	return int64(n * float64(scale)), nil
+}
+
+// filterTimeUnits are the duration suffixes a filter accepts beyond those of
+// time.ParseDuration
+var filterTimeUnits = map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+
+// parseFilterTime accepts what parseQueryTime does, plus durations in days
+// and weeks such as 7d or 2w
+func parseFilterTime(value string, now time.Time) (time.Time, error) {
+	if n := len(value); n > 1 {
+		if unit, ok := filterTimeUnits[value[n-1]]; ok {
+			if count, err := strconv.Atoi(value[:n-1]); err == nil && count >= 0 {
+				return now.Add(-time.Duration(count) * unit), nil
+			}
+		}
+	}
+	return parseQueryTime(value, now)
+}
+
+// pruneByFilter drops files that do not match the filter, and directories
+// left without files
+func pruneByFilter(node *FileNode, filter fileFilter) bool {
+	if node.Type != "directory" {
+		entry := filterEntry{relPath: filepath.ToSlash(node.Path), modTime: node.modTime, tags: node.Tags}
+		if node.Size != nil {
+			entry.size = *node.Size
+		}
+		return filter.match(entry)
+	}
+	kept := node.Children[:0]
+	for _, child := range node.Children {
+		if pruneByFilter(child, filter) {
+			kept = append(kept, child)
+		}
+	}
+	node.Children = kept
+	return len(kept) > 0
+}
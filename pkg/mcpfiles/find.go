@@ -0,0 +1,339 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// FoundFile is one file returned by find_files
+type FoundFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// parseGlobs splits a comma-separated list of glob patterns and checks them
+func parseGlobs(list string) ([]string, error) {
+	var globs []string
+	for _, glob := range strings.Split(list, ",") {
+		if glob = strings.Trim(strings.TrimSpace(glob), "/"); glob == "" {
+			continue
+		}
+		for _, segment := range strings.Split(glob, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", glob, err)
+			}
+		}
+		globs = append(globs, glob)
+	}
+	if len(globs) == 0 {
+		return nil, fmt.Errorf("at least one pattern is required")
+	}
+	return globs, nil
+}
+
+// matchGlob matches a slash-separated path against a glob pattern, in which
+// ** stands for any number of directories. Patterns without a slash match
+// the file name at any depth.
+func matchGlob(glob, relPath string) bool {
+	if !strings.Contains(glob, "/") {
+		ok, _ := path.Match(glob, path.Base(relPath))
+		return ok
+	}
+	return matchSegments(strings.Split(glob, "/"), strings.Split(relPath, "/"))
+}
+
+// matchSegments matches path segments against pattern segments
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Try every number of directories for **, fewest first
+			for skip := 0; skip <= len(segments); skip++ {
+				if matchSegments(pattern[1:], segments[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// collectFiles appends the files of a tree that match one of the globs,
+// stopping at limit, and reports whether it stopped early
+func collectFiles(node *FileNode, globs []string, limit int, found *[]FoundFile) bool {
+	if node.Type != "directory" {
+		relPath := filepath.ToSlash(node.Path)
+		for _, glob := range globs {
+			if matchGlob(glob, relPath) {
+				if len(*found) == limit {
+					return true
+				}
+				file := FoundFile{Path: relPath}
+				if node.Size != nil {
+					file.Size = *node.Size
+				}
+				*found = append(*found, file)
+				break
+			}
+		}
+		return false
+	}
+	for _, child := range node.Children {
+		if collectFiles(child, globs, limit, found) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleFindFiles handles the find_files tool
+func (s *Server) handleFindFiles(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	patterns, err := request.RequireString("patterns")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	globs, err := parseGlobs(patterns)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid patterns: %v", err)), nil
+	}
+	maxResults := request.GetInt("max_results", 1000)
+	if maxResults <= 0 {
+		return mcp.NewToolResultError("max_results must be positive"), nil
+	}
+	view, _, err := s.requestView(request)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid view: %v", err)), nil
+	}
+
+	root, truncated, err := s.buildFileTreeWithFilter(ctx, s.config.BasePath, s.config.MaxTreeDepth, s.pathFilter())
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read file structure: %v", err)), nil
+	}
+	files := []FoundFile{}
+	if root != nil {
+		if view != nil {
+			pruneByFilter(root, view)
+		}
+		if collectFiles(root, globs, maxResults, &files) {
+			truncated = true
+		}
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"patterns":  globs,
+		"files":     files,
+		"count":     len(files),
+		"truncated": truncated,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// Fuzzy match scores, after fzf: every matched character scores, characters
+// at word boundaries and runs of consecutive characters score extra, and gaps
+// between matched characters cost
+const (
+	fuzzyMatch       = 16
+	fuzzyGapStart    = -3
+	fuzzyGapExtend   = -1
+	fuzzyConsecutive = 4
+	fuzzyAfterSlash  = 10 // first character of a path segment
+	fuzzyAfterSep    = 8  // after _, -, . or a space
+	fuzzyCamelCase   = 7  // upper case after lower case
+	fuzzyInBaseName  = 2  // anywhere in the file name
+)
+
+// FuzzyMatch is one file ranked by fuzzy_find
+type FuzzyMatch struct {
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	Score int    `json:"score"`
+}
+
+// fuzzyScore scores how well query matches text as a subsequence, or returns
+// false if it does not. Matching ignores case unless query has upper case.
+func fuzzyScore(query, text string) (int, bool) {
+	q, t := []rune(query), []rune(text)
+	if !strings.ContainsFunc(query, unicode.IsUpper) {
+		q, t = []rune(strings.ToLower(query)), []rune(strings.ToLower(text))
+	}
+	if len(q) == 0 || len(q) > len(t) || !isSubsequence(q, t) {
+		return 0, false
+	}
+
+	// Bonus of matching each character of text, judged on the original case
+	original := []rune(text)
+	baseStart := strings.LastIndexByte(text, '/') + 1
+	baseStart = len([]rune(text[:baseStart]))
+	bonus := make([]int, len(t))
+	for j, r := range original {
+		prev := '/'
+		if j > 0 {
+			prev = original[j-1]
+		}
+		switch {
+		case prev == '/':
+			bonus[j] = fuzzyAfterSlash
+		case prev == '_' || prev == '-' || prev == '.' || prev == ' ':
+			bonus[j] = fuzzyAfterSep
+		case unicode.IsLower(prev) && unicode.IsUpper(r):
+			bonus[j] = fuzzyCamelCase
+		}
+		if j >= baseStart {
+			bonus[j] += fuzzyInBaseName
+		}
+	}
+
+	// best[j] is the best score of the query so far with its last character
+	// matched at text[j]; gaps are carried along in gapped
+	const none = math.MinInt / 2
+	best := make([]int, len(t))
+	next := make([]int, len(t))
+	for j := range t {
+		best[j] = none
+		if t[j] == q[0] {
+			best[j] = fuzzyMatch + 2*bonus[j]
+		}
+	}
+	for i := 1; i < len(q); i++ {
+		gapped := none
+		for j := range t {
+			next[j] = none
+			if j >= 2 {
+				gapped = max(gapped+fuzzyGapExtend, best[j-2]+fuzzyGapStart)
+			}
+			if t[j] != q[i] || j == 0 {
+				continue
+			}
+			from := max(gapped, best[j-1]+fuzzyConsecutive)
+			if from > none {
+				next[j] = from + fuzzyMatch + bonus[j]
+			}
+		}
+		best, next = next, best
+	}
+
+	score := none
+	for _, s := range best {
+		score = max(score, s)
+	}
+	return score, score > none
+}
+
+// isSubsequence reports whether q occurs in t in order
+func isSubsequence(q, t []rune) bool {
+	i := 0
+	for _, r := range t {
+		if i < len(q) && r == q[i] {
+			i++
+		}
+	}
+	return i == len(q)
+}
+
+// collectFuzzy scores the files of a tree against a query
+func collectFuzzy(node *FileNode, query string, matches *[]FuzzyMatch) {
+	if node.Type != "directory" {
+		relPath := filepath.ToSlash(node.Path)
+		if score, ok := fuzzyScore(query, relPath); ok {
+			match := FuzzyMatch{Path: relPath, Score: score}
+			if node.Size != nil {
+				match.Size = *node.Size
+			}
+			*matches = append(*matches, match)
+		}
+		return
+	}
+	for _, child := range node.Children {
+		collectFuzzy(child, query, matches)
+	}
+}
+
+// handleFuzzyFind handles the fuzzy_find tool
+func (s *Server) handleFuzzyFind(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, err := request.RequireString("query")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	// Spaces separate words in the query, not characters to match
+	query = strings.Join(strings.Fields(query), "")
+	if query == "" {
+		return mcp.NewToolResultError("query must not be empty"), nil
+	}
+	maxResults := request.GetInt("max_results", 20)
+	if maxResults <= 0 {
+		return mcp.NewToolResultError("max_results must be positive"), nil
+	}
+	view, _, err := s.requestView(request)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid view: %v", err)), nil
+	}
+
+	root, truncated, err := s.buildFileTreeWithFilter(ctx, s.config.BasePath, s.config.MaxTreeDepth, s.pathFilter())
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read file structure: %v", err)), nil
+	}
+	matches := []FuzzyMatch{}
+	if root != nil {
+		if view != nil {
+			pruneByFilter(root, view)
+		}
+		collectFuzzy(root, query, &matches)
+	}
+
+	// Best first; shorter paths win ties
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if len(a.Path) != len(b.Path) {
+			return len(a.Path) < len(b.Path)
+		}
+		return a.Path < b.Path
+	})
+	total := len(matches)
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"query":     query,
+		"matches":   matches[:min(maxResults, total)],
+		"total":     total,
+		"truncated": truncated,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
@@ -0,0 +1,11 @@
+//go:build go1.24
+
+package mcpfiles
+
+import "crypto/fips140"
+
+// fipsMode reports whether the Go cryptographic module runs in FIPS 140
+// mode, as with GODEBUG=fips140=on or a binary built with GOFIPS140
+func fipsMode() bool {
+	return fips140.Enabled()
+}
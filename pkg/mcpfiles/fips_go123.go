@@ -0,0 +1,9 @@
+//go:build !go1.24
+
+package mcpfiles
+
+// fipsMode reports whether the Go cryptographic module runs in FIPS 140
+// mode, which toolchains before Go 1.24 do not have
+func fipsMode() bool {
+	return false
+}
@@ -0,0 +1,579 @@
+package mcpfiles
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	// breakerThreshold is the number of consecutive timeouts that open the circuit
+	breakerThreshold = 3
+	// breakerCooldown is how long an open circuit rejects operations before allowing a probe
+	breakerCooldown = 30 * time.Second
+)
+
+// UnavailableError is returned when a filesystem root does not respond in time
+// or its circuit breaker is open
+type UnavailableError struct {
+	Root string
+	Op   string
+	Path string
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("filesystem root %s is unavailable (%s %s)", e.Root, e.Op, e.Path)
+}
+
+// RootGuard protects filesystem operations on a single root with deadlines
+// and a circuit breaker, so a hung network mount cannot block handlers forever
+type RootGuard struct {
+	root    string
+	fs      FileSystem
+	timeout time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// NewRootGuard creates a guard for the given root backed by fsys
+func NewRootGuard(root string, fsys FileSystem, timeout time.Duration) *RootGuard {
+	return &RootGuard{
+		root:    root,
+		fs:      fsys,
+		timeout: timeout,
+	}
+}
+
+// Healthy reports whether the circuit breaker is closed
+func (g *RootGuard) Healthy() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.failures < breakerThreshold
+}
+
+// allow reports whether an operation may run. Once the cooldown has expired an
+// open circuit lets operations through again to probe the root.
+func (g *RootGuard) allow() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.failures < breakerThreshold || time.Now().After(g.openUntil)
+}
+
+func (g *RootGuard) recordSuccess() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.failures = 0
+}
+
+func (g *RootGuard) recordTimeout() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.failures++
+	if g.failures >= breakerThreshold {
+		g.openUntil = time.Now().Add(breakerCooldown)
+	}
+}
+
+// Check returns an UnavailableError if the circuit is open
+func (g *RootGuard) Check(op, path string) error {
+	if !g.allow() {
+		return &UnavailableError{Root: g.root, Op: op, Path: path}
+	}
+	return nil
+}
+
+// guardFS runs fn with the guard's deadline. Regular filesystem errors such as
+// ENOENT are returned unchanged and count as a healthy response; only timeouts
+// trip the breaker. A timed-out call keeps running in the background because
+// blocking syscalls cannot be interrupted.
+func guardFS[T any](g *RootGuard, op, path string, fn func() (T, error)) (T, error) {
+	var zero T
+	if err := g.Check(op, path); err != nil {
+		return zero, err
+	}
+
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := fn()
+		done <- result{value, err}
+	}()
+
+	timer := time.NewTimer(g.timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-done:
+		g.recordSuccess()
+		return r.value, r.err
+	case <-timer.C:
+		g.recordTimeout()
+		return zero, &UnavailableError{Root: g.root, Op: op, Path: path}
+	}
+}
+
+// Stat is FileSystem.Stat with the guard's deadline
+func (g *RootGuard) Stat(path string) (os.FileInfo, error) {
+	return guardFS(g, "stat", path, func() (os.FileInfo, error) {
+		return g.fs.Stat(path)
+	})
+}
+
+// Lstat is FileSystem.Lstat with the guard's deadline
+func (g *RootGuard) Lstat(path string) (os.FileInfo, error) {
+	return guardFS(g, "stat", path, func() (os.FileInfo, error) {
+		return g.fs.Lstat(path)
+	})
+}
+
+// ReadDir is FileSystem.ReadDir with the guard's deadline
+func (g *RootGuard) ReadDir(path string) ([]fs.DirEntry, error) {
+	return guardFS(g, "readdir", path, func() ([]fs.DirEntry, error) {
+		return g.fs.ReadDir(path)
+	})
+}
+
+// ReadFile is FileSystem.ReadFile with the guard's deadline
+func (g *RootGuard) ReadFile(path string) ([]byte, error) {
+	return guardFS(g, "read", path, func() ([]byte, error) {
+		return g.fs.ReadFile(path)
+	})
+}
+
+// EvalSymlinks is filepath.EvalSymlinks with the guard's deadline
+func (g *RootGuard) EvalSymlinks(path string) (string, error) {
+	return guardFS(g, "stat", path, func() (string, error) {
+		return filepath.EvalSymlinks(path)
+	})
+}
+
+// WalkDir walks the tree at root like filepath.WalkDir, reading directories
+// through the backend with the guard's deadline. A root that stops
+// responding ends the walk with its UnavailableError, whatever fn does with
+// errors, and so does ctx once it is done.
+func (g *RootGuard) WalkDir(ctx context.Context, root string, fn fs.WalkDirFunc) error {
+	info, err := g.Lstat(root)
+	if err != nil {
+		if unavailableResult(err) != nil {
+			return err
+		}
+		err = fn(root, nil, err)
+	} else {
+		err = g.walkDir(ctx, root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkDir walks one directory of WalkDir
+func (g *RootGuard) walkDir(ctx context.Context, path string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	entries, err := g.ReadDir(path)
+	if err != nil {
+		if unavailableResult(err) != nil {
+			return err
+		}
+		if err = fn(path, d, err); err != nil {
+			if err == filepath.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+	for _, entry := range entries {
+		if err := g.walkDir(ctx, filepath.Join(path, entry.Name()), entry, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadLines reads a line range of a file, streaming it when the backend is a
+// FileOpener and failing with errors.ErrUnsupported otherwise. Each read of
+// the stream has the guard's deadline, and the read stops with ctx's error
+// once ctx is done.
+func (g *RootGuard) ReadLines(ctx context.Context, path string, start, end int, maxBytes int64) (lineRange, error) {
+	return g.streamLines(ctx, path, func(r io.Reader) (lineRange, error) {
+		return readLines(r, start, end, maxBytes)
+	})
+}
+
+// ReadTail reads the last n lines of a file like ReadLines
+func (g *RootGuard) ReadTail(ctx context.Context, path string, n int, maxBytes int64) (lineRange, error) {
+	return g.streamLines(ctx, path, func(r io.Reader) (lineRange, error) {
+		return readTail(r, n, maxBytes)
+	})
+}
+
+// streamLines opens a file from a FileOpener backend and reads lines from it
+func (g *RootGuard) streamLines(ctx context.Context, path string, read func(io.Reader) (lineRange, error)) (lineRange, error) {
+	f, err := g.openStream(ctx, path)
+	if err != nil {
+		return lineRange{}, err
+	}
+	defer f.Close()
+	return read(contextReader{ctx, f})
+}
+
+// contextReader fails reads with its context's error once the context is
+// done, so long scans stop when their caller goes away
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// Hash computes the hash of a file, streaming it when the backend is a
+// FileOpener and reading it whole with the guard's deadline otherwise
+func (g *RootGuard) Hash(ctx context.Context, path string, newHash func() hash.Hash) (string, error) {
+	h := newHash()
+	f, err := g.openStream(ctx, path)
+	if errors.Is(err, errors.ErrUnsupported) {
+		data, err := g.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		h.Write(data)
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, contextReader{ctx, f}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Fingerprint returns a quick identity for a file of the given size: the
+// hash of its first and last fingerprintSampleSize bytes. Files that fit in
+// the two samples are hashed in full, so their fingerprint is their hash.
+// Files with different fingerprints differ; equal fingerprints must be
+// confirmed with Hash.
+func (g *RootGuard) Fingerprint(ctx context.Context, path string, size int64, newHash func() hash.Hash) (string, error) {
+	if size <= 2*fingerprintSampleSize {
+		return g.Hash(ctx, path, newHash)
+	}
+	h := newHash()
+	for _, offset := range []int64{0, size - fingerprintSampleSize} {
+		data, err := g.ReadAt(ctx, path, offset, fingerprintSampleSize)
+		if err != nil {
+			return "", err
+		}
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ReadAt reads up to n bytes of a file from offset, reading at the offset
+// where the backend's files can and reading the file whole with the guard's
+// deadline when the backend cannot open files
+func (g *RootGuard) ReadAt(ctx context.Context, path string, offset, n int64) ([]byte, error) {
+	f, err := g.openStream(ctx, path)
+	if errors.Is(err, errors.ErrUnsupported) {
+		data, err := g.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if offset >= int64(len(data)) {
+			return nil, nil
+		}
+		return data[offset:min(offset+n, int64(len(data)))], nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if at, ok := f.(io.ReaderAt); ok {
+		buf := make([]byte, n)
+		read, err := at.ReadAt(buf, offset)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		return buf[:read], nil
+	}
+	r := contextReader{ctx, f}
+	if _, err := io.CopyN(io.Discard, r, offset); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return io.ReadAll(io.LimitReader(r, n))
+}
+
+// ReadWith calls read with a file and its size. read gets the open file when
+// the backend can open files, which is an io.ReaderAt where the backend's
+// files are, and the content read whole with the guard's deadline otherwise.
+// Reads of the open file stop with ctx's error once ctx is done.
+func (g *RootGuard) ReadWith(ctx context.Context, path string, read func(r io.Reader, size int64) error) error {
+	f, err := g.openStream(ctx, path)
+	if errors.Is(err, errors.ErrUnsupported) {
+		data, err := g.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return read(bytes.NewReader(data), int64(len(data)))
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := g.Stat(path)
+	if err != nil {
+		return err
+	}
+	return read(f, stat.Size())
+}
+
+// open opens a file of a FileOpener backend, failing with
+// errors.ErrUnsupported when the backend cannot
+func (g *RootGuard) open(path string) (io.ReadCloser, error) {
+	opener, ok := g.fs.(FileOpener)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	return opener.Open(path)
+}
+
+// openStream opens a file with the guard's deadline for reads that each get
+// the deadline of their own, as a guardedFile
+func (g *RootGuard) openStream(ctx context.Context, path string) (io.ReadCloser, error) {
+	f, err := guardFS(g, "read", path, func() (io.ReadCloser, error) {
+		return g.open(path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	gf := &guardedFile{g: g, ctx: ctx, path: path, f: f, chunks: make(chan streamChunk), stop: make(chan struct{})}
+	if at, ok := f.(io.ReaderAt); ok {
+		return &guardedReaderAt{gf, at}, nil
+	}
+	return gf, nil
+}
+
+// streamChunkSize is how much one read of a guarded stream asks for
+const streamChunkSize = 64 << 10
+
+// streamChunk is the outcome of one read of a guarded stream
+type streamChunk struct {
+	data []byte
+	err  error
+}
+
+// guardedFile puts the guard's deadline on each read of a file rather than
+// on the whole stream, so hashing or scanning a large file on a slow but
+// healthy disk is not taken for a hung root. Timeouts fail the stream
+// without counting toward the breaker, which only the calls that open and
+// stat files trip. A goroutine of the file's own reads ahead one chunk at a
+// time and stops at its next read once the file is closed, so a stream
+// that timed out or was cancelled does not go on reading in the background.
+type guardedFile struct {
+	g    *RootGuard
+	ctx  context.Context
+	path string
+	f    io.ReadCloser
+
+	started bool
+	chunks  chan streamChunk
+	stop    chan struct{}
+	closed  bool
+	pending []byte
+	err     error
+}
+
+func (gf *guardedFile) Read(p []byte) (int, error) {
+	for len(gf.pending) == 0 && gf.err == nil {
+		if !gf.started {
+			gf.started = true
+			go gf.readAhead()
+		}
+		timer := time.NewTimer(gf.g.timeout)
+		select {
+		case chunk := <-gf.chunks:
+			gf.pending, gf.err = chunk.data, chunk.err
+		case <-timer.C:
+			gf.err = &UnavailableError{Root: gf.g.root, Op: "read", Path: gf.path}
+		case <-gf.ctx.Done():
+			gf.err = gf.ctx.Err()
+		}
+		timer.Stop()
+	}
+	n := copy(p, gf.pending)
+	gf.pending = gf.pending[n:]
+	if n > 0 {
+		return n, nil
+	}
+	return 0, gf.err
+}
+
+// readAhead reads the file for Read until an error or Close, and then
+// closes it
+func (gf *guardedFile) readAhead() {
+	defer gf.f.Close()
+	for {
+		buf := make([]byte, streamChunkSize)
+		n, err := gf.f.Read(buf)
+		select {
+		case gf.chunks <- streamChunk{buf[:n], err}:
+		case <-gf.stop:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Close stops the stream. The file is closed once a read in progress returns.
+func (gf *guardedFile) Close() error {
+	if gf.closed {
+		return nil
+	}
+	gf.closed = true
+	close(gf.stop)
+	if !gf.started {
+		return gf.f.Close()
+	}
+	return nil
+}
+
+// guardedReaderAt is a guardedFile whose file can be read at an offset, as
+// zip archives are. Each ReadAt has the guard's deadline.
+type guardedReaderAt struct {
+	*guardedFile
+	at io.ReaderAt
+}
+
+func (gr *guardedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if err := gr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	// The read fills a buffer of its own, which a read that timed out may go
+	// on filling after p was handed back
+	done := make(chan streamChunk, 1)
+	go func() {
+		buf := make([]byte, len(p))
+		n, err := gr.at.ReadAt(buf, off)
+		done <- streamChunk{buf[:n], err}
+	}()
+	timer := time.NewTimer(gr.g.timeout)
+	defer timer.Stop()
+	select {
+	case chunk := <-done:
+		return copy(p, chunk.data), chunk.err
+	case <-timer.C:
+		return 0, &UnavailableError{Root: gr.g.root, Op: "read", Path: gr.path}
+	case <-gr.ctx.Done():
+		return 0, gr.ctx.Err()
+	}
+}
+
+// WriteFile is FileSystem.WriteFile with the guard's deadline
+func (g *RootGuard) WriteFile(path string, data []byte, perm fs.FileMode) error {
+	_, err := guardFS(g, "write", path, func() (struct{}, error) {
+		return struct{}{}, g.fs.WriteFile(path, data, perm)
+	})
+	return err
+}
+
+// MkdirAll is FileSystem.MkdirAll with the guard's deadline
+func (g *RootGuard) MkdirAll(path string, perm fs.FileMode) error {
+	_, err := guardFS(g, "mkdir", path, func() (struct{}, error) {
+		return struct{}{}, g.fs.MkdirAll(path, perm)
+	})
+	return err
+}
+
+// Remove is FileSystem.Remove with the guard's deadline
+func (g *RootGuard) Remove(path string) error {
+	_, err := guardFS(g, "delete", path, func() (struct{}, error) {
+		return struct{}{}, g.fs.Remove(path)
+	})
+	return err
+}
+
+// RemoveAll is FileSystem.RemoveAll with the guard's deadline
+func (g *RootGuard) RemoveAll(path string) error {
+	_, err := guardFS(g, "delete", path, func() (struct{}, error) {
+		return struct{}{}, g.fs.RemoveAll(path)
+	})
+	return err
+}
+
+// Rename is FileSystem.Rename with the guard's deadline
+func (g *RootGuard) Rename(oldPath, newPath string) error {
+	_, err := guardFS(g, "rename", oldPath, func() (struct{}, error) {
+		return struct{}{}, g.fs.Rename(oldPath, newPath)
+	})
+	return err
+}
+
+// unavailableResult converts an UnavailableError into a structured tool error.
+// Returns nil if err is not an UnavailableError.
+func unavailableResult(err error) *mcp.CallToolResult {
+	var unavailable *UnavailableError
+	if !errors.As(err, &unavailable) {
+		return nil
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"code":    "UNAVAILABLE",
+		"root":    unavailable.Root,
+		"op":      unavailable.Op,
+		"path":    unavailable.Path,
+		"message": unavailable.Error(),
+	})
+	return mcp.NewToolResultError(string(payload))
+}
+
+// handleReadiness reports 503 while the base path is unreachable
+func (s *Server) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	// Probe the roots so a recovered mount closes the breaker again
+	roots := s.roots
+	if len(roots) == 0 {
+		roots = []*Server{s}
+	}
+	for _, rs := range roots {
+		if _, err := rs.guard.Stat(rs.config.BasePath); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,224 @@
+package mcpfiles
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ignoreRule is one pattern line of a .gitignore file
+type ignoreRule struct {
+	segments []string // pattern split at slashes
+	negate   bool     // ! re-includes what earlier rules excluded
+	dirOnly  bool     // trailing slash: only matches directories
+	anchored bool     // contains a slash: matched from the .gitignore's directory
+}
+
+// GitignoreFilter hides what git would: paths matched by the .gitignore
+// files of the base path and its subdirectories, and by .git/info/exclude,
+// following gitignore semantics. Rules in deeper files override shallower
+// ones, later rules override earlier ones, and nothing inside an ignored
+// directory can be re-included. The same rules apply to .mcpignore files.
+type GitignoreFilter struct {
+	basePath string
+	fileName string       // name of the ignore files, such as .gitignore
+	always   string       // name of entries hidden at any depth, whatever the rules
+	extra    []ignoreRule // applied after the base directory's ignore file
+
+	mu      sync.Mutex
+	rules   map[string][]ignoreRule // by slash-separated directory, "" for the base
+	ignored map[string]bool         // decisions on directories seen so far
+}
+
+// NewGitignoreFilter creates a new gitignore filter
+func NewGitignoreFilter(basePath string) *GitignoreFilter {
+	return &GitignoreFilter{
+		basePath: basePath,
+		fileName: ".gitignore",
+		always:   ".git",
+		rules:    make(map[string][]ignoreRule),
+		ignored:  make(map[string]bool),
+	}
+}
+
+// newMCPIgnoreFilter creates a filter for the .mcpignore files under a base
+// path and the given patterns, which were checked by ValidateConfig. The
+// .mcpignore files themselves are hidden, so agents cannot change them.
+func newMCPIgnoreFilter(basePath string, patterns []string) *GitignoreFilter {
+	filter := &GitignoreFilter{
+		basePath: basePath,
+		fileName: mcpignoreFile,
+		always:   mcpignoreFile,
+		rules:    make(map[string][]ignoreRule),
+		ignored:  make(map[string]bool),
+	}
+	for _, pattern := range patterns {
+		if rule, ok := parseIgnoreRule(pattern); ok {
+			filter.extra = append(filter.extra, rule)
+		}
+	}
+	return filter
+}
+
+// ShouldIgnore checks if a file/directory should be ignored
+func (f *GitignoreFilter) ShouldIgnore(fullPath string) bool {
+	// Get relative path from base
+	relPath, err := filepath.Rel(f.basePath, fullPath)
+	if err != nil || relPath == "." || strings.HasPrefix(relPath, "..") {
+		return false
+	}
+	segments := strings.Split(filepath.ToSlash(relPath), "/")
+
+	// Always ignore .git directory, or the .mcpignore files
+	for _, segment := range segments {
+		if segment == f.always {
+			return true
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Anything in an ignored directory is ignored
+	for i := 1; i < len(segments); i++ {
+		if f.dirIgnored(segments[:i]) {
+			return true
+		}
+	}
+
+	isDir := func() bool {
+		info, err := os.Stat(fullPath)
+		return err == nil && info.IsDir()
+	}
+	return f.match(segments, isDir)
+}
+
+// dirIgnored decides on a directory once and remembers the answer
+func (f *GitignoreFilter) dirIgnored(segments []string) bool {
+	key := strings.Join(segments, "/")
+	if ignored, ok := f.ignored[key]; ok {
+		return ignored
+	}
+	ignored := f.match(segments, func() bool { return true })
+	f.ignored[key] = ignored
+	return ignored
+}
+
+// match applies the rules of every .gitignore above a path; the last rule
+// that matches decides
+func (f *GitignoreFilter) match(segments []string, isDir func() bool) bool {
+	ignored := false
+	for depth := 0; depth < len(segments); depth++ {
+		for _, rule := range f.rulesFor(strings.Join(segments[:depth], "/")) {
+			if rule.matches(segments[depth:], isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// rulesFor loads the rules of a directory's ignore file on first use. For
+// .gitignore the base directory's also include .git/info/exclude, which its
+// .gitignore overrides.
+func (f *GitignoreFilter) rulesFor(dir string) []ignoreRule {
+	if rules, ok := f.rules[dir]; ok {
+		return rules
+	}
+	fullDir := filepath.Join(f.basePath, filepath.FromSlash(dir))
+	var rules []ignoreRule
+	if dir == "" && f.fileName == ".gitignore" {
+		rules = readIgnoreFile(filepath.Join(fullDir, ".git", "info", "exclude"))
+	}
+	rules = append(rules, readIgnoreFile(filepath.Join(fullDir, f.fileName))...)
+	if dir == "" {
+		rules = append(rules, f.extra...)
+	}
+	f.rules[dir] = rules
+	return rules
+}
+
+// readIgnoreFile parses a gitignore file, returning no rules if it is missing
+func readIgnoreFile(name string) []ignoreRule {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// parseIgnoreRule parses one line of a gitignore file, reporting false for
+// blank lines, comments and invalid patterns
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+
+	// Trailing spaces are dropped unless escaped with a backslash
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	var rule ignoreRule
+	switch {
+	case strings.HasPrefix(line, "!"):
+		rule.negate = true
+		line = line[1:]
+	case strings.HasPrefix(line, "\\!"), strings.HasPrefix(line, "\\#"):
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	// A slash at the start or in the middle anchors the pattern
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	for _, segment := range strings.Split(line, "/") {
+		// gitignore negates character classes with [! as well as [^
+		segment = strings.ReplaceAll(segment, "[!", "[^")
+		if _, err := path.Match(segment, ""); err != nil {
+			return ignoreRule{}, false
+		}
+		rule.segments = append(rule.segments, segment)
+	}
+	return rule, true
+}
+
+// matches reports whether a rule matches a path relative to the directory of
+// its .gitignore
+func (r ignoreRule) matches(segments []string, isDir func() bool) bool {
+	var ok bool
+	switch last := len(r.segments) - 1; {
+	case !r.anchored:
+		// Patterns without a slash match the name at any depth
+		ok, _ = path.Match(r.segments[0], segments[len(segments)-1])
+	case r.segments[last] == "**":
+		// A trailing /** matches everything inside, but not the directory itself
+		for i := 0; i < len(segments) && !ok; i++ {
+			ok = matchSegments(r.segments[:last], segments[:i])
+		}
+	default:
+		ok = matchSegments(r.segments, segments)
+	}
+	return ok && (!r.dirOnly || isDir())
+}
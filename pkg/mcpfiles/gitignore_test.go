@@ -0,0 +1,96 @@
+package mcpfiles
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseIgnoreRule(t *testing.T) {
+	tests := []struct {
+		line string
+		want ignoreRule
+		ok   bool
+	}{
+		{"*.log", ignoreRule{segments: []string{"*.log"}}, true},
+		{"build/", ignoreRule{segments: []string{"build"}, dirOnly: true}, true},
+		{"/foo", ignoreRule{segments: []string{"foo"}, anchored: true}, true},
+		{"a/b", ignoreRule{segments: []string{"a", "b"}, anchored: true}, true},
+		{"docs/**/", ignoreRule{segments: []string{"docs", "**"}, anchored: true, dirOnly: true}, true},
+		{"!keep.log", ignoreRule{segments: []string{"keep.log"}, negate: true}, true},
+		{`\!bang`, ignoreRule{segments: []string{"!bang"}}, true},
+		{`\#hash`, ignoreRule{segments: []string{"#hash"}}, true},
+		{"[!a]b", ignoreRule{segments: []string{"[^a]b"}}, true},
+
+		// Trailing spaces and carriage returns are dropped unless escaped
+		{"tmp  ", ignoreRule{segments: []string{"tmp"}}, true},
+		{"tmp\r", ignoreRule{segments: []string{"tmp"}}, true},
+		{`tmp\ `, ignoreRule{segments: []string{`tmp\ `}}, true},
+
+		// Blank lines, comments and invalid patterns are no rules
+		{"", ignoreRule{}, false},
+		{"   ", ignoreRule{}, false},
+		{"# comment", ignoreRule{}, false},
+		{"/", ignoreRule{}, false},
+		{"!", ignoreRule{}, false},
+		{"[", ignoreRule{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseIgnoreRule(tt.line)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseIgnoreRule(%q) = %+v, %v; want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestIgnoreRuleMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		// Patterns without a slash match the name at any depth
+		{"*.log", "b.log", false, true},
+		{"*.log", "a/b.log", false, true},
+		{"*.log", "b.log/c", false, false},
+
+		// A trailing slash only matches directories
+		{"build/", "x/build", true, true},
+		{"build/", "x/build", false, false},
+
+		// A slash anchors the pattern at the .gitignore's directory
+		{"/foo", "foo", false, true},
+		{"/foo", "a/foo", false, false},
+		{"a/b", "a/b", false, true},
+		{"a/b", "x/a/b", false, false},
+		{"a/*.go", "a/main.go", false, true},
+		{"a/*.go", "a/b/main.go", false, false},
+
+		// ** stands for any number of directories
+		{"**/foo", "foo", false, true},
+		{"**/foo", "x/y/foo", false, true},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"a/**/b", "a/x/c", false, false},
+
+		// A trailing /** matches what is inside, not the directory itself
+		{"a/**", "a/x", false, true},
+		{"a/**", "a/x/y", false, true},
+		{"a/**", "a", true, false},
+
+		{"[!a]b", "cb", false, true},
+		{"[!a]b", "ab", false, false},
+		{`tmp\ `, "tmp ", false, true},
+	}
+	for _, tt := range tests {
+		rule, ok := parseIgnoreRule(tt.pattern)
+		if !ok {
+			t.Fatalf("parseIgnoreRule(%q) failed", tt.pattern)
+		}
+		isDir := func() bool { return tt.isDir }
+		if got := rule.matches(strings.Split(tt.path, "/"), isDir); got != tt.want {
+			t.Errorf("rule %q matches %q (dir %v) = %v, want %v", tt.pattern, tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
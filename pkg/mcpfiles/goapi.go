@@ -0,0 +1,347 @@
+package mcpfiles
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxAPIPackages caps the packages reported by go_api_surface
+const maxAPIPackages = 500
+
+// APIIdentifier is one exported identifier of a package
+type APIIdentifier struct {
+	Name      string `json:"name"` // methods are qualified by their type, e.g. Server.Start
+	Kind      string `json:"kind"`
+	Signature string `json:"signature"`
+}
+
+// APIPackage is the exported API of one Go package
+type APIPackage struct {
+	Path        string          `json:"path"` // import path, or directory without a go.mod
+	Name        string          `json:"name"`
+	Identifiers []APIIdentifier `json:"identifiers"`
+}
+
+// APIChange is an identifier added, removed or changed between snapshots
+type APIChange struct {
+	Package string  `json:"package"`
+	Name    string  `json:"name"`
+	Kind    string  `json:"kind"`
+	Before  *string `json:"before,omitempty"`
+	After   *string `json:"after,omitempty"`
+}
+
+// handleGoAPISurface handles the go_api_surface tool
+func (s *Server) handleGoAPISurface(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	dirPath := request.GetString("path", "")
+	snapshotJSON := request.GetString("snapshot", "")
+
+	var snapshot struct {
+		Packages []APIPackage `json:"packages"`
+	}
+	if snapshotJSON != "" {
+		if err := json.Unmarshal([]byte(snapshotJSON), &snapshot); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid snapshot (expected a previous go_api_surface result): %v", err)), nil
+		}
+	}
+
+	// Validate and resolve path
+	fullPath, err := s.validateFilePath(dirPath)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid file path: %v", err)), nil
+	}
+	if stat, err := s.guard.Stat(fullPath); err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Directory not found: %v", err)), nil
+	} else if !stat.IsDir() {
+		return mcp.NewToolResultError("Cannot report API: path is not a directory"), nil
+	}
+
+	packages, truncated, err := s.goAPISurface(ctx, fullPath)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read packages: %v", err)), nil
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"path":      dirPath,
+		"packages":  packages,
+		"truncated": truncated,
+	}
+	if snapshotJSON != "" {
+		added, removed, changed := diffAPI(snapshot.Packages, packages)
+		result["diff"] = map[string]interface{}{
+			"added":   added,
+			"removed": removed,
+			"changed": changed,
+		}
+		result["compatible"] = len(removed) == 0 && len(changed) == 0
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// goAPISurface parses each Go package under root, skipping commands, tests,
+// testdata and vendored code
+func (s *Server) goAPISurface(ctx context.Context, root string) ([]APIPackage, bool, error) {
+	filter := s.pathFilter()
+	packages := []APIPackage{}
+	truncated := false
+	err := s.guard.WalkDir(ctx, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if p != root {
+			name := d.Name()
+			if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || filter.ShouldIgnore(p) {
+				return filepath.SkipDir
+			}
+		}
+
+		pkg, err := s.goPackageAPI(p)
+		if err != nil || pkg == nil {
+			return ignoreUnlessUnavailable(err)
+		}
+		if len(packages) == maxAPIPackages {
+			truncated = true
+			return filepath.SkipAll
+		}
+		packages = append(packages, *pkg)
+		return nil
+	})
+	return packages, truncated, err
+}
+
+// goPackageAPI collects the exported identifiers of the package in dir, or
+// returns nil if dir holds no importable package
+func (s *Server) goPackageAPI(dir string) (*APIPackage, error) {
+	entries, err := s.guard.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		filePath := filepath.Join(dir, name)
+		if info, err := entry.Info(); err != nil || info.Size() > s.config.maxFileSize(filePath) {
+			continue
+		}
+		src, err := s.guard.ReadFile(filePath)
+		if err != nil {
+			if unavailableResult(err) != nil {
+				return nil, err
+			}
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, src, parser.SkipObjectResolution)
+		if err != nil || file.Name.Name == "main" {
+			continue
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	relDir, _ := filepath.Rel(s.config.BasePath, dir)
+	relDir = filepath.ToSlash(relDir)
+	pkgPath := s.goImportPath(relDir)
+	if pkgPath == "" {
+		pkgPath = relDir
+	}
+
+	pkg := &APIPackage{Path: pkgPath, Name: files[0].Name.Name, Identifiers: []APIIdentifier{}}
+	for _, file := range files {
+		pkg.Identifiers = append(pkg.Identifiers, fileAPI(fset, file)...)
+	}
+	sort.Slice(pkg.Identifiers, func(i, j int) bool { return pkg.Identifiers[i].Name < pkg.Identifiers[j].Name })
+	return pkg, nil
+}
+
+// fileAPI lists the exported top-level identifiers of one file. Function
+// signatures omit parameter names, so renaming a parameter is not a change.
+func fileAPI(fset *token.FileSet, file *ast.File) []APIIdentifier {
+	var ids []APIIdentifier
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !d.Name.IsExported() {
+				continue
+			}
+			name, kind := d.Name.Name, "func"
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				recv := goReceiverName(d.Recv.List[0].Type)
+				if !ast.IsExported(recv) {
+					continue
+				}
+				name, kind = recv+"."+name, "method"
+			}
+			sig := &ast.FuncDecl{Recv: unnamedFields(d.Recv), Name: d.Name, Type: &ast.FuncType{
+				TypeParams: d.Type.TypeParams,
+				Params:     unnamedFields(d.Type.Params),
+				Results:    unnamedFields(d.Type.Results),
+			}}
+			ids = append(ids, APIIdentifier{Name: name, Kind: kind, Signature: printNode(fset, sig)})
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch sp := spec.(type) {
+				case *ast.TypeSpec:
+					if !sp.Name.IsExported() {
+						continue
+					}
+					exported := *sp
+					exported.Doc, exported.Comment = nil, nil
+					exported.Type = exportedType(sp.Type)
+					ids = append(ids, APIIdentifier{Name: sp.Name.Name, Kind: "type", Signature: "type " + printNode(fset, &exported)})
+				case *ast.ValueSpec:
+					for i, ident := range sp.Names {
+						if !ident.IsExported() {
+							continue
+						}
+						sig := d.Tok.String() + " " + ident.Name
+						if sp.Type != nil {
+							sig += " " + printNode(fset, sp.Type)
+						}
+						// A constant's value is part of its API
+						if d.Tok == token.CONST && i < len(sp.Values) {
+							sig += " = " + printNode(fset, sp.Values[i])
+						}
+						ids = append(ids, APIIdentifier{Name: ident.Name, Kind: d.Tok.String(), Signature: sig})
+					}
+				}
+			}
+		}
+	}
+	return ids
+}
+
+// unnamedFields copies a parameter list without its names
+func unnamedFields(fields *ast.FieldList) *ast.FieldList {
+	if fields == nil {
+		return nil
+	}
+	out := &ast.FieldList{}
+	for _, field := range fields.List {
+		count := max(len(field.Names), 1)
+		for range count {
+			out.List = append(out.List, &ast.Field{Type: field.Type})
+		}
+	}
+	return out
+}
+
+// exportedType hides the unexported fields of a struct type, which are not
+// part of its API
+func exportedType(expr ast.Expr) ast.Expr {
+	st, ok := expr.(*ast.StructType)
+	if !ok {
+		return expr
+	}
+	fields := &ast.FieldList{}
+	for _, field := range st.Fields.List {
+		var names []*ast.Ident
+		for _, name := range field.Names {
+			if name.IsExported() {
+				names = append(names, name)
+			}
+		}
+		// Embedded fields are named by their type
+		embedded := len(field.Names) == 0 && ast.IsExported(goReceiverName(field.Type))
+		if len(names) > 0 || embedded {
+			fields.List = append(fields.List, &ast.Field{Names: names, Type: field.Type, Tag: field.Tag})
+		}
+	}
+	return &ast.StructType{Fields: fields}
+}
+
+// printNode formats an AST node on one line
+func printNode(fset *token.FileSet, node any) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	// Struct and interface members become semicolon-separated, with the
+	// alignment padding and blank lines of the source dropped
+	var lines []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	out := strings.Join(lines, "; ")
+	out = strings.ReplaceAll(out, "{; ", "{ ")
+	out = strings.ReplaceAll(out, "; }", " }")
+	return strings.ReplaceAll(out, "{ }", "{}")
+}
+
+// diffAPI compares two API snapshots by package path and identifier name
+func diffAPI(before, after []APIPackage) (added, removed, changed []APIChange) {
+	index := func(packages []APIPackage) map[[2]string]APIIdentifier {
+		ids := map[[2]string]APIIdentifier{}
+		for _, pkg := range packages {
+			for _, id := range pkg.Identifiers {
+				ids[[2]string{pkg.Path, id.Name}] = id
+			}
+		}
+		return ids
+	}
+	old, cur := index(before), index(after)
+
+	added, removed, changed = []APIChange{}, []APIChange{}, []APIChange{}
+	for key, id := range cur {
+		prev, ok := old[key]
+		switch {
+		case !ok:
+			sig := id.Signature
+			added = append(added, APIChange{Package: key[0], Name: id.Name, Kind: id.Kind, After: &sig})
+		case prev.Signature != id.Signature:
+			was, now := prev.Signature, id.Signature
+			changed = append(changed, APIChange{Package: key[0], Name: id.Name, Kind: id.Kind, Before: &was, After: &now})
+		}
+	}
+	for key, id := range old {
+		if _, ok := cur[key]; !ok {
+			sig := id.Signature
+			removed = append(removed, APIChange{Package: key[0], Name: id.Name, Kind: id.Kind, Before: &sig})
+		}
+	}
+	for _, list := range [][]APIChange{added, removed, changed} {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Package != list[j].Package {
+				return list[i].Package < list[j].Package
+			}
+			return list[i].Name < list[j].Name
+		})
+	}
+	return added, removed, changed
+}
@@ -0,0 +1,458 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	// defaultGrantDuration is how long an access grant lasts unless asked
+	defaultGrantDuration = 15 * time.Minute
+	// maxGrantDuration bounds how long one access grant lasts
+	maxGrantDuration = 24 * time.Hour
+	// maxGrants bounds the grants kept, active or not; the oldest that ran
+	// out are forgotten first
+	maxGrants = 1000
+)
+
+// Statuses of an access grant
+const (
+	grantActive  = "active"
+	grantExpired = "expired"
+	grantRevoked = "revoked"
+)
+
+// AccessGrant lets one session see a path the allow and deny lists or its
+// API key's paths refuse, until it expires or is revoked
+type AccessGrant struct {
+	ID       string     `json:"id"`
+	Session  string     `json:"session"`
+	Root     string     `json:"root,omitempty"`
+	Path     string     `json:"path"`
+	Reviewer string     `json:"reviewer,omitempty"`
+	Reason   string     `json:"reason,omitempty"`
+	Granted  time.Time  `json:"granted"`
+	Expires  time.Time  `json:"expires"`
+	Revoked  *time.Time `json:"revoked,omitempty"`
+	Status   string     `json:"status"`
+}
+
+// GrantRequest is the body of a request for an access grant. Duration takes
+// Go syntax like 15m.
+type GrantRequest struct {
+	Session  string `json:"session"`
+	Root     string `json:"root"`
+	Path     string `json:"path"`
+	Duration string `json:"duration"`
+	Reviewer string `json:"reviewer"`
+	Reason   string `json:"reason"`
+}
+
+// GrantEvent is the audit log line of a grant given or revoked
+type GrantEvent struct {
+	Time  time.Time   `json:"time"`
+	Event string      `json:"event"`
+	Grant AccessGrant `json:"grant"`
+}
+
+// grantStore holds the access grants of a server started with AccessGrants,
+// and the servers that let each session's calls through them
+type grantStore struct {
+	mu      sync.Mutex
+	nextID  int
+	grants  map[string]*AccessGrant
+	order   []string // IDs, oldest first
+	servers map[string]*grantServer
+}
+
+// grantServer serves the calls of one session, with one API key, through
+// its active grants
+type grantServer struct {
+	ids      string // the grants it was built with
+	handlers map[string]server.ToolHandlerFunc
+}
+
+func newGrantStore() *grantStore {
+	return &grantStore{grants: make(map[string]*AccessGrant), servers: make(map[string]*grantServer)}
+}
+
+// status returns what became of a grant by now; the caller holds the lock
+func (g *AccessGrant) status(now time.Time) string {
+	switch {
+	case g.Revoked != nil:
+		return grantRevoked
+	case !now.Before(g.Expires):
+		return grantExpired
+	}
+	return grantActive
+}
+
+// add stores a grant and assigns its ID, forgetting the oldest grants that
+// are no longer active past maxGrants
+func (g *grantStore) add(grant *AccessGrant) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.nextID++
+	grant.ID = strconv.Itoa(g.nextID)
+	g.grants[grant.ID] = grant
+	g.order = append(g.order, grant.ID)
+
+	now := time.Now()
+	kept := g.order[:0]
+	for i, id := range g.order {
+		if len(g.order)-i+len(kept) > maxGrants && g.grants[id].status(now) != grantActive {
+			delete(g.grants, id)
+			continue
+		}
+		kept = append(kept, id)
+	}
+	g.order = kept
+}
+
+// get returns a copy of a grant
+func (g *grantStore) get(id string) (AccessGrant, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	grant, ok := g.grants[id]
+	if !ok {
+		return AccessGrant{}, false
+	}
+	copied := *grant
+	copied.Status = grant.status(time.Now())
+	return copied, true
+}
+
+// revoke ends a grant before it expires
+func (g *grantStore) revoke(id string) (AccessGrant, int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	grant, ok := g.grants[id]
+	if !ok {
+		return AccessGrant{}, http.StatusNotFound, fmt.Errorf("unknown grant")
+	}
+	now := time.Now().UTC()
+	if status := grant.status(now); status != grantActive {
+		return AccessGrant{}, http.StatusConflict, fmt.Errorf("grant already %s", status)
+	}
+	grant.Revoked = &now
+	copied := *grant
+	copied.Status = grantRevoked
+	return copied, http.StatusOK, nil
+}
+
+// list returns copies of the grants with a status, or of all grants when
+// status is empty, optionally only those of one session, oldest first
+func (g *grantStore) list(status, session string) []AccessGrant {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	grants := []AccessGrant{}
+	for _, id := range g.order {
+		grant := g.grants[id]
+		copied := *grant
+		copied.Status = grant.status(now)
+		if (status == "" || copied.Status == status) && (session == "" || grant.Session == session) {
+			grants = append(grants, copied)
+		}
+	}
+	return grants
+}
+
+// active returns the grants of a session in force now, oldest first
+func (g *grantStore) active(session string) []*AccessGrant {
+	if session == "" {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	var grants []*AccessGrant
+	for _, id := range g.order {
+		if grant := g.grants[id]; grant.Session == session && grant.status(now) == grantActive {
+			grants = append(grants, grant)
+		}
+	}
+	return grants
+}
+
+// allows reports whether a grant is still in force
+func (g *grantStore) allows(grant *AccessGrant) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return grant.status(time.Now()) == grantActive
+}
+
+// forget drops the servers kept for a session that ended
+func (g *grantStore) forget(session string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for key := range g.servers {
+		if strings.HasPrefix(key, session+"\x00") {
+			delete(g.servers, key)
+		}
+	}
+}
+
+// grantFilter lets through the paths of a session's grants, and the
+// directories leading to them, that filter would refuse, for as long as
+// each grant is in force
+type grantFilter struct {
+	basePath string
+	store    *grantStore
+	grants   []*AccessGrant
+	filter   PathFilter
+}
+
+func (f grantFilter) ShouldIgnore(fullPath string) bool {
+	if !f.filter.ShouldIgnore(fullPath) {
+		return false
+	}
+	relPath, err := filepath.Rel(f.basePath, fullPath)
+	if err != nil {
+		return true
+	}
+	relPath = filepath.ToSlash(relPath)
+	for _, grant := range f.grants {
+		if pathsOverlap(grant.Path, relPath) && f.store.allows(grant) {
+			return false
+		}
+	}
+	return true
+}
+
+// grantTools routes the calls of sessions with active grants to handlers of
+// servers that let them through. Each runs on a copy of the servers the
+// caller would otherwise get, so a grant widens what its API key sees
+// without lifting its other limits.
+func (s *Server) grantTools(tools []server.ServerTool) {
+	for i := range tools {
+		name, handler := tools[i].Tool.Name, tools[i].Handler
+		tools[i].Handler = func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if grantHandler, ok := s.grantHandlers(ctx)[name]; ok {
+				return grantHandler(ctx, request)
+			}
+			return handler(ctx, request)
+		}
+	}
+}
+
+// grantHandlers returns the handlers of the caller's active grants, or nil
+// when it has none, building the servers for them when they changed
+func (s *Server) grantHandlers(ctx context.Context) map[string]server.ToolHandlerFunc {
+	session := sessionID(ctx)
+	grants := s.grants.active(session)
+	if len(grants) == 0 {
+		return nil
+	}
+	key := session + "\x00"
+	if apiKey := callAPIKey(ctx); apiKey != nil {
+		key += apiKey.Name
+	}
+	ids := make([]string, len(grants))
+	for i, grant := range grants {
+		ids[i] = grant.ID
+	}
+	s.grants.mu.Lock()
+	gs := s.grants.servers[key]
+	s.grants.mu.Unlock()
+	if gs != nil && gs.ids == strings.Join(ids, ",") {
+		return gs.handlers
+	}
+
+	base := s.callServer(ctx)
+	roots := base.roots
+	if len(roots) == 0 {
+		roots = []*Server{base}
+	}
+	granted := make([]*Server, len(roots))
+	for i, rs := range roots {
+		gs := *rs
+		gs.keyScopes, gs.grants, gs.granted = nil, s.grants, nil
+		for _, grant := range grants {
+			if grant.Root == rs.root {
+				gs.granted = append(gs.granted, grant)
+			}
+		}
+		gs.openRoot(rs.backend)
+		gs.access, gs.reservations, gs.artifacts, gs.repoMap, gs.watches = rs.access, rs.reservations, rs.artifacts, rs.repoMap, rs.watches
+		granted[i] = &gs
+	}
+	tools := granted[0].toolDefinitions()
+	if len(roots) > 1 {
+		for _, gs := range granted {
+			gs.roots = granted
+		}
+		tools = granted[0].rootTools()
+	}
+	handlers := make(map[string]server.ToolHandlerFunc, len(tools))
+	for _, tool := range tools {
+		handlers[tool.Tool.Name] = tool.Handler
+	}
+	s.grants.mu.Lock()
+	s.grants.servers[key] = &grantServer{ids: strings.Join(ids, ","), handlers: handlers}
+	s.grants.mu.Unlock()
+	return handlers
+}
+
+// grantIDs returns the IDs of the grants in force for the caller, for its
+// audit record
+func (s *Server) grantIDs(ctx context.Context) []string {
+	if s.grants == nil {
+		return nil
+	}
+	var ids []string
+	for _, grant := range s.grants.active(sessionID(ctx)) {
+		ids = append(ids, grant.ID)
+	}
+	return ids
+}
+
+// newGrant checks a request for a grant and returns the grant it asks for
+func (s *Server) newGrant(request GrantRequest) (*AccessGrant, error) {
+	if request.Session == "" {
+		return nil, fmt.Errorf("missing session")
+	}
+	duration := defaultGrantDuration
+	if request.Duration != "" {
+		parsed, err := time.ParseDuration(request.Duration)
+		if err != nil || parsed <= 0 || parsed > maxGrantDuration {
+			return nil, fmt.Errorf("duration must be positive and at most %s", maxGrantDuration)
+		}
+		duration = parsed
+	}
+
+	// Paths are relative to a root, the first unless named
+	root := ""
+	if len(s.roots) > 1 {
+		root = s.root
+		if request.Root != "" {
+			root = request.Root
+		}
+		if !rootNamed(s.config.Roots, root) {
+			return nil, fmt.Errorf("unknown root %q", root)
+		}
+	} else if request.Root != "" && !rootNamed(s.config.Roots, request.Root) {
+		return nil, fmt.Errorf("unknown root %q", request.Root)
+	}
+	p := path.Clean(strings.Trim(filepath.ToSlash(request.Path), "/"))
+	if strings.TrimSpace(request.Path) == "" || p == ".." || strings.HasPrefix(p, "../") || filepath.IsAbs(request.Path) {
+		return nil, fmt.Errorf("path must be relative to the root and inside it")
+	}
+
+	now := time.Now().UTC()
+	return &AccessGrant{
+		Session:  request.Session,
+		Root:     root,
+		Path:     p,
+		Reviewer: request.Reviewer,
+		Reason:   request.Reason,
+		Granted:  now,
+		Expires:  now.Add(duration),
+		Status:   grantActive,
+	}, nil
+}
+
+// auditGrant records a grant given or revoked in the audit log and the log
+func (s *Server) auditGrant(event string, grant AccessGrant) {
+	s.metrics.Add("mcp_access_grants_total", 1, "event", event)
+	log.Printf("Access grant %s %s: %s for session %s until %s", grant.ID, event, grant.Path, grant.Session, grant.Expires.Format(time.RFC3339))
+	if s.auditLog != nil {
+		if err := s.auditLog.Record(GrantEvent{Time: time.Now().UTC(), Event: event, Grant: grant}); err != nil {
+			log.Printf("Failed to write audit log: %v", err)
+		}
+	}
+}
+
+// handleGrants serves the access grant API:
+//
+//	GET  /grants               grants, filtered by ?status= (default active) and ?session=
+//	POST /grants               give a grant, with a GrantRequest body
+//	GET  /grants/<id>          one grant
+//	POST /grants/<id>/revoke   end it before it expires
+func (s *Server) handleGrants(w http.ResponseWriter, r *http.Request) {
+	// Grants take the reviewers' token, so agents cannot grant themselves
+	// access; ValidateConfig requires one whenever agents need a credential
+	if token := s.config.ApprovalToken; token != "" && !hasBearerToken(r, token) {
+		s.unauthorized(w, r)
+		return
+	}
+
+	id, action, _ := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/grants"), "/"), "/")
+	wantMethod := http.MethodGet
+	if action == "revoke" || (id == "" && r.Method == http.MethodPost) {
+		wantMethod = http.MethodPost
+	}
+	if r.Method != wantMethod {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body interface{}
+	status := http.StatusOK
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		var request GrantRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+			http.Error(w, fmt.Sprintf("invalid grant: %v", err), http.StatusBadRequest)
+			return
+		}
+		grant, err := s.newGrant(request)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid grant: %v", err), http.StatusBadRequest)
+			return
+		}
+		s.grants.add(grant)
+		s.auditGrant("granted", *grant)
+		body, status = *grant, http.StatusCreated
+	case id == "":
+		filter := r.URL.Query().Get("status")
+		switch filter {
+		case "":
+			filter = grantActive
+		case "all":
+			filter = ""
+		case grantActive, grantExpired, grantRevoked:
+		default:
+			http.Error(w, "unknown status (use active, expired, revoked or all)", http.StatusBadRequest)
+			return
+		}
+		body = map[string]interface{}{"grants": s.grants.list(filter, r.URL.Query().Get("session"))}
+	case action == "":
+		grant, ok := s.grants.get(id)
+		if !ok {
+			http.Error(w, "unknown grant", http.StatusNotFound)
+			return
+		}
+		body = grant
+	case action == "revoke":
+		grant, code, err := s.grants.revoke(id)
+		if err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+		s.auditGrant("revoked", grant)
+		body = grant
+	default:
+		http.Error(w, "unknown action (use revoke)", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(body)
+}
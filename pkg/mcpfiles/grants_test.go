@@ -0,0 +1,97 @@
+package mcpfiles
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postGrant asks for an access grant as a reviewer would
+func postGrant(t *testing.T, s *Server, token, path, body string) (int, AccessGrant) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.handleGrants(w, r)
+	var grant AccessGrant
+	if w.Code == http.StatusOK || w.Code == http.StatusCreated {
+		if err := json.Unmarshal(w.Body.Bytes(), &grant); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, grant
+}
+
+func TestAccessGrants(t *testing.T) {
+	s := newTestServer(t, &Config{
+		Transport:     TransportHTTP,
+		AccessGrants:  true,
+		ApprovalToken: "review",
+		DenyPaths:     []string{"secrets"},
+	}, map[string]string{"secrets/key.txt": "key\n", "a.txt": "a\n"})
+	alice := sessionContext(s, "alice")
+	canRead := func(session string) bool {
+		t.Helper()
+		_, isError := callTool(t, sessionContext(s, session), s, "read_file_contents", map[string]interface{}{"file_path": "secrets/key.txt"})
+		return !isError
+	}
+	if canRead("alice") {
+		t.Fatal("read_file_contents of a denied path succeeded without a grant")
+	}
+
+	// Agents cannot grant themselves access
+	body := `{"session":"alice","path":"secrets","reason":"rotate"}`
+	if code, _ := postGrant(t, s, "", "/grants", body); code != http.StatusUnauthorized {
+		t.Errorf("POST /grants without the reviewers' token = %d, want %d", code, http.StatusUnauthorized)
+	}
+	for _, bad := range []string{`{"path":"secrets"}`, `{"session":"alice","path":"../x"}`, `{"session":"alice","path":"secrets","duration":"48h"}`} {
+		if code, _ := postGrant(t, s, "review", "/grants", bad); code != http.StatusBadRequest {
+			t.Errorf("POST /grants %s = %d, want %d", bad, code, http.StatusBadRequest)
+		}
+	}
+
+	code, grant := postGrant(t, s, "review", "/grants", body)
+	if code != http.StatusCreated || grant.Status != grantActive {
+		t.Fatalf("POST /grants = %d, %+v", code, grant)
+	}
+	if !canRead("alice") {
+		t.Error("read_file_contents of a granted path failed")
+	}
+	if canRead("bob") {
+		t.Error("a grant let another session through")
+	}
+	if text, _ := callTool(t, alice, s, "read_file_structure", map[string]interface{}{}); !strings.Contains(text, "key.txt") {
+		t.Errorf("read_file_structure leaves out a granted path: %s", text)
+	}
+
+	// Revoking a grant refuses the path again, and only once
+	if code, revoked := postGrant(t, s, "review", "/grants/"+grant.ID+"/revoke", ""); code != http.StatusOK || revoked.Status != grantRevoked {
+		t.Fatalf("revoke = %d, %+v", code, revoked)
+	}
+	if canRead("alice") {
+		t.Error("read_file_contents of a revoked grant's path succeeded")
+	}
+	if code, _ := postGrant(t, s, "review", "/grants/"+grant.ID+"/revoke", ""); code != http.StatusConflict {
+		t.Errorf("second revoke = %d, want %d", code, http.StatusConflict)
+	}
+
+	// So does its running out
+	_, grant = postGrant(t, s, "review", "/grants", body)
+	if !canRead("alice") {
+		t.Fatal("read_file_contents of a granted path failed")
+	}
+	s.grants.mu.Lock()
+	s.grants.grants[grant.ID].Expires = time.Now()
+	s.grants.mu.Unlock()
+	if canRead("alice") {
+		t.Error("read_file_contents of an expired grant's path succeeded")
+	}
+	if got, _ := s.grants.get(grant.ID); got.Status != grantExpired {
+		t.Errorf("grant status = %s, want %s", got.Status, grantExpired)
+	}
+}
@@ -0,0 +1,88 @@
+package mcpfiles
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Reasons a grep query skips a file, as reported by explain
+const (
+	skipIgnored     = "ignored"      // hidden by ignore rules; a hidden directory counts once
+	skipNotRegular  = "not_regular"  // symlinks, devices and the like
+	skipFilePattern = "file_pattern" // name matches neither file_pattern nor file_patterns
+	skipExcluded    = "excluded"     // matches an exclude glob; an excluded directory counts once
+	skipBinary      = "binary"       // configured binary, or content holding a NUL byte
+	skipTooLarge    = "too_large"    // over the server's size limit
+	skipScope       = "out_of_scope" // left out by max_file_size, modified_after or modified_before
+	skipView        = "view"         // outside the tool's view
+	skipUnreadable  = "unreadable"
+	skipNotSearched = "not_searched" // left once the match or output cap was reached
+)
+
+// GrepExplain reports how a query was searched, so that a missing match can
+// be traced to the backend, a skipped file or a cap
+type GrepExplain struct {
+	Backend      string             `json:"backend"`
+	Reason       string             `json:"reason"` // why this backend searched
+	FilesScanned int                `json:"files_scanned"`
+	FilesSkipped map[string]int     `json:"files_skipped"`
+	PhasesMs     map[string]float64 `json:"phases_ms"` // walk, search and collect
+	Note         string             `json:"note,omitempty"`
+}
+
+// searchTally counts the files of a search as it runs, from several workers
+type searchTally struct {
+	mu      sync.Mutex
+	scanned int
+	skipped map[string]int
+}
+
+func newSearchTally() *searchTally {
+	return &searchTally{skipped: map[string]int{}}
+}
+
+func (t *searchTally) scan() {
+	t.mu.Lock()
+	t.scanned++
+	t.mu.Unlock()
+}
+
+func (t *searchTally) skip(reason string) {
+	t.mu.Lock()
+	t.skipped[reason]++
+	t.mu.Unlock()
+}
+
+// explain reports the tally as searched by a backend
+func (t *searchTally) explain(backend string) *GrepExplain {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &GrepExplain{Backend: backend, FilesScanned: t.scanned, FilesSkipped: t.skipped, PhasesMs: map[string]float64{}}
+}
+
+// phaseMs returns the milliseconds elapsed since start
+func phaseMs(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
+
+// nativeReason returns why a query cannot be searched with ripgrep, or ""
+// when it can
+func (s *Server) nativeReason(query GrepQuery) string {
+	switch {
+	case s.ripgrep == "" && s.config.SearchBackend == SearchBackendNative:
+		return "the search backend is native"
+	case s.ripgrep == "":
+		if rg := s.config.externalTool("rg"); !rg.Available {
+			return fmt.Sprintf("rg is unavailable: %s", rg.Error)
+		}
+		return "ripgrep cannot read this root: its filesystem is not the OS disk or has injected faults"
+	case query.ModifiedAfter != nil || query.ModifiedBefore != nil:
+		return "ripgrep cannot filter by modification time"
+	case query.view != nil:
+		return "ripgrep cannot apply views"
+	case s.config.sizeOrBinaryOverrides():
+		return "ripgrep cannot apply the binary and max_size extension overrides"
+	}
+	return ""
+}
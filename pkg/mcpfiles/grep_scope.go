@@ -0,0 +1,118 @@
+package mcpfiles
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// searchScope restricts a grep query to files by size and modification time
+type searchScope struct {
+	maxSize        int64 // 0 means no limit
+	modifiedAfter  time.Time
+	modifiedBefore time.Time
+}
+
+// scoped reports whether the query filters files by size or mtime
+func (q GrepQuery) scoped() bool {
+	return q.MaxFileSize != nil || q.ModifiedAfter != nil || q.ModifiedBefore != nil
+}
+
+// scope parses the query's file filters
+func (q GrepQuery) scope(now time.Time) (searchScope, error) {
+	var scope searchScope
+	if q.MaxFileSize != nil {
+		if *q.MaxFileSize <= 0 {
+			return scope, fmt.Errorf("max_file_size must be positive")
+		}
+		scope.maxSize = *q.MaxFileSize
+	}
+	if q.ModifiedAfter != nil {
+		t, err := parseQueryTime(*q.ModifiedAfter, now)
+		if err != nil {
+			return scope, fmt.Errorf("invalid modified_after: %w", err)
+		}
+		scope.modifiedAfter = t
+	}
+	if q.ModifiedBefore != nil {
+		t, err := parseQueryTime(*q.ModifiedBefore, now)
+		if err != nil {
+			return scope, fmt.Errorf("invalid modified_before: %w", err)
+		}
+		scope.modifiedBefore = t
+	}
+	if !scope.modifiedAfter.IsZero() && !scope.modifiedBefore.IsZero() && !scope.modifiedAfter.Before(scope.modifiedBefore) {
+		return scope, fmt.Errorf("modified_after must be earlier than modified_before")
+	}
+	return scope, nil
+}
+
+// parseQueryTime accepts an RFC 3339 timestamp, a date, or a duration meaning
+// that long ago (e.g. "24h")
+func parseQueryTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not an RFC 3339 time, YYYY-MM-DD date or duration such as 24h", value)
+}
+
+// namePatterns returns the globs of file_pattern and file_patterns, of
+// which a file's name must match one; none means every name will do
+func (q GrepQuery) namePatterns() []string {
+	if q.FilePattern == nil {
+		return q.FilePatterns
+	}
+	return append([]string{*q.FilePattern}, q.FilePatterns...)
+}
+
+// matchesName reports whether a file name matches one of the query's name
+// globs, or the query has none
+func (q GrepQuery) matchesName(name string) bool {
+	globs := q.namePatterns()
+	for _, glob := range globs {
+		if ok, _ := filepath.Match(glob, name); ok {
+			return true
+		}
+	}
+	return len(globs) == 0
+}
+
+// excludes reports whether a path under basePath matches one of the query's
+// exclude globs. A directory that matches is excluded with all it holds.
+func (q GrepQuery) excludes(basePath, fullPath string) bool {
+	if len(q.Exclude) == 0 {
+		return false
+	}
+	relPath, err := filepath.Rel(basePath, fullPath)
+	if err != nil {
+		return false
+	}
+	relPath = filepath.ToSlash(relPath)
+	for _, glob := range q.Exclude {
+		if matchGlob(glob, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// includes reports whether a file passes the scope
+func (sc searchScope) includes(info fs.FileInfo) bool {
+	if sc.maxSize > 0 && info.Size() > sc.maxSize {
+		return false
+	}
+	if !sc.modifiedAfter.IsZero() && !info.ModTime().After(sc.modifiedAfter) {
+		return false
+	}
+	if !sc.modifiedBefore.IsZero() && !info.ModTime().Before(sc.modifiedBefore) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,370 @@
+package mcpfiles
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp/syntax"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxPatternLength caps the length of a single grep pattern
+const maxPatternLength = 1000
+
+// Regex dialects accepted in GrepQuery.Syntax
+const (
+	SyntaxBRE     = "bre"
+	SyntaxERE     = "ere"
+	SyntaxRE2     = "re2"
+	SyntaxPCRE    = "pcre"
+	SyntaxLiteral = "literal"
+)
+
+// dialect returns the query's regex dialect, defaulting to grep's basic syntax
+func (q GrepQuery) dialect() string {
+	if q.Syntax == nil || *q.Syntax == "" {
+		return SyntaxBRE
+	}
+	return strings.ToLower(*q.Syntax)
+}
+
+// multiline reports whether the query's matches may cross lines
+func (q GrepQuery) multiline() bool {
+	return q.Multiline != nil && *q.Multiline
+}
+
+// QueryError describes why a grep query was rejected before running
+type QueryError struct {
+	Index    int    // position of the query in the request
+	Position int    // character offset in the pattern, or -1 if unknown
+	Message  string // human-readable reason
+}
+
+func (e *QueryError) Error() string {
+	if e.Position >= 0 {
+		return fmt.Sprintf("query %d: invalid pattern at position %d: %s", e.Index, e.Position, e.Message)
+	}
+	return fmt.Sprintf("query %d: %s", e.Index, e.Message)
+}
+
+// Validate checks a query up front so syntax errors are reported precisely
+// instead of as a failed search. index is the query's position in the request.
+func (q GrepQuery) Validate(index int) error {
+	if q.Pattern == "" {
+		return &QueryError{Index: index, Position: -1, Message: "pattern must not be empty"}
+	}
+	if len(q.Pattern) > maxPatternLength {
+		return &QueryError{Index: index, Position: -1, Message: fmt.Sprintf("pattern is %d characters, maximum is %d", len(q.Pattern), maxPatternLength)}
+	}
+	if q.FilePattern != nil {
+		if _, err := filepath.Match(*q.FilePattern, ""); err != nil {
+			return &QueryError{Index: index, Position: -1, Message: fmt.Sprintf("invalid file_pattern %q: %v", *q.FilePattern, err)}
+		}
+	}
+	for _, glob := range q.FilePatterns {
+		if glob == "" {
+			return &QueryError{Index: index, Position: -1, Message: "file_patterns must not hold an empty glob"}
+		}
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return &QueryError{Index: index, Position: -1, Message: fmt.Sprintf("invalid file_patterns glob %q: %v", glob, err)}
+		}
+	}
+
+	if err := validatePathGlobs("exclude", q.Exclude); err != nil {
+		return &QueryError{Index: index, Position: -1, Message: err.Error()}
+	}
+
+	if _, err := q.scope(time.Now()); err != nil {
+		return &QueryError{Index: index, Position: -1, Message: err.Error()}
+	}
+	if q.multiline() && q.Invert != nil && *q.Invert {
+		return &QueryError{Index: index, Position: -1, Message: "invert selects lines and cannot be combined with multiline"}
+	}
+	if q.MaxMatches != nil && *q.MaxMatches <= 0 {
+		return &QueryError{Index: index, Position: -1, Message: "max_matches must be positive"}
+	}
+	if q.MaxMatchesPerFile != nil && *q.MaxMatchesPerFile <= 0 {
+		return &QueryError{Index: index, Position: -1, Message: "max_matches_per_file must be positive"}
+	}
+	if q.Timeout != nil {
+		if timeout, err := time.ParseDuration(*q.Timeout); err != nil || timeout <= 0 {
+			return &QueryError{Index: index, Position: -1, Message: fmt.Sprintf("timeout %q must be a positive duration such as 5s", *q.Timeout)}
+		}
+	}
+
+	// Check every dialect with Go's parser after translating it to
+	// equivalent RE2 syntax
+	var translated string
+	var offsets []int
+	switch q.dialect() {
+	case SyntaxLiteral:
+		return nil
+	case SyntaxBRE, SyntaxERE:
+		var backref int
+		translated, offsets, backref = translatePOSIX(q.Pattern, q.dialect() == SyntaxERE)
+		if backref >= 0 {
+			return &QueryError{
+				Index:    index,
+				Position: utf8.RuneCountInString(q.Pattern[:backref]),
+				Message:  fmt.Sprintf("backreference `%s` is not supported", q.Pattern[backref:backref+2]),
+			}
+		}
+	case SyntaxRE2, SyntaxPCRE:
+		// pcre accepts the Perl syntax that RE2 shares; the constructs that
+		// need a backtracking matcher are rejected with their position
+		if constructs := pcreConstructs(q.Pattern); len(constructs) > 0 {
+			c := constructs[0]
+			return &QueryError{
+				Index:    index,
+				Position: utf8.RuneCountInString(q.Pattern[:c.start]),
+				Message:  fmt.Sprintf("%s `%s` is not supported", c.name, q.Pattern[c.start:c.end]),
+			}
+		}
+		translated, offsets = q.Pattern, identityOffsets(q.Pattern)
+	default:
+		return &QueryError{Index: index, Position: -1, Message: fmt.Sprintf("unsupported syntax %q (use bre, ere, re2, pcre or literal)", *q.Syntax)}
+	}
+
+	if _, err := syntax.Parse(translated, syntax.Perl); err != nil {
+		return queryErrorFromSyntax(index, err, q.Pattern, translated, offsets)
+	}
+
+	return nil
+}
+
+// queryErrorFromSyntax maps a Go regexp syntax error back to a position in the original pattern
+func queryErrorFromSyntax(index int, err error, pattern, translated string, offsets []int) *QueryError {
+	position := -1
+	message := err.Error()
+
+	var syntaxErr *syntax.Error
+	if errors.As(err, &syntaxErr) {
+		message = syntaxErr.Code.String()
+		if i := strings.Index(translated, syntaxErr.Expr); i >= 0 && syntaxErr.Expr != "" {
+			// Quote the offending part as the caller wrote it
+			position = offsets[i]
+			message = fmt.Sprintf("%s: `%s`", message, pattern[position:offsets[i+len(syntaxErr.Expr)]])
+		}
+		// The expression of a missing paren error is the whole pattern; point
+		// at the group that was never closed instead
+		if syntaxErr.Code == syntax.ErrMissingParen {
+			if i := unclosedGroup(translated); i >= 0 {
+				position = offsets[i]
+			}
+		}
+	}
+
+	// Report characters rather than bytes
+	if position >= 0 {
+		position = utf8.RuneCountInString(pattern[:position])
+	}
+
+	return &QueryError{Index: index, Position: position, Message: message}
+}
+
+// unclosedGroup returns the index of the last unmatched ( in an RE2 pattern
+func unclosedGroup(pattern string) int {
+	var open []int
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[':
+			if end := strings.IndexByte(pattern[i+1:], ']'); end >= 0 {
+				i += end + 1
+			}
+		case '(':
+			open = append(open, i)
+		case ')':
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	if len(open) == 0 {
+		return -1
+	}
+	return open[len(open)-1]
+}
+
+// translatePOSIX converts a POSIX basic or, if extended is set, extended regular
+// expression (with GNU extensions) into RE2 syntax. offsets[i] is the position in
+// pattern that produced byte i of the result, with one trailing entry for the end
+// of the pattern. The last result is the position of the first backreference,
+// which RE2 cannot express, or -1 if there is none.
+func translatePOSIX(pattern string, extended bool) (string, []int, int) {
+	var out strings.Builder
+	offsets := make([]int, 0, len(pattern)+1)
+	backref := -1
+
+	emit := func(s string, origin int) {
+		out.WriteString(s)
+		for range len(s) {
+			offsets = append(offsets, origin)
+		}
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+
+		switch c {
+		case '[':
+			// Bracket expressions mean the same in both syntaxes, except that
+			// a backslash inside them is literal in POSIX
+			end := bracketEnd(pattern, i)
+			if end < 0 {
+				emit(pattern[i:], i)
+				i = len(pattern)
+				continue
+			}
+			for j := i; j <= end; j++ {
+				if pattern[j] == '\\' {
+					emit(`\\`, j)
+				} else {
+					emit(pattern[j:j+1], j)
+				}
+			}
+			i = end
+		case '\\':
+			if i+1 >= len(pattern) {
+				emit(`\\`, i)
+				continue
+			}
+			next := pattern[i+1]
+			switch {
+			case strings.IndexByte("(){}|+?", next) >= 0:
+				// Escaped in BRE means special, in ERE literal
+				if extended {
+					emit(`\`+string(next), i)
+				} else {
+					emit(string(next), i)
+				}
+			case next >= '1' && next <= '9':
+				// RE2 has no backreferences; drop them so the rest can be checked
+				if backref < 0 {
+					backref = i
+				}
+			case next == '<' || next == '>':
+				// GNU word boundaries
+				emit(`\b`, i)
+			case next == '`':
+				emit(`\A`, i)
+			case next == '\'':
+				emit(`\z`, i)
+			case strings.IndexByte("wWsSbB", next) >= 0:
+				emit(`\`+string(next), i)
+			case next >= 'a' && next <= 'z' || next >= 'A' && next <= 'Z' || next == '0' || next >= utf8.RuneSelf:
+				// grep treats other escaped letters as the letter itself
+				emit(pattern[i+1:i+2], i)
+			default:
+				emit(`\`+string(next), i)
+			}
+			i++
+		case '(', ')', '{', '}', '|', '+', '?':
+			// Unescaped in BRE means literal, in ERE special
+			if extended {
+				emit(string(c), i)
+			} else {
+				emit(`\`+string(c), i)
+			}
+		case '*':
+			// A leading star is literal
+			if i == 0 || pattern[i-1] == '^' && i == 1 {
+				emit(`\*`, i)
+			} else {
+				emit("*", i)
+			}
+		default:
+			emit(pattern[i:i+1], i)
+		}
+	}
+	offsets = append(offsets, len(pattern))
+
+	return out.String(), offsets, backref
+}
+
+// pcreConstruct is a PCRE feature that RE2 lacks, spanning pattern[start:end]
+type pcreConstruct struct {
+	name       string
+	start, end int
+}
+
+// pcreGroups are the PCRE group openers without an RE2 equivalent
+var pcreGroups = []struct{ opener, name string }{
+	{"(?<=", "lookbehind"},
+	{"(?<!", "negative lookbehind"},
+	{"(?=", "lookahead"},
+	{"(?!", "negative lookahead"},
+	{"(?>", "atomic group"},
+}
+
+// pcreConstructs lists the PCRE-only constructs in pattern in order
+func pcreConstructs(pattern string) []pcreConstruct {
+	var found []pcreConstruct
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			if i+1 < len(pattern) && pattern[i+1] >= '1' && pattern[i+1] <= '9' {
+				found = append(found, pcreConstruct{name: "backreference", start: i, end: i + 2})
+			}
+			i++
+		case '[':
+			if end := bracketEnd(pattern, i); end >= 0 {
+				i = end
+			}
+		case '(':
+			for _, g := range pcreGroups {
+				if strings.HasPrefix(pattern[i:], g.opener) {
+					found = append(found, pcreConstruct{name: g.name, start: i, end: i + len(g.opener)})
+					i += len(g.opener) - 1
+					break
+				}
+			}
+		case '*', '+', '?', '}':
+			// A quantifier followed by + is possessive
+			if i > 0 && i+1 < len(pattern) && pattern[i+1] == '+' {
+				found = append(found, pcreConstruct{name: "possessive quantifier", start: i, end: i + 2})
+				i++
+			}
+		}
+	}
+	return found
+}
+
+// identityOffsets returns offsets for a pattern that is checked unchanged
+func identityOffsets(pattern string) []int {
+	offsets := make([]int, len(pattern)+1)
+	for i := range offsets {
+		offsets[i] = i
+	}
+	return offsets
+}
+
+// bracketEnd returns the index of the ] closing the bracket expression that
+// starts at pattern[start], or -1 if it is unterminated
+func bracketEnd(pattern string, start int) int {
+	j := start + 1
+	if j < len(pattern) && pattern[j] == '^' {
+		j++
+	}
+	// A leading ] is a literal member of the set
+	if j < len(pattern) && pattern[j] == ']' {
+		j++
+	}
+	for ; j < len(pattern); j++ {
+		switch {
+		case pattern[j] == '[' && j+1 < len(pattern) && strings.IndexByte(":.=", pattern[j+1]) >= 0:
+			// Skip character classes such as [:alpha:]
+			closing := strings.Index(pattern[j+2:], string(pattern[j+1])+"]")
+			if closing < 0 {
+				return -1
+			}
+			j += closing + 3
+		case pattern[j] == ']':
+			return j
+		}
+	}
+	return -1
+}
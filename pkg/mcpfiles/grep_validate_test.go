@@ -0,0 +1,101 @@
+package mcpfiles
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTranslatePOSIX(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		extended bool
+		want     string
+		backref  int
+	}{
+		// Groups, intervals and alternation are escaped in BRE, bare in ERE
+		{`a\(b\)c`, false, `a(b)c`, -1},
+		{`a(b)c`, false, `a\(b\)c`, -1},
+		{`a(b)c`, true, `a(b)c`, -1},
+		{`a\(b\)`, true, `a\(b\)`, -1},
+		{`a\{2\}`, false, `a{2}`, -1},
+		{`a{2}`, false, `a\{2\}`, -1},
+		{`a\|b`, false, `a|b`, -1},
+		{`a|b`, false, `a\|b`, -1},
+		{`a+b?`, false, `a\+b\?`, -1},
+		{`a\+b\?`, false, `a+b?`, -1},
+		{`a+b?`, true, `a+b?`, -1},
+
+		// A leading star is literal
+		{`*a`, false, `\*a`, -1},
+		{`^*a`, false, `^\*a`, -1},
+		{`a*`, false, `a*`, -1},
+
+		// Backslashes are literal in bracket expressions
+		{`[\w]`, false, `[\\w]`, -1},
+		{`[a-z]+`, true, `[a-z]+`, -1},
+		{`a[bc`, false, `a[bc`, -1},
+
+		// GNU extensions
+		{`\<word\>`, false, `\bword\b`, -1},
+		{"\\`a\\'", false, `\Aa\z`, -1},
+		{`\w\s\B`, false, `\w\s\B`, -1},
+
+		// Other escaped letters are the letter itself
+		{`\d\0`, false, `d0`, -1},
+		{`\.`, false, `\.`, -1},
+		{`a\`, false, `a\\`, -1},
+
+		// Backreferences are dropped, and the first one reported
+		{`\(a\)\1`, false, `(a)`, 5},
+		{`(a)(b)\2\1`, true, `(a)(b)`, 6},
+	}
+	for _, tt := range tests {
+		got, offsets, backref := translatePOSIX(tt.pattern, tt.extended)
+		if got != tt.want || backref != tt.backref {
+			t.Errorf("translatePOSIX(%q, %v) = %q, %d; want %q, %d", tt.pattern, tt.extended, got, backref, tt.want, tt.backref)
+		}
+		if len(offsets) != len(got)+1 {
+			t.Errorf("translatePOSIX(%q, %v) returned %d offsets for %d bytes", tt.pattern, tt.extended, len(offsets), len(got))
+		}
+	}
+}
+
+func TestTranslatePOSIXOffsets(t *testing.T) {
+	// Each byte of the result points at what produced it in the pattern
+	got, offsets, _ := translatePOSIX(`a\(b\)*`, false)
+	if got != `a(b)*` {
+		t.Fatalf("translatePOSIX = %q, want %q", got, `a(b)*`)
+	}
+	if want := []int{0, 1, 3, 4, 6, 7}; !reflect.DeepEqual(offsets, want) {
+		t.Errorf("offsets = %v, want %v", offsets, want)
+	}
+}
+
+func TestPCREConstructs(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []pcreConstruct
+	}{
+		{`a(?=b)`, []pcreConstruct{{"lookahead", 1, 4}}},
+		{`(?!a)`, []pcreConstruct{{"negative lookahead", 0, 3}}},
+		{`(?<=x)y(?<!z)`, []pcreConstruct{{"lookbehind", 0, 4}, {"negative lookbehind", 7, 11}}},
+		{`(?>ab)`, []pcreConstruct{{"atomic group", 0, 3}}},
+		{`(a)\1`, []pcreConstruct{{"backreference", 3, 5}}},
+		{`a++`, []pcreConstruct{{"possessive quantifier", 1, 3}}},
+		{`a*+b`, []pcreConstruct{{"possessive quantifier", 1, 3}}},
+		{`a{2}+`, []pcreConstruct{{"possessive quantifier", 3, 5}}},
+
+		// What RE2 supports, or what only looks like a construct
+		{`a(?:b)(?P<n>c)(?i)d`, nil},
+		{`[(?=]`, nil},
+		{`\(?=a`, nil},
+		{`\\1`, nil},
+		{`+a`, nil},
+		{`a+?`, nil},
+	}
+	for _, tt := range tests {
+		if got := pcreConstructs(tt.pattern); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("pcreConstructs(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
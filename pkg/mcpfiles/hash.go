@@ -0,0 +1,60 @@
+package mcpfiles
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+)
+
+// Hash algorithms for checksums, such as the result digests of recordings and
+// the content hashes of artifacts
+const (
+	HashSHA256 = "sha256"
+	HashSHA384 = "sha384"
+	HashSHA512 = "sha512"
+	HashSHA1   = "sha1" // weak; only with AllowWeakHashes
+	HashMD5    = "md5"  // weak; only with AllowWeakHashes
+)
+
+// hashAlgorithms are the supported hash algorithms by name
+var hashAlgorithms = map[string]func() hash.Hash{
+	HashSHA256: sha256.New,
+	HashSHA384: sha512.New384,
+	HashSHA512: sha512.New,
+	HashSHA1:   sha1.New,
+	HashMD5:    md5.New,
+}
+
+// weakHashes are broken for collision resistance and must be enabled explicitly
+var weakHashes = map[string]bool{HashSHA1: true, HashMD5: true}
+
+// checkHashAlgorithm checks that a hash algorithm is supported and allowed.
+// Weak hashes need allowWeak and are never allowed in FIPS 140 mode.
+func checkHashAlgorithm(name string, allowWeak bool) error {
+	if _, ok := hashAlgorithms[name]; !ok {
+		names := make([]string, 0, len(hashAlgorithms))
+		for known := range hashAlgorithms {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown hash algorithm %q (use %s)", name, strings.Join(names, ", "))
+	}
+	if weakHashes[name] {
+		if fipsMode() {
+			return fmt.Errorf("hash algorithm %s is not allowed in FIPS 140 mode", name)
+		}
+		if !allowWeak {
+			return fmt.Errorf("hash algorithm %s is weak; allow weak hashes to use it", name)
+		}
+	}
+	return nil
+}
+
+// fingerprintSampleSize is the number of bytes sampled from each end of a
+// file for its fingerprint
+const fingerprintSampleSize = 64 * 1024
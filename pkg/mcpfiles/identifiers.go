@@ -0,0 +1,291 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxIdentifierOccurrences caps the occurrences returned by find_identifier
+const maxIdentifierOccurrences = 1000
+
+// Where an occurrence sits in its file
+const (
+	ContextCode    = "code"
+	ContextString  = "string"
+	ContextComment = "comment"
+	ContextText    = "text" // file type without a known syntax
+)
+
+// Confidence that an occurrence is the identifier itself, and so must change
+// in a rename
+const (
+	ConfidenceHigh   = "high"   // code in a known language
+	ConfidenceMedium = "medium" // file of unknown syntax
+	ConfidenceLow    = "low"    // inside a string or comment
+)
+
+// IdentifierOccurrence is one whole-word occurrence of an identifier
+type IdentifierOccurrence struct {
+	FilePath   string  `json:"file_path"`
+	LineNumber int     `json:"line_number"`
+	Column     int     `json:"column"`
+	Content    string  `json:"content"`
+	Context    string  `json:"context"`
+	Preview    *string `json:"preview,omitempty"`
+}
+
+// lexSyntax is just enough of a language's lexical syntax to tell code from
+// strings and comments
+type lexSyntax struct {
+	lineComments []string
+	blockComment [2]string // opening and closing delimiter, if any
+	quotes       string    // single-line string delimiters, with backslash escapes
+	rawQuotes    string    // delimiters of strings that may span lines, without escapes
+	tripleQuotes bool      // """ and ''' strings
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// lexSyntaxes maps file extensions to their lexical syntax
+var lexSyntaxes = func() map[string]*lexSyntax {
+	goSyntax := &lexSyntax{lineComments: slashComments, blockComment: cLikeComment, quotes: `"'`, rawQuotes: "`"}
+	javascript := &lexSyntax{lineComments: slashComments, blockComment: cLikeComment, quotes: `"'`, rawQuotes: "`"}
+	c := &lexSyntax{lineComments: slashComments, blockComment: cLikeComment, quotes: `"'`}
+	jvm := &lexSyntax{lineComments: slashComments, blockComment: cLikeComment, quotes: `"'`, tripleQuotes: true}
+	// Rust's ' also starts lifetimes, so only " delimits strings
+	rust := &lexSyntax{lineComments: slashComments, blockComment: cLikeComment, quotes: `"`}
+	php := &lexSyntax{lineComments: []string{"//", "#"}, blockComment: cLikeComment, quotes: `"'`}
+	python := &lexSyntax{lineComments: hashComments, quotes: `"'`, tripleQuotes: true}
+	script := &lexSyntax{lineComments: hashComments, quotes: `"'`}
+
+	return map[string]*lexSyntax{
+		".go": goSyntax,
+		".js": javascript, ".jsx": javascript, ".mjs": javascript, ".cjs": javascript,
+		".ts": javascript, ".tsx": javascript, ".mts": javascript, ".cts": javascript,
+		".c": c, ".h": c, ".cc": c, ".cpp": c, ".cxx": c, ".hpp": c, ".hh": c, ".m": c, ".mm": c,
+		".java": c, ".cs": c,
+		".kt": jvm, ".kts": jvm, ".scala": jvm, ".groovy": jvm, ".swift": jvm,
+		".rs":  rust,
+		".php": php,
+		".py":  python, ".pyi": python,
+		".rb": script, ".sh": script, ".bash": script,
+	}
+}()
+
+// Lexical classes of a byte, as recorded by contexts
+const (
+	lexCode byte = iota
+	lexString
+	lexComment
+)
+
+// handleFindIdentifier handles the find_identifier tool
+func (s *Server) handleFindIdentifier(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	identifier, err := request.RequireString("identifier")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	if !identifierPattern.MatchString(identifier) {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid identifier: %q", identifier)), nil
+	}
+	newName := request.GetString("new_name", "")
+	if newName != "" && !identifierPattern.MatchString(newName) {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid new_name: %q", newName)), nil
+	}
+	filePattern := request.GetString("file_pattern", "")
+	if filePattern != "" {
+		if _, err := filepath.Match(filePattern, ""); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid file_pattern: %v", err)), nil
+		}
+	}
+
+	groups := map[string][]IdentifierOccurrence{
+		ConfidenceHigh:   {},
+		ConfidenceMedium: {},
+		ConfidenceLow:    {},
+	}
+	total := 0
+	truncated := false
+	err = s.walkTextFiles(ctx, func(_, relPath string, content []byte) error {
+		if filePattern != "" {
+			if ok, _ := filepath.Match(filePattern, path.Base(relPath)); !ok {
+				return nil
+			}
+		}
+		for _, occ := range findIdentifier(string(content), relPath, identifier) {
+			if total == maxIdentifierOccurrences {
+				truncated = true
+				return filepath.SkipAll
+			}
+			if newName != "" {
+				preview := occ.Content[:occ.Column-1] + newName + occ.Content[occ.Column-1+len(identifier):]
+				occ.Preview = &preview
+			}
+			confidence := ConfidenceLow
+			switch occ.Context {
+			case ContextCode:
+				confidence = ConfidenceHigh
+			case ContextText:
+				confidence = ConfidenceMedium
+			}
+			groups[confidence] = append(groups[confidence], occ)
+			total++
+		}
+		return nil
+	})
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to search for identifier: %v", err)), nil
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"identifier":  identifier,
+		"occurrences": groups,
+		"total":       total,
+		"truncated":   truncated,
+	}
+	if newName != "" {
+		result["new_name"] = newName
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// findIdentifier returns the whole-word occurrences of identifier in a file,
+// each classified by the lexical context it appears in
+func findIdentifier(src, relPath, identifier string) []IdentifierOccurrence {
+	if !strings.Contains(src, identifier) {
+		return nil
+	}
+	syntax := lexSyntaxes[strings.ToLower(path.Ext(relPath))]
+	var classes []byte
+	if syntax != nil {
+		classes = syntax.contexts(src)
+	}
+
+	var occurrences []IdentifierOccurrence
+	lineStart, lineNum := 0, 1
+	for start := 0; ; {
+		i := strings.Index(src[start:], identifier)
+		if i < 0 {
+			break
+		}
+		i += start
+		start = i + 1
+		end := i + len(identifier)
+		if i > 0 && isIdentByte(src[i-1]) || end < len(src) && isIdentByte(src[end]) {
+			continue
+		}
+
+		lineNum += strings.Count(src[lineStart:i], "\n")
+		if nl := strings.LastIndexByte(src[:i], '\n'); nl >= 0 {
+			lineStart = nl + 1
+		} else {
+			lineStart = 0
+		}
+		lineEnd := strings.IndexByte(src[i:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(src)
+		} else {
+			lineEnd += i
+		}
+
+		context := ContextText
+		if classes != nil {
+			switch classes[i] {
+			case lexCode:
+				context = ContextCode
+			case lexString:
+				context = ContextString
+			case lexComment:
+				context = ContextComment
+			}
+		}
+		occurrences = append(occurrences, IdentifierOccurrence{
+			FilePath:   relPath,
+			LineNumber: lineNum,
+			Column:     i - lineStart + 1,
+			Content:    strings.TrimRight(src[lineStart:lineEnd], "\r"),
+			Context:    context,
+		})
+	}
+	return occurrences
+}
+
+// contexts returns the lexical class of every byte of src
+func (syn *lexSyntax) contexts(src string) []byte {
+	classes := make([]byte, len(src))
+	mark := func(from, to int, class byte) int {
+		to = min(to, len(src))
+		for j := from; j < to; j++ {
+			classes[j] = class
+		}
+		return to
+	}
+	// through returns the end of the first closing delimiter at or after from
+	through := func(from int, closing string) int {
+		if j := strings.Index(src[from:], closing); j >= 0 {
+			return from + j + len(closing)
+		}
+		return len(src)
+	}
+
+	for i := 0; i < len(src); {
+		rest := src[i:]
+		switch {
+		case hasAnyPrefix(rest, syn.lineComments):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			i = mark(i, i+end, lexComment)
+		case syn.blockComment[0] != "" && strings.HasPrefix(rest, syn.blockComment[0]):
+			i = mark(i, through(i+len(syn.blockComment[0]), syn.blockComment[1]), lexComment)
+		case syn.tripleQuotes && (strings.HasPrefix(rest, `"""`) || strings.HasPrefix(rest, `'''`)):
+			i = mark(i, through(i+3, rest[:3]), lexString)
+		case strings.IndexByte(syn.rawQuotes, src[i]) >= 0:
+			i = mark(i, through(i+1, src[i:i+1]), lexString)
+		case strings.IndexByte(syn.quotes, src[i]) >= 0:
+			// Unterminated strings end at the line, so one stray quote
+			// cannot swallow the rest of the file
+			j := i + 1
+			for j < len(src) && src[j] != src[i] && src[j] != '\n' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j < len(src) && src[j] == src[i] {
+				j++
+			}
+			i = mark(i, j, lexString)
+		default:
+			i++
+		}
+	}
+	return classes
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
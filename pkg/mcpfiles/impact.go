@@ -0,0 +1,202 @@
+package mcpfiles
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxImpactFiles caps the uncommitted files an impact report lists
+const maxImpactFiles = 100
+
+// Impact is what moving or deleting a file or directory would affect, as
+// reported by dry runs and to approval reviewers
+type Impact struct {
+	Path  string `json:"path"`
+	IsDir bool   `json:"is_dir"`
+	Files int    `json:"files"` // files moved or deleted
+	// References are lines of other files that refer to the path and would
+	// be left pointing at nothing
+	References          []FileUsage `json:"references"`
+	ReferencesTruncated bool        `json:"references_truncated"`
+	// Reservations of any session that overlap the path or the destination
+	Reservations []Reservation `json:"reservations"`
+	Git          *GitStatus    `json:"git,omitempty"` // nil when git is unavailable
+}
+
+// GitStatus is how git sees the files a change would move or delete
+type GitStatus struct {
+	Repository bool `json:"repository"` // the base path is in a git work tree
+	Tracked    int  `json:"tracked"`    // files git tracks
+	// Uncommitted are files with changes not yet committed, or not tracked
+	// at all, which a delete would lose for good
+	Uncommitted []string `json:"uncommitted"`
+	Truncated   bool     `json:"truncated,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// impact reports what moving or deleting fullPath would affect. dest is the
+// destination of a move, or empty.
+func (s *Server) impact(ctx context.Context, fullPath string, isDir bool, dest string) (*Impact, error) {
+	relPath, _ := filepath.Rel(s.config.BasePath, fullPath)
+	relPath = filepath.ToSlash(relPath)
+	report := &Impact{Path: relPath, IsDir: isDir, Files: 1}
+	if isDir {
+		files, err := s.filesUnder(fullPath)
+		if err != nil {
+			return nil, err
+		}
+		report.Files = len(files)
+	}
+
+	usages, truncated, err := s.findFileUsages(ctx, fullPath, isDir)
+	if err != nil {
+		return nil, err
+	}
+	report.References, report.ReferencesTruncated = usages, truncated
+
+	session := sessionID(ctx)
+	report.Reservations = s.reservations.list(session, relPath)
+	if dest != "" {
+		relDest, _ := filepath.Rel(s.config.BasePath, dest)
+		seen := map[Reservation]bool{}
+		for _, reservation := range report.Reservations {
+			seen[reservation] = true
+		}
+		for _, reservation := range s.reservations.list(session, filepath.ToSlash(relDest)) {
+			if !seen[reservation] {
+				report.Reservations = append(report.Reservations, reservation)
+			}
+		}
+		sortReservations(report.Reservations)
+	}
+
+	report.Git = s.gitStatus(ctx, relPath)
+	return report, nil
+}
+
+// gitStatus asks git about the files at relPath, or returns nil when git
+// cannot be used
+func (s *Server) gitStatus(ctx context.Context, relPath string) *GitStatus {
+	git := s.config.externalTool("git")
+	if s.realBase == "" || !git.Available {
+		return nil
+	}
+	run := func(args ...string) ([]byte, bool, error) {
+		args = append([]string{"-C", s.config.BasePath}, args...)
+		out, err := runCommand(ctx, commandLimits{Timeout: s.config.FSTimeout, MaxOutput: s.config.MaxGrepOutput}, git.Binary, args...)
+		if err != nil {
+			return nil, false, err
+		}
+		return out.Stdout, out.ExitCode == 0, nil
+	}
+
+	// Paths from git status are relative to the top of the work tree
+	prefix, ok, err := run("rev-parse", "--show-prefix")
+	if err != nil {
+		return &GitStatus{Error: err.Error(), Uncommitted: []string{}}
+	}
+	status := &GitStatus{Repository: ok, Uncommitted: []string{}}
+	if !ok {
+		return status
+	}
+	top := strings.TrimSpace(string(prefix))
+	visible := func(p string) bool {
+		return !s.hidden.ShouldIgnore(filepath.Join(s.config.BasePath, filepath.FromSlash(p)))
+	}
+
+	tracked, _, err := run("ls-files", "-z", "--", relPath)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	for _, p := range bytes.Split(tracked, []byte{0}) {
+		if len(p) > 0 && visible(string(p)) {
+			status.Tracked++
+		}
+	}
+
+	changed, _, err := run("status", "--porcelain", "-z", "--untracked-files=all", "--", relPath)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	entries := bytes.Split(changed, []byte{0})
+	for i := 0; i < len(entries); i++ {
+		entry := string(entries[i])
+		if len(entry) < 4 {
+			continue
+		}
+		if entry[0] == 'R' || entry[0] == 'C' {
+			i++ // the path the entry was renamed or copied from follows
+		}
+		p := strings.TrimPrefix(entry[3:], top)
+		if !visible(p) {
+			continue
+		}
+		if len(status.Uncommitted) == maxImpactFiles {
+			status.Truncated = true
+			break
+		}
+		status.Uncommitted = append(status.Uncommitted, p)
+	}
+	return status
+}
+
+// changeImpact reports what a move or delete queued for approval would
+// affect, with paths as the caller gives them, or nil for other changes and
+// calls that cannot be resolved
+func (s *Server) changeImpact(ctx context.Context, request mcp.CallToolRequest) json.RawMessage {
+	tool := request.Params.Name
+	rs, args := s.callServer(ctx), request.GetArguments()
+	if len(rs.roots) > 1 {
+		index, plain, err := rs.selectRoot(args)
+		if err != nil {
+			return nil
+		}
+		rs, args = rs.roots[index], plain
+	}
+	arg := func(key string) string {
+		value, _ := args[key].(string)
+		return value
+	}
+
+	var fullPath, dest string
+	var err error
+	switch tool {
+	case "delete_file":
+		fullPath, err = rs.validateFilePath(arg("file_path"))
+	case "delete_directory":
+		fullPath, err = rs.validateFilePath(arg("path"))
+	case "move_file":
+		if fullPath, err = rs.validateFilePath(arg("source")); err == nil {
+			dest, err = rs.validateFilePath(arg("destination"))
+		}
+	default:
+		return nil
+	}
+	if err != nil {
+		return nil
+	}
+	info, err := rs.guard.Stat(fullPath)
+	if err != nil {
+		return nil
+	}
+	impact, err := rs.impact(ctx, fullPath, info.IsDir(), dest)
+	if err != nil {
+		return nil
+	}
+
+	var value any
+	data, _ := json.Marshal(impact)
+	if rs.root == "" || json.Unmarshal(data, &value) != nil {
+		return data
+	}
+	prefixPaths(value, rs.root, tool)
+	data, _ = json.Marshal(value)
+	return data
+}
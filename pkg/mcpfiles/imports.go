@@ -0,0 +1,229 @@
+package mcpfiles
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+// maxImportScanLines bounds how far into a file the import block is looked for
+const maxImportScanLines = 1000
+
+// ImportBlock is the import/include section of a source file
+type ImportBlock struct {
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Content   string `json:"content"`
+}
+
+// importSyntax describes how one language spells its imports
+type importSyntax struct {
+	statement    *regexp.Regexp // line that starts an import statement
+	preamble     *regexp.Regexp // other lines allowed before or between imports
+	terminator   string         // statement runs until this appears, if set
+	brackets     bool           // statement runs until brackets balance
+	lineComments []string
+	blockComment [2]string // opening and closing delimiter, if any
+}
+
+var (
+	cLikeComment   = [2]string{"/*", "*/"}
+	slashComments  = []string{"//"}
+	hashComments   = []string{"#"}
+	pythonDocQuote = [2]string{`"""`, `"""`}
+)
+
+// importSyntaxes maps file extensions to their import syntax. Go is parsed
+// with go/parser instead.
+var importSyntaxes = func() map[string]*importSyntax {
+	python := &importSyntax{
+		statement:    regexp.MustCompile(`^(import|from)\s`),
+		brackets:     true,
+		lineComments: hashComments,
+		blockComment: pythonDocQuote,
+	}
+	javascript := &importSyntax{
+		statement:    regexp.MustCompile(`^(import[\s{*'"]|export\s.*\sfrom\s|(const|let|var)\s.*=\s*require\()`),
+		preamble:     regexp.MustCompile(`^['"]use \w+['"];?$`),
+		brackets:     true,
+		lineComments: slashComments,
+		blockComment: cLikeComment,
+	}
+	c := &importSyntax{
+		statement:    regexp.MustCompile(`^#\s*(include|import)\b`),
+		preamble:     regexp.MustCompile(`^#\s*(pragma|if|ifdef|ifndef|define|else|elif|endif)\b`),
+		lineComments: slashComments,
+		blockComment: cLikeComment,
+	}
+	java := &importSyntax{
+		statement:    regexp.MustCompile(`^import\s`),
+		preamble:     regexp.MustCompile(`^(package\s|@file:)`),
+		lineComments: slashComments,
+		blockComment: cLikeComment,
+	}
+	rust := &importSyntax{
+		statement:    regexp.MustCompile(`^(pub(\([^)]*\))?\s+)?(use|extern\s+crate)\s`),
+		preamble:     regexp.MustCompile(`^#!?\[`),
+		terminator:   ";",
+		lineComments: slashComments,
+		blockComment: cLikeComment,
+	}
+	csharp := &importSyntax{
+		statement:    regexp.MustCompile(`^(global\s+)?using\s[^(]*;`),
+		lineComments: slashComments,
+		blockComment: cLikeComment,
+	}
+	php := &importSyntax{
+		statement:    regexp.MustCompile(`^(use\s|(require|include)(_once)?\b)`),
+		preamble:     regexp.MustCompile(`^(<\?php|namespace\s|declare\s*\()`),
+		terminator:   ";",
+		lineComments: []string{"//", "#"},
+		blockComment: cLikeComment,
+	}
+	ruby := &importSyntax{
+		statement:    regexp.MustCompile(`^(require|require_relative|load)\b`),
+		lineComments: hashComments,
+	}
+	swift := &importSyntax{
+		statement:    regexp.MustCompile(`^(@\w+\s+)?import\s`),
+		lineComments: slashComments,
+		blockComment: cLikeComment,
+	}
+
+	return map[string]*importSyntax{
+		".py": python, ".pyi": python,
+		".js": javascript, ".jsx": javascript, ".mjs": javascript, ".cjs": javascript,
+		".ts": javascript, ".tsx": javascript, ".mts": javascript, ".cts": javascript,
+		".c": c, ".h": c, ".cc": c, ".cpp": c, ".cxx": c, ".hpp": c, ".hh": c, ".m": c, ".mm": c,
+		".java": java, ".kt": java, ".kts": java, ".scala": java, ".groovy": java,
+		".rs":    rust,
+		".cs":    csharp,
+		".php":   php,
+		".rb":    ruby,
+		".swift": swift,
+	}
+}()
+
+// extractImports returns the import block of a source file, given the
+// extension sourceExtension selects for it, or nil if the language is
+// unknown or the file has no imports
+func extractImports(ext string, src []byte) *ImportBlock {
+	if ext == ".go" {
+		return goImports(src)
+	}
+	if syntax, ok := importSyntaxes[ext]; ok {
+		return syntax.scan(src)
+	}
+	return nil
+}
+
+// goImports finds the span of a Go file's import declarations
+func goImports(src []byte) *ImportBlock {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ImportsOnly)
+	if err != nil || len(file.Imports) == 0 {
+		return nil
+	}
+
+	start, end := 0, 0
+	for _, decl := range file.Decls {
+		first, last := fset.Position(decl.Pos()).Line, fset.Position(decl.End()).Line
+		if start == 0 {
+			start = first
+		}
+		end = last
+	}
+	return importBlock(src, start, end)
+}
+
+// scan walks the top of a file until the first line of code, returning the
+// span from the first to the last import statement
+func (syn *importSyntax) scan(src []byte) *ImportBlock {
+	lines := strings.Split(string(src), "\n")
+	if len(lines) > maxImportScanLines {
+		lines = lines[:maxImportScanLines]
+	}
+
+	start, end := 0, 0
+	var statement strings.Builder // open multi-line statement
+	inComment := false
+	for i, raw := range lines {
+		line := strings.TrimSpace(raw)
+		lineNum := i + 1
+
+		switch {
+		case statement.Len() > 0:
+			statement.WriteString(line)
+			end = lineNum
+			if !syn.open(statement.String()) {
+				statement.Reset()
+			}
+		case inComment:
+			if strings.Contains(line, syn.blockComment[1]) {
+				inComment = false
+			}
+		case syn.blockComment[0] != "" && strings.HasPrefix(line, syn.blockComment[0]):
+			rest := line[len(syn.blockComment[0]):]
+			inComment = !strings.Contains(rest, syn.blockComment[1])
+		case line == "" || syn.isLineComment(line):
+		case syn.statement.MatchString(line):
+			if start == 0 {
+				start = lineNum
+			}
+			end = lineNum
+			if syn.open(line) {
+				statement.WriteString(line)
+			}
+		case syn.preamble != nil && syn.preamble.MatchString(line):
+		default:
+			// First line of code
+			return importBlock(src, start, end)
+		}
+	}
+	return importBlock(src, start, end)
+}
+
+// open reports whether an import statement continues past the text so far
+func (syn *importSyntax) open(statement string) bool {
+	if syn.terminator != "" {
+		return !strings.Contains(statement, syn.terminator)
+	}
+	if syn.brackets {
+		depth := 0
+		for _, c := range statement {
+			switch c {
+			case '(', '{', '[':
+				depth++
+			case ')', '}', ']':
+				depth--
+			}
+		}
+		return depth > 0
+	}
+	return false
+}
+
+func (syn *importSyntax) isLineComment(line string) bool {
+	for _, prefix := range syn.lineComments {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// importBlock cuts lines start..end (1-based, inclusive) out of src
+func importBlock(src []byte, start, end int) *ImportBlock {
+	if start == 0 {
+		return nil
+	}
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	content := bytes.Join(lines[start-1:end], nil)
+	return &ImportBlock{
+		StartLine: start,
+		EndLine:   end,
+		Content:   strings.TrimRight(string(content), "\r\n"),
+	}
+}
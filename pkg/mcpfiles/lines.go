@@ -0,0 +1,200 @@
+package mcpfiles
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	errLineRangeTooLarge = errors.New("line range too large")
+	errStreamedUTF16     = errors.New("line ranges of UTF-16 files over the size limit are not supported")
+)
+
+// lineRange is the text of lines start through end of a file, 1-based and
+// inclusive. Line numbers are 0 when unknown; total is unknown when reading
+// stopped before the end of the file.
+type lineRange struct {
+	data       []byte
+	start, end int
+	total      int
+}
+
+// readLines reads lines start through end from r, or through the last line
+// when end is 0, failing once they hold more than maxBytes. Lines end as
+// lineStarts ends them: a final newline does not start an empty line.
+func readLines(r io.Reader, start, end int, maxBytes int64) (lineRange, error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	if head, _ := br.Peek(2); bytes.Equal(head, bomUTF16LE) || bytes.Equal(head, bomUTF16BE) {
+		return lineRange{}, errStreamedUTF16
+	}
+
+	lr := lineRange{start: start}
+	line := 1
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if line >= start && (end == 0 || line <= end) {
+			if int64(len(lr.data)+len(chunk)) > maxBytes {
+				return lineRange{}, errLineRangeTooLarge
+			}
+			lr.data = append(lr.data, chunk...)
+		}
+		switch {
+		case err == bufio.ErrBufferFull:
+			// The line goes on past the buffer
+			continue
+		case err == io.EOF:
+			if len(chunk) == 0 {
+				line--
+			}
+			lr.total, lr.end = line, line
+			if end > 0 {
+				lr.end = min(end, line)
+			}
+			return lr, nil
+		case err != nil:
+			return lineRange{}, err
+		}
+		if line == end {
+			lr.end = end
+			if _, err := br.Peek(1); err == io.EOF {
+				lr.total = end
+			}
+			return lr, nil
+		}
+		line++
+	}
+}
+
+// tailChunkSize is how much readTail reads at a time from the end of a file
+const tailChunkSize = 64 << 10
+
+// readTail reads the last n lines of r, failing once they hold more than
+// maxBytes. Readers that can seek are read backwards from the end, so line
+// numbers stay 0 (unknown) unless the tail reaches the start of the file.
+func readTail(r io.Reader, n int, maxBytes int64) (lineRange, error) {
+	rs, ok := r.(io.ReadSeeker)
+	if !ok {
+		return readTailForward(r, n, maxBytes)
+	}
+	head := make([]byte, 2)
+	if k, _ := io.ReadFull(rs, head); k == 2 && (bytes.Equal(head, bomUTF16LE) || bytes.Equal(head, bomUTF16BE)) {
+		return lineRange{}, errStreamedUTF16
+	}
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return lineRange{}, err
+	}
+
+	var tail []byte
+	found := 0
+	for pos := size; pos > 0; {
+		step := min(tailChunkSize, pos)
+		pos -= step
+		chunk := make([]byte, step)
+		if _, err := rs.Seek(pos, io.SeekStart); err != nil {
+			return lineRange{}, err
+		}
+		if _, err := io.ReadFull(rs, chunk); err != nil {
+			return lineRange{}, err
+		}
+		tail = append(chunk, tail...)
+
+		// Count the newlines ending the lines before the tail; a final
+		// newline ends the last line rather than starting another
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] != '\n' || pos+int64(i) == size-1 {
+				continue
+			}
+			if found++; found == n {
+				if int64(len(tail)-i-1) > maxBytes {
+					return lineRange{}, errLineRangeTooLarge
+				}
+				return lineRange{data: tail[i+1:]}, nil
+			}
+		}
+		if int64(len(tail)-len(chunk)) > maxBytes {
+			return lineRange{}, errLineRangeTooLarge
+		}
+	}
+
+	// The tail is the whole file
+	if int64(len(tail)) > maxBytes {
+		return lineRange{}, errLineRangeTooLarge
+	}
+	total := len(lineStarts(tail))
+	return lineRange{data: tail, start: 1, end: total, total: total}, nil
+}
+
+// readTailForward reads the last n lines of a reader that cannot seek by
+// reading it through
+func readTailForward(r io.Reader, n int, maxBytes int64) (lineRange, error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	if head, _ := br.Peek(2); bytes.Equal(head, bomUTF16LE) || bytes.Equal(head, bomUTF16BE) {
+		return lineRange{}, errStreamedUTF16
+	}
+
+	var lines [][]byte
+	var size int64
+	total := 0
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			total++
+			lines = append(lines, line)
+			size += int64(len(line))
+			if len(lines) > n {
+				size -= int64(len(lines[0]))
+				lines = lines[1:]
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return lineRange{}, err
+		}
+	}
+	if size > maxBytes {
+		return lineRange{}, errLineRangeTooLarge
+	}
+	return lineRange{data: bytes.Join(lines, nil), start: total - len(lines) + 1, end: total, total: total}, nil
+}
+
+// tailLines returns the last n lines of text
+func tailLines(text string, n int) lineRange {
+	total := len(lineStarts([]byte(text)))
+	return sliceLines(text, max(total-n+1, 1), 0)
+}
+
+// sliceLines returns lines start through end of text, or through the last
+// line when end is 0
+func sliceLines(text string, start, end int) lineRange {
+	starts := lineStarts([]byte(text))
+	lr := lineRange{start: start, end: len(starts), total: len(starts)}
+	if end > 0 {
+		lr.end = min(end, len(starts))
+	}
+	if start > lr.end {
+		return lr
+	}
+	stop := len(text)
+	if lr.end < len(starts) {
+		stop = starts[lr.end]
+	}
+	lr.data = []byte(text[starts[start-1]:stop])
+	return lr
+}
+
+// checkLineRange validates requested line numbers; 0 means not given
+func checkLineRange(start, end int) error {
+	if start < 0 || end < 0 {
+		return fmt.Errorf("start_line and end_line must be positive")
+	}
+	if end > 0 && start > end {
+		return fmt.Errorf("start_line %d is after end_line %d", start, end)
+	}
+	return nil
+}
@@ -0,0 +1,494 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// LocaleEnglish is the locale messages are written in
+const LocaleEnglish = "en"
+
+// errorPrefix gives the stable code of the errors starting with an English
+// prefix, which a locale may translate
+type errorPrefix struct {
+	prefix string
+	code   string
+}
+
+// errorPrefixes lists the error messages of the tools by how they start.
+// Codes are part of the interface: add prefixes, but never change a code.
+var errorPrefixes = []errorPrefix{
+	{"Missing required parameter", "MISSING_PARAMETER"},
+
+	{"Invalid file path", "INVALID_PATH"},
+	{"Invalid path", "INVALID_PATH"},
+	{"Invalid source path", "INVALID_PATH"},
+	{"Invalid destination path", "INVALID_PATH"},
+
+	{"At least one edit is required", "INVALID_ARGUMENT"},
+	{"At least one search query is required", "INVALID_ARGUMENT"},
+	{"Binary file", "INVALID_ARGUMENT"},
+	{"Cannot move a directory into itself", "INVALID_ARGUMENT"},
+	{"Invalid algorithm", "INVALID_ARGUMENT"},
+	{"Invalid cursor", "INVALID_ARGUMENT"},
+	{"Invalid edits JSON", "INVALID_ARGUMENT"},
+	{"Invalid exclude", "INVALID_ARGUMENT"},
+	{"Invalid file_pattern", "INVALID_ARGUMENT"},
+	{"Invalid files", "INVALID_ARGUMENT"},
+	{"Invalid filter", "INVALID_ARGUMENT"},
+	{"Invalid identifier", "INVALID_ARGUMENT"},
+	{"Invalid kind", "INVALID_ARGUMENT"},
+	{"Invalid line range", "INVALID_ARGUMENT"},
+	{"Invalid max_tokens", "INVALID_ARGUMENT"},
+	{"Invalid modified_after", "INVALID_ARGUMENT"},
+	{"Invalid modified_before", "INVALID_ARGUMENT"},
+	{"Invalid new_name", "INVALID_ARGUMENT"},
+	{"Invalid patch", "INVALID_ARGUMENT"},
+	{"Invalid pattern", "INVALID_ARGUMENT"},
+	{"Invalid patterns", "INVALID_ARGUMENT"},
+	{"Invalid queries JSON", "INVALID_ARGUMENT"},
+	{"Invalid root", "INVALID_ARGUMENT"},
+	{"Invalid snapshot", "INVALID_ARGUMENT"},
+	{"Invalid state", "INVALID_ARGUMENT"},
+	{"Invalid view", "INVALID_ARGUMENT"},
+	{"Source and destination are the same path", "INVALID_ARGUMENT"},
+	{"Unknown tag", "INVALID_ARGUMENT"},
+	{"Unsupported archive format", "INVALID_ARGUMENT"},
+	{"Unsupported file type for docs", "INVALID_ARGUMENT"},
+	{"content_hash must be", "INVALID_ARGUMENT"},
+	{"limit must be positive", "INVALID_ARGUMENT"},
+	{"duration_seconds must be positive", "INVALID_ARGUMENT"},
+	{"max_depth must be positive", "INVALID_ARGUMENT"},
+	{"max_lines must be positive", "INVALID_ARGUMENT"},
+	{"max_entries must be positive", "INVALID_ARGUMENT"},
+	{"max_results must be positive", "INVALID_ARGUMENT"},
+	{"modified_after must be earlier than modified_before", "INVALID_ARGUMENT"},
+	{"offset", "INVALID_ARGUMENT"},
+	{"paths must name at least one file", "INVALID_ARGUMENT"},
+	{"paths must name at least one file or directory", "INVALID_ARGUMENT"},
+	{"query must not be empty", "INVALID_ARGUMENT"},
+	{"start_line", "INVALID_ARGUMENT"},
+	{"ttl_seconds must be between 1 and", "INVALID_ARGUMENT"},
+
+	{"Broken symlink", "NOT_FOUND"},
+	{"Directory not found", "NOT_FOUND"},
+	{"File not found", "NOT_FOUND"},
+	{"File not in view", "NOT_FOUND"},
+	{"Member not found", "NOT_FOUND"},
+	{"Source not found", "NOT_FOUND"},
+	{"Symbol not found", "NOT_FOUND"},
+	{"Unknown change", "NOT_FOUND"},
+	{"Unknown watch", "NOT_FOUND"},
+
+	{"Destination already exists", "ALREADY_EXISTS"},
+	{"File already exists", "ALREADY_EXISTS"},
+
+	{"Cannot delete directory", "WRONG_TYPE"},
+	{"Cannot delete file", "WRONG_TYPE"},
+	{"Cannot edit file", "WRONG_TYPE"},
+	{"Cannot follow file", "WRONG_TYPE"},
+	{"Cannot list", "WRONG_TYPE"},
+	{"Cannot map repository", "WRONG_TYPE"},
+	{"Cannot overwrite", "WRONG_TYPE"},
+	{"Cannot read archive", "WRONG_TYPE"},
+	{"Cannot rename", "WRONG_TYPE"},
+	{"Cannot report API", "WRONG_TYPE"},
+	{"Cannot summarize file", "WRONG_TYPE"},
+	{"Cannot watch", "WRONG_TYPE"},
+	{"Cannot write file", "WRONG_TYPE"},
+
+	{"Content too large", "TOO_LARGE"},
+	{"File too large", "TOO_LARGE"},
+	{"Line range too large", "TOO_LARGE"},
+	{"Too many references to rewrite", "TOO_LARGE"},
+
+	{"Maximum 20 search queries allowed", "LIMIT_EXCEEDED"},
+	{"Too many changes waiting for approval", "LIMIT_EXCEEDED"},
+	{"too many artifacts", "LIMIT_EXCEEDED"},
+	{"too many reservations", "LIMIT_EXCEEDED"},
+	{"too many watches", "LIMIT_EXCEEDED"},
+	{"Rate limit exceeded", "RATE_LIMITED"},
+	{"Call cancelled by the client", "CANCELLED"},
+
+	{"API key", "PERMISSION_DENIED"},
+	{"Denied by write policy", "POLICY_DENIED"},
+
+	{"Failed to decode file", "READ_FAILED"},
+	{"Failed to hash file", "READ_FAILED"},
+	{"Failed to list directory", "READ_FAILED"},
+	{"Failed to preview patch", "READ_FAILED"},
+	{"Failed to preview rename", "READ_FAILED"},
+	{"Failed to preview replacements", "READ_FAILED"},
+	{"Failed to read directory", "READ_FAILED"},
+	{"Failed to read file structure", "READ_FAILED"},
+	{"Failed to read file", "READ_FAILED"},
+	{"Failed to read archive", "READ_FAILED"},
+	{"Failed to read packages", "READ_FAILED"},
+	{"Failed to read source", "READ_FAILED"},
+	{"Failed to search for identifier", "READ_FAILED"},
+	{"Failed to search for references", "READ_FAILED"},
+	{"Failed to search for usages", "READ_FAILED"},
+	{"Failed to stat destination", "READ_FAILED"},
+	{"Failed to stat file", "READ_FAILED"},
+	{"Failed to watch", "READ_FAILED"},
+
+	{"Failed to apply edits", "WRITE_FAILED"},
+	{"Failed to create directory", "WRITE_FAILED"},
+	{"Failed to delete directory", "WRITE_FAILED"},
+	{"Failed to delete file", "WRITE_FAILED"},
+	{"Failed to encode content", "WRITE_FAILED"},
+	{"Failed to move", "WRITE_FAILED"},
+	{"Failed to write file", "WRITE_FAILED"},
+
+	{"Failed to summarize file", "UPSTREAM_FAILED"},
+
+	{"Failed to marshal result", "INTERNAL"},
+}
+
+// errorCodeUnknown is the code of errors no prefix matches
+const errorCodeUnknown = "TOOL_ERROR"
+
+// errorPhrases are translated wherever they appear in an error message,
+// such as the reasons file system errors give
+var errorPhrases = []string{
+	"path not allowed by the configured allow and deny lists",
+	"path outside of allowed directory",
+	"path escapes the base path through a symlink",
+	"path traversal not allowed",
+	"file does not exist",
+	"no such file or directory",
+	"permission denied",
+	"is a directory",
+	"not a directory",
+	"directory is not empty; set recursive to delete its contents",
+	"set overwrite to replace it",
+	"retry later",
+}
+
+// summaryMessages are the fixed human-readable notes of tool results
+var summaryMessages = []string{
+	"Filtered out .git directory and .gitignore patterns",
+	"stopped after %d entries",
+	"The change was queued and takes effect once a reviewer approves it",
+}
+
+// builtinMessages translate the messages above, keyed by their English text.
+// Prefixes and phrases without a translation stay in English.
+var builtinMessages = map[string]map[string]string{
+	"de": {
+		"Missing required parameter":                              "Erforderlicher Parameter fehlt",
+		"Invalid file path":                                       "Ungültiger Dateipfad",
+		"Invalid path":                                            "Ungültiger Pfad",
+		"Invalid source path":                                     "Ungültiger Quellpfad",
+		"Invalid destination path":                                "Ungültiger Zielpfad",
+		"At least one edit is required":                           "Mindestens eine Änderung ist erforderlich",
+		"At least one search query is required":                   "Mindestens eine Suchanfrage ist erforderlich",
+		"Cannot move a directory into itself":                     "Ein Verzeichnis kann nicht in sich selbst verschoben werden",
+		"Invalid line range":                                      "Ungültiger Zeilenbereich",
+		"Invalid view":                                            "Ungültige Ansicht",
+		"Source and destination are the same path":                "Quelle und Ziel sind derselbe Pfad",
+		"Directory not found":                                     "Verzeichnis nicht gefunden",
+		"File not found":                                          "Datei nicht gefunden",
+		"Source not found":                                        "Quelle nicht gefunden",
+		"Destination already exists":                              "Ziel existiert bereits",
+		"File already exists":                                     "Datei existiert bereits",
+		"Cannot delete directory":                                 "Verzeichnis kann nicht gelöscht werden",
+		"Cannot delete file":                                      "Datei kann nicht gelöscht werden",
+		"Cannot edit file":                                        "Datei kann nicht bearbeitet werden",
+		"Cannot write file":                                       "Datei kann nicht geschrieben werden",
+		"Cannot summarize file":                                   "Datei kann nicht zusammengefasst werden",
+		"Cannot map repository":                                   "Repository kann nicht kartiert werden",
+		"Failed to summarize file":                                "Datei konnte nicht zusammengefasst werden",
+		"Content too large":                                       "Inhalt zu groß",
+		"File too large":                                          "Datei zu groß",
+		"Rate limit exceeded":                                     "Anfragelimit überschritten",
+		"Call cancelled by the client":                            "Aufruf vom Client abgebrochen",
+		"Denied by write policy":                                  "Von der Schreibrichtlinie abgelehnt",
+		"Failed to list directory":                                "Verzeichnis konnte nicht aufgelistet werden",
+		"Failed to read directory":                                "Verzeichnis konnte nicht gelesen werden",
+		"Failed to read file structure":                           "Dateistruktur konnte nicht gelesen werden",
+		"Failed to read file":                                     "Datei konnte nicht gelesen werden",
+		"Failed to create directory":                              "Verzeichnis konnte nicht erstellt werden",
+		"Failed to delete directory":                              "Verzeichnis konnte nicht gelöscht werden",
+		"Failed to delete file":                                   "Datei konnte nicht gelöscht werden",
+		"Failed to move":                                          "Verschieben fehlgeschlagen",
+		"Failed to write file":                                    "Datei konnte nicht geschrieben werden",
+		"path not allowed by the configured allow and deny lists": "Pfad durch die konfigurierten Erlaubt- und Sperrlisten nicht zugelassen",
+		"path outside of allowed directory":                       "Pfad außerhalb des erlaubten Verzeichnisses",
+		"path escapes the base path through a symlink":            "Pfad verlässt das Basisverzeichnis über einen symbolischen Link",
+		"path traversal not allowed":                              "Verzeichniswechsel nach oben nicht erlaubt",
+		"file does not exist":                                     "Datei existiert nicht",
+		"no such file or directory":                               "Datei oder Verzeichnis nicht gefunden",
+		"permission denied":                                       "Zugriff verweigert",
+		"is a directory":                                          "ist ein Verzeichnis",
+		"not a directory":                                         "kein Verzeichnis",
+		"directory is not empty; set recursive to delete its contents":       "Verzeichnis ist nicht leer; recursive setzen, um den Inhalt zu löschen",
+		"set overwrite to replace it":                                        "overwrite setzen, um es zu ersetzen",
+		"retry later":                                                        "später erneut versuchen",
+		"Filtered out .git directory and .gitignore patterns":                "Das .git-Verzeichnis und .gitignore-Muster wurden ausgeblendet",
+		"stopped after %d entries":                                           "nach %d Einträgen abgebrochen",
+		"The change was queued and takes effect once a reviewer approves it": "Die Änderung wurde vorgemerkt und wird wirksam, sobald sie freigegeben ist",
+	},
+	"es": {
+		"Missing required parameter":                              "Falta un parámetro obligatorio",
+		"Invalid file path":                                       "Ruta de archivo no válida",
+		"Invalid path":                                            "Ruta no válida",
+		"Invalid source path":                                     "Ruta de origen no válida",
+		"Invalid destination path":                                "Ruta de destino no válida",
+		"At least one edit is required":                           "Se requiere al menos una edición",
+		"At least one search query is required":                   "Se requiere al menos una consulta de búsqueda",
+		"Cannot move a directory into itself":                     "No se puede mover un directorio dentro de sí mismo",
+		"Invalid line range":                                      "Rango de líneas no válido",
+		"Invalid view":                                            "Vista no válida",
+		"Source and destination are the same path":                "El origen y el destino son la misma ruta",
+		"Directory not found":                                     "Directorio no encontrado",
+		"File not found":                                          "Archivo no encontrado",
+		"Source not found":                                        "Origen no encontrado",
+		"Destination already exists":                              "El destino ya existe",
+		"File already exists":                                     "El archivo ya existe",
+		"Cannot delete directory":                                 "No se puede eliminar el directorio",
+		"Cannot delete file":                                      "No se puede eliminar el archivo",
+		"Cannot edit file":                                        "No se puede editar el archivo",
+		"Cannot write file":                                       "No se puede escribir el archivo",
+		"Cannot summarize file":                                   "No se puede resumir el archivo",
+		"Cannot map repository":                                   "No se puede generar el mapa del repositorio",
+		"Failed to summarize file":                                "No se pudo resumir el archivo",
+		"Content too large":                                       "Contenido demasiado grande",
+		"File too large":                                          "Archivo demasiado grande",
+		"Rate limit exceeded":                                     "Límite de solicitudes superado",
+		"Call cancelled by the client":                            "Llamada cancelada por el cliente",
+		"Denied by write policy":                                  "Denegado por la política de escritura",
+		"Failed to list directory":                                "No se pudo listar el directorio",
+		"Failed to read directory":                                "No se pudo leer el directorio",
+		"Failed to read file structure":                           "No se pudo leer la estructura de archivos",
+		"Failed to read file":                                     "No se pudo leer el archivo",
+		"Failed to create directory":                              "No se pudo crear el directorio",
+		"Failed to delete directory":                              "No se pudo eliminar el directorio",
+		"Failed to delete file":                                   "No se pudo eliminar el archivo",
+		"Failed to move":                                          "No se pudo mover",
+		"Failed to write file":                                    "No se pudo escribir el archivo",
+		"path not allowed by the configured allow and deny lists": "ruta no permitida por las listas de permitidos y denegados configuradas",
+		"path outside of allowed directory":                       "ruta fuera del directorio permitido",
+		"path escapes the base path through a symlink":            "la ruta sale del directorio base a través de un enlace simbólico",
+		"path traversal not allowed":                              "no se permite salir del directorio",
+		"file does not exist":                                     "el archivo no existe",
+		"no such file or directory":                               "no existe el archivo o el directorio",
+		"permission denied":                                       "permiso denegado",
+		"is a directory":                                          "es un directorio",
+		"not a directory":                                         "no es un directorio",
+		"directory is not empty; set recursive to delete its contents":       "el directorio no está vacío; use recursive para eliminar su contenido",
+		"set overwrite to replace it":                                        "use overwrite para reemplazarlo",
+		"retry later":                                                        "inténtelo más tarde",
+		"Filtered out .git directory and .gitignore patterns":                "Se omitieron el directorio .git y los patrones de .gitignore",
+		"stopped after %d entries":                                           "se detuvo tras %d entradas",
+		"The change was queued and takes effect once a reviewer approves it": "El cambio quedó en cola y se aplicará cuando un revisor lo apruebe",
+	},
+	"fr": {
+		"Missing required parameter":                              "Paramètre obligatoire manquant",
+		"Invalid file path":                                       "Chemin de fichier invalide",
+		"Invalid path":                                            "Chemin invalide",
+		"Invalid source path":                                     "Chemin source invalide",
+		"Invalid destination path":                                "Chemin de destination invalide",
+		"At least one edit is required":                           "Au moins une modification est requise",
+		"At least one search query is required":                   "Au moins une requête de recherche est requise",
+		"Cannot move a directory into itself":                     "Impossible de déplacer un répertoire dans lui-même",
+		"Invalid line range":                                      "Plage de lignes invalide",
+		"Invalid view":                                            "Vue invalide",
+		"Source and destination are the same path":                "La source et la destination sont le même chemin",
+		"Directory not found":                                     "Répertoire introuvable",
+		"File not found":                                          "Fichier introuvable",
+		"Source not found":                                        "Source introuvable",
+		"Destination already exists":                              "La destination existe déjà",
+		"File already exists":                                     "Le fichier existe déjà",
+		"Cannot delete directory":                                 "Impossible de supprimer le répertoire",
+		"Cannot delete file":                                      "Impossible de supprimer le fichier",
+		"Cannot edit file":                                        "Impossible de modifier le fichier",
+		"Cannot write file":                                       "Impossible d'écrire le fichier",
+		"Cannot summarize file":                                   "Impossible de résumer le fichier",
+		"Cannot map repository":                                   "Impossible de cartographier le dépôt",
+		"Failed to summarize file":                                "Échec du résumé du fichier",
+		"Content too large":                                       "Contenu trop volumineux",
+		"File too large":                                          "Fichier trop volumineux",
+		"Rate limit exceeded":                                     "Limite de requêtes dépassée",
+		"Call cancelled by the client":                            "Appel annulé par le client",
+		"Denied by write policy":                                  "Refusé par la politique d'écriture",
+		"Failed to list directory":                                "Impossible de lister le répertoire",
+		"Failed to read directory":                                "Impossible de lire le répertoire",
+		"Failed to read file structure":                           "Impossible de lire l'arborescence",
+		"Failed to read file":                                     "Impossible de lire le fichier",
+		"Failed to create directory":                              "Impossible de créer le répertoire",
+		"Failed to delete directory":                              "Impossible de supprimer le répertoire",
+		"Failed to delete file":                                   "Impossible de supprimer le fichier",
+		"Failed to move":                                          "Échec du déplacement",
+		"Failed to write file":                                    "Impossible d'écrire le fichier",
+		"path not allowed by the configured allow and deny lists": "chemin refusé par les listes d'autorisation et d'interdiction configurées",
+		"path outside of allowed directory":                       "chemin en dehors du répertoire autorisé",
+		"path escapes the base path through a symlink":            "le chemin sort du répertoire de base par un lien symbolique",
+		"path traversal not allowed":                              "remontée de répertoire interdite",
+		"file does not exist":                                     "le fichier n'existe pas",
+		"no such file or directory":                               "aucun fichier ou dossier de ce nom",
+		"permission denied":                                       "permission refusée",
+		"is a directory":                                          "est un répertoire",
+		"not a directory":                                         "n'est pas un répertoire",
+		"directory is not empty; set recursive to delete its contents":       "le répertoire n'est pas vide ; utilisez recursive pour supprimer son contenu",
+		"set overwrite to replace it":                                        "utilisez overwrite pour le remplacer",
+		"retry later":                                                        "réessayez plus tard",
+		"Filtered out .git directory and .gitignore patterns":                "Le répertoire .git et les motifs .gitignore ont été exclus",
+		"stopped after %d entries":                                           "arrêté après %d entrées",
+		"The change was queued and takes effect once a reviewer approves it": "La modification est en attente et prendra effet après approbation",
+	},
+}
+
+// loadLocaleMessages reads a locale file of the form {"messages": {...}},
+// translations keyed by the English messages
+func loadLocaleMessages(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Messages map[string]string `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid locale config: %w", err)
+	}
+
+	return file.Messages, nil
+}
+
+// normalizeLocale lowercases a locale tag such as pt_BR into pt-br
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// mergeLocaleMessages applies configured translations over the built-in ones
+// of a locale, or of its language for tags such as de-ch
+func mergeLocaleMessages(locale string, configured map[string]string) (map[string]string, error) {
+	known := map[string]bool{}
+	for _, p := range errorPrefixes {
+		known[p.prefix] = true
+	}
+	for _, text := range append(append([]string{}, errorPhrases...), summaryMessages...) {
+		known[text] = true
+	}
+	for text, translated := range configured {
+		if !known[text] {
+			return nil, fmt.Errorf("unknown message %q in locale config", text)
+		}
+		// Counts are formatted into messages after they are translated
+		if strings.Contains(text, "%d") && (strings.Count(translated, "%") != 1 || !strings.Contains(translated, "%d")) {
+			return nil, fmt.Errorf("translation of %q in locale config must contain %%d once", text)
+		}
+	}
+
+	builtin, ok := builtinMessages[locale]
+	if !ok {
+		language, _, _ := strings.Cut(locale, "-")
+		builtin, ok = builtinMessages[language]
+	}
+	if !ok && locale != LocaleEnglish && !strings.HasPrefix(locale, LocaleEnglish+"-") && len(configured) == 0 {
+		languages := []string{LocaleEnglish}
+		for language := range builtinMessages {
+			languages = append(languages, language)
+		}
+		sort.Strings(languages)
+		return nil, fmt.Errorf("unsupported locale %q (built in: %s; give others with -locale-config)", locale, strings.Join(languages, ", "))
+	}
+
+	messages := make(map[string]string, len(builtin)+len(configured))
+	for text, translated := range builtin {
+		messages[text] = translated
+	}
+	for text, translated := range configured {
+		messages[text] = translated
+	}
+	return messages, nil
+}
+
+// localize translates a fixed message into the configured locale
+func (s *Server) localize(text string) string {
+	if translated, ok := s.config.Messages[text]; ok {
+		return translated
+	}
+	return text
+}
+
+// errorCode returns the stable code of an error message and the English
+// prefix it was found by, if any
+func errorCode(text string) (string, string) {
+	// Structured errors carry their own code
+	var structured struct {
+		Code string `json:"code"`
+	}
+	if strings.HasPrefix(text, "{") && json.Unmarshal([]byte(text), &structured) == nil && structured.Code != "" {
+		return structured.Code, ""
+	}
+
+	code, prefix := errorCodeUnknown, ""
+	for _, p := range errorPrefixes {
+		if len(p.prefix) <= len(prefix) || !strings.HasPrefix(text, p.prefix) {
+			continue
+		}
+		// Match whole words, so Invalid path does not take Invalid paths
+		if rest := text[len(p.prefix):]; rest == "" || strings.ContainsAny(rest[:1], ":( ;,") {
+			code, prefix = p.code, p.prefix
+		}
+	}
+	return code, prefix
+}
+
+// localizeError translates an error message
+func (s *Server) localizeError(text, prefix string) string {
+	if len(s.config.Messages) == 0 || strings.HasPrefix(text, "{") {
+		return text
+	}
+	rest := text[len(prefix):]
+	for _, phrase := range errorPhrases {
+		if translated, ok := s.config.Messages[phrase]; ok {
+			rest = strings.ReplaceAll(rest, phrase, translated)
+		}
+	}
+	return s.localize(prefix) + rest
+}
+
+// localeMiddleware gives error results a stable code in their _meta, which
+// stays the same whatever the locale, and translates their text. The layers
+// below, such as the audit log, see the English messages.
+func (s *Server) localeMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := next(ctx, request)
+		if result == nil || !result.IsError {
+			return result, err
+		}
+
+		code := ""
+		for i, content := range result.Content {
+			text, ok := content.(mcp.TextContent)
+			if !ok {
+				continue
+			}
+			var prefix string
+			if code == "" {
+				code, prefix = errorCode(text.Text)
+			}
+			text.Text = s.localizeError(text.Text, prefix)
+			result.Content[i] = text
+		}
+		if code != "" {
+			if result.Meta == nil {
+				result.Meta = map[string]any{}
+			}
+			result.Meta["error_code"] = code
+		}
+
+		return result, err
+	}
+}
@@ -0,0 +1,38 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTruncatedTreeNoteIsLocalized(t *testing.T) {
+	s := newTestServer(t, &Config{Locale: "de", MaxTreeNodes: 2}, map[string]string{"a.txt": "a", "b.txt": "b"})
+
+	text, isError := callTool(t, context.Background(), s, "read_file_structure", map[string]interface{}{})
+	if isError {
+		t.Fatalf("read_file_structure = %s", text)
+	}
+	var result struct {
+		Note string `json:"note"`
+	}
+	if err := json.Unmarshal([]byte(text), &result); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Das .git-Verzeichnis und .gitignore-Muster wurden ausgeblendet; nach 2 Einträgen abgebrochen"; result.Note != want {
+		t.Errorf("note = %q, want %q", result.Note, want)
+	}
+}
+
+func TestLocaleConfigKeepsCounts(t *testing.T) {
+	if _, err := mergeLocaleMessages("pt", map[string]string{"stopped after %d entries": "parou após %d entradas"}); err != nil {
+		t.Errorf("translation with its count: %v", err)
+	}
+	for _, translated := range []string{"parou", "parou após %s entradas", "%d de %d"} {
+		_, err := mergeLocaleMessages("pt", map[string]string{"stopped after %d entries": translated})
+		if err == nil || !strings.Contains(err.Error(), "must contain %d once") {
+			t.Errorf("translation %q: error = %v", translated, err)
+		}
+	}
+}
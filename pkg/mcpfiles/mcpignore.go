@@ -0,0 +1,148 @@
+package mcpfiles
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// mcpignoreFile names the files of gitignore patterns that hide paths from
+// every tool, for paths that git tracks but agents should not see
+const mcpignoreFile = ".mcpignore"
+
+// HiddenFileSystem wraps a FileSystem and hides the paths a filter matches,
+// as if they did not exist: they are left out of directory listings, cannot
+// be read, and cannot be written, moved or deleted
+type HiddenFileSystem struct {
+	base   FileSystem
+	filter PathFilter
+}
+
+// NewHiddenFileSystem creates a backend that hides the paths filter matches
+func NewHiddenFileSystem(base FileSystem, filter PathFilter) *HiddenFileSystem {
+	return &HiddenFileSystem{
+		base:   base,
+		filter: filter,
+	}
+}
+
+// hide returns the error for an operation on a hidden path, or nil
+func (h *HiddenFileSystem) hide(op, path string, err error) error {
+	if h.filter.ShouldIgnore(path) {
+		return &fs.PathError{Op: op, Path: path, Err: err}
+	}
+	return nil
+}
+
+func (h *HiddenFileSystem) Stat(path string) (os.FileInfo, error) {
+	if err := h.hide("stat", path, fs.ErrNotExist); err != nil {
+		return nil, err
+	}
+	return h.base.Stat(path)
+}
+
+func (h *HiddenFileSystem) Lstat(path string) (os.FileInfo, error) {
+	if err := h.hide("lstat", path, fs.ErrNotExist); err != nil {
+		return nil, err
+	}
+	return h.base.Lstat(path)
+}
+
+// ReadDir leaves hidden entries out of the listing
+func (h *HiddenFileSystem) ReadDir(path string) ([]fs.DirEntry, error) {
+	if err := h.hide("readdir", path, fs.ErrNotExist); err != nil {
+		return nil, err
+	}
+	entries, err := h.base.ReadDir(path)
+	visible := entries[:0]
+	for _, entry := range entries {
+		if !h.filter.ShouldIgnore(path + string(os.PathSeparator) + entry.Name()) {
+			visible = append(visible, entry)
+		}
+	}
+	return visible, err
+}
+
+func (h *HiddenFileSystem) ReadFile(path string) ([]byte, error) {
+	if err := h.hide("read", path, fs.ErrNotExist); err != nil {
+		return nil, err
+	}
+	return h.base.ReadFile(path)
+}
+
+// Open streams a file when the wrapped backend can
+func (h *HiddenFileSystem) Open(path string) (io.ReadCloser, error) {
+	opener, ok := h.base.(FileOpener)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	if err := h.hide("open", path, fs.ErrNotExist); err != nil {
+		return nil, err
+	}
+	return opener.Open(path)
+}
+
+func (h *HiddenFileSystem) WriteFile(path string, data []byte, perm fs.FileMode) error {
+	if err := h.hide("write", path, fs.ErrPermission); err != nil {
+		return err
+	}
+	return h.base.WriteFile(path, data, perm)
+}
+
+func (h *HiddenFileSystem) MkdirAll(path string, perm fs.FileMode) error {
+	if err := h.hide("mkdir", path, fs.ErrPermission); err != nil {
+		return err
+	}
+	return h.base.MkdirAll(path, perm)
+}
+
+func (h *HiddenFileSystem) Remove(path string) error {
+	if err := h.hide("remove", path, fs.ErrNotExist); err != nil {
+		return err
+	}
+	return h.base.Remove(path)
+}
+
+// RemoveAll refuses directories with hidden paths inside, which the caller
+// cannot see to know they would go too
+func (h *HiddenFileSystem) RemoveAll(path string) error {
+	if err := h.hide("remove", path, fs.ErrNotExist); err != nil {
+		return err
+	}
+	if h.holdsHidden(path) {
+		return &fs.PathError{Op: "remove", Path: path, Err: fs.ErrPermission}
+	}
+	return h.base.RemoveAll(path)
+}
+
+// Rename refuses to move directories with hidden paths inside, since the
+// patterns that hide them may not match where they end up
+func (h *HiddenFileSystem) Rename(oldPath, newPath string) error {
+	if err := h.hide("rename", oldPath, fs.ErrNotExist); err != nil {
+		return err
+	}
+	if err := h.hide("rename", newPath, fs.ErrPermission); err != nil {
+		return err
+	}
+	if h.holdsHidden(oldPath) {
+		return &fs.PathError{Op: "rename", Path: oldPath, Err: fs.ErrPermission}
+	}
+	return h.base.Rename(oldPath, newPath)
+}
+
+// holdsHidden reports whether a directory has hidden paths anywhere inside
+func (h *HiddenFileSystem) holdsHidden(dir string) bool {
+	info, err := h.base.Lstat(dir)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	entries, _ := h.base.ReadDir(dir)
+	for _, entry := range entries {
+		child := dir + string(os.PathSeparator) + entry.Name()
+		if h.filter.ShouldIgnore(child) || (entry.IsDir() && h.holdsHidden(child)) {
+			return true
+		}
+	}
+	return false
+}
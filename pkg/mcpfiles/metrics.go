@@ -0,0 +1,84 @@
+package mcpfiles
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Metrics holds counters and gauges exposed in Prometheus text format
+type Metrics struct {
+	mu     sync.Mutex
+	values map[string]float64
+	types  map[string]string
+}
+
+// NewMetrics creates an empty metrics registry
+func NewMetrics() *Metrics {
+	return &Metrics{
+		values: make(map[string]float64),
+		types:  make(map[string]string),
+	}
+}
+
+// metricKey renders a metric name with its label pairs, e.g. calls{tool="x"}
+func metricKey(name string, labels []string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Add increments a counter. Labels are given as alternating names and values.
+func (m *Metrics) Add(name string, value float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.types[name] = "counter"
+	m.values[metricKey(name, labels)] += value
+}
+
+// Set sets a gauge. Labels are given as alternating names and values.
+func (m *Metrics) Set(name string, value float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.types[name] = "gauge"
+	m.values[metricKey(name, labels)] = value
+}
+
+// WritePrometheus writes all metrics in Prometheus text exposition format
+func (m *Metrics) WritePrometheus(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]string, 0, len(m.values))
+	for key := range m.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lastName := ""
+	for _, key := range keys {
+		name := key
+		if i := strings.IndexByte(key, '{'); i >= 0 {
+			name = key[:i]
+		}
+		if name != lastName {
+			fmt.Fprintf(w, "# TYPE %s %s\n", name, m.types[name])
+			lastName = name
+		}
+		fmt.Fprintf(w, "%s %g\n", key, m.values[key])
+	}
+}
+
+// handleMetrics serves the metrics endpoint
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.metrics.WritePrometheus(w)
+}
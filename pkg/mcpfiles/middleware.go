@@ -0,0 +1,226 @@
+package mcpfiles
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Middleware wraps a tool handler with cross-cutting behaviour such as
+// rate limiting, auditing or metrics
+type Middleware = server.ToolHandlerMiddleware
+
+// Chain composes middlewares into one. The first middleware is the outermost
+// layer and sees the call first.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
+
+// WithMiddleware adds custom layers around every tool handler. They run inside
+// the built-in layers, just before the handler itself.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(s *Server) {
+		s.middlewares = append(s.middlewares, middlewares...)
+	}
+}
+
+// handlerChain assembles the layers enabled for this deployment
+func (s *Server) handlerChain() Middleware {
+	layers := []Middleware{s.metricsMiddleware, s.localeMiddleware, s.cancelMiddleware}
+	if s.sessions != nil {
+		layers = append(layers, s.activityMiddleware)
+	}
+	if len(s.config.APIKeys) > 0 {
+		layers = append(layers, s.apiKeyMiddleware)
+	}
+	if s.config.WritePolicy != nil {
+		layers = append(layers, s.policyMiddleware)
+	}
+	// Approved changes run through the layers below, so they are audited
+	// and reported when they are applied rather than when they are queued
+	if s.approvals != nil {
+		layers = append(layers, s.approvalMiddleware)
+	}
+	if s.config.AuditLogPath != "" {
+		layers = append(layers, s.auditMiddleware)
+	}
+	if s.sessionReports != nil {
+		layers = append(layers, s.sessionReportMiddleware)
+	}
+	if s.config.RateLimit > 0 {
+		layers = append(layers, s.rateLimitMiddleware())
+	}
+	layers = append(layers, s.recordingMiddleware)
+	layers = append(layers, s.middlewares...)
+	if s.config.RedactSecrets {
+		layers = append(layers, redactionMiddleware)
+	}
+	return Chain(layers...)
+}
+
+// sessionID returns the calling session's ID, or "" outside a session
+func sessionID(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+// metricsMiddleware counts calls, errors and time spent per tool
+func (s *Server) metricsMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		start := time.Now()
+		result, err := next(ctx, request)
+
+		status := "ok"
+		if err != nil || (result != nil && result.IsError) {
+			status = "error"
+		}
+		tool := request.Params.Name
+		s.metrics.Add("mcp_tool_calls_total", 1, "tool", tool, "status", status)
+		s.metrics.Add("mcp_tool_duration_seconds_total", time.Since(start).Seconds(), "tool", tool)
+
+		return result, err
+	}
+}
+
+// AuditEntry is one line of the audit log
+type AuditEntry struct {
+	Time       time.Time              `json:"time"`
+	Session    string                 `json:"session,omitempty"`
+	APIKey     string                 `json:"api_key,omitempty"` // name of the key the call was made with
+	Grants     []string               `json:"grants,omitempty"`  // IDs of the access grants in force for the session
+	Tool       string                 `json:"tool"`
+	Arguments  map[string]interface{} `json:"arguments"`
+	DurationMs float64                `json:"duration_ms"`
+	IsError    bool                   `json:"is_error"`
+}
+
+// auditMiddleware logs who called which tool with which arguments
+func (s *Server) auditMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		start := time.Now()
+		result, err := next(ctx, request)
+
+		if s.auditLog != nil {
+			entry := AuditEntry{
+				Time:       start.UTC(),
+				Session:    sessionID(ctx),
+				Tool:       request.Params.Name,
+				Arguments:  sanitizeArguments(request.GetArguments()),
+				DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+				IsError:    err != nil || (result != nil && result.IsError),
+				Grants:     s.grantIDs(ctx),
+			}
+			if key := callAPIKey(ctx); key != nil {
+				entry.APIKey = key.Name
+			}
+			if auditErr := s.auditLog.Record(entry); auditErr != nil {
+				log.Printf("Failed to write audit log: %v", auditErr)
+			}
+		}
+
+		return result, err
+	}
+}
+
+// tokenBucket is a simple rate limiter refilled continuously
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimitMiddleware limits each session to config.RateLimit calls per
+// second, with bursts of up to one second's worth of calls
+func (s *Server) rateLimitMiddleware() Middleware {
+	rate := s.config.RateLimit
+	burst := rate
+	if burst < 1 {
+		burst = 1
+	}
+
+	var mu sync.Mutex
+	buckets := make(map[string]*tokenBucket)
+	if s.sessions != nil {
+		s.sessions.onEnd(func(session string) {
+			mu.Lock()
+			defer mu.Unlock()
+			delete(buckets, session)
+		})
+	}
+
+	allow := func(key string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		now := time.Now()
+		bucket, ok := buckets[key]
+		if !ok {
+			bucket = &tokenBucket{tokens: burst, last: now}
+			buckets[key] = bucket
+		}
+		bucket.tokens += now.Sub(bucket.last).Seconds() * rate
+		if bucket.tokens > burst {
+			bucket.tokens = burst
+		}
+		bucket.last = now
+
+		if bucket.tokens < 1 {
+			return false
+		}
+		bucket.tokens--
+		return true
+	}
+
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if !allow(sessionID(ctx)) {
+				s.metrics.Add("mcp_rate_limited_total", 1, "tool", request.Params.Name)
+				return mcp.NewToolResultError(fmt.Sprintf("Rate limit exceeded (%.2f calls/s), retry later", rate)), nil
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// secretPatterns match credentials commonly found in source trees
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`),
+}
+
+// redactionMiddleware masks secrets in tool results before they leave the server
+func redactionMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := next(ctx, request)
+		if result == nil {
+			return result, err
+		}
+
+		for i, content := range result.Content {
+			text, ok := content.(mcp.TextContent)
+			if !ok {
+				continue
+			}
+			for _, pattern := range secretPatterns {
+				text.Text = pattern.ReplaceAllString(text.Text, "[REDACTED]")
+			}
+			result.Content[i] = text
+		}
+
+		return result, err
+	}
+}
@@ -0,0 +1,484 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Statuses of a hunk of apply_patch
+const (
+	hunkApplied  = "applied"
+	hunkRejected = "rejected"
+)
+
+// hunkHeader matches the @@ line that starts a hunk; counts left out are 1
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// PatchHunk is what apply_patch did with one hunk
+type PatchHunk struct {
+	Header string `json:"header"`           // the hunk's @@ line
+	Status string `json:"status"`           // applied or rejected
+	Line   int    `json:"line,omitempty"`   // where it applied, in the file before the patch
+	Offset int    `json:"offset,omitempty"` // lines from where its header placed it
+	Reason string `json:"reason,omitempty"` // why it was rejected
+}
+
+// PatchedFile is one file apply_patch changed, or would change
+type PatchedFile struct {
+	FilePath string      `json:"file_path"`
+	Created  bool        `json:"created,omitempty"`
+	Hunks    []PatchHunk `json:"hunks"`
+	Diff     string      `json:"diff,omitempty"`
+}
+
+// filePatch is the part of a unified diff for one file. Paths are relative
+// to the base path, and "" for /dev/null.
+type filePatch struct {
+	oldPath string
+	newPath string
+	hunks   []patchHunk
+}
+
+// patchHunk is one hunk of a unified diff
+type patchHunk struct {
+	header   string
+	oldStart int
+	oldCount int
+	lines    []string // each starting with ' ', '-' or '+'
+	oldNoEOL bool     // the old side's last line has no newline
+	newNoEOL bool
+}
+
+// patchTarget is a planned change to one file
+type patchTarget struct {
+	fullPath string
+	file     *textFile
+	text     string
+	PatchedFile
+}
+
+// handleApplyPatch handles the apply_patch tool
+func (s *Server) handleApplyPatch(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	patch, err := request.RequireString("patch")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	dryRun := request.GetBool("dry_run", false)
+
+	patches, err := parsePatch(patch)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid patch: %v", err)), nil
+	}
+
+	// Apply every hunk in memory first, so a patch that does not apply
+	// cleanly leaves every file untouched
+	targets, errResult := s.planPatch(patches)
+	if errResult != nil {
+		return errResult, nil
+	}
+
+	changed := []PatchedFile{}
+	applied := 0
+	for _, t := range targets {
+		if !dryRun {
+			if t.Created {
+				if err := s.guard.MkdirAll(filepath.Dir(t.fullPath), newDirMode); err != nil {
+					if result := unavailableResult(err); result != nil {
+						return result, nil
+					}
+					return mcp.NewToolResultError(fmt.Sprintf("Failed to create directory: %v", err)), nil
+				}
+			}
+			if _, errResult := s.storeTextFile(t.fullPath, t.file, t.text); errResult != nil {
+				if len(changed) == 0 {
+					return errResult, nil
+				}
+				return mcp.NewToolResultError(fmt.Sprintf("%s (after changing %d files)", resultText(errResult), len(changed))), nil
+			}
+			op := changeModified
+			if t.Created {
+				op = changeCreated
+			}
+			s.recordChange("apply_patch", op, t.fullPath, "", false)
+		}
+		changed = append(changed, t.PatchedFile)
+		applied += len(t.Hunks)
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"files":         changed,
+		"files_changed": len(changed),
+		"hunks_applied": applied,
+		"dry_run":       dryRun,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// planPatch applies the patches to the files they name, in memory. Patches
+// with hunks that do not apply cleanly are answered with a structured error
+// giving the status of every hunk.
+func (s *Server) planPatch(patches []filePatch) ([]*patchTarget, *mcp.CallToolResult) {
+	var targets []*patchTarget
+	byPath := map[string]*patchTarget{}
+	hunks, rejected := 0, 0
+	for _, p := range patches {
+		t, ok := byPath[p.newPath]
+		if !ok {
+			var errResult *mcp.CallToolResult
+			if t, errResult = s.patchTarget(p); errResult != nil {
+				return nil, errResult
+			}
+			byPath[p.newPath] = t
+			targets = append(targets, t)
+		}
+
+		text, statuses := applyHunks(t.text, p.hunks)
+		t.text = text
+		t.Hunks = append(t.Hunks, statuses...)
+		for _, status := range statuses {
+			hunks++
+			if status.Status == hunkRejected {
+				rejected++
+			}
+		}
+	}
+
+	if rejected > 0 {
+		files := make([]PatchedFile, len(targets))
+		for i, t := range targets {
+			files[i] = t.PatchedFile
+		}
+		payload, _ := json.Marshal(map[string]interface{}{
+			"code":    "PATCH_REJECTED",
+			"message": fmt.Sprintf("Patch does not apply: %d of %d hunks rejected", rejected, hunks),
+			"files":   files,
+		})
+		return nil, mcp.NewToolResultError(string(payload))
+	}
+
+	for _, t := range targets {
+		t.Diff = unifiedDiff(t.FilePath, t.file.text, t.text)
+	}
+	return targets, nil
+}
+
+// patchTarget loads the file a patch changes, or prepares the one it creates
+func (s *Server) patchTarget(p filePatch) (*patchTarget, *mcp.CallToolResult) {
+	fullPath, err := s.validateFilePath(p.newPath)
+	if err != nil {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Invalid file path: %v", err))
+	}
+	if fullPath == s.config.BasePath {
+		return nil, mcp.NewToolResultError("Invalid file path: cannot write to the base path itself")
+	}
+	t := &patchTarget{fullPath: fullPath, PatchedFile: PatchedFile{FilePath: p.newPath, Hunks: []PatchHunk{}}}
+
+	if p.oldPath != "" {
+		file, errResult := s.loadTextFile(fullPath)
+		if errResult != nil {
+			return nil, errResult
+		}
+		t.file, t.text = file, file.text
+		return t, nil
+	}
+
+	// New files take the encoding configured for their extension, as with
+	// write_file
+	_, err = s.guard.Stat(fullPath)
+	switch {
+	case err == nil:
+		return nil, mcp.NewToolResultError(fmt.Sprintf("File already exists: %s, which the patch creates", p.newPath))
+	case !errors.Is(err, fs.ErrNotExist):
+		if result := unavailableResult(err); result != nil {
+			return nil, result
+		}
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Failed to stat file: %v", err))
+	}
+	encoding := TextEncoding{Name: EncodingUTF8}
+	if forced := s.config.extensionHandling(fullPath).Encoding; forced != "" {
+		encoding.Name = forced
+	}
+	t.file = &textFile{encoding: encoding, perm: newFileMode}
+	t.Created = true
+	return t, nil
+}
+
+// parsePatch reads a unified diff as written by diff -u or git diff,
+// ignoring lines outside its file headers and hunks
+func parsePatch(patch string) ([]filePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n")
+	var patches []filePatch
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			p, err := patchPaths(line[4:], lines[i+1][4:])
+			if err != nil {
+				return nil, err
+			}
+			patches = append(patches, p)
+			i++
+
+		case strings.HasPrefix(line, "@@"):
+			if len(patches) == 0 {
+				return nil, fmt.Errorf("hunk %q comes before any --- and +++ file header", line)
+			}
+			h, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			p := &patches[len(patches)-1]
+			p.hunks = append(p.hunks, h)
+			i = next - 1
+
+		case strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch":
+			return nil, fmt.Errorf("binary patches are not supported")
+		case strings.HasPrefix(line, "rename from "):
+			return nil, fmt.Errorf("renames are not supported; use move_file")
+		}
+	}
+
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no --- and +++ file headers found")
+	}
+	for _, p := range patches {
+		if len(p.hunks) == 0 {
+			return nil, fmt.Errorf("%s has no hunks", p.newPath)
+		}
+	}
+	return patches, nil
+}
+
+// patchPaths reads the paths of a file header, dropping timestamps and the
+// a/ and b/ prefixes of git diffs. Deletions and renames are refused, since
+// delete_file and move_file do them.
+func patchPaths(oldHeader, newHeader string) (filePatch, error) {
+	path := func(header string) string {
+		header, _, _ = strings.Cut(header, "\t")
+		if header = strings.TrimSpace(header); header == "/dev/null" {
+			return ""
+		}
+		return header
+	}
+	p := filePatch{oldPath: path(oldHeader), newPath: path(newHeader)}
+	if (p.oldPath == "" || strings.HasPrefix(p.oldPath, "a/")) && (p.newPath == "" || strings.HasPrefix(p.newPath, "b/")) {
+		p.oldPath = strings.TrimPrefix(p.oldPath, "a/")
+		p.newPath = strings.TrimPrefix(p.newPath, "b/")
+	}
+
+	switch {
+	case p.newPath == "" && p.oldPath == "":
+		return p, fmt.Errorf("a file header names no file")
+	case p.newPath == "":
+		return p, fmt.Errorf("the patch deletes %s; use delete_file", p.oldPath)
+	case p.oldPath != "" && p.oldPath != p.newPath:
+		return p, fmt.Errorf("the patch renames %s to %s; use move_file", p.oldPath, p.newPath)
+	}
+	return p, nil
+}
+
+// parseHunk reads the hunk starting at lines[start], returning it with the
+// index of the line after it
+func parseHunk(lines []string, start int) (patchHunk, int, error) {
+	m := hunkHeader.FindStringSubmatch(lines[start])
+	if m == nil {
+		return patchHunk{}, 0, fmt.Errorf("malformed hunk header %q", lines[start])
+	}
+	count := func(s string) int {
+		if s == "" {
+			return 1
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	oldStart, _ := strconv.Atoi(m[1])
+	h := patchHunk{header: m[0], oldStart: oldStart, oldCount: count(m[2])}
+	newCount := count(m[4])
+
+	oldSeen, newSeen := 0, 0
+	i := start + 1
+	for ; oldSeen < h.oldCount || newSeen < newCount; i++ {
+		if i == len(lines) || strings.HasPrefix(lines[i], "@@") {
+			return patchHunk{}, 0, fmt.Errorf("hunk %s has fewer lines than its header gives", h.header)
+		}
+		line := lines[i]
+		if line == "" {
+			// Some editors strip the space of empty context lines
+			line = " "
+		}
+		switch line[0] {
+		case ' ':
+			oldSeen++
+			newSeen++
+		case '-':
+			oldSeen++
+		case '+':
+			newSeen++
+		case '\\':
+			h.markNoEOL()
+			continue
+		default:
+			return patchHunk{}, 0, fmt.Errorf("hunk %s has a line starting with neither space, - nor +: %q", h.header, line)
+		}
+		h.lines = append(h.lines, line)
+	}
+	if oldSeen != h.oldCount || newSeen != newCount {
+		return patchHunk{}, 0, fmt.Errorf("hunk %s has more lines than its header gives", h.header)
+	}
+	if i < len(lines) && strings.HasPrefix(lines[i], `\`) {
+		h.markNoEOL()
+		i++
+	}
+	return h, i, nil
+}
+
+// markNoEOL handles a "\ No newline at end of file" line, which applies to
+// the line before it
+func (h *patchHunk) markNoEOL() {
+	if len(h.lines) == 0 {
+		return
+	}
+	switch h.lines[len(h.lines)-1][0] {
+	case ' ':
+		h.oldNoEOL, h.newNoEOL = true, true
+	case '-':
+		h.oldNoEOL = true
+	case '+':
+		h.newNoEOL = true
+	}
+}
+
+// sides returns the lines a hunk expects and the lines it leaves
+func (h *patchHunk) sides() ([]string, []string) {
+	var old, updated []string
+	for _, line := range h.lines {
+		if line[0] != '+' {
+			old = append(old, line[1:])
+		}
+		if line[0] != '-' {
+			updated = append(updated, line[1:])
+		}
+	}
+	return old, updated
+}
+
+// applyHunks applies the hunks of one file in order, each where its lines
+// match exactly: at the line its header gives, shifted by the offset of the
+// hunk before it, or else at the nearest line they do. Hunks that match
+// nowhere are rejected and leave the text as it was.
+func applyHunks(text string, hunks []patchHunk) (string, []PatchHunk) {
+	// Patches are matched with LF endings; files with CRLF keep theirs
+	crlf := strings.Contains(text, "\r\n")
+	if crlf {
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	}
+	var lines []string
+	eol := true
+	if text != "" {
+		lines = strings.Split(text, "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		} else {
+			eol = false
+		}
+	}
+
+	var out []string
+	statuses := make([]PatchHunk, len(hunks))
+	pos, drift := 0, 0
+	for i, h := range hunks {
+		old, updated := h.sides()
+		want := h.oldStart - 1
+		if h.oldCount == 0 {
+			// A hunk that only adds lines adds them after oldStart
+			want = h.oldStart
+		}
+		at, reason := findHunk(lines, old, want+drift, pos)
+		if reason != "" {
+			statuses[i] = PatchHunk{Header: h.header, Status: hunkRejected, Reason: reason}
+			continue
+		}
+		drift = at - want
+		statuses[i] = PatchHunk{Header: h.header, Status: hunkApplied, Line: at + 1, Offset: drift}
+
+		out = append(out, lines[pos:at]...)
+		out = append(out, updated...)
+		if pos = at + len(old); pos == len(lines) {
+			eol = !h.newNoEOL
+		}
+	}
+	out = append(out, lines[pos:]...)
+
+	if len(out) == 0 {
+		return "", statuses
+	}
+	patched := strings.Join(out, "\n")
+	if eol {
+		patched += "\n"
+	}
+	if crlf {
+		patched = toCRLF(patched)
+	}
+	return patched, statuses
+}
+
+// findHunk returns the index nearest want, and not before from, at which
+// lines holds old. If there is none it returns why.
+func findHunk(lines, old []string, want, from int) (int, string) {
+	last := len(lines) - len(old)
+	if len(old) == 0 {
+		if want < from || want > len(lines) {
+			return 0, fmt.Sprintf("line %d is outside the file, which has %d lines", want, len(lines))
+		}
+		return want, ""
+	}
+	matches := func(at int) bool {
+		if at < from || at > last {
+			return false
+		}
+		for j, line := range old {
+			if lines[at+j] != line {
+				return false
+			}
+		}
+		return true
+	}
+	for d := 0; want-d >= from || want+d <= last; d++ {
+		if matches(want - d) {
+			return want - d, ""
+		}
+		if matches(want + d) {
+			return want + d, ""
+		}
+	}
+
+	// Report the first line that differs where the hunk was meant to go
+	switch {
+	case want < from:
+		return 0, "the hunk overlaps the one before it, and its lines are found nowhere after it"
+	case want > last:
+		return 0, fmt.Sprintf("the file has %d lines, too few for the %d lines the hunk expects at line %d, which are found nowhere else", len(lines), len(old), want+1)
+	}
+	for j, line := range old {
+		if lines[want+j] != line {
+			return 0, fmt.Sprintf("line %d reads %q where the hunk expects %q, and its lines are found nowhere else", want+j+1, lines[want+j], line)
+		}
+	}
+	return 0, "its lines are found nowhere in the file"
+}
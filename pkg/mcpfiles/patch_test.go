@@ -0,0 +1,290 @@
+package mcpfiles
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		want  []filePatch
+		err   string
+	}{
+		{
+			name: "git diff",
+			patch: "diff --git a/f.go b/f.go\nindex 1a2b3c4..5d6e7f8 100644\n--- a/f.go\n+++ b/f.go\n" +
+				"@@ -1,2 +1,2 @@\n package f\n-var x = 1\n+var x = 2\n",
+			want: []filePatch{{oldPath: "f.go", newPath: "f.go", hunks: []patchHunk{
+				{header: "@@ -1,2 +1,2 @@", oldStart: 1, oldCount: 2, lines: []string{" package f", "-var x = 1", "+var x = 2"}},
+			}}},
+		},
+		{
+			name:  "diff -u with timestamps",
+			patch: "--- f.txt\t2024-01-01 00:00:00\n+++ f.txt\t2024-01-02 00:00:00\n@@ -3 +3 @@\n-a\n+b\n",
+			want: []filePatch{{oldPath: "f.txt", newPath: "f.txt", hunks: []patchHunk{
+				{header: "@@ -3 +3 @@", oldStart: 3, oldCount: 1, lines: []string{"-a", "+b"}},
+			}}},
+		},
+		{
+			name:  "new file",
+			patch: "--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1,2 @@\n+one\n+two\n",
+			want: []filePatch{{newPath: "new.txt", hunks: []patchHunk{
+				{header: "@@ -0,0 +1,2 @@", lines: []string{"+one", "+two"}},
+			}}},
+		},
+		{
+			name:  "CRLF line endings",
+			patch: "--- a/f\r\n+++ b/f\r\n@@ -1 +1 @@\r\n-a\r\n+b\r\n",
+			want: []filePatch{{oldPath: "f", newPath: "f", hunks: []patchHunk{
+				{header: "@@ -1 +1 @@", oldStart: 1, oldCount: 1, lines: []string{"-a", "+b"}},
+			}}},
+		},
+		{
+			name: "several files and hunks",
+			patch: "--- a/x\n+++ b/x\n@@ -1 +1 @@\n-a\n+b\n@@ -9 +9 @@\n-c\n+d\n" +
+				"--- a/y\n+++ b/y\n@@ -2,0 +3 @@\n+e\n",
+			want: []filePatch{
+				{oldPath: "x", newPath: "x", hunks: []patchHunk{
+					{header: "@@ -1 +1 @@", oldStart: 1, oldCount: 1, lines: []string{"-a", "+b"}},
+					{header: "@@ -9 +9 @@", oldStart: 9, oldCount: 1, lines: []string{"-c", "+d"}},
+				}},
+				{oldPath: "y", newPath: "y", hunks: []patchHunk{
+					{header: "@@ -2,0 +3 @@", oldStart: 2, lines: []string{"+e"}},
+				}},
+			},
+		},
+
+		{name: "no headers", patch: "just text\n", err: "no --- and +++ file headers found"},
+		{name: "hunk before header", patch: "@@ -1 +1 @@\n-a\n+b\n", err: "comes before any --- and +++ file header"},
+		{name: "header without hunks", patch: "--- a/f\n+++ b/f\n", err: "f has no hunks"},
+		{name: "deletion", patch: "--- a/f\n+++ /dev/null\n@@ -1 +0,0 @@\n-a\n", err: "the patch deletes f; use delete_file"},
+		{name: "rename by paths", patch: "--- a/f\n+++ b/g\n@@ -1 +1 @@\n-a\n+b\n", err: "the patch renames f to g; use move_file"},
+		{name: "rename without hunks", patch: "diff --git a/f b/g\nsimilarity index 100%\nrename from f\nrename to g\n", err: "renames are not supported"},
+		{name: "binary", patch: "--- a/f\n+++ b/f\nBinary files a/f and b/f differ\n", err: "binary patches are not supported"},
+		{name: "no file named", patch: "--- /dev/null\n+++ /dev/null\n", err: "a file header names no file"},
+	}
+	for _, tt := range tests {
+		got, err := parsePatch(tt.patch)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: parsePatch error = %v, want one containing %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: parsePatch error = %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parsePatch = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseHunk(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  patchHunk
+		next  int
+		err   string
+	}{
+		{
+			name:  "stops after its lines",
+			lines: []string{"@@ -1,2 +1,2 @@ func f()", " a", "-b", "+c", " not part of it"},
+			want:  patchHunk{header: "@@ -1,2 +1,2 @@", oldStart: 1, oldCount: 2, lines: []string{" a", "-b", "+c"}},
+			next:  4,
+		},
+		{
+			name:  "empty context line without its space",
+			lines: []string{"@@ -1,2 +1,2 @@", "", " b"},
+			want:  patchHunk{header: "@@ -1,2 +1,2 @@", oldStart: 1, oldCount: 2, lines: []string{" ", " b"}},
+			next:  3,
+		},
+		{
+			name:  "no newline at the end of either side",
+			lines: []string{"@@ -1 +1 @@", "-a", `\ No newline at end of file`, "+b", `\ No newline at end of file`},
+			want:  patchHunk{header: "@@ -1 +1 @@", oldStart: 1, oldCount: 1, lines: []string{"-a", "+b"}, oldNoEOL: true, newNoEOL: true},
+			next:  5,
+		},
+		{
+			name:  "no newline at the end of the context",
+			lines: []string{"@@ -1,2 +1,2 @@", "-a", "+b", " c", `\ No newline at end of file`},
+			want:  patchHunk{header: "@@ -1,2 +1,2 @@", oldStart: 1, oldCount: 2, lines: []string{"-a", "+b", " c"}, oldNoEOL: true, newNoEOL: true},
+			next:  5,
+		},
+		{
+			name:  "only the new side ends without a newline",
+			lines: []string{"@@ -1 +1 @@", "-a", "+b", `\ No newline at end of file`},
+			want:  patchHunk{header: "@@ -1 +1 @@", oldStart: 1, oldCount: 1, lines: []string{"-a", "+b"}, newNoEOL: true},
+			next:  4,
+		},
+
+		{name: "malformed header", lines: []string{"@@ -a +b @@"}, err: "malformed hunk header"},
+		{name: "cut short", lines: []string{"@@ -1,3 +1,3 @@", " a"}, err: "fewer lines than its header gives"},
+		{name: "runs into the next hunk", lines: []string{"@@ -1,2 +1,2 @@", " a", "@@ -5 +5 @@"}, err: "fewer lines than its header gives"},
+		{name: "too many lines", lines: []string{"@@ -1 +1,2 @@", " a", "-b", "+c"}, err: "more lines than its header gives"},
+		{name: "unknown line", lines: []string{"@@ -1 +1 @@", "*a"}, err: "neither space, - nor +"},
+	}
+	for _, tt := range tests {
+		got, next, err := parseHunk(tt.lines, 0)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: parseHunk error = %v, want one containing %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: parseHunk error = %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) || next != tt.next {
+			t.Errorf("%s: parseHunk = %+v, %d; want %+v, %d", tt.name, got, next, tt.want, tt.next)
+		}
+	}
+}
+
+func TestApplyHunks(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		hunks  string // hunks of one file, after its headers
+		want   string
+		status []PatchHunk // without rejection reasons
+		reason string      // part of the reason of the rejected hunk
+	}{
+		{
+			name:   "at its line",
+			text:   "a\nb\nc\n",
+			hunks:  "@@ -2 +2 @@\n-b\n+B\n",
+			want:   "a\nB\nc\n",
+			status: []PatchHunk{{Header: "@@ -2 +2 @@", Status: hunkApplied, Line: 2}},
+		},
+		{
+			name:   "found at an offset",
+			text:   "x\nx\na\nb\nc\n",
+			hunks:  "@@ -1,2 +1,2 @@\n a\n-b\n+B\n",
+			want:   "x\nx\na\nB\nc\n",
+			status: []PatchHunk{{Header: "@@ -1,2 +1,2 @@", Status: hunkApplied, Line: 3, Offset: 2}},
+		},
+		{
+			// The second hunk is looked for shifted like the first, which
+			// passes over the e its header points at
+			name:  "drift carried between hunks",
+			text:  "x\ny\na\nb\ne\nc\ne\nf\n",
+			hunks: "@@ -1 +1 @@\n-a\n+A\n@@ -5 +5 @@\n-e\n+E\n",
+			want:  "x\ny\nA\nb\ne\nc\nE\nf\n",
+			status: []PatchHunk{
+				{Header: "@@ -1 +1 @@", Status: hunkApplied, Line: 3, Offset: 2},
+				{Header: "@@ -5 +5 @@", Status: hunkApplied, Line: 7, Offset: 2},
+			},
+		},
+		{
+			name:  "overlapping the hunk before",
+			text:  "a\nb\nc\n",
+			hunks: "@@ -1,2 +1,2 @@\n a\n-b\n+B\n@@ -2 +2 @@\n-b\n+X\n",
+			want:  "a\nB\nc\n",
+			status: []PatchHunk{
+				{Header: "@@ -1,2 +1,2 @@", Status: hunkApplied, Line: 1},
+				{Header: "@@ -2 +2 @@", Status: hunkRejected},
+			},
+			reason: "overlaps the one before it",
+		},
+		{
+			name:   "lines found nowhere",
+			text:   "a\nb\n",
+			hunks:  "@@ -1 +1 @@\n-z\n+Z\n",
+			want:   "a\nb\n",
+			status: []PatchHunk{{Header: "@@ -1 +1 @@", Status: hunkRejected}},
+			reason: `line 1 reads "a" where the hunk expects "z"`,
+		},
+		{
+			name:   "past the end of the file",
+			text:   "a\n",
+			hunks:  "@@ -5 +5 @@\n-z\n+y\n",
+			want:   "a\n",
+			status: []PatchHunk{{Header: "@@ -5 +5 @@", Status: hunkRejected}},
+			reason: "the file has 1 lines, too few",
+		},
+		{
+			name:   "CRLF endings kept",
+			text:   "a\r\nb\r\n",
+			hunks:  "@@ -1 +1,2 @@\n-a\n+A\n+a2\n",
+			want:   "A\r\na2\r\nb\r\n",
+			status: []PatchHunk{{Header: "@@ -1 +1,2 @@", Status: hunkApplied, Line: 1}},
+		},
+		{
+			name:   "newline added at the end",
+			text:   "a\nb",
+			hunks:  "@@ -2 +2 @@\n-b\n\\ No newline at end of file\n+B\n",
+			want:   "a\nB\n",
+			status: []PatchHunk{{Header: "@@ -2 +2 @@", Status: hunkApplied, Line: 2}},
+		},
+		{
+			name:   "newline removed at the end",
+			text:   "a\nb\n",
+			hunks:  "@@ -2 +2 @@\n-b\n+B\n\\ No newline at end of file\n",
+			want:   "a\nB",
+			status: []PatchHunk{{Header: "@@ -2 +2 @@", Status: hunkApplied, Line: 2}},
+		},
+		{
+			name:   "empty file",
+			text:   "",
+			hunks:  "@@ -0,0 +1,2 @@\n+one\n+two\n",
+			want:   "one\ntwo\n",
+			status: []PatchHunk{{Header: "@@ -0,0 +1,2 @@", Status: hunkApplied, Line: 1}},
+		},
+	}
+	for _, tt := range tests {
+		patches, err := parsePatch("--- a/f\n+++ b/f\n" + tt.hunks)
+		if err != nil {
+			t.Fatalf("%s: parsePatch: %v", tt.name, err)
+		}
+		got, statuses := applyHunks(tt.text, patches[0].hunks)
+		if got != tt.want {
+			t.Errorf("%s: applyHunks = %q, want %q", tt.name, got, tt.want)
+		}
+		for i := range statuses {
+			if statuses[i].Status == hunkRejected && !strings.Contains(statuses[i].Reason, tt.reason) {
+				t.Errorf("%s: hunk %d rejected because %q, want %q", tt.name, i+1, statuses[i].Reason, tt.reason)
+			}
+			statuses[i].Reason = ""
+		}
+		if !reflect.DeepEqual(statuses, tt.status) {
+			t.Errorf("%s: statuses = %+v, want %+v", tt.name, statuses, tt.status)
+		}
+	}
+}
+
+func TestFindHunk(t *testing.T) {
+	lines := strings.Split("a b x a b x a b", " ")
+	tests := []struct {
+		old      string
+		want     int
+		from     int
+		at       int
+		rejected bool
+	}{
+		{"a b", 3, 0, 3, false}, // where it is expected
+		{"a b", 4, 0, 3, false}, // the nearest match
+		{"a b", 4, 4, 6, false}, // not before from
+		{"x a", 7, 0, 5, false}, // searched back from past the end
+		{"b a", 0, 0, 0, true},  // nowhere
+		{"", 8, 0, 8, false},    // an insertion at the end
+		{"", 9, 0, 0, true},     // an insertion past the end
+		{"a b", 1, 7, 0, true},  // only before from
+	}
+	for _, tt := range tests {
+		var old []string
+		if tt.old != "" {
+			old = strings.Split(tt.old, " ")
+		}
+		at, reason := findHunk(lines, old, tt.want, tt.from)
+		if (reason != "") != tt.rejected || !tt.rejected && at != tt.at {
+			t.Errorf("findHunk(%q, want %d, from %d) = %d, %q", tt.old, tt.want, tt.from, at, reason)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package mcpfiles
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// pathListFilter hides paths refused by the configured allow and deny
+// lists. A path is denied when it or a directory above it matches a deny
+// glob; with allow globs, it must also match one or be inside a match,
+// except for directories that lead to one.
+type pathListFilter struct {
+	basePath string
+	allow    []string
+	deny     []string
+	fsys     FileSystem // tells directories from files, which allow globs treat differently
+}
+
+// newPathListFilter returns the filter of the configured lists, or nil when
+// there are none
+func newPathListFilter(basePath string, allow, deny []string, fsys FileSystem) PathFilter {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil
+	}
+	return pathListFilter{basePath: basePath, allow: allow, deny: deny, fsys: fsys}
+}
+
+func (f pathListFilter) ShouldIgnore(fullPath string) bool {
+	relPath, err := filepath.Rel(f.basePath, fullPath)
+	if err != nil || relPath == "." || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return false
+	}
+	relPath = filepath.ToSlash(relPath)
+
+	// Check the path and each directory above it, so the contents of a
+	// denied or allowed directory go with it
+	denied, allowed := false, len(f.allow) == 0
+	for p := relPath; p != "."; p = path.Dir(p) {
+		for _, glob := range f.deny {
+			denied = denied || matchGlob(glob, p)
+		}
+		for _, glob := range f.allow {
+			allowed = allowed || matchGlob(glob, p)
+		}
+	}
+	if denied || allowed {
+		return denied
+	}
+
+	// Directories stay visible while an allow glob could match below them
+	for _, glob := range f.allow {
+		if globBelow(glob, relPath) {
+			info, err := f.fsys.Stat(fullPath)
+			return err != nil || !info.IsDir()
+		}
+	}
+	return true
+}
+
+// globBelow reports whether a glob could match paths inside a directory
+func globBelow(glob, dir string) bool {
+	if !strings.Contains(glob, "/") {
+		return true
+	}
+	pattern, segments := strings.Split(glob, "/"), strings.Split(dir, "/")
+	for ; len(segments) > 0; pattern, segments = pattern[1:], segments[1:] {
+		if len(pattern) == 0 {
+			return false
+		}
+		if pattern[0] == "**" {
+			return true
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+	}
+	return len(pattern) > 0
+}
+
+// validatePathGlobs checks allow or deny globs, trimming slashes around them
+func validatePathGlobs(kind string, globs []string) error {
+	for i, glob := range globs {
+		trimmed := strings.Trim(strings.TrimSpace(filepath.ToSlash(glob)), "/")
+		if trimmed == "" {
+			return fmt.Errorf("empty %s pattern", kind)
+		}
+		for _, segment := range strings.Split(trimmed, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return fmt.Errorf("invalid %s pattern %q: %w", kind, glob, err)
+			}
+		}
+		globs[i] = trimmed
+	}
+	return nil
+}
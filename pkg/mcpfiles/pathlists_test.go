@@ -0,0 +1,145 @@
+package mcpfiles
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPathListsApplyToSymlinkTargets(t *testing.T) {
+	s := newTestServer(t, &Config{
+		DenyPaths: []string{".env", "secrets"},
+	}, map[string]string{".env": "TOKEN=1\n", "secrets/key.txt": "key\n", "readme.txt": "hi\n"})
+	for link, target := range map[string]string{"notes.txt": ".env", "pub": "secrets", "docs.txt": "readme.txt"} {
+		if err := os.Symlink(target, filepath.Join(s.config.BasePath, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+
+	for _, name := range []string{"notes.txt", "pub/key.txt"} {
+		text, isError := callTool(t, ctx, s, "read_file_contents", map[string]interface{}{"file_path": name})
+		if !isError || strings.Contains(text, "TOKEN") || strings.Contains(text, "key\\n") {
+			t.Errorf("read_file_contents %s through a link to a denied path = %s", name, text)
+		}
+	}
+	if text, isError := callTool(t, ctx, s, "read_file_contents", map[string]interface{}{"file_path": "docs.txt"}); isError {
+		t.Errorf("read_file_contents through a link to an allowed path = %s", text)
+	}
+
+	text, _ := callTool(t, ctx, s, "read_file_structure", map[string]interface{}{})
+	if strings.Contains(text, "notes.txt") || strings.Contains(text, "key.txt") {
+		t.Errorf("read_file_structure lists what links to denied paths lead to: %s", text)
+	}
+}
+
+func TestPathListFilter(t *testing.T) {
+	base := t.TempDir()
+	for _, dir := range []string{"src/api", "docs/guide", "build"} {
+		if err := os.MkdirAll(filepath.Join(base, filepath.FromSlash(dir)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filter := newPathListFilter(base, []string{"src/**", "docs/*.md"}, []string{"**/*.env", "id_rsa"}, OSFileSystem{})
+
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		// Allowed by a glob, or inside a directory that is
+		{"src", false},
+		{"src/api", false},
+		{"src/api/h.go", false},
+		{"docs/a.md", false},
+
+		// Directories leading to an allowed glob stay, unlike files there
+		{"docs", false},
+		{"docs/guide", true},
+		{"docs/b.txt", true},
+		{"README.md", true},
+		{"build", true},
+
+		// Deny globs win wherever the path is
+		{"src/.env", true},
+		{"src/api/prod.env", true},
+		{"src/keys/id_rsa", true},
+
+		// The base path itself and paths outside it are left alone
+		{".", false},
+		{"../other", false},
+	}
+	for _, tt := range tests {
+		if got := filter.ShouldIgnore(filepath.Join(base, filepath.FromSlash(tt.path))); got != tt.ignored {
+			t.Errorf("ShouldIgnore(%s) = %v, want %v", tt.path, got, tt.ignored)
+		}
+	}
+
+	if newPathListFilter(base, nil, nil, OSFileSystem{}) != nil {
+		t.Error("newPathListFilter without lists is not nil")
+	}
+}
+
+func TestGlobBelow(t *testing.T) {
+	tests := []struct {
+		glob string
+		dir  string
+		want bool
+	}{
+		{"*.md", "any/dir", true},
+		{"docs/*.md", "docs", true},
+		{"docs/*.md", "docs/guide", false},
+		{"docs/*.md", "src", false},
+		{"a/*/c/*.go", "a/b", true},
+		{"a/*/c/*.go", "a/b/c", true},
+		{"a/**/x", "a/b/c/d", true},
+		{"a/b", "a/b", false},
+	}
+	for _, tt := range tests {
+		if got := globBelow(tt.glob, tt.dir); got != tt.want {
+			t.Errorf("globBelow(%q, %q) = %v, want %v", tt.glob, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestValidatePathGlobs(t *testing.T) {
+	globs := []string{" /src/** ", "docs/"}
+	if err := validatePathGlobs("allow", globs); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"src/**", "docs"}; !reflect.DeepEqual(globs, want) {
+		t.Errorf("globs = %q, want %q", globs, want)
+	}
+	for _, glob := range []string{"/", "  ", "src/[a"} {
+		if err := validatePathGlobs("deny", []string{glob}); err == nil {
+			t.Errorf("validatePathGlobs(%q) succeeded", glob)
+		}
+	}
+}
+
+func TestPathListsRefuseToolCalls(t *testing.T) {
+	s := newTestServer(t, &Config{
+		AllowPaths: []string{"src/**"},
+		DenyPaths:  []string{"*.env"},
+	}, map[string]string{"src/main.go": "token\n", "src/prod.env": "token\n", "notes.txt": "token\n"})
+	ctx := context.Background()
+
+	for _, name := range []string{"src/prod.env", "notes.txt"} {
+		text, isError := callTool(t, ctx, s, "read_file_contents", map[string]interface{}{"file_path": name})
+		if !isError || !strings.Contains(text, "path not allowed by the configured allow and deny lists") {
+			t.Errorf("read_file_contents %s = %s", name, text)
+		}
+	}
+	text, isError := callTool(t, ctx, s, "write_file", map[string]interface{}{"file_path": "new.txt", "content": "x"})
+	if !isError || readTestFile(t, s, "new.txt") != "" {
+		t.Errorf("write_file outside the allow list = %s", text)
+	}
+
+	// Searches leave refused files out
+	text, _ = callTool(t, ctx, s, "find_files", map[string]interface{}{"patterns": "*"})
+	if !strings.Contains(text, "src/main.go") || strings.Contains(text, "prod.env") || strings.Contains(text, "notes.txt") {
+		t.Errorf("find_files = %s", text)
+	}
+}
@@ -0,0 +1,374 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// WritePolicy constrains what write tools may change, whatever the agent asks
+// for. Paths are matched as they appear in tool arguments, so with several
+// roots they start with the root name. Zero values leave a limit unset.
+type WritePolicy struct {
+	MaxFiles          int      `json:"max_files"`          // paths one call may change; a move changes two
+	ForbiddenPaths    []string `json:"forbidden_paths"`    // patterns as for file tags
+	AllowedExtensions []string `json:"allowed_extensions"` // files changed must have one of them, e.g. ".go"
+	MaxDiffLines      int      `json:"max_diff_lines"`     // lines added plus removed by one call
+}
+
+// loadWritePolicy reads a write policy file
+func loadWritePolicy(path string) (*WritePolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var policy WritePolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("invalid write policy: %w", err)
+	}
+
+	return &policy, nil
+}
+
+// validate checks the limits and patterns of a policy
+func (p *WritePolicy) validate() error {
+	if p.MaxFiles < 0 || p.MaxDiffLines < 0 {
+		return fmt.Errorf("write policy limits must not be negative")
+	}
+	for _, pattern := range p.ForbiddenPaths {
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/"), ""); err != nil {
+			return fmt.Errorf("invalid forbidden path %q: %w", pattern, err)
+		}
+	}
+	for _, ext := range p.AllowedExtensions {
+		if !strings.HasPrefix(ext, ".") {
+			return fmt.Errorf("allowed extension %q must start with a dot", ext)
+		}
+	}
+	return nil
+}
+
+// check returns why a planned change breaks the policy, or "" if it does not
+func (p *WritePolicy) check(plan changePlan) string {
+	if p.MaxFiles > 0 && len(plan.paths) > p.MaxFiles {
+		return fmt.Sprintf("the call changes %d paths, more than the %d allowed", len(plan.paths), p.MaxFiles)
+	}
+	if p.MaxDiffLines > 0 && plan.diffLines > p.MaxDiffLines {
+		return fmt.Sprintf("the diff has %d changed lines, more than the %d allowed", plan.diffLines, p.MaxDiffLines)
+	}
+	for _, dir := range plan.dirs {
+		for _, pattern := range p.ForbiddenPaths {
+			if matchTagPattern(pattern, dir) || matchTagPattern(pattern, dir+"/") {
+				return fmt.Sprintf("%s is a forbidden path (matches %q)", dir, pattern)
+			}
+		}
+	}
+	for _, changed := range plan.paths {
+		for _, pattern := range p.ForbiddenPaths {
+			if matchTagPattern(pattern, changed) {
+				return fmt.Sprintf("%s is a forbidden path (matches %q)", changed, pattern)
+			}
+		}
+		if len(p.AllowedExtensions) > 0 && !hasExtension(changed, p.AllowedExtensions) {
+			return fmt.Sprintf("%s does not have an allowed extension (%s)", changed, strings.Join(p.AllowedExtensions, ", "))
+		}
+	}
+	return ""
+}
+
+// hasExtension reports whether a path ends in one of the extensions, compared
+// without case
+func hasExtension(p string, extensions []string) bool {
+	ext := path.Ext(p)
+	for _, allowed := range extensions {
+		if strings.EqualFold(ext, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// policyMiddleware refuses calls to write tools that break the write policy,
+// before they are applied or queued for approval
+func (s *Server) policyMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if !changesFiles(request) {
+			return next(ctx, request)
+		}
+		tool := request.Params.Name
+
+		plan, errResult := s.planChange(ctx, request, next)
+		if errResult != nil {
+			return errResult, nil
+		}
+		if reason := s.config.WritePolicy.check(plan); reason != "" {
+			s.metrics.Add("mcp_policy_denied_total", 1, "tool", tool)
+			log.Printf("Write policy denied %s: %s", tool, reason)
+			return mcp.NewToolResultError(fmt.Sprintf("Denied by write policy: %s", reason)), nil
+		}
+		return next(ctx, request)
+	}
+}
+
+// changePlan is what a call to a write tool would change
+type changePlan struct {
+	preview   string   // unified diff, or what the call would do
+	paths     []string // files changed, as given in tool arguments
+	dirs      []string // directories moved or deleted
+	diffLines int      // lines added and removed by writes, edits and renames
+}
+
+// planChange works out what a write tool call would do without doing it: a
+// unified diff for writes, edits, replacements and patches, the changeset
+// for renames and a summary otherwise. Calls that cannot succeed are returned as error results.
+func (s *Server) planChange(ctx context.Context, request mcp.CallToolRequest, next server.ToolHandlerFunc) (changePlan, *mcp.CallToolResult) {
+	tool := request.Params.Name
+	original := request.GetArguments()
+	shown := func(key string) string {
+		value, _ := original[key].(string)
+		return filepath.ToSlash(value)
+	}
+
+	if tool == "rename_file" {
+		// rename_file previews its own changeset when apply is unset
+		preview := request
+		args := make(map[string]interface{}, len(original))
+		for key, value := range original {
+			args[key] = value
+		}
+		args["apply"] = false
+		preview.Params.Arguments = args
+		result, err := next(ctx, preview)
+		if err != nil {
+			return changePlan{}, mcp.NewToolResultError(fmt.Sprintf("Failed to preview rename: %v", err))
+		}
+		if result.IsError {
+			return changePlan{}, result
+		}
+
+		plan := changePlan{preview: resultText(result), paths: []string{shown("source"), shown("destination")}}
+		var changeset struct {
+			Changes []ReferenceChange `json:"changes"`
+		}
+		if err := json.Unmarshal([]byte(plan.preview), &changeset); err != nil {
+			return changePlan{}, mcp.NewToolResultError(fmt.Sprintf("Failed to read rename changeset: %v", err))
+		}
+		seen := map[string]bool{}
+		for _, change := range changeset.Changes {
+			if !seen[change.FilePath] {
+				seen[change.FilePath] = true
+				plan.paths = append(plan.paths, change.FilePath)
+			}
+		}
+		plan.diffLines = 2 * len(changeset.Changes)
+		return plan, nil
+	}
+
+	// Resolve paths against the root the call is for, as the caller's API
+	// key sees it
+	rs, args := s.callServer(ctx), original
+	shownRel := func(relPath string) string { return relPath }
+	if len(rs.roots) > 1 {
+		index, plain, err := rs.selectRoot(args)
+		if err != nil {
+			return changePlan{}, mcp.NewToolResultError(fmt.Sprintf("Invalid root: %v", err))
+		}
+		name := rs.config.Roots[index].Name
+		shownRel = func(relPath string) string { return joinRootPath(name, relPath) }
+		rs, args = rs.roots[index], plain
+	}
+	arg := func(key string) string {
+		value, _ := args[key].(string)
+		return value
+	}
+
+	switch tool {
+	case "write_file":
+		fullPath, err := rs.validateFilePath(arg("file_path"))
+		if err != nil {
+			return changePlan{}, mcp.NewToolResultError(fmt.Sprintf("Invalid file path: %v", err))
+		}
+		content, ok := args["content"].(string)
+		if !ok {
+			return changePlan{}, mcp.NewToolResultError("Missing required parameter: content")
+		}
+		old := ""
+		if file, errResult := rs.loadTextFile(fullPath); errResult == nil {
+			old = file.text
+		}
+		return diffPlan(shown("file_path"), old, content), nil
+
+	case "edit_file":
+		fullPath, err := rs.validateFilePath(arg("file_path"))
+		if err != nil {
+			return changePlan{}, mcp.NewToolResultError(fmt.Sprintf("Invalid file path: %v", err))
+		}
+		var edits []FileEdit
+		if err := json.Unmarshal([]byte(arg("edits")), &edits); err != nil {
+			return changePlan{}, mcp.NewToolResultError(fmt.Sprintf("Invalid edits JSON: %v", err))
+		}
+		file, errResult := rs.loadTextFile(fullPath)
+		if errResult != nil {
+			return changePlan{}, errResult
+		}
+		text, _, err := applyEdits(file.text, edits)
+		if err != nil {
+			return changePlan{}, mcp.NewToolResultError(fmt.Sprintf("Failed to apply edits: %v", err))
+		}
+		return diffPlan(shown("file_path"), file.text, text), nil
+
+	case "search_and_replace":
+		// search_and_replace finds the files it changes itself
+		plain := request
+		plain.Params.Arguments = args
+		replace, errResult := parseReplaceRequest(plain)
+		if errResult != nil {
+			return changePlan{}, errResult
+		}
+		_, planned, err := rs.planReplacements(ctx, replace.globs, replace.re, replace.substitute)
+		if err != nil {
+			if result := unavailableResult(err); result != nil {
+				return changePlan{}, result
+			}
+			return changePlan{}, mcp.NewToolResultError(fmt.Sprintf("Failed to read directory: %v", err))
+		}
+		var plan changePlan
+		for _, r := range planned {
+			plan.addDiff(shownRel(r.FilePath), r.Diff)
+		}
+		if plan.preview == "" {
+			plan.preview = fmt.Sprintf("replace %s in no files", shown("pattern"))
+		}
+		return plan, nil
+
+	case "apply_patch":
+		// A patch names its files in its text
+		patches, err := parsePatch(arg("patch"))
+		if err != nil {
+			return changePlan{}, mcp.NewToolResultError(fmt.Sprintf("Invalid patch: %v", err))
+		}
+		targets, errResult := rs.planPatch(patches)
+		if errResult != nil {
+			return changePlan{}, errResult
+		}
+		var plan changePlan
+		for _, t := range targets {
+			plan.addDiff(shownRel(t.FilePath), t.Diff)
+		}
+		if plan.preview == "" {
+			plan.preview = "apply a patch that changes no lines"
+		}
+		return plan, nil
+
+	case "delete_file":
+		if _, errResult := rs.deletablePath(arg("file_path"), false); errResult != nil {
+			return changePlan{}, errResult
+		}
+		return changePlan{preview: fmt.Sprintf("delete file %s", shown("file_path")), paths: []string{shown("file_path")}}, nil
+
+	case "delete_directory":
+		fullPath, errResult := rs.deletablePath(arg("path"), true)
+		if errResult != nil {
+			return changePlan{}, errResult
+		}
+		plan := changePlan{preview: fmt.Sprintf("delete empty directory %s", shown("path")), dirs: []string{shown("path")}}
+		if request.GetBool("recursive", false) {
+			files, err := rs.filesUnder(fullPath)
+			if err != nil {
+				return changePlan{}, mcp.NewToolResultError(fmt.Sprintf("Failed to list directory: %v", err))
+			}
+			for _, file := range files {
+				plan.paths = append(plan.paths, path.Join(shown("path"), file))
+			}
+			plan.preview = fmt.Sprintf("delete directory %s and the %d files in it", shown("path"), len(files))
+		}
+		return plan, nil
+
+	case "move_file":
+		plan := changePlan{preview: fmt.Sprintf("move %s to %s", shown("source"), shown("destination"))}
+		if request.GetBool("overwrite", false) {
+			plan.preview += ", replacing it if it exists"
+		}
+
+		// Moving a directory moves every file in it
+		fullSource, err := rs.validateFilePath(arg("source"))
+		if err != nil {
+			return changePlan{}, mcp.NewToolResultError(fmt.Sprintf("Invalid source path: %v", err))
+		}
+		if info, err := rs.guard.Stat(fullSource); err != nil || !info.IsDir() {
+			plan.paths = []string{shown("source"), shown("destination")}
+			return plan, nil
+		}
+		files, err := rs.filesUnder(fullSource)
+		if err != nil {
+			return changePlan{}, mcp.NewToolResultError(fmt.Sprintf("Failed to list directory: %v", err))
+		}
+		plan.dirs = []string{shown("source"), shown("destination")}
+		for _, file := range files {
+			plan.paths = append(plan.paths, path.Join(shown("source"), file), path.Join(shown("destination"), file))
+		}
+		return plan, nil
+	}
+	return changePlan{preview: fmt.Sprintf("%s %v", tool, sanitizeArguments(original))}, nil
+}
+
+// diffPlan plans a change to the text of one file
+func diffPlan(shownPath, oldText, newText string) changePlan {
+	diff := unifiedDiff(shownPath, oldText, newText)
+	return changePlan{preview: diff, paths: []string{shownPath}, diffLines: diffLineCount(diff)}
+}
+
+// addDiff adds the diff of one more file the call changes to the plan
+func (p *changePlan) addDiff(shownPath, diff string) {
+	p.preview += diff
+	p.paths = append(p.paths, shownPath)
+	p.diffLines += diffLineCount(diff)
+}
+
+// diffLineCount counts the lines a unified diff of one file adds and removes
+func diffLineCount(diff string) int {
+	changed := 0
+	for i, line := range strings.Split(diff, "\n") {
+		// Skip the file header
+		if i >= 2 && (strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-")) {
+			changed++
+		}
+	}
+	return changed
+}
+
+// filesUnder lists the files below a directory, relative to it, failing
+// past MaxTreeNodes entries
+func (s *Server) filesUnder(dir string) ([]string, error) {
+	var files []string
+	var walk func(fullPath, relPath string) error
+	walk = func(fullPath, relPath string) error {
+		entries, err := s.guard.ReadDir(fullPath)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			childRel := path.Join(relPath, entry.Name())
+			if entry.IsDir() {
+				if err := walk(filepath.Join(fullPath, entry.Name()), childRel); err != nil {
+					return err
+				}
+				continue
+			}
+			if files = append(files, childRel); s.config.MaxTreeNodes > 0 && len(files) > s.config.MaxTreeNodes {
+				return fmt.Errorf("more than %d files", s.config.MaxTreeNodes)
+			}
+		}
+		return nil
+	}
+	return files, walk(dir, "")
+}
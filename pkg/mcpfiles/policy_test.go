@@ -0,0 +1,144 @@
+package mcpfiles
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestWritePolicyChecksWritesWithDryRun(t *testing.T) {
+	s := newTestServer(t, &Config{
+		WritePolicy: &WritePolicy{ForbiddenPaths: []string{"*.lock"}},
+	}, map[string]string{"deps.lock": "old\n"})
+	ctx := context.Background()
+
+	// write_file ignores dry_run, so the policy must still see the call
+	text, isError := callTool(t, ctx, s, "write_file", map[string]interface{}{"file_path": "deps.lock", "content": "new\n", "dry_run": true})
+	if !isError || !strings.Contains(text, "Denied by write policy") {
+		t.Errorf("write_file with dry_run to a forbidden path = %s", text)
+	}
+	if got := readTestFile(t, s, "deps.lock"); got != "old\n" {
+		t.Errorf("deps.lock = %q after a denied write", got)
+	}
+
+	// A dry run of a tool that has one changes nothing and is not checked
+	text, isError = callTool(t, ctx, s, "move_file", map[string]interface{}{"source": "deps.lock", "destination": "moved.lock", "dry_run": true})
+	if isError {
+		t.Errorf("move_file with dry_run = %s", text)
+	}
+}
+
+func TestWritePolicyChecksFilesToolsFindThemselves(t *testing.T) {
+	s := newTestServer(t, &Config{
+		WritePolicy: &WritePolicy{ForbiddenPaths: []string{"secrets/"}},
+	}, map[string]string{"notes.txt": "token=a\n", "secrets/key.txt": "token=a\n"})
+	ctx := context.Background()
+
+	// The forbidden file is named only inside the patch text
+	patch := "--- a/secrets/key.txt\n+++ b/secrets/key.txt\n@@ -1 +1 @@\n-token=a\n+token=b\n"
+	text, isError := callTool(t, ctx, s, "apply_patch", map[string]interface{}{"patch": patch})
+	if !isError || !strings.Contains(text, "secrets/key.txt is a forbidden path") {
+		t.Errorf("apply_patch to a forbidden path = %s", text)
+	}
+
+	// search_and_replace finds the forbidden file by walking the tree
+	text, isError = callTool(t, ctx, s, "search_and_replace", map[string]interface{}{"pattern": "token=a", "replacement": "token=b", "files": "**/*.txt"})
+	if !isError || !strings.Contains(text, "secrets/key.txt is a forbidden path") {
+		t.Errorf("search_and_replace over a forbidden path = %s", text)
+	}
+	for _, name := range []string{"notes.txt", "secrets/key.txt"} {
+		if got := readTestFile(t, s, name); got != "token=a\n" {
+			t.Errorf("%s = %q after a denied call", name, got)
+		}
+	}
+
+	// Calls that stay clear of it are applied
+	text, isError = callTool(t, ctx, s, "search_and_replace", map[string]interface{}{"pattern": "token=a", "replacement": "token=b", "files": "notes.txt"})
+	if isError {
+		t.Errorf("search_and_replace outside the forbidden path = %s", text)
+	}
+	if got := readTestFile(t, s, "notes.txt"); got != "token=b\n" {
+		t.Errorf("notes.txt = %q after an allowed replacement", got)
+	}
+}
+
+func TestWritePolicyLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy WritePolicy
+		tool   string
+		args   map[string]interface{}
+		denied string // part of the reason, or "" when allowed
+	}{
+		{
+			name:   "too many files",
+			policy: WritePolicy{MaxFiles: 1},
+			tool:   "move_file",
+			args:   map[string]interface{}{"source": "src/a.go", "destination": "src/b.go"},
+			denied: "changes 2 paths, more than the 1 allowed",
+		},
+		{
+			name:   "a moved directory counts its files",
+			policy: WritePolicy{MaxFiles: 3},
+			tool:   "move_file",
+			args:   map[string]interface{}{"source": "src", "destination": "lib"},
+			denied: "changes 4 paths, more than the 3 allowed",
+		},
+		{
+			name:   "too many changed lines",
+			policy: WritePolicy{MaxDiffLines: 1},
+			tool:   "write_file",
+			args:   map[string]interface{}{"file_path": "notes.md", "content": "one\ntwo\nthree\n"},
+			denied: "the diff has 2 changed lines, more than the 1 allowed",
+		},
+		{
+			name:   "within the changed lines",
+			policy: WritePolicy{MaxDiffLines: 2},
+			tool:   "write_file",
+			args:   map[string]interface{}{"file_path": "notes.md", "content": "one\ntwo\nthree\n"},
+		},
+		{
+			name:   "extension not allowed",
+			policy: WritePolicy{AllowedExtensions: []string{".go"}},
+			tool:   "write_file",
+			args:   map[string]interface{}{"file_path": "notes.md", "content": "x\n"},
+			denied: "notes.md does not have an allowed extension (.go)",
+		},
+		{
+			name:   "extensions compared without case",
+			policy: WritePolicy{AllowedExtensions: []string{".go"}},
+			tool:   "write_file",
+			args:   map[string]interface{}{"file_path": "src/C.GO", "content": "package src\n"},
+		},
+		{
+			name:   "forbidden directory moved",
+			policy: WritePolicy{ForbiddenPaths: []string{"src/"}},
+			tool:   "move_file",
+			args:   map[string]interface{}{"source": "src", "destination": "lib"},
+			denied: "src is a forbidden path",
+		},
+		{
+			name:   "files a rename rewrites",
+			policy: WritePolicy{ForbiddenPaths: []string{"README.md"}},
+			tool:   "rename_file",
+			args:   map[string]interface{}{"source": "notes.md", "destination": "guide.md", "apply": true},
+			denied: "README.md is a forbidden path",
+		},
+	}
+	for _, tt := range tests {
+		policy := tt.policy
+		s := newTestServer(t, &Config{WritePolicy: &policy}, map[string]string{
+			"src/a.go":  "package src\n",
+			"src/b.go":  "package src\n",
+			"notes.md":  "one\n",
+			"README.md": "See [the notes](notes.md).\n",
+		})
+		text, isError := callTool(t, context.Background(), s, tt.tool, tt.args)
+		switch {
+		case tt.denied == "" && isError:
+			t.Errorf("%s: %s = %s, want it allowed", tt.name, tt.tool, text)
+		case tt.denied != "" && (!isError || !strings.Contains(text, "Denied by write policy: ") || !strings.Contains(text, tt.denied)):
+			t.Errorf("%s: %s = %s, want it denied because %s", tt.name, tt.tool, text, tt.denied)
+		}
+	}
+}
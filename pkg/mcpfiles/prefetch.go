@@ -0,0 +1,370 @@
+package mcpfiles
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Prefetch heuristics, enabled with a comma-separated list in Config.Prefetch
+const (
+	prefetchOutline  = "outline"  // parse the docs of files read, for read_docs
+	prefetchImports  = "imports"  // read the files a file imports
+	prefetchSiblings = "siblings" // read files next to it with the same stem or extension
+)
+
+const (
+	// maxPrefetchFiles bounds the files read ahead after one read
+	maxPrefetchFiles = 16
+	// maxPrefetchSiblings bounds the siblings among them
+	maxPrefetchSiblings = 8
+	// prefetchCacheBytes bounds the content kept in the prefetch cache
+	prefetchCacheBytes = 64 << 20
+)
+
+// pythonRelativeImport matches `from .module import name` statements
+var pythonRelativeImport = regexp.MustCompile(`(?m)^\s*from\s+(\.+)([\w.]*)\s+import\b`)
+
+// scriptExtensions are tried in order when resolving extensionless JS/TS imports
+var scriptExtensions = []string{".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs", ".mts", ".cts"}
+
+// prefetcher reads ahead the files an agent is likely to ask for after the
+// one it just read and keeps them until they change
+type prefetcher struct {
+	server                     *Server
+	outline, imports, siblings bool
+	busy                       atomic.Bool // one read-ahead at a time; reads meanwhile are not followed
+
+	mu      sync.Mutex
+	entries map[string]*prefetchEntry
+	order   []string // keys by insertion, oldest first
+	size    int64
+}
+
+// prefetchEntry is what is cached of one file, valid while its size and
+// modification time are unchanged
+type prefetchEntry struct {
+	size    int64
+	modTime time.Time
+	content []byte // nil when only the outline is cached
+	outline *fileOutline
+}
+
+// fileOutline is a file's documentation as read_docs extracts it
+type fileOutline struct {
+	doc     string
+	symbols []SymbolDoc
+}
+
+// parsePrefetch validates a comma-separated list of prefetch heuristics
+func parsePrefetch(list string) (map[string]bool, error) {
+	enabled := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "":
+		case prefetchOutline, prefetchImports, prefetchSiblings:
+			enabled[name] = true
+		default:
+			return nil, fmt.Errorf("unknown prefetch heuristic %q (use %s, %s or %s)", name, prefetchOutline, prefetchImports, prefetchSiblings)
+		}
+	}
+	return enabled, nil
+}
+
+// newPrefetcher returns the prefetcher for a server, or nil when prefetching
+// is disabled
+func newPrefetcher(s *Server) *prefetcher {
+	enabled, _ := parsePrefetch(s.config.Prefetch)
+	if len(enabled) == 0 {
+		return nil
+	}
+	return &prefetcher{
+		server:   s,
+		outline:  enabled[prefetchOutline],
+		imports:  enabled[prefetchImports],
+		siblings: enabled[prefetchSiblings],
+		entries:  make(map[string]*prefetchEntry),
+	}
+}
+
+// lookup returns the cache entry for a file if it is still current
+func (p *prefetcher) lookup(fullPath string, info fs.FileInfo) *prefetchEntry {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry, ok := p.entries[fullPath]
+	if !ok || entry.size != info.Size() || !entry.modTime.Equal(info.ModTime()) {
+		return nil
+	}
+	return entry
+}
+
+// cachedContent returns a file's prefetched content if it is still current
+func (p *prefetcher) cachedContent(fullPath string, info fs.FileInfo) ([]byte, bool) {
+	entry := p.lookup(fullPath, info)
+	if entry == nil || entry.content == nil {
+		return nil, false
+	}
+	p.server.metrics.Add("mcp_prefetch_hits_total", 1, "kind", "content")
+	return entry.content, true
+}
+
+// cachedOutline returns a file's parsed docs if they are still current
+func (p *prefetcher) cachedOutline(fullPath string, info fs.FileInfo) (*fileOutline, bool) {
+	entry := p.lookup(fullPath, info)
+	if entry == nil || entry.outline == nil {
+		return nil, false
+	}
+	p.server.metrics.Add("mcp_prefetch_hits_total", 1, "kind", "outline")
+	return entry.outline, true
+}
+
+// store caches a file, evicting the oldest entries past prefetchCacheBytes
+func (p *prefetcher) store(fullPath string, info fs.FileInfo, content []byte, outline *fileOutline) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if old, ok := p.entries[fullPath]; ok {
+		p.size -= int64(len(old.content))
+	} else {
+		p.order = append(p.order, fullPath)
+	}
+	p.entries[fullPath] = &prefetchEntry{size: info.Size(), modTime: info.ModTime(), content: content, outline: outline}
+	p.size += int64(len(content))
+
+	for p.size > prefetchCacheBytes && len(p.order) > 1 {
+		oldest := p.order[0]
+		p.order = p.order[1:]
+		if entry, ok := p.entries[oldest]; ok {
+			p.size -= int64(len(entry.content))
+			delete(p.entries, oldest)
+		}
+	}
+}
+
+// afterRead starts reading ahead from a file that was just read, unless a
+// read-ahead is already running
+func (p *prefetcher) afterRead(fullPath string, info fs.FileInfo, content []byte) {
+	if p == nil || !p.busy.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer p.busy.Store(false)
+		p.readAhead(fullPath, info, content)
+	}()
+}
+
+// readAhead caches the outline of the file read and the files the enabled
+// heuristics expect next
+func (p *prefetcher) readAhead(fullPath string, info fs.FileInfo, content []byte) {
+	s := p.server
+	if p.outline {
+		if outline := extractOutline(s.config.sourceExtension(fullPath), content); outline != nil {
+			p.store(fullPath, info, nil, outline)
+		}
+	}
+
+	relPath, err := filepath.Rel(s.config.BasePath, fullPath)
+	if err != nil {
+		return
+	}
+	relPath = filepath.ToSlash(relPath)
+	var candidates []string
+	if p.imports {
+		candidates = append(candidates, s.importTargets(relPath, content)...)
+	}
+	if p.siblings {
+		candidates = append(candidates, s.siblingFiles(relPath)...)
+	}
+
+	seen := map[string]bool{relPath: true}
+	fetched := 0
+	for _, candidate := range candidates {
+		if seen[candidate] || fetched == maxPrefetchFiles {
+			continue
+		}
+		seen[candidate] = true
+		target := filepath.Join(s.config.BasePath, filepath.FromSlash(candidate))
+		info, err := s.guard.Stat(target)
+		if err != nil || !info.Mode().IsRegular() || info.Size() > s.config.maxFileSize(target) || p.lookup(target, info) != nil {
+			continue
+		}
+		data, err := s.guard.ReadFile(target)
+		if err != nil {
+			continue
+		}
+		var outline *fileOutline
+		if p.outline {
+			outline = extractOutline(s.config.sourceExtension(target), data)
+		}
+		p.store(target, info, data, outline)
+		fetched++
+		s.metrics.Add("mcp_prefetch_files_total", 1)
+	}
+}
+
+// extractOutline parses a file's docs, given the extension sourceExtension
+// selects for it, or returns nil for unsupported types
+func extractOutline(ext string, content []byte) *fileOutline {
+	extract, ok := docExtractors[ext]
+	if !ok {
+		return nil
+	}
+	doc, symbols := extract(string(content))
+	return &fileOutline{doc: doc, symbols: symbols}
+}
+
+// importTargets resolves the imports of a file to files under the base path:
+// Go packages of the same module, and relative JS/TS and Python imports
+func (s *Server) importTargets(relPath string, content []byte) []string {
+	dir := path.Dir(relPath)
+	var targets []string
+	switch ext := strings.ToLower(path.Ext(relPath)); {
+	case ext == ".go":
+		file, err := parser.ParseFile(token.NewFileSet(), "", content, parser.ImportsOnly)
+		if err != nil {
+			return nil
+		}
+		modDir, module := s.goModuleRoot(dir)
+		if module == "" {
+			return nil
+		}
+		for _, spec := range file.Imports {
+			importPath := strings.Trim(spec.Path.Value, `"`)
+			if importPath != module && !strings.HasPrefix(importPath, module+"/") {
+				continue
+			}
+			targets = append(targets, s.goPackageFiles(path.Join(modDir, strings.TrimPrefix(importPath, module)))...)
+		}
+	case isJavaScriptLike(relPath):
+		block := extractImports(s.config.sourceExtension(relPath), content)
+		if block == nil {
+			return nil
+		}
+		for _, m := range quotedStrings.FindAllStringSubmatch(block.Content, -1) {
+			if strings.HasPrefix(m[1], "./") || strings.HasPrefix(m[1], "../") {
+				if target := s.resolveScript(path.Join(dir, m[1])); target != "" {
+					targets = append(targets, target)
+				}
+			}
+		}
+	case ext == ".py":
+		for _, m := range pythonRelativeImport.FindAllStringSubmatch(string(content), -1) {
+			base := dir
+			for range len(m[1]) - 1 {
+				base = path.Dir(base)
+			}
+			module := path.Join(base, strings.ReplaceAll(m[2], ".", "/"))
+			for _, candidate := range []string{module + ".py", module + "/__init__.py"} {
+				if s.isFile(candidate) {
+					targets = append(targets, candidate)
+					break
+				}
+			}
+		}
+	}
+	return targets
+}
+
+// goPackageFiles lists the non-test Go files of a directory
+func (s *Server) goPackageFiles(dir string) []string {
+	entries, err := s.guard.ReadDir(filepath.Join(s.config.BasePath, filepath.FromSlash(dir)))
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+			files = append(files, path.Join(dir, name))
+		}
+	}
+	return files
+}
+
+// resolveScript finds the file a relative JS/TS import refers to, which may
+// omit its extension or name a directory with an index file
+func (s *Server) resolveScript(resolved string) string {
+	candidates := []string{resolved}
+	for _, ext := range scriptExtensions {
+		candidates = append(candidates, resolved+ext)
+	}
+	for _, ext := range scriptExtensions {
+		candidates = append(candidates, resolved+"/index"+ext)
+	}
+	for _, candidate := range candidates {
+		if s.isFile(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// isFile reports whether a path relative to the base path is a regular file
+func (s *Server) isFile(relPath string) bool {
+	if relPath == ".." || strings.HasPrefix(relPath, "../") {
+		return false
+	}
+	info, err := s.guard.Stat(filepath.Join(s.config.BasePath, filepath.FromSlash(relPath)))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// siblingFiles lists files in the same directory that share the file's stem
+// (main.go and main_test.go, app.ts and app.spec.ts) followed by files with
+// the same extension, nearest in name first
+func (s *Server) siblingFiles(relPath string) []string {
+	dir, name := path.Split(relPath)
+	entries, err := s.guard.ReadDir(filepath.Join(s.config.BasePath, filepath.FromSlash(dir)))
+	if err != nil {
+		return nil
+	}
+
+	stem, ext := fileStem(name), path.Ext(name)
+	var sameStem, sameExt []string
+	for _, entry := range entries {
+		other := entry.Name()
+		if other == name || !entry.Type().IsRegular() {
+			continue
+		}
+		switch {
+		case fileStem(other) == stem:
+			sameStem = append(sameStem, path.Join(dir, other))
+		case path.Ext(other) == ext:
+			sameExt = append(sameExt, path.Join(dir, other))
+		}
+	}
+	sort.SliceStable(sameExt, func(i, j int) bool {
+		return nameDistance(path.Base(sameExt[i]), name) < nameDistance(path.Base(sameExt[j]), name)
+	})
+
+	siblings := append(sameStem, sameExt...)
+	return siblings[:min(len(siblings), maxPrefetchSiblings)]
+}
+
+// fileStem strips a file name's extensions and test suffixes
+func fileStem(name string) string {
+	if i := strings.IndexByte(name[min(1, len(name)):], '.'); i >= 0 {
+		name = name[:i+1]
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(name, "_test"), "_spec")
+}
+
+// nameDistance orders names by the length of the prefix they share with
+// name, longer first
+func nameDistance(other, name string) int {
+	n := 0
+	for n < len(other) && n < len(name) && other[n] == name[n] {
+		n++
+	}
+	return -n
+}
@@ -0,0 +1,49 @@
+package mcpfiles
+
+import "fmt"
+
+// Resource profiles
+const (
+	ProfileDefault   = "default"
+	ProfileLowMemory = "low-memory" // for small VMs and Raspberry Pi-class devices
+)
+
+// Limits of the low-memory profile; settings above them are lowered to them
+const (
+	lowMemoryConcurrency       = 2
+	lowMemoryMaxFileSize       = 1024 * 1024 // 1MB
+	lowMemoryMaxGrepOutput     = 1024 * 1024 // 1MB
+	lowMemoryMaxMatches        = 1000
+	lowMemoryMaxMatchesPerFile = 100
+	lowMemoryMaxTreeNodes      = 10000
+)
+
+// applyProfile validates the resource profile and lowers the limits it
+// caps. The low-memory profile also keeps no caches: summaries and repo map
+// outlines are made afresh, nothing is read ahead, and line ranges are read
+// by streaming the file rather than loading it whole.
+func applyProfile(config *Config) error {
+	switch config.Profile {
+	case "":
+		config.Profile = ProfileDefault
+	case ProfileDefault:
+	case ProfileLowMemory:
+		if config.Prefetch != "" {
+			return fmt.Errorf("prefetching caches files read ahead and cannot be enabled with the %s profile", ProfileLowMemory)
+		}
+		config.WalkConcurrency = min(config.WalkConcurrency, lowMemoryConcurrency)
+		config.MaxFileSize = min(config.MaxFileSize, lowMemoryMaxFileSize)
+		config.MaxGrepOutput = min(config.MaxGrepOutput, lowMemoryMaxGrepOutput)
+		config.MaxMatches = min(config.MaxMatches, lowMemoryMaxMatches)
+		config.MaxMatchesPerFile = min(config.MaxMatchesPerFile, lowMemoryMaxMatchesPerFile)
+		config.MaxTreeNodes = min(config.MaxTreeNodes, lowMemoryMaxTreeNodes)
+	default:
+		return fmt.Errorf("unsupported profile %q (use %s or %s)", config.Profile, ProfileDefault, ProfileLowMemory)
+	}
+	return nil
+}
+
+// lowMemory reports whether the server runs with the low-memory profile
+func (c *Config) lowMemory() bool {
+	return c.Profile == ProfileLowMemory
+}
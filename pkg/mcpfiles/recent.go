@@ -0,0 +1,127 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// defaultRecentFiles is how many files recently_modified returns by default
+const defaultRecentFiles = 20
+
+// RecentFile is one file returned by recently_modified
+type RecentFile struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Modified string `json:"modified"`
+
+	modTime time.Time
+}
+
+// handleRecentlyModified handles the recently_modified tool
+func (s *Server) handleRecentlyModified(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	globs := []string{"*"}
+	if patterns := request.GetString("patterns", ""); patterns != "" {
+		var err error
+		if globs, err = parseGlobs(patterns); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid patterns: %v", err)), nil
+		}
+	}
+	maxResults := request.GetInt("max_results", defaultRecentFiles)
+	if maxResults <= 0 {
+		return mcp.NewToolResultError("max_results must be positive"), nil
+	}
+	now := time.Now()
+	var after, before time.Time
+	if value := request.GetString("modified_after", ""); value != "" {
+		t, err := parseQueryTime(value, now)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid modified_after: %v", err)), nil
+		}
+		after = t
+	}
+	if value := request.GetString("modified_before", ""); value != "" {
+		t, err := parseQueryTime(value, now)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid modified_before: %v", err)), nil
+		}
+		before = t
+	}
+	if !after.IsZero() && !before.IsZero() && !after.Before(before) {
+		return mcp.NewToolResultError("modified_after must be earlier than modified_before"), nil
+	}
+	view, _, err := s.requestView(request)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid view: %v", err)), nil
+	}
+
+	root, truncated, err := s.buildFileTreeWithFilter(ctx, s.config.BasePath, s.config.MaxTreeDepth, s.pathFilter())
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read file structure: %v", err)), nil
+	}
+	files := []RecentFile{}
+	if root != nil {
+		if view != nil {
+			pruneByFilter(root, view)
+		}
+		collectRecent(root, globs, after, before, &files)
+	}
+
+	// Newest first, keeping the first maxResults
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].modTime.Equal(files[j].modTime) {
+			return files[i].modTime.After(files[j].modTime)
+		}
+		return files[i].Path < files[j].Path
+	})
+	matched := len(files)
+	if len(files) > maxResults {
+		files = files[:maxResults]
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"files":     files,
+		"count":     len(files),
+		"matched":   matched,
+		"truncated": truncated,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// collectRecent appends the files of a tree that match one of the globs and
+// were modified after after and before before, where those are set
+func collectRecent(node *FileNode, globs []string, after, before time.Time, found *[]RecentFile) {
+	if node.Type == "directory" {
+		for _, child := range node.Children {
+			collectRecent(child, globs, after, before, found)
+		}
+		return
+	}
+	if !after.IsZero() && !node.modTime.After(after) || !before.IsZero() && !node.modTime.Before(before) {
+		return
+	}
+	relPath := filepath.ToSlash(node.Path)
+	if !matchesAnyGlob(globs, relPath) {
+		return
+	}
+	file := RecentFile{Path: relPath, Modified: node.modTime.UTC().Format(time.RFC3339), modTime: node.modTime}
+	if node.Size != nil {
+		file.Size = *node.Size
+	}
+	*found = append(*found, file)
+}
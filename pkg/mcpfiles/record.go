@@ -0,0 +1,159 @@
+package mcpfiles
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"log"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// sensitiveArgumentPattern matches argument names whose values are never recorded
+var sensitiveArgumentPattern = regexp.MustCompile(`(?i)(token|secret|password|passwd|authorization|api[_-]?key)`)
+
+// RecordedCall is one tool call written by the recorder. Its tool and
+// arguments fields match BenchCall, so recordings can also be benchmarked.
+type RecordedCall struct {
+	Time         time.Time              `json:"time"`
+	Tool         string                 `json:"tool"`
+	Arguments    map[string]interface{} `json:"arguments"`
+	DurationMs   float64                `json:"duration_ms"`
+	IsError      bool                   `json:"is_error"`
+	ResultSHA256 string                 `json:"result_sha256,omitempty"`
+	// Recorders configured with another hash algorithm record it here instead
+	ResultHash    string `json:"result_hash,omitempty"`
+	HashAlgorithm string `json:"hash_algorithm,omitempty"`
+}
+
+// CallRecorder appends JSON records, such as sanitized tool calls, to a JSONL file
+type CallRecorder struct {
+	mu     sync.Mutex
+	file   *os.File
+	cipher *StateCipher // seals each line when set
+}
+
+// NewCallRecorder opens (or creates) a recording file for appending
+func NewCallRecorder(path string) (*CallRecorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &CallRecorder{file: file}, nil
+}
+
+// Record writes a single record
+func (r *CallRecorder) Record(entry interface{}) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if r.cipher != nil {
+		line = r.cipher.Seal(line)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err = r.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the recording file
+func (r *CallRecorder) Close() error {
+	return r.file.Close()
+}
+
+// recordingMiddleware records every tool call while a recorder is attached
+func (s *Server) recordingMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if s.recorder == nil {
+			return next(ctx, request)
+		}
+
+		start := time.Now()
+		result, err := next(ctx, request)
+
+		call := RecordedCall{
+			Time:       start.UTC(),
+			Tool:       request.Params.Name,
+			Arguments:  sanitizeArguments(request.GetArguments()),
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+			IsError:    err != nil || (result != nil && result.IsError),
+		}
+		if result != nil && s.config.HashAlgorithm == HashSHA256 {
+			call.ResultSHA256 = ResultDigest(result)
+		} else if result != nil {
+			call.HashAlgorithm = s.config.HashAlgorithm
+			call.ResultHash, _ = ResultDigestWith(result, s.config.HashAlgorithm)
+		}
+		if recordErr := s.recorder.Record(call); recordErr != nil {
+			log.Printf("Failed to record tool call: %v", recordErr)
+		}
+
+		return result, err
+	}
+}
+
+// sanitizeArguments copies arguments, redacting values of sensitive keys,
+// also in objects nested in them or in arrays
+func sanitizeArguments(args map[string]interface{}) map[string]interface{} {
+	sanitized := make(map[string]interface{}, len(args))
+	for key, value := range args {
+		if sensitiveArgumentPattern.MatchString(key) {
+			sanitized[key] = "[REDACTED]"
+			continue
+		}
+		sanitized[key] = sanitizeValue(value)
+	}
+	return sanitized
+}
+
+// sanitizeValue copies an argument value, redacting the sensitive keys of
+// the objects in it
+func sanitizeValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return sanitizeArguments(value)
+	case []interface{}:
+		sanitized := make([]interface{}, len(value))
+		for i, item := range value {
+			sanitized[i] = sanitizeValue(item)
+		}
+		return sanitized
+	}
+	return value
+}
+
+// ResultDigest hashes the text content of a tool result with SHA-256
+func ResultDigest(result *mcp.CallToolResult) string {
+	return digestResult(result, sha256.New)
+}
+
+// ResultDigestWith hashes the text content of a tool result with the named
+// hash algorithm
+func ResultDigestWith(result *mcp.CallToolResult, algorithm string) (string, error) {
+	newHash, ok := hashAlgorithms[algorithm]
+	if !ok {
+		return "", fmt.Errorf("unknown hash algorithm %q", algorithm)
+	}
+	return digestResult(result, newHash), nil
+}
+
+// digestResult hashes the text content of a tool result
+func digestResult(result *mcp.CallToolResult, newHash func() hash.Hash) string {
+	h := newHash()
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			h.Write([]byte(text.Text))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
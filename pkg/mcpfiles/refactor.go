@@ -0,0 +1,473 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ReferenceChange is one line rename_file rewrites
+type ReferenceChange struct {
+	FilePath   string `json:"file_path"`
+	LineNumber int    `json:"line_number"`
+	Kind       string `json:"kind"`
+	Before     string `json:"before"`
+	After      string `json:"after"`
+}
+
+// SkippedReference is a reference rename_file found but cannot rewrite safely
+type SkippedReference struct {
+	FilePath   string `json:"file_path"`
+	LineNumber int    `json:"line_number"`
+	Content    string `json:"content"`
+	Reason     string `json:"reason"`
+}
+
+// referenceRule rewrites lines in which text appears, mirroring one of the
+// needles find_file_usages looks for. apply returns the new line, or a reason
+// it cannot be rewritten.
+type referenceRule struct {
+	text  string
+	match func(line string) bool // optional further check
+	apply func(relPath, line string) (string, string)
+}
+
+// referenceRewriter maps references to oldPath onto newPath, both
+// slash-separated and relative to the base path
+type referenceRewriter struct {
+	oldPath, newPath string
+	rules            []referenceRule
+}
+
+// handleRenameFile handles the rename_file tool
+func (s *Server) handleRenameFile(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	source, err := request.RequireString("source")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	destination, err := request.RequireString("destination")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	apply := request.GetBool("apply", false)
+
+	// Validate and resolve both paths
+	fullSource, err := s.validateFilePath(source)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid source path: %v", err)), nil
+	}
+	fullDest, err := s.validateFilePath(destination)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid destination path: %v", err)), nil
+	}
+	if fullSource == fullDest {
+		return mcp.NewToolResultError("Source and destination are the same path"), nil
+	}
+
+	stat, err := s.guard.Stat(fullSource)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Source not found: %v", err)), nil
+	}
+	if !stat.Mode().IsRegular() {
+		return mcp.NewToolResultError("Cannot rename: source is not a file; use move_file for directories"), nil
+	}
+	if _, err := s.guard.Stat(fullDest); err == nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Destination already exists: %s", destination)), nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to stat destination: %v", err)), nil
+	}
+
+	usages, truncated, err := s.findFileUsages(ctx, fullSource, false)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to search for references: %v", err)), nil
+	}
+	if truncated && apply {
+		return mcp.NewToolResultError(fmt.Sprintf("Too many references to rewrite (more than %d); rename in smaller steps", maxUsages)), nil
+	}
+
+	relSource, _ := filepath.Rel(s.config.BasePath, fullSource)
+	relDest, _ := filepath.Rel(s.config.BasePath, fullDest)
+	rw := s.newReferenceRewriter(filepath.ToSlash(relSource), filepath.ToSlash(relDest))
+
+	changes := []ReferenceChange{}
+	skipped := []SkippedReference{}
+	for _, usage := range usages {
+		after, reason := rw.rewrite(usage.FilePath, usage.Content)
+		switch {
+		case reason != "":
+			skipped = append(skipped, SkippedReference{usage.FilePath, usage.LineNumber, usage.Content, reason})
+		case after != usage.Content:
+			changes = append(changes, ReferenceChange{usage.FilePath, usage.LineNumber, usage.Kind, usage.Content, after})
+		}
+	}
+	ownChanges, err := s.ownReferenceChanges(fullSource, rw)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read source: %v", err)), nil
+	}
+	changes = append(changes, ownChanges...)
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"source":      source,
+		"destination": destination,
+		"changes":     changes,
+		"skipped":     skipped,
+		"truncated":   truncated,
+		"applied":     false,
+	}
+
+	if apply {
+		// Move first, so a failure leaves every reference untouched
+		if err := s.guard.MkdirAll(filepath.Dir(fullDest), newDirMode); err != nil {
+			if result := unavailableResult(err); result != nil {
+				return result, nil
+			}
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to create directory: %v", err)), nil
+		}
+		if err := s.guard.Rename(fullSource, fullDest); err != nil {
+			if result := unavailableResult(err); result != nil {
+				return result, nil
+			}
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to move: %v", err)), nil
+		}
+		s.recordChange("rename_file", changeMoved, fullDest, fullSource, false)
+		updated, failures := s.applyReferenceChanges(changes, rw)
+		result["applied"] = true
+		result["files_updated"] = updated
+		result["errors"] = failures
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// ownReferenceChanges lists the relative imports inside a JS/TS file that
+// must change for it to move to rw.newPath
+func (s *Server) ownReferenceChanges(fullPath string, rw *referenceRewriter) ([]ReferenceChange, error) {
+	if !isJavaScriptLike(rw.oldPath) || path.Dir(rw.oldPath) == path.Dir(rw.newPath) {
+		return nil, nil
+	}
+	content, err := s.guard.ReadFile(fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []ReferenceChange
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if after := rw.rewriteOwnImports(line); after != line {
+			changes = append(changes, ReferenceChange{rw.newPath, i + 1, UsageImport, line, after})
+		}
+	}
+	return changes, nil
+}
+
+// applyReferenceChanges rewrites the changed lines file by file, returning
+// the number of files updated and a description of each file that failed
+func (s *Server) applyReferenceChanges(changes []ReferenceChange, rw *referenceRewriter) (int, []map[string]string) {
+	byFile := map[string][]ReferenceChange{}
+	var files []string
+	for _, change := range changes {
+		if _, ok := byFile[change.FilePath]; !ok {
+			files = append(files, change.FilePath)
+		}
+		byFile[change.FilePath] = append(byFile[change.FilePath], change)
+	}
+	sort.Strings(files)
+
+	updated := 0
+	failures := []map[string]string{}
+	for _, relPath := range files {
+		fullPath := filepath.Join(s.config.BasePath, filepath.FromSlash(relPath))
+		file, failed := s.loadTextFile(fullPath)
+		if failed == nil {
+			// Re-derive each line from the decoded text rather than trusting
+			// the preview, which was taken from the raw bytes
+			lines := strings.Split(file.text, "\n")
+			for _, change := range byFile[relPath] {
+				if change.LineNumber > len(lines) {
+					continue
+				}
+				line := lines[change.LineNumber-1]
+				cr := strings.HasSuffix(line, "\r")
+				line = strings.TrimRight(line, "\r")
+				if relPath == rw.newPath {
+					line = rw.rewriteOwnImports(line)
+				} else {
+					line, _ = rw.rewrite(relPath, line)
+				}
+				if cr {
+					line += "\r"
+				}
+				lines[change.LineNumber-1] = line
+			}
+			_, failed = s.storeTextFile(fullPath, file, strings.Join(lines, "\n"))
+		}
+		if failed != nil {
+			failures = append(failures, map[string]string{"file_path": relPath, "error": resultText(failed)})
+			continue
+		}
+		s.recordChange("rename_file", changeModified, fullPath, "", false)
+		updated++
+	}
+	return updated, failures
+}
+
+// newReferenceRewriter builds the rewrite rules for moving oldPath to newPath,
+// in the same order as the needles of usageNeedles
+func (s *Server) newReferenceRewriter(oldPath, newPath string) *referenceRewriter {
+	rw := &referenceRewriter{oldPath: oldPath, newPath: newPath}
+	oldExt, newExt := path.Ext(oldPath), path.Ext(newPath)
+	oldDir, newDir := path.Dir(oldPath), path.Dir(newPath)
+
+	if oldExt == ".go" {
+		if oldImport := s.goImportPath(oldDir); oldImport != "" {
+			newImport := s.goImportPath(newDir)
+			reason := ""
+			switch {
+			case newImport == "":
+				reason = "destination is outside any Go module"
+			case oldDir != newDir && !s.onlyGoFile(oldPath):
+				reason = fmt.Sprintf("other Go files remain in package %s; move the package instead", oldImport)
+			}
+			oldQuoted, newQuoted := `"`+oldImport+`"`, `"`+newImport+`"`
+			rw.rules = append(rw.rules, referenceRule{text: oldQuoted, apply: func(_, line string) (string, string) {
+				if reason != "" && oldImport != newImport {
+					return "", reason
+				}
+				return strings.ReplaceAll(line, oldQuoted, newQuoted), ""
+			}})
+		}
+	}
+
+	if oldExt == ".py" {
+		oldParts := pythonModuleParts(oldPath)
+		newParts := pythonModuleParts(newPath)
+		for i := range oldParts {
+			oldModule := strings.Join(oldParts[i:], ".")
+			root := oldParts[:i]
+			rw.rules = append(rw.rules, referenceRule{text: oldModule, match: pythonImportLine.MatchString, apply: func(relPath, line string) (string, string) {
+				if !strings.HasPrefix(path.Ext(relPath), ".py") {
+					return line, ""
+				}
+				// The first i directories are the import root; the new
+				// module must live under the same root
+				if newExt != ".py" || len(newParts) <= i || strings.Join(newParts[:i], "/") != strings.Join(root, "/") {
+					return "", fmt.Sprintf("destination is not a module under the import root of %s", oldModule)
+				}
+				if i == len(oldParts)-1 && len(oldParts) > 1 && oldDir != newDir {
+					return "", "bare module name; its package changes, so update the import by hand"
+				}
+				after := replaceDotted(line, oldModule, strings.Join(newParts[i:], "."))
+				if after == line {
+					return "", "relative import; update by hand"
+				}
+				return after, ""
+			}})
+		}
+	}
+
+	rw.rules = append(rw.rules, referenceRule{text: oldPath, apply: func(_, line string) (string, string) {
+		return replaceWord(line, oldPath, newPath), ""
+	}})
+	if oldExt != "" {
+		oldNoExt, newNoExt := strings.TrimSuffix(oldPath, oldExt), strings.TrimSuffix(newPath, newExt)
+		rw.rules = append(rw.rules, referenceRule{text: oldNoExt, apply: func(_, line string) (string, string) {
+			return replaceWord(line, oldNoExt, newNoExt), ""
+		}})
+	}
+
+	oldBase, newBase := path.Base(oldPath), path.Base(newPath)
+	rw.rules = append(rw.rules, referenceRule{text: oldBase, apply: func(relPath, line string) (string, string) {
+		reason := ""
+		after := replaceQuoted(line, func(spec string) string {
+			if spec != oldBase && !strings.HasSuffix(spec, "/"+oldBase) {
+				return spec
+			}
+			if oldDir == newDir {
+				return strings.TrimSuffix(spec, oldBase) + newBase
+			}
+			// A moved file can only be followed if the name resolves from
+			// the referencing file's directory
+			if path.Join(path.Dir(relPath), spec) == oldPath {
+				return relativeSpec(path.Dir(relPath), newPath, false)
+			}
+			reason = fmt.Sprintf("cannot tell what %q is relative to", spec)
+			return spec
+		})
+		if reason != "" {
+			return "", reason
+		}
+		return after, ""
+	}})
+
+	return rw
+}
+
+// rewrite returns a line of the file at relPath with its references to the
+// old path replaced, or a reason it cannot be rewritten
+func (rw *referenceRewriter) rewrite(relPath, line string) (string, string) {
+	if isJavaScriptLike(relPath) && importsRelative(line, path.Dir(relPath), rw.oldPath) {
+		dir := path.Dir(relPath)
+		return replaceQuoted(line, func(spec string) string {
+			if !resolvesTo(spec, dir, rw.oldPath) {
+				return spec
+			}
+			return rw.newSpec(spec, dir)
+		}), ""
+	}
+	for _, rule := range rw.rules {
+		if containsWord(line, rule.text) && (rule.match == nil || rule.match(line)) {
+			return rule.apply(relPath, line)
+		}
+	}
+	return line, ""
+}
+
+// newSpec rewrites a relative import of the old path, made from dir, to
+// import the new path in the same style
+func (rw *referenceRewriter) newSpec(spec, dir string) string {
+	resolved := path.Join(dir, spec)
+	newNoExt := strings.TrimSuffix(rw.newPath, path.Ext(rw.newPath))
+	switch {
+	case resolved == rw.oldPath:
+		return relativeSpec(dir, rw.newPath, true)
+	case resolved == path.Dir(rw.oldPath) && path.Base(newNoExt) == "index":
+		return relativeSpec(dir, path.Dir(rw.newPath), true)
+	default:
+		return relativeSpec(dir, newNoExt, true)
+	}
+}
+
+// rewriteOwnImports re-points the relative imports of the moved file itself
+func (rw *referenceRewriter) rewriteOwnImports(line string) string {
+	oldDir, newDir := path.Dir(rw.oldPath), path.Dir(rw.newPath)
+	return replaceQuoted(line, func(spec string) string {
+		if !strings.HasPrefix(spec, "./") && !strings.HasPrefix(spec, "../") {
+			return spec
+		}
+		return relativeSpec(newDir, path.Join(oldDir, spec), true)
+	})
+}
+
+// onlyGoFile reports whether the Go file at relPath is the only non-test Go
+// file in its directory, so its import path can move with it
+func (s *Server) onlyGoFile(relPath string) bool {
+	entries, err := s.guard.ReadDir(filepath.Join(s.config.BasePath, filepath.FromSlash(path.Dir(relPath))))
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if name != path.Base(relPath) && strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+			return false
+		}
+	}
+	return true
+}
+
+// pythonModuleParts splits a .py path into the parts of its dotted module name
+func pythonModuleParts(relPath string) []string {
+	parts := strings.Split(strings.TrimSuffix(relPath, path.Ext(relPath)), "/")
+	if len(parts) > 1 && parts[len(parts)-1] == "__init__" {
+		parts = parts[:len(parts)-1]
+	}
+	return parts
+}
+
+// relativeSpec spells target as a path relative to dir; dotted specs always
+// start with "./" or "../", as JS imports require
+func relativeSpec(dir, target string, dotted bool) string {
+	rel, err := filepath.Rel(filepath.FromSlash(dir), filepath.FromSlash(target))
+	if err != nil {
+		return target
+	}
+	rel = filepath.ToSlash(rel)
+	if dotted && rel != ".." && !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+	return rel
+}
+
+// replaceQuoted rewrites the contents of each quoted string on a line
+func replaceQuoted(line string, replace func(spec string) string) string {
+	var out strings.Builder
+	last := 0
+	for _, m := range quotedStrings.FindAllStringSubmatchIndex(line, -1) {
+		out.WriteString(line[last:m[2]])
+		out.WriteString(replace(line[m[2]:m[3]]))
+		last = m[3]
+	}
+	out.WriteString(line[last:])
+	return out.String()
+}
+
+// replaceWord replaces each occurrence of old in line that is not part of a
+// longer identifier, as matched by containsWord
+func replaceWord(line, old, new string) string {
+	return replaceBounded(line, old, new, func(c byte) bool { return isIdentByte(c) })
+}
+
+// replaceDotted is replaceWord for dotted module names, which must not be
+// the tail of a longer name or a relative import
+func replaceDotted(line, old, new string) string {
+	return replaceBounded(line, old, new, func(c byte) bool { return isIdentByte(c) || c == '.' })
+}
+
+func replaceBounded(line, old, new string, before func(byte) bool) string {
+	var out strings.Builder
+	last := 0
+	for start := 0; start < len(line); {
+		i := strings.Index(line[start:], old)
+		if i < 0 {
+			break
+		}
+		i += start
+		end := i + len(old)
+		if (i == 0 || !before(line[i-1])) && (end == len(line) || !isIdentByte(line[end])) {
+			out.WriteString(line[last:i])
+			out.WriteString(new)
+			last = end
+			start = end
+			continue
+		}
+		start = i + 1
+	}
+	out.WriteString(line[last:])
+	return out.String()
+}
+
+// resultText returns the text of a tool result, such as an error message
+func resultText(result *mcp.CallToolResult) string {
+	var parts []string
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			parts = append(parts, text.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
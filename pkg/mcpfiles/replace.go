@@ -0,0 +1,207 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ReplacedFile is one file search_and_replace changed, or would change
+type ReplacedFile struct {
+	FilePath     string `json:"file_path"`
+	Replacements int    `json:"replacements"`
+	Diff         string `json:"diff"`
+}
+
+// replacement is a planned change to one file
+type replacement struct {
+	fullPath string
+	file     *textFile
+	text     string
+	ReplacedFile
+}
+
+// handleSearchAndReplace handles the search_and_replace tool
+func (s *Server) handleSearchAndReplace(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	replace, errResult := parseReplaceRequest(request)
+	if errResult != nil {
+		return errResult, nil
+	}
+	dryRun := request.GetBool("dry_run", false)
+
+	// Plan every change before writing any, so a file that cannot be
+	// changed leaves them all untouched
+	searched, planned, err := s.planReplacements(ctx, replace.globs, replace.re, replace.substitute)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read directory: %v", err)), nil
+	}
+
+	changed := []ReplacedFile{}
+	total := 0
+	for _, r := range planned {
+		if !dryRun {
+			if _, errResult := s.storeTextFile(r.fullPath, r.file, r.text); errResult != nil {
+				if len(changed) == 0 {
+					return errResult, nil
+				}
+				return mcp.NewToolResultError(fmt.Sprintf("%s (after changing %d files)", resultText(errResult), len(changed))), nil
+			}
+			s.recordChange("search_and_replace", changeModified, r.fullPath, "", false)
+		}
+		changed = append(changed, r.ReplacedFile)
+		total += r.Replacements
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"pattern":        replace.pattern,
+		"files":          changed,
+		"files_searched": searched,
+		"files_changed":  len(changed),
+		"replacements":   total,
+		"dry_run":        dryRun,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// replaceRequest is a search_and_replace call with its pattern compiled
+type replaceRequest struct {
+	pattern    string
+	globs      []string
+	re         *regexp.Regexp
+	substitute func(string) string
+}
+
+// parseReplaceRequest reads the arguments of a search_and_replace call
+func parseReplaceRequest(request mcp.CallToolRequest) (*replaceRequest, *mcp.CallToolResult) {
+	pattern, err := request.RequireString("pattern")
+	if err != nil {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err))
+	}
+	replace, err := request.RequireString("replacement")
+	if err != nil {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err))
+	}
+	files, err := request.RequireString("files")
+	if err != nil {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err))
+	}
+	globs, err := parseGlobs(files)
+	if err != nil {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Invalid files: %v", err))
+	}
+	literal := request.GetBool("literal", false)
+
+	// Compile the pattern; one that matches nothing at all would insert the
+	// replacement between every two characters
+	expr := pattern
+	if literal {
+		expr = regexp.QuoteMeta(pattern)
+	}
+	if request.GetBool("ignore_case", false) {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Invalid pattern: %v", err))
+	}
+	if re.MatchString("") {
+		return nil, mcp.NewToolResultError("Invalid pattern: it matches the empty string")
+	}
+	substitute := func(text string) string { return re.ReplaceAllString(text, replace) }
+	if literal {
+		substitute = func(text string) string { return re.ReplaceAllLiteralString(text, replace) }
+	}
+
+	return &replaceRequest{pattern: pattern, globs: globs, re: re, substitute: substitute}, nil
+}
+
+// planReplacements applies the substitution, in memory, to the text files
+// under the base path matching one of globs, skipping files .gitignore and
+// .mcpignore hide. Returns how many files were searched and the changes to
+// those that matched.
+func (s *Server) planReplacements(ctx context.Context, globs []string, re *regexp.Regexp, substitute func(string) string) (int, []replacement, error) {
+	filter := s.pathFilter()
+	searched := 0
+	var planned []replacement
+	err := s.guard.WalkDir(ctx, s.config.BasePath, func(path string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return nil
+		}
+		if path != s.config.BasePath && filter.ShouldIgnore(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || s.config.extensionHandling(path).Binary {
+			return nil
+		}
+		relPath, _ := filepath.Rel(s.config.BasePath, path)
+		relPath = filepath.ToSlash(relPath)
+		if !matchesAnyGlob(globs, relPath) {
+			return nil
+		}
+
+		// Files that are too large or not text are left alone, as
+		// loadTextFile would refuse them
+		info, err := d.Info()
+		if err != nil || info.Size() > s.config.maxFileSize(path) {
+			return nil
+		}
+		content, err := s.guard.ReadFile(path)
+		if err != nil {
+			return ignoreUnlessUnavailable(err)
+		}
+		encoding, ok := s.config.textEncoding(path, content)
+		if !ok {
+			return nil
+		}
+		decoded, err := decodeText(content, encoding)
+		if err != nil {
+			return nil
+		}
+		file := &textFile{text: decoded, encoding: encoding, perm: info.Mode().Perm()}
+		searched++
+		count := len(re.FindAllStringIndex(file.text, -1))
+		if count == 0 {
+			return nil
+		}
+		text := substitute(file.text)
+		planned = append(planned, replacement{
+			fullPath:     path,
+			file:         file,
+			text:         text,
+			ReplacedFile: ReplacedFile{FilePath: relPath, Replacements: count, Diff: unifiedDiff(relPath, file.text, text)},
+		})
+		return nil
+	})
+	return searched, planned, err
+}
+
+// matchesAnyGlob reports whether a slash-separated path matches one of globs
+func matchesAnyGlob(globs []string, relPath string) bool {
+	for _, glob := range globs {
+		if matchGlob(glob, relPath) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,297 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Token budgets of repo_map, estimated at four bytes a token
+const (
+	defaultRepoMapTokens = 1024
+	maxRepoMapTokens     = 16384
+	bytesPerToken        = 4
+	maxRepoMapDocLength  = 80 // characters of a one-line description
+)
+
+// repoMapEntryFiles are base names that mark a file as an entry point of its
+// package, ranked above its neighbors
+var repoMapEntryFiles = map[string]bool{
+	"main.go": true, "doc.go": true, "__init__.py": true, "__main__.py": true, "main.py": true,
+	"index.js": true, "index.ts": true, "main.js": true, "main.ts": true,
+}
+
+// repoMapCache keeps the outline of each file the map was built from, so
+// later maps only parse the files that changed since. A nil cache keeps
+// nothing.
+type repoMapCache struct {
+	mu      sync.Mutex
+	entries map[string]*repoMapEntry
+}
+
+type repoMapEntry struct {
+	size    int64
+	modTime time.Time
+	outline *fileOutline
+}
+
+func newRepoMapCache() *repoMapCache {
+	return &repoMapCache{entries: map[string]*repoMapEntry{}}
+}
+
+// lookup returns the outline of a file if it is still current
+func (c *repoMapCache) lookup(fullPath string, info fs.FileInfo) *fileOutline {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.entries[fullPath]
+	if entry == nil || entry.size != info.Size() || !entry.modTime.Equal(info.ModTime()) {
+		return nil
+	}
+	return entry.outline
+}
+
+func (c *repoMapCache) store(fullPath string, info fs.FileInfo, outline *fileOutline) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.entries[fullPath] = &repoMapEntry{size: info.Size(), modTime: info.ModTime(), outline: outline}
+	c.mu.Unlock()
+}
+
+// sweep forgets the files under dir that a walk of it did not see, so the
+// cache does not outgrow the tree
+func (c *repoMapCache) sweep(dir string, seen map[string]bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for p := range c.entries {
+		if !seen[p] && (p == dir || strings.HasPrefix(p, dir+string(filepath.Separator))) {
+			delete(c.entries, p)
+		}
+	}
+}
+
+// repoMapFile is a file of the map with its exported symbols
+type repoMapFile struct {
+	relPath string
+	doc     string
+	symbols []SymbolDoc
+	rank    int // 0 for source, 1 for tests, 2 for generated files
+	score   int
+}
+
+// handleRepoMap handles the repo_map tool
+func (s *Server) handleRepoMap(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	dirPath := request.GetString("path", ".")
+	budget := request.GetInt("max_tokens", defaultRepoMapTokens)
+	if budget <= 0 || budget > maxRepoMapTokens {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid max_tokens: must be between 1 and %d", maxRepoMapTokens)), nil
+	}
+
+	// Validate and resolve path
+	fullPath, err := s.validateFilePath(dirPath)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid path: %v", err)), nil
+	}
+	stat, err := s.guard.Stat(fullPath)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Directory not found: %v", err)), nil
+	}
+	if !stat.IsDir() {
+		return mcp.NewToolResultError("Cannot map repository: path is not a directory"), nil
+	}
+
+	files, parsed, err := s.repoMapFiles(ctx, fullPath)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read directory: %v", err)), nil
+	}
+	sort.Slice(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if a.rank != b.rank {
+			return a.rank < b.rank
+		}
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		return a.relPath < b.relPath
+	})
+
+	// Add whole files while they fit, then only the names of the rest
+	var b strings.Builder
+	included, truncated := 0, false
+	limit := budget * bytesPerToken
+	for _, file := range files {
+		block := s.repoMapBlock(file)
+		if b.Len()+len(block) > limit {
+			truncated = true
+			name, _, _ := strings.Cut(block, "\n")
+			block = name + "\n"
+			if b.Len()+len(block) > limit {
+				break
+			}
+		}
+		b.WriteString(block)
+		included++
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"path":        dirPath,
+		"map":         b.String(),
+		"files":       included,
+		"files_total": len(files),
+		"tokens":      (b.Len() + bytesPerToken - 1) / bytesPerToken,
+		"max_tokens":  budget,
+		"truncated":   truncated,
+		"parsed":      parsed,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// repoMapFiles outlines the source files under dir that have exported
+// symbols, reusing the outlines of files unchanged since the last map.
+// Returns how many files had to be parsed.
+func (s *Server) repoMapFiles(ctx context.Context, dir string) ([]repoMapFile, int, error) {
+	filter := s.pathFilter()
+	seen := map[string]bool{}
+	var files []repoMapFile
+	parsed := 0
+	err := s.guard.WalkDir(ctx, dir, func(p string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return nil
+		}
+		if p != dir && filter.ShouldIgnore(p) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := s.config.sourceExtension(p)
+		extract, ok := docExtractors[ext]
+		if !d.Type().IsRegular() || !ok {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() > s.config.maxFileSize(p) {
+			return nil
+		}
+		seen[p] = true
+
+		outline := s.repoMap.lookup(p, info)
+		if outline == nil {
+			content, err := s.guard.ReadFile(p)
+			if err != nil {
+				return ignoreUnlessUnavailable(err)
+			}
+			doc, symbols := extract(string(content))
+			outline = &fileOutline{doc: doc, symbols: symbols}
+			s.repoMap.store(p, info, outline)
+			parsed++
+		}
+
+		relPath, _ := filepath.Rel(s.config.BasePath, p)
+		relPath = filepath.ToSlash(relPath)
+		file := repoMapFile{relPath: relPath, doc: outline.doc}
+		for _, sym := range outline.symbols {
+			if exportedSymbol(ext, sym.Name) {
+				file.symbols = append(file.symbols, sym)
+			}
+		}
+		if len(file.symbols) == 0 {
+			return nil
+		}
+		tags := fileTags(s.config.Tags, relPath)
+		switch {
+		case hasAnyTag(tags, map[string]bool{"generated": true}):
+			file.rank = 2
+		case hasAnyTag(tags, map[string]bool{"test": true}):
+			file.rank = 1
+		}
+		file.score = len(file.symbols)
+		if file.doc != "" {
+			file.score += 5
+		}
+		if repoMapEntryFiles[path.Base(relPath)] {
+			file.score += 10
+		}
+		files = append(files, file)
+		return nil
+	})
+
+	s.repoMap.sweep(dir, seen)
+	return files, parsed, err
+}
+
+// repoMapBlock renders one file of the map: its path and description, then
+// a line per exported symbol
+func (s *Server) repoMapBlock(file repoMapFile) string {
+	var b strings.Builder
+	b.WriteString(path.Join(s.root, file.relPath))
+	if doc := shortDoc(file.doc); doc != "" {
+		b.WriteString(": " + doc)
+	}
+	b.WriteString("\n")
+	for _, sym := range file.symbols {
+		b.WriteString("  " + strings.TrimSpace(strings.TrimSuffix(firstLine(sym.Signature), "{")))
+		if doc := shortDoc(sym.Doc); doc != "" {
+			b.WriteString("  // " + doc)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// shortDoc returns the first line of a doc comment, cut to
+// maxRepoMapDocLength characters
+func shortDoc(doc string) string {
+	line := firstLine(doc)
+	if utf8.RuneCountInString(line) <= maxRepoMapDocLength {
+		return line
+	}
+	return string([]rune(line)[:maxRepoMapDocLength-3]) + "..."
+}
+
+// exportedSymbol reports whether a symbol is part of a file's public API: in
+// Go a capitalized name, and elsewhere one without a leading underscore or #.
+// Names qualified by their type count when both parts are exported.
+func exportedSymbol(ext, name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		first, _ := utf8.DecodeRuneInString(part)
+		if ext == ".go" && !unicode.IsUpper(first) || first == '_' || first == '#' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,308 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	// defaultReservationTTL is how long a reservation lasts unless renewed
+	defaultReservationTTL = 10 * time.Minute
+	// maxReservationTTL bounds the lifetime asked for with ttl_seconds
+	maxReservationTTL = time.Hour
+	// maxReservations bounds the reservations held at once, by all sessions
+	maxReservations = 10000
+)
+
+// Reservation is a session's advisory claim on a file or directory it means
+// to change. Nothing is locked: other sessions see it and can keep clear.
+type Reservation struct {
+	Path     string    `json:"path"`
+	Owner    string    `json:"owner,omitempty"` // name the agent gave itself
+	Note     string    `json:"note,omitempty"`  // what it means to change
+	Reserved time.Time `json:"reserved"`
+	Expires  time.Time `json:"expires"`
+	Mine     bool      `json:"mine"` // held by the calling session
+
+	session string
+}
+
+// reservationStore holds the live reservations of one root, keyed by
+// session and path
+type reservationStore struct {
+	mu           sync.Mutex
+	reservations map[string]*Reservation
+}
+
+func newReservationStore() *reservationStore {
+	return &reservationStore{reservations: make(map[string]*Reservation)}
+}
+
+func reservationKey(session, relPath string) string {
+	return session + "\x00" + relPath
+}
+
+// pathsOverlap reports whether two slash-separated paths are the same or one
+// is inside the other
+func pathsOverlap(a, b string) bool {
+	return a == b || a == "." || b == "." || strings.HasPrefix(b, a+"/") || strings.HasPrefix(a, b+"/")
+}
+
+// expire drops reservations past their time; the caller holds the lock
+func (r *reservationStore) expire(now time.Time) {
+	for key, reservation := range r.reservations {
+		if !now.Before(reservation.Expires) {
+			delete(r.reservations, key)
+		}
+	}
+}
+
+// reserve claims paths for a session, renewing those it already holds, and
+// returns the reservations and those of other sessions that overlap them
+func (r *reservationStore) reserve(session string, paths []string, owner, note string, ttl time.Duration) ([]Reservation, []Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	r.expire(now)
+	added := 0
+	for _, p := range paths {
+		if _, ok := r.reservations[reservationKey(session, p)]; !ok {
+			added++
+		}
+	}
+	if len(r.reservations)+added > maxReservations {
+		return nil, nil, fmt.Errorf("too many reservations (%d); release some first", maxReservations)
+	}
+
+	reserved := make([]Reservation, 0, len(paths))
+	for _, p := range paths {
+		key := reservationKey(session, p)
+		reservation, ok := r.reservations[key]
+		if !ok {
+			reservation = &Reservation{Path: p, Reserved: now, session: session}
+			r.reservations[key] = reservation
+		}
+		reservation.Owner, reservation.Note = owner, note
+		reservation.Expires = now.Add(ttl)
+		reserved = append(reserved, reservation.view(session))
+	}
+
+	var conflicts []Reservation
+	for _, reservation := range r.reservations {
+		if reservation.session == session {
+			continue
+		}
+		for _, p := range paths {
+			if pathsOverlap(p, reservation.Path) {
+				conflicts = append(conflicts, reservation.view(session))
+				break
+			}
+		}
+	}
+	sortReservations(conflicts)
+	return reserved, conflicts, nil
+}
+
+// release drops a session's reservations of paths, or all of them when
+// paths is empty, and returns what it dropped
+func (r *reservationStore) release(session string, paths []string) []Reservation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expire(time.Now())
+	var released []Reservation
+	for key, reservation := range r.reservations {
+		if reservation.session != session {
+			continue
+		}
+		match := len(paths) == 0
+		for _, p := range paths {
+			match = match || reservation.Path == p
+		}
+		if match {
+			released = append(released, reservation.view(session))
+			delete(r.reservations, key)
+		}
+	}
+	sortReservations(released)
+	return released
+}
+
+// list returns the live reservations overlapping relPath, or all of them
+// when it is empty, as seen by a session
+func (r *reservationStore) list(session, relPath string) []Reservation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expire(time.Now())
+	reservations := []Reservation{}
+	for _, reservation := range r.reservations {
+		if relPath == "" || pathsOverlap(relPath, reservation.Path) {
+			reservations = append(reservations, reservation.view(session))
+		}
+	}
+	sortReservations(reservations)
+	return reservations
+}
+
+// forget drops every reservation of a session that has ended
+func (r *reservationStore) forget(session string) {
+	r.release(session, nil)
+}
+
+// view copies a reservation as a session sees it. Session IDs are never
+// shown, since they would let one agent act as another.
+func (res *Reservation) view(session string) Reservation {
+	out := *res
+	out.Mine = res.session == session
+	out.session = ""
+	return out
+}
+
+// sortReservations orders reservations by path, then oldest first
+func sortReservations(reservations []Reservation) {
+	sort.Slice(reservations, func(i, j int) bool {
+		a, b := reservations[i], reservations[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Reserved.Before(b.Reserved)
+	})
+}
+
+// relativePath checks a path a tool keeps state about, such as one to
+// reserve, and returns it relative to the base path, slash-separated. It need
+// not exist.
+func (s *Server) relativePath(p string) (string, error) {
+	fullPath, err := s.validateFilePath(p)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", p, err)
+	}
+	if s.hidden.ShouldIgnore(fullPath) {
+		return "", fmt.Errorf("%s: permission denied", p)
+	}
+	relPath, _ := filepath.Rel(s.config.BasePath, fullPath)
+	return filepath.ToSlash(relPath), nil
+}
+
+// relativePaths checks a comma-separated list of paths like relativePath
+func (s *Server) relativePaths(list string) ([]string, error) {
+	var paths []string
+	seen := map[string]bool{}
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		relPath, err := s.relativePath(p)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[relPath] {
+			seen[relPath] = true
+			paths = append(paths, relPath)
+		}
+	}
+	return paths, nil
+}
+
+// handleReserveFiles handles the reserve_files tool
+func (s *Server) handleReserveFiles(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	list, err := request.RequireString("paths")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	paths, err := s.relativePaths(list)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid path: %v", err)), nil
+	}
+	if len(paths) == 0 {
+		return mcp.NewToolResultError("paths must name at least one file or directory"), nil
+	}
+	ttl := defaultReservationTTL
+	if seconds := request.GetInt("ttl_seconds", 0); seconds != 0 {
+		ttl = time.Duration(seconds) * time.Second
+		if ttl <= 0 || ttl > maxReservationTTL {
+			return mcp.NewToolResultError(fmt.Sprintf("ttl_seconds must be between 1 and %d", int(maxReservationTTL.Seconds()))), nil
+		}
+	}
+
+	reserved, conflicts, err := s.reservations.reserve(sessionID(ctx), paths, request.GetString("owner", ""), request.GetString("note", ""), ttl)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if conflicts == nil {
+		conflicts = []Reservation{}
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"reserved":  reserved,
+		"conflicts": conflicts,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// handleReleaseFiles handles the release_files tool
+func (s *Server) handleReleaseFiles(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	paths, err := s.relativePaths(request.GetString("paths", ""))
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid path: %v", err)), nil
+	}
+	released := s.reservations.release(sessionID(ctx), paths)
+	if released == nil {
+		released = []Reservation{}
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"released": released,
+		"count":    len(released),
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// handleListReservations handles the list_reservations tool
+func (s *Server) handleListReservations(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	relPath := ""
+	if p := request.GetString("path", ""); p != "" {
+		var err error
+		if relPath, err = s.relativePath(p); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid path: %v", err)), nil
+		}
+	}
+	reservations := s.reservations.list(sessionID(ctx), relPath)
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"reservations": reservations,
+		"count":        len(reservations),
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
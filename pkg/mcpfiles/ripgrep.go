@@ -0,0 +1,322 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rgOutputFactor bounds ripgrep's JSON output relative to MaxGrepOutput,
+// since each line arrives wrapped in a message several times its size
+const rgOutputFactor = 4
+
+// rgText is a string in ripgrep's JSON output. Data that is not valid UTF-8
+// is sent base64-encoded in bytes instead of text.
+type rgText struct {
+	Text  *string `json:"text"`
+	Bytes string  `json:"bytes"`
+}
+
+func (t rgText) String() string {
+	if t.Text != nil {
+		return *t.Text
+	}
+	data, _ := base64.StdEncoding.DecodeString(t.Bytes)
+	return string(data)
+}
+
+// rgMessage is one line of `rg --json` output
+type rgMessage struct {
+	Type string `json:"type"` // begin, match, context, end or summary
+	Data struct {
+		Path       rgText `json:"path"`
+		Lines      rgText `json:"lines"`
+		LineNumber int    `json:"line_number"`
+		Submatches []struct {
+			Start int `json:"start"`
+			End   int `json:"end"`
+		} `json:"submatches"`
+		Stats struct {
+			Searches int `json:"searches"` // files searched, in the summary
+		} `json:"stats"`
+	} `json:"data"`
+}
+
+// ripgrepQuery runs a query with rg, giving it the RE2 translation of the
+// pattern. Files are selected as the native search selects them: ignore
+// files, hidden files and symlinks get no special treatment, and paths
+// .mcpignore hides are dropped from the output.
+func (s *Server) ripgrepQuery(ctx context.Context, query GrepQuery, surrounding grepContext) (*GrepResult, error) {
+	maxSize := s.config.MaxFileSize
+	if query.MaxFileSize != nil {
+		maxSize = min(maxSize, *query.MaxFileSize)
+	}
+	limits := s.grepLimits(query)
+
+	args := []string{"--no-config", "--no-ignore", "--hidden", "--max-filesize", strconv.FormatInt(maxSize, 10)}
+	switch {
+	case query.countOnly:
+		// Counts come as a path, a NUL and the count, one file per line
+		args = append(args, "--count-matches", "--with-filename", "--null")
+	default:
+		// One match past the cap tells whether a file had more
+		args = append(args, "--json", "--max-count", strconv.Itoa(limits.perFile+1))
+		if surrounding.Before > 0 {
+			args = append(args, "--before-context", strconv.Itoa(surrounding.Before))
+		}
+		if surrounding.After > 0 {
+			args = append(args, "--after-context", strconv.Itoa(surrounding.After))
+		}
+	}
+	if query.Invert != nil && *query.Invert {
+		args = append(args, "--invert-match")
+	}
+	if query.multiline() {
+		args = append(args, "--multiline", "--multiline-dotall")
+	}
+	// rg searches files matching any of several globs
+	for _, glob := range query.namePatterns() {
+		args = append(args, "--glob", glob)
+	}
+	// rg anchors globs with a slash to its working directory, so only name
+	// globs are passed; the output is filtered by every glob below
+	for _, glob := range query.Exclude {
+		if !strings.Contains(glob, "/") {
+			args = append(args, "--glob", "!"+glob)
+		}
+	}
+	args = append(args, "--regexp", query.expression(), "--", s.config.BasePath)
+	if query.countOnly {
+		return s.ripgrepCount(ctx, query, args)
+	}
+
+	// Parse messages as they arrive so rg is stopped as soon as a cap is passed
+	tally := newSearchTally()
+	files := map[string]*fileHits{}
+	var relPaths []string
+	var current *fileHits
+	var currentPath string
+	matches := 0
+	var output int64
+	finished := false
+	var parseErr error
+	parse := func(line []byte) bool {
+		var msg rgMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			parseErr = fmt.Errorf("unexpected rg output: %w", err)
+			return true
+		}
+		switch msg.Type {
+		case "begin":
+			path := msg.Data.Path.String()
+			// rg knows nothing of .mcpignore; drop what it hides
+			if s.hidden.ShouldIgnore(path) {
+				tally.skip(skipIgnored)
+				current = nil
+				return false
+			}
+			if query.excludes(s.config.BasePath, path) {
+				tally.skip(skipExcluded)
+				current = nil
+				return false
+			}
+			if rel, err := filepath.Rel(s.config.BasePath, path); err == nil {
+				path = rel
+			}
+			current, currentPath = &fileHits{}, path
+			files[path] = current
+			relPaths = append(relPaths, path)
+		case "match", "context":
+			if current == nil || current.truncated {
+				return false
+			}
+			if msg.Type == "match" && current.matches >= limits.perFile {
+				current.truncated = true
+				current.lines = trimContext(current.lines, surrounding.After)
+				return false
+			}
+			lines, spans := rgLines(msg, query.multiline())
+			for _, gl := range lines {
+				current.lines = append(current.lines, gl)
+				output += outputSize(currentPath, gl)
+			}
+			if msg.Type == "match" {
+				n := max(len(spans), 1)
+				current.matches += n
+				matches += n
+				current.spans = append(current.spans, spans...)
+			}
+			return matches > limits.matches || output > s.config.MaxGrepOutput
+		case "summary":
+			tally.scanned = msg.Data.Stats.Searches
+			finished = true
+		}
+		return false
+	}
+
+	start := time.Now()
+	out, err := runCommand(ctx, commandLimits{
+		Timeout:    s.grepTimeout(query),
+		MaxOutput:  rgOutputFactor * s.config.MaxGrepOutput,
+		StopBefore: parse,
+	}, s.ripgrep, args...)
+	// rg exits 2 when some files could not be read, even after a complete search
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) && cmdErr.ExitCode == 2 && finished {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	searched := phaseMs(start)
+
+	// rg searches files in parallel; report them in walk order
+	start = time.Now()
+	sort.Slice(relPaths, func(i, j int) bool { return walkLess(relPaths[i], relPaths[j]) })
+	hits := make([]*fileHits, len(relPaths))
+	for i, path := range relPaths {
+		hits[i] = files[path]
+	}
+
+	result := s.collectHits(query, SearchBackendRipgrep, relPaths, hits)
+	if out != nil && out.Truncated {
+		result.Truncated = true
+	}
+	result.Explain = tally.explain(SearchBackendRipgrep)
+	result.Explain.PhasesMs = map[string]float64{"search": searched, "collect": phaseMs(start)}
+	result.Explain.Note = "rg walks and searches in one pass and does not say which files it skips: " +
+		"only files .mcpignore hid from its output are counted, and files_scanned is unknown when the search stopped at a cap"
+	return result, nil
+}
+
+// ripgrepCount runs rg with --count-matches, which has no caps and sends no
+// lines, and drops the files .mcpignore hides or the query excludes
+func (s *Server) ripgrepCount(ctx context.Context, query GrepQuery, args []string) (*GrepResult, error) {
+	tally := newSearchTally()
+	counts := map[string]int{}
+	var relPaths []string
+	var parseErr error
+	parse := func(line []byte) bool {
+		path, count, ok := strings.Cut(string(line), "\x00")
+		n, err := strconv.Atoi(count)
+		if !ok || err != nil {
+			parseErr = fmt.Errorf("unexpected rg output: %q", line)
+			return true
+		}
+		switch {
+		case s.hidden.ShouldIgnore(path):
+			tally.skip(skipIgnored)
+		case query.excludes(s.config.BasePath, path):
+			tally.skip(skipExcluded)
+		default:
+			if rel, err := filepath.Rel(s.config.BasePath, path); err == nil {
+				path = rel
+			}
+			counts[path] = n
+			relPaths = append(relPaths, path)
+		}
+		return false
+	}
+
+	start := time.Now()
+	out, err := runCommand(ctx, commandLimits{
+		Timeout:    s.grepTimeout(query),
+		MaxOutput:  rgOutputFactor * s.config.MaxGrepOutput,
+		StopBefore: parse,
+	}, s.ripgrep, args...)
+	// rg exits 2 when some files could not be read, after counting the rest
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) && cmdErr.ExitCode == 2 && len(relPaths) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	searched := phaseMs(start)
+
+	start = time.Now()
+	sort.Slice(relPaths, func(i, j int) bool { return walkLess(relPaths[i], relPaths[j]) })
+	hits := make([]*fileHits, len(relPaths))
+	for i, path := range relPaths {
+		hits[i] = &fileHits{matches: counts[path]}
+	}
+	result := s.collectHits(query, SearchBackendRipgrep, relPaths, hits)
+	if out != nil && out.Truncated {
+		result.Truncated = true
+	}
+	result.Explain = tally.explain(SearchBackendRipgrep)
+	result.Explain.PhasesMs = map[string]float64{"search": searched, "collect": phaseMs(start)}
+	result.Explain.Note = "rg counts matches without saying which files it searched or skipped: " +
+		"only files .mcpignore hid from its output are counted, and files_scanned is unknown"
+	return result, nil
+}
+
+// rgLines returns the lines of a match or context message. A multiline
+// match may cross several lines; its submatches are returned as spans.
+func rgLines(msg rgMessage, multiline bool) ([]GrepLine, []MatchSpan) {
+	text := strings.TrimSuffix(msg.Data.Lines.String(), "\n")
+	if !multiline || msg.Type != "match" {
+		gl := GrepLine{LineNumber: msg.Data.LineNumber, Content: text, IsMatch: msg.Type == "match"}
+		for _, sub := range msg.Data.Submatches {
+			gl.Ranges = append(gl.Ranges, MatchRange{Start: sub.Start, End: sub.End})
+		}
+		gl.Ranges = withColumns(text, gl.Ranges)
+		return []GrepLine{gl}, nil
+	}
+
+	content := []byte(text)
+	starts := lineStarts(content)
+	if len(starts) == 0 {
+		starts = []int{0}
+	}
+	lines := make([]GrepLine, len(starts))
+	for i := range starts {
+		lines[i] = GrepLine{LineNumber: msg.Data.LineNumber + i, Content: string(lineAt(content, starts, i)), IsMatch: true}
+	}
+	var spans []MatchSpan
+	for _, sub := range msg.Data.Submatches {
+		first, last := lineIndex(starts, sub.Start), lineIndex(starts, max(sub.End-1, sub.Start))
+		spans = append(spans, MatchSpan{StartLine: msg.Data.LineNumber + first, EndLine: msg.Data.LineNumber + last})
+		for i := first; i <= last; i++ {
+			start := starts[i]
+			end := start + len(lines[i].Content)
+			lines[i].Ranges = append(lines[i].Ranges, MatchRange{Start: max(sub.Start, start) - start, End: max(min(sub.End, end), sub.Start) - start})
+		}
+	}
+	for i := range lines {
+		lines[i].Ranges = withColumns(lines[i].Content, lines[i].Ranges)
+	}
+	return lines, spans
+}
+
+// trimContext drops the lines past the after context of the last match,
+// which rg sent as the before context of a match over the per-file cap
+func trimContext(lines []GrepLine, after int) []GrepLine {
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i].IsMatch {
+			return lines[:min(i+1+max(after, 0), len(lines))]
+		}
+	}
+	return lines
+}
+
+// walkLess reports whether relative path a comes before b in a tree walk,
+// which visits the entries of each directory by name
+func walkLess(a, b string) bool {
+	sep := string(filepath.Separator)
+	return strings.ReplaceAll(a, sep, "\x00") < strings.ReplaceAll(b, sep, "\x00")
+}
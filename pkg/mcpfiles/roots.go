@@ -0,0 +1,230 @@
+package mcpfiles
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Root is a directory served under a name. With more than one root, paths
+// in tool arguments and results start with the name of their root.
+type Root struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// rootPathArgs are the tool arguments that hold paths
+var rootPathArgs = []string{"file_path", "path", "source", "destination"}
+
+// rootPathListArgs are the tool arguments that hold comma-separated paths
+var rootPathListArgs = []string{"paths"}
+
+// resultPathKeys are the result fields that hold paths relative to the root
+var resultPathKeys = map[string]bool{"path": true, "file_path": true, "source": true, "destination": true}
+
+// rootNames lists the configured root names in order
+func (s *Server) rootNames() []string {
+	names := make([]string, len(s.config.Roots))
+	for i, root := range s.config.Roots {
+		names[i] = root.Name
+	}
+	return names
+}
+
+// rootTools returns the tools of a multi-root server. Each call is handed to
+// the tools of the root it names, with root prefixes removed from its path
+// arguments and added to the paths in its result.
+func (s *Server) rootTools() []server.ServerTool {
+	handlers := make([]map[string]server.ToolHandlerFunc, len(s.roots))
+	for i, rs := range s.roots {
+		handlers[i] = map[string]server.ToolHandlerFunc{}
+		for _, tool := range rs.toolDefinitions() {
+			handlers[i][tool.Tool.Name] = tool.Handler
+		}
+	}
+
+	names := s.rootNames()
+	tools := s.toolDefinitions()
+	for i := range tools {
+		name := tools[i].Tool.Name
+		mcp.WithString("root", mcp.Enum(names...),
+			mcp.Description(fmt.Sprintf("Root to use: %s (default: the root its paths start with, or %s)", strings.Join(names, ", "), names[0])),
+		)(&tools[i].Tool)
+
+		rootHandlers := make([]server.ToolHandlerFunc, len(s.roots))
+		for j := range s.roots {
+			rootHandlers[j] = handlers[j][name]
+		}
+		tools[i].Handler = s.rootHandler(name, rootHandlers)
+	}
+	return tools
+}
+
+// rootHandler routes a tool call to the root selected by its arguments
+func (s *Server) rootHandler(tool string, handlers []server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		index, args, err := s.selectRoot(request.GetArguments())
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid root: %v", err)), nil
+		}
+		request.Params.Arguments = args
+
+		result, err := handlers[index](ctx, request)
+		if err != nil || result == nil || result.IsError {
+			return result, err
+		}
+		return prefixResult(result, s.config.Roots[index].Name, tool), nil
+	}
+}
+
+// selectRoot picks the root named by the root argument or by the first segment
+// of the path arguments, which must agree, and returns the arguments with the
+// root removed. Calls naming no root use the first.
+func (s *Server) selectRoot(args map[string]any) (int, map[string]any, error) {
+	selected := -1
+	plain := make(map[string]any, len(args))
+	for key, value := range args {
+		plain[key] = value
+	}
+	delete(plain, "root")
+
+	if name, ok := args["root"].(string); ok && name != "" {
+		if selected = s.rootIndex(name); selected < 0 {
+			return 0, nil, fmt.Errorf("unknown root %q (roots: %s)", name, strings.Join(s.rootNames(), ", "))
+		}
+	}
+
+	for _, key := range rootPathArgs {
+		value, ok := args[key].(string)
+		if !ok || value == "" {
+			continue
+		}
+		name, rest, _ := strings.Cut(filepath.ToSlash(value), "/")
+		index := s.rootIndex(name)
+		if index < 0 {
+			return 0, nil, fmt.Errorf("path %q does not start with a root name (roots: %s)", value, strings.Join(s.rootNames(), ", "))
+		}
+		if selected >= 0 && index != selected {
+			return 0, nil, fmt.Errorf("path %q is not in root %q", value, s.config.Roots[selected].Name)
+		}
+		selected = index
+		plain[key] = rest
+	}
+
+	// Every path of a list must be in the same root
+	for _, key := range rootPathListArgs {
+		list, ok := args[key].(string)
+		if !ok || list == "" {
+			continue
+		}
+		var rests []string
+		for _, value := range strings.Split(list, ",") {
+			if value = strings.TrimSpace(value); value == "" {
+				continue
+			}
+			name, rest, _ := strings.Cut(filepath.ToSlash(value), "/")
+			index := s.rootIndex(name)
+			if index < 0 {
+				return 0, nil, fmt.Errorf("path %q does not start with a root name (roots: %s)", value, strings.Join(s.rootNames(), ", "))
+			}
+			if selected >= 0 && index != selected {
+				return 0, nil, fmt.Errorf("path %q is not in root %q", value, s.config.Roots[selected].Name)
+			}
+			selected = index
+			if rest == "" {
+				rest = "."
+			}
+			rests = append(rests, rest)
+		}
+		plain[key] = strings.Join(rests, ",")
+	}
+
+	return max(selected, 0), plain, nil
+}
+
+// rootIndex returns the position of the named root, or -1
+func (s *Server) rootIndex(name string) int {
+	for i, root := range s.config.Roots {
+		if root.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// prefixResult adds the root name to the paths of a JSON result and records
+// the root itself. Results that are not JSON objects pass through unchanged.
+func prefixResult(result *mcp.CallToolResult, rootName, tool string) *mcp.CallToolResult {
+	for i, content := range result.Content {
+		text, ok := content.(mcp.TextContent)
+		if !ok {
+			continue
+		}
+		decoder := json.NewDecoder(strings.NewReader(text.Text))
+		decoder.UseNumber()
+		var value map[string]any
+		if err := decoder.Decode(&value); err != nil {
+			continue
+		}
+
+		prefixPaths(value, rootName, tool)
+		value["root"] = rootName
+
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(value); err != nil {
+			continue
+		}
+		text.Text = strings.TrimSuffix(buf.String(), "\n")
+		result.Content[i] = text
+	}
+	return result
+}
+
+// prefixPaths rewrites path fields anywhere in a decoded result
+func prefixPaths(value any, rootName, tool string) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			switch {
+			case resultPathKeys[key]:
+				if p, ok := field.(string); ok {
+					v[key] = joinRootPath(rootName, p)
+					continue
+				}
+			case key == "files_updated" || key == "uncommitted" || tool == "find_duplicates" && key == "files":
+				if list, ok := field.([]any); ok {
+					for j, item := range list {
+						if p, ok := item.(string); ok {
+							list[j] = joinRootPath(rootName, p)
+						}
+					}
+					continue
+				}
+			case tool == "go_api_surface" && (key == "packages" || key == "diff"):
+				// Package paths are import paths, not file paths
+				continue
+			}
+			prefixPaths(field, rootName, tool)
+		}
+	case []any:
+		for _, item := range v {
+			prefixPaths(item, rootName, tool)
+		}
+	}
+}
+
+// joinRootPath prefixes a path relative to a root with the root's name
+func joinRootPath(rootName, p string) string {
+	if p == "" || p == "." {
+		return rootName
+	}
+	return rootName + "/" + p
+}
@@ -0,0 +1,595 @@
+package mcpfiles
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// searchFile is a file to search, listed in walk order
+type searchFile struct {
+	path    string
+	relPath string
+}
+
+// fileHits are the lines of one file returned by a search
+type fileHits struct {
+	lines     []GrepLine
+	spans     []MatchSpan // the lines of each match, for multiline queries
+	matches   int
+	truncated bool // the file has more matches than the per-file cap
+}
+
+// grepLimits caps the matching lines of a query
+type grepLimits struct {
+	matches int
+	perFile int
+}
+
+// grepLimits returns the caps of a query: its own where given, but never
+// above the server's. Counts have no caps.
+func (s *Server) grepLimits(query GrepQuery) grepLimits {
+	if query.countOnly {
+		return grepLimits{matches: math.MaxInt32, perFile: math.MaxInt32}
+	}
+	limits := grepLimits{matches: s.config.MaxMatches, perFile: s.config.MaxMatchesPerFile}
+	if query.MaxMatches != nil {
+		limits.matches = min(limits.matches, *query.MaxMatches)
+	}
+	if query.MaxMatchesPerFile != nil {
+		limits.perFile = min(limits.perFile, *query.MaxMatchesPerFile)
+	}
+	return limits
+}
+
+// grepTimeout returns the deadline of a query that passed Validate: its own
+// where given, but never above the server's
+func (s *Server) grepTimeout(query GrepQuery) time.Duration {
+	if query.Timeout != nil {
+		timeout, _ := time.ParseDuration(*query.Timeout)
+		return min(timeout, s.config.GrepTimeout)
+	}
+	return s.config.GrepTimeout
+}
+
+// lineMatcher matches a query against single lines. buffer finds candidate
+// lines in a whole file at once and is nil when the pattern anchors to the
+// start or end of text, which only means the same thing per line, or when
+// invert selects the lines that do not match. span is set instead for
+// multiline queries, whose matches may cross lines.
+type lineMatcher struct {
+	line   *regexp.Regexp
+	buffer *regexp.Regexp
+	span   *regexp.Regexp
+	invert bool
+	count  bool // count matches instead of returning their lines
+}
+
+// expression translates a query that passed Validate into RE2 syntax
+func (q GrepQuery) expression() string {
+	var expr string
+	switch q.dialect() {
+	case SyntaxLiteral:
+		expr = regexp.QuoteMeta(q.Pattern)
+	case SyntaxBRE, SyntaxERE:
+		expr, _, _ = translatePOSIX(q.Pattern, q.dialect() == SyntaxERE)
+	default:
+		expr = q.Pattern
+	}
+	if q.WordBoundary != nil && *q.WordBoundary {
+		expr = `\b(?:` + expr + `)\b`
+	}
+	if q.IgnoreCase != nil && *q.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	return expr
+}
+
+// compile builds the matcher for a query that passed Validate
+func (q GrepQuery) compile() (*lineMatcher, error) {
+	expr := q.expression()
+	line, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	m := &lineMatcher{line: line, invert: q.Invert != nil && *q.Invert, count: q.countOnly}
+	switch {
+	case q.multiline():
+		// . also matches newlines, and ^ and $ still match at every line
+		m.span = regexp.MustCompile("(?ms)" + expr)
+	case !m.invert && !strings.Contains(expr, `\A`) && !strings.Contains(expr, `\z`):
+		m.buffer = regexp.MustCompile("(?m)" + expr)
+	}
+	return m, nil
+}
+
+// grepContext is how many lines grep_search shows before and after each
+// match
+type grepContext struct {
+	Before int
+	After  int
+}
+
+// executeGrepQuery runs a single query against the files under the base path,
+// returning matched files in walk order. Queries go to ripgrep when it is
+// available; in auto mode a failed ripgrep run is retried natively.
+func (s *Server) executeGrepQuery(ctx context.Context, query GrepQuery, surrounding grepContext) (*GrepResult, error) {
+	// Fail fast instead of walking a root that is not responding
+	if err := s.guard.Check("grep", s.config.BasePath); err != nil {
+		return nil, err
+	}
+
+	// The deadline applies to the query as a whole, walk included
+	timeout := s.grepTimeout(query)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var result *GrepResult
+	var err error
+	reason := s.nativeReason(query)
+	if reason == "" {
+		reason = "rg is installed"
+		if s.config.SearchBackend == SearchBackendRipgrep {
+			reason = "the search backend is ripgrep"
+		}
+		result, err = s.ripgrepQuery(ctx, query, surrounding)
+		if err != nil && s.config.SearchBackend == SearchBackendAuto && ctx.Err() == nil {
+			log.Printf("ripgrep failed, searching natively: %v", err)
+			reason = fmt.Sprintf("ripgrep failed: %v", err)
+			result, err = nil, nil
+		}
+	}
+	if result == nil && err == nil {
+		result, err = s.nativeQuery(ctx, query, surrounding)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("search timed out after %s", timeout)
+	}
+	// A cancelled search stops early; what it found so far is not the result
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if result != nil {
+		result.Explain.Reason = reason
+	}
+	return result, err
+}
+
+// nativeQuery runs a query with Go's regexp package
+func (s *Server) nativeQuery(ctx context.Context, query GrepQuery, surrounding grepContext) (*GrepResult, error) {
+	matcher, err := query.compile()
+	if err != nil {
+		return nil, err
+	}
+	scope, err := query.scope(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	tally := newSearchTally()
+	phases := map[string]float64{}
+	start := time.Now()
+	files, err := s.searchFiles(ctx, query, scope, tally)
+	if err != nil {
+		return nil, err
+	}
+	phases["walk"] = phaseMs(start)
+	start = time.Now()
+	hits, err := s.searchAll(ctx, matcher, files, surrounding, s.grepLimits(query), tally)
+	if err != nil {
+		return nil, err
+	}
+	phases["search"] = phaseMs(start)
+
+	start = time.Now()
+	relPaths := make([]string, len(files))
+	for i, file := range files {
+		relPaths[i] = file.relPath
+		if hits[i] == nil {
+			tally.skip(skipNotSearched)
+		}
+	}
+	result := s.collectHits(query, SearchBackendNative, relPaths, hits)
+	phases["collect"] = phaseMs(start)
+	result.Explain = tally.explain(SearchBackendNative)
+	result.Explain.PhasesMs = phases
+	return result, nil
+}
+
+// collectHits keeps whole files of hits in order until the match or output
+// cap is reached. A nil entry means searching stopped at a cap before it.
+func (s *Server) collectHits(query GrepQuery, backend string, relPaths []string, hits []*fileHits) *GrepResult {
+	result := &GrepResult{Query: query.Pattern, Matches: []GrepMatchResult{}, Backend: backend}
+	if query.countOnly {
+		total := 0
+		for i, h := range hits {
+			if h != nil && h.matches > 0 {
+				result.Matches = append(result.Matches, GrepMatchResult{FilePath: relPaths[i], Count: h.matches})
+				total += h.matches
+			}
+		}
+		result.Total = &total
+		return result
+	}
+	limits := s.grepLimits(query)
+	total := 0
+	var output int64
+	for i, h := range hits {
+		if h == nil {
+			result.Truncated = true
+			break
+		}
+		// A multiline match counts once, on the line it starts on
+		spanStarts := make(map[int]int, len(h.spans))
+		for _, span := range h.spans {
+			spanStarts[span.StartLine]++
+		}
+		var lines []GrepLine
+		for _, line := range h.lines {
+			size := outputSize(relPaths[i], line)
+			n := 0
+			if line.IsMatch {
+				n = 1
+				if h.spans != nil {
+					n = spanStarts[line.LineNumber]
+				}
+			}
+			if n > 0 && total+n > limits.matches || output+size > s.config.MaxGrepOutput {
+				result.Truncated = true
+				break
+			}
+			total += n
+			output += size
+			lines = append(lines, line)
+		}
+		if len(lines) > 0 {
+			match := GrepMatchResult{FilePath: relPaths[i], Lines: lines}
+			for _, span := range h.spans {
+				if span.StartLine <= lines[len(lines)-1].LineNumber {
+					match.Spans = append(match.Spans, span)
+				}
+			}
+			result.Matches = append(result.Matches, match)
+		}
+		if h.truncated {
+			result.Truncated = true
+		}
+		if result.Truncated {
+			break
+		}
+	}
+	return result
+}
+
+// searchFiles lists the regular files a query searches, as grep -r would:
+// symlinks are not followed and unreadable directories are skipped
+func (s *Server) searchFiles(ctx context.Context, query GrepQuery, scope searchScope, tally *searchTally) ([]searchFile, error) {
+	var files []searchFile
+	err := s.guard.WalkDir(ctx, s.config.BasePath, func(path string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			tally.skip(skipUnreadable)
+			if d != nil && d.IsDir() && path != s.config.BasePath {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if path != s.config.BasePath && s.hidden.ShouldIgnore(path) {
+			tally.skip(skipIgnored)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if path != s.config.BasePath && query.excludes(s.config.BasePath, path) {
+			tally.skip(skipExcluded)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			tally.skip(skipNotRegular)
+			return nil
+		}
+		if !query.matchesName(d.Name()) {
+			tally.skip(skipFilePattern)
+			return nil
+		}
+		if s.config.extensionHandling(path).Binary {
+			tally.skip(skipBinary)
+			return nil
+		}
+		info, err := d.Info()
+		switch {
+		case err != nil:
+			tally.skip(skipUnreadable)
+			return nil
+		case info.Size() > s.config.maxFileSize(path):
+			tally.skip(skipTooLarge)
+			return nil
+		case !scope.includes(info):
+			tally.skip(skipScope)
+			return nil
+		}
+
+		relPath, err := filepath.Rel(s.config.BasePath, path)
+		if err != nil {
+			relPath = path
+		}
+		if query.view != nil && !query.view.match(s.fileEntry(relPath, info)) {
+			tally.skip(skipView)
+			return nil
+		}
+		files = append(files, searchFile{path: path, relPath: relPath})
+		return nil
+	})
+	return files, err
+}
+
+// searchAll searches files with up to WalkConcurrency workers. Workers take
+// files in order and stop taking more once the hits so far pass the match or
+// output cap, so the searched files always form a prefix of files.
+func (s *Server) searchAll(ctx context.Context, matcher *lineMatcher, files []searchFile, surrounding grepContext, limits grepLimits, tally *searchTally) ([]*fileHits, error) {
+	hits := make([]*fileHits, len(files))
+	var next, matches, output atomic.Int64
+	var stop atomic.Bool
+	var mu sync.Mutex
+	var firstErr error
+
+	var wg sync.WaitGroup
+	for range min(s.config.WalkConcurrency, len(files)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() && ctx.Err() == nil {
+				i := int(next.Add(1) - 1)
+				if i >= len(files) {
+					return
+				}
+				h, err := s.searchFile(files[i].path, matcher, surrounding, limits.perFile, tally)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					stop.Store(true)
+					return
+				}
+				hits[i] = h
+
+				var size int64
+				for _, line := range h.lines {
+					size += outputSize(files[i].relPath, line)
+				}
+				if !matcher.count && (matches.Add(int64(h.matches)) > int64(limits.matches) || output.Add(size) > s.config.MaxGrepOutput) {
+					stop.Store(true)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return hits, firstErr
+}
+
+// searchFile matches one file. Unreadable and binary files have no hits.
+func (s *Server) searchFile(path string, matcher *lineMatcher, surrounding grepContext, limit int, tally *searchTally) (*fileHits, error) {
+	content, err := s.guard.ReadFile(path)
+	if err != nil {
+		tally.skip(skipUnreadable)
+		return &fileHits{}, ignoreUnlessUnavailable(err)
+	}
+	if bytes.IndexByte(content, 0) >= 0 {
+		tally.skip(skipBinary)
+		return &fileHits{}, nil
+	}
+	tally.scan()
+	return matcher.search(content, limit, surrounding), nil
+}
+
+// search finds up to limit matching lines in content and returns them with
+// the surrounding lines asked for, merging context that overlaps
+func (m *lineMatcher) search(content []byte, limit int, surrounding grepContext) *fileHits {
+	starts := lineStarts(content)
+	if m.count {
+		return &fileHits{matches: m.countMatches(content, starts)}
+	}
+	if m.span != nil {
+		return m.searchSpans(content, starts, limit, surrounding)
+	}
+	// One match past the limit tells whether the file had more
+	matched := m.matchingLines(content, starts, limit+1)
+	truncated := len(matched) > limit
+	if truncated {
+		matched = matched[:limit]
+	}
+	hits := &fileHits{matches: len(matched), truncated: truncated}
+	hits.lines = contextLines(content, starts, matched, surrounding, func(i int) []MatchRange {
+		var ranges []MatchRange
+		for _, loc := range m.line.FindAllIndex(lineAt(content, starts, i), -1) {
+			ranges = append(ranges, MatchRange{Start: loc[0], End: loc[1]})
+		}
+		return ranges
+	})
+	return hits
+}
+
+// countMatches counts the matches in content: each match on a line, each
+// line that does not match when inverted, and each match of a multiline query
+// once, however many lines it crosses
+func (m *lineMatcher) countMatches(content []byte, starts []int) int {
+	if m.span != nil {
+		if len(starts) == 0 {
+			return 0
+		}
+		return len(m.span.FindAllIndex(content, -1))
+	}
+	n := 0
+	for _, i := range m.matchingLines(content, starts, len(starts)) {
+		if m.invert {
+			n++
+		} else {
+			n += len(m.line.FindAllIndex(lineAt(content, starts, i), -1))
+		}
+	}
+	return n
+}
+
+// searchSpans finds up to limit matches of a multiline query in content and
+// returns the lines each one crosses, with the surrounding lines asked for
+func (m *lineMatcher) searchSpans(content []byte, starts []int, limit int, surrounding grepContext) *fileHits {
+	if len(starts) == 0 {
+		return &fileHits{}
+	}
+	// One match past the limit tells whether the file had more
+	locs := m.span.FindAllIndex(content, limit+1)
+	truncated := len(locs) > limit
+	if truncated {
+		locs = locs[:limit]
+	}
+	hits := &fileHits{matches: len(locs), truncated: truncated}
+
+	ranges := map[int][]MatchRange{}
+	var matched []int
+	for _, loc := range locs {
+		first, last := lineIndex(starts, loc[0]), lineIndex(starts, max(loc[1]-1, loc[0]))
+		hits.spans = append(hits.spans, MatchSpan{StartLine: first + 1, EndLine: last + 1})
+		for i := first; i <= last; i++ {
+			start := starts[i]
+			end := start + len(lineAt(content, starts, i))
+			if _, ok := ranges[i]; !ok {
+				matched = append(matched, i)
+			}
+			ranges[i] = append(ranges[i], MatchRange{Start: max(loc[0], start) - start, End: max(min(loc[1], end), loc[0]) - start})
+		}
+	}
+	hits.lines = contextLines(content, starts, matched, surrounding, func(i int) []MatchRange { return ranges[i] })
+	return hits
+}
+
+// contextLines returns the matched lines, in order, with the surrounding
+// lines asked for, merging context that overlaps. ranges gives where a
+// matched line matched.
+func contextLines(content []byte, starts, matched []int, surrounding grepContext, ranges func(i int) []MatchRange) []GrepLine {
+	isMatch := make(map[int]bool, len(matched))
+	for _, i := range matched {
+		isMatch[i] = true
+	}
+	var lines []GrepLine
+	before, after := max(surrounding.Before, 0), max(surrounding.After, 0)
+	last := -1
+	for _, i := range matched {
+		for j := max(i-before, last+1); j <= min(i+after, len(starts)-1); j++ {
+			line := GrepLine{LineNumber: j + 1, Content: string(lineAt(content, starts, j)), IsMatch: isMatch[j]}
+			if line.IsMatch {
+				line.Ranges = withColumns(line.Content, ranges(j))
+			}
+			lines = append(lines, line)
+			last = j
+		}
+	}
+	return lines
+}
+
+// withColumns fills in the columns and lengths of the match ranges of a line
+func withColumns(content string, ranges []MatchRange) []MatchRange {
+	for i, r := range ranges {
+		start, end := min(r.Start, len(content)), min(r.End, len(content))
+		ranges[i].Column = utf8.RuneCountInString(content[:start]) + 1
+		ranges[i].Length = utf8.RuneCountInString(content[start:max(start, end)])
+	}
+	return ranges
+}
+
+// matchingLines returns the indexes of up to limit lines that match
+func (m *lineMatcher) matchingLines(content []byte, starts []int, limit int) []int {
+	var lines []int
+	if m.buffer == nil {
+		for i := range starts {
+			if len(lines) == limit {
+				break
+			}
+			if m.line.Match(lineAt(content, starts, i)) != m.invert {
+				lines = append(lines, i)
+			}
+		}
+		return lines
+	}
+
+	// Jump between candidate matches instead of running the regexp on every
+	// line. The leftmost match from pos never starts past a line that really
+	// matches, so resuming after the candidate's line misses nothing.
+	for pos := 0; pos < len(content) && len(lines) < limit; {
+		loc := m.buffer.FindIndex(content[pos:])
+		if loc == nil {
+			break
+		}
+		i := lineIndex(starts, pos+loc[0])
+		// A candidate may span lines, so confirm it within its own line
+		if m.line.Match(lineAt(content, starts, i)) {
+			lines = append(lines, i)
+		}
+		if i+1 >= len(starts) {
+			break
+		}
+		pos = starts[i+1]
+	}
+	return lines
+}
+
+// lineStarts returns the offset of each line in content. A final newline
+// ends the last line rather than starting an empty one.
+func lineStarts(content []byte) []int {
+	if len(content) == 0 {
+		return nil
+	}
+	starts := []int{0}
+	for i, c := range content {
+		if c == '\n' && i+1 < len(content) {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+// lineAt returns line i of content without its newline
+func lineAt(content []byte, starts []int, i int) []byte {
+	end := len(content)
+	if i+1 < len(starts) {
+		end = starts[i+1]
+	}
+	return bytes.TrimSuffix(content[starts[i]:end], []byte("\n"))
+}
+
+// lineIndex returns the line containing offset
+func lineIndex(starts []int, offset int) int {
+	i := sort.SearchInts(starts, offset)
+	if i == len(starts) || starts[i] != offset {
+		i--
+	}
+	return i
+}
+
+// outputSize is what a returned line counts against MaxGrepOutput
+func outputSize(relPath string, line GrepLine) int64 {
+	return int64(len(relPath) + len(line.Content) + 16)
+}
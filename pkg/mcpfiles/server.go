@@ -0,0 +1,1828 @@
+// Package mcpfiles implements an MCP server exposing read access to a
+// filesystem tree. Programs can run it standalone with Start or add its
+// tools to their own MCP server:
+//
+//	config := &mcpfiles.Config{BasePath: "/srv/repo"}
+//	if err := mcpfiles.ValidateConfig(config); err != nil {
+//		log.Fatal(err)
+//	}
+//	files := mcpfiles.NewServer(config)
+//	myServer.AddTools(files.Tools()...)
+package mcpfiles
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Name and version the server reports to clients
+const (
+	serverName    = "filesystem-mcp-server"
+	serverVersion = "1.0.0"
+)
+
+// Supported transports
+const (
+	TransportHTTP  = "http"
+	TransportSSE   = "sse"
+	TransportStdio = "stdio"
+)
+
+// Backends grep_search can run queries with
+const (
+	SearchBackendAuto    = "auto" // ripgrep when installed, otherwise native
+	SearchBackendNative  = "native"
+	SearchBackendRipgrep = "ripgrep"
+)
+
+// Backends watch_path can follow changes with
+const (
+	WatchBackendAuto     = "auto" // fsnotify, except on network and FUSE filesystems and non-OS backends, which are polled
+	WatchBackendFSNotify = "fsnotify"
+	WatchBackendPoll     = "poll"
+)
+
+// Modes a server can run in
+const (
+	ModeReadWrite = "rw"
+	ModeReadOnly  = "ro" // write tools are not registered at all
+)
+
+// Config holds server configuration
+type Config struct {
+	Transport         string        `json:"transport"`
+	AlsoServe         string        `json:"also_serve"` // http or sse, served alongside stdio
+	Port              string        `json:"port"`
+	BasePath          string        `json:"base_path"`
+	Roots             []Root        `json:"roots,omitempty"` // named base paths; the first is BasePath
+	MaxFileSize       int64         `json:"max_file_size"`
+	MaxWriteSize      int64         `json:"max_write_size"`
+	AllowDelete       bool          `json:"allow_delete"`
+	Mode              string        `json:"mode"`
+	FSTimeout         time.Duration `json:"fs_timeout"`
+	GrepTimeout       time.Duration `json:"grep_timeout"`
+	MaxGrepOutput     int64         `json:"max_grep_output"`
+	MaxMatches        int           `json:"max_matches"`
+	MaxMatchesPerFile int           `json:"max_matches_per_file"`
+	SearchBackend     string        `json:"search_backend"`
+	Prefetch          string        `json:"prefetch"` // comma-separated heuristics: outline, imports, siblings
+	Profile           string        `json:"profile"`  // default or low-memory
+	WalkConcurrency   int           `json:"walk_concurrency"`
+	MaxTreeDepth      int           `json:"max_tree_depth"`
+	MaxTreeNodes      int           `json:"max_tree_nodes"`
+	MaxWatchDirs      int           `json:"max_watch_dirs"` // directories all watches follow at once
+	WatchBackend      string        `json:"watch_backend"`
+	WatchPollInterval time.Duration `json:"watch_poll_interval"` // how often polled directories are read
+	RecordPath        string        `json:"record_path"`
+	AuditLogPath      string        `json:"audit_log"`
+	StateKeyFile      string        `json:"state_key_file"` // hex key that encrypts recordings and audit logs
+	StateKey          []byte        `json:"-"`
+	HashAlgorithm     string        `json:"hash_algorithm"` // for checksums; SHA-256 by default
+	AllowWeakHashes   bool          `json:"allow_weak_hashes"`
+	SessionReports    bool          `json:"session_reports"`
+	ApproveWrites     bool          `json:"approve_writes"` // hold write tool calls until approved at /approvals
+	ApprovalToken     string        `json:"-"`              // bearer token /approvals and /grants require, if set
+	AccessGrants      bool          `json:"access_grants"`  // let reviewers grant sessions refused paths for a while at /grants
+	RateLimit         float64       `json:"rate_limit"`
+	RedactSecrets     bool          `json:"redact_secrets"`
+	FaultConfigPath   string        `json:"fault_config"`
+	Faults            []FaultRule   `json:"faults,omitempty"`
+	// Tags map file tags to name patterns, applied over the built-in rules
+	TagConfigPath string              `json:"tag_config"`
+	Tags          map[string][]string `json:"tags,omitempty"`
+	// Extensions override how files are handled by extension, such as .log
+	ExtensionConfigPath string                       `json:"extension_config"`
+	Extensions          map[string]ExtensionHandling `json:"extensions,omitempty"`
+	// Views name filter expressions that tools can select to narrow what they see
+	ViewConfigPath string            `json:"view_config"`
+	Views          map[string]string `json:"views,omitempty"`
+	// Locale is the language of error messages and result notes, which
+	// Messages translate over the built-in catalogs, keyed by the English text
+	Locale           string            `json:"locale"`
+	LocaleConfigPath string            `json:"locale_config"`
+	Messages         map[string]string `json:"messages,omitempty"`
+	// WritePolicy limits what write tools may change, whatever the agent asks
+	WritePolicyPath string       `json:"write_policy"`
+	WritePolicy     *WritePolicy `json:"policy,omitempty"`
+	// Ignore hides paths matching these gitignore patterns from every tool,
+	// on top of any .mcpignore files
+	Ignore []string `json:"ignore,omitempty"`
+	// AllowPaths and DenyPaths are globs such as src/** or **/*.env, relative
+	// to each root; with allow globs only matching paths are served, and
+	// paths matching a deny glob never are
+	AllowPaths []string `json:"allow_paths,omitempty"`
+	DenyPaths  []string `json:"deny_paths,omitempty"`
+	// Variables are custom ${NAME} variables for base_path, roots, ignore,
+	// allow_paths and deny_paths, next to the built-in ${HOME} and
+	// ${WORKSPACE} and the environment
+	Variables map[string]string `json:"variables,omitempty"`
+	// SessionIdleTimeout ends sessions that make no tool calls for this long,
+	// dropping what the server keeps for them; 0 keeps them until they close
+	SessionIdleTimeout time.Duration `json:"session_idle_timeout"`
+	// TLSCertFile and TLSKeyFile are PEM files to serve HTTPS with, when set
+	TLSCertFile string `json:"tls_cert"`
+	TLSKeyFile  string `json:"tls_key"`
+	// AuthToken is the bearer token HTTP requests must carry, if set; it can
+	// be read from AuthTokenFile instead
+	AuthTokenFile string `json:"auth_token_file"`
+	AuthToken     string `json:"-"`
+	// APIKeys are further bearer tokens, each limited to what its agent may
+	// do; they can be read from APIKeyConfigPath instead
+	APIKeyConfigPath string   `json:"api_key_config"`
+	APIKeys          []APIKey `json:"api_keys,omitempty"`
+	// SummarizeEndpoint is the base URL of an OpenAI-compatible API that
+	// summarize_file asks SummarizeModel for summaries; the tool is only
+	// registered when it is set. The API key can be read from a file.
+	SummarizeEndpoint   string `json:"summarize_endpoint"`
+	SummarizeModel      string `json:"summarize_model"`
+	SummarizeAPIKeyFile string `json:"summarize_api_key_file"`
+	SummarizeAPIKey     string `json:"-"`
+	// Toolchain is what ValidateConfig found of the external tools in PATH
+	Toolchain []ExternalTool `json:"-"`
+}
+
+// GrepQuery represents a single grep search query
+type GrepQuery struct {
+	Pattern     string  `json:"pattern"`
+	FilePattern *string `json:"file_pattern,omitempty"`
+	IgnoreCase  *bool   `json:"ignore_case,omitempty"`
+	Syntax      *string `json:"syntax,omitempty"`
+
+	// WordBoundary only matches whole words, like grep -w, Invert selects
+	// the lines that do not match, like grep -v, and Multiline matches the
+	// whole file at once, so that matches can cross lines
+	WordBoundary *bool `json:"word_boundary,omitempty"`
+	Invert       *bool `json:"invert,omitempty"`
+	Multiline    *bool `json:"multiline,omitempty"`
+	// view limits the files searched to those of the tool's view parameter,
+	// and countOnly counts matches without keeping their lines or stopping
+	// at the caps
+	view      fileFilter
+	countOnly bool
+	// Scope filters; times are RFC 3339, YYYY-MM-DD or a duration ago such as "24h"
+	MaxFileSize    *int64  `json:"max_file_size,omitempty"`
+	ModifiedAfter  *string `json:"modified_after,omitempty"`
+	ModifiedBefore *string `json:"modified_before,omitempty"`
+	// Caps on matching lines, at most the server's -max-matches and
+	// -max-matches-per-file
+	MaxMatches        *int `json:"max_matches,omitempty"`
+	MaxMatchesPerFile *int `json:"max_matches_per_file,omitempty"`
+	// Timeout stops the query after this long, such as 5s, and reports it
+	// as timed out; at most the server's -grep-timeout, which is the default
+	Timeout *string `json:"timeout,omitempty"`
+	// FilePatterns, like FilePattern, only searches files whose name matches
+	// one of these globs, such as *.go and *.proto
+	FilePatterns []string `json:"file_patterns,omitempty"`
+	// Exclude skips files whose path matches one of these globs, in the
+	// syntax of find_files, such as *_test.go or vendor/**
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// grepQuerySchema is the JSON schema of a GrepQuery
+var grepQuerySchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"pattern":              map[string]any{"type": "string", "description": "Regular expression to search for"},
+		"file_pattern":         map[string]any{"type": "string", "description": "Only search files whose name matches this glob, such as *.go"},
+		"file_patterns":        map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Only search files whose name matches one of these globs, such as [\"*.go\", \"*.proto\"]; together with file_pattern, a file matching any of them is searched"},
+		"ignore_case":          map[string]any{"type": "boolean", "description": "Match case-insensitively (default: false)"},
+		"word_boundary":        map[string]any{"type": "boolean", "description": "Only match whole words, like grep -w, so id does not match identifier (default: false)"},
+		"invert":               map[string]any{"type": "boolean", "description": "Return the lines that do not match instead, like grep -v (default: false)"},
+		"multiline":            map[string]any{"type": "boolean", "description": "Match the whole file at once so matches can cross lines, with . matching newlines; each match's lines are returned in spans (default: false)"},
+		"syntax":               map[string]any{"type": "string", "enum": []string{"bre", "ere", "re2", "pcre", "literal"}, "description": "Regex dialect (default: bre)"},
+		"max_file_size":        map[string]any{"type": "integer", "description": "Only search files of at most this many bytes"},
+		"modified_after":       map[string]any{"type": "string", "description": "Only search files modified after this time: RFC 3339, YYYY-MM-DD or a duration ago such as 24h"},
+		"modified_before":      map[string]any{"type": "string", "description": "Only search files modified before this time, in the same forms"},
+		"max_matches":          map[string]any{"type": "integer", "description": "Stop after this many matching lines, setting truncated (default and maximum: the server's limit)"},
+		"exclude":              map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Skip files whose path matches one of these globs, where ** stands for any number of directories and a glob without a slash matches the name, such as *_test.go, vendor/** or *.min.js"},
+		"max_matches_per_file": map[string]any{"type": "integer", "description": "Return at most this many matching lines of each file, setting truncated (default and maximum: the server's limit)"},
+		"timeout":              map[string]any{"type": "string", "description": "Give up on this query after this long, such as 5s, reporting it as timed out in its error while the other queries run (default and maximum: the server's limit)"},
+	},
+	"required": []string{"pattern"},
+}
+
+// parseGrepQueries reads the queries argument of grep_search: an array of
+// query objects, or the same array encoded as a JSON string
+func parseGrepQueries(value any) ([]GrepQuery, error) {
+	var data []byte
+	switch v := value.(type) {
+	case string:
+		data = []byte(v)
+	case []any:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("queries must be an array of query objects")
+	}
+
+	var queries []GrepQuery
+	if err := json.Unmarshal(data, &queries); err != nil {
+		return nil, err
+	}
+	return queries, nil
+}
+
+// FileNode represents a file or directory in the tree structure
+type FileNode struct {
+	Name     string      `json:"name"`
+	Type     string      `json:"type"` // "file" or "directory"
+	Size     *int64      `json:"size,omitempty"`
+	Tags     []string    `json:"tags,omitempty"`
+	Children []*FileNode `json:"children,omitempty"`
+	Path     string      `json:"path"`
+
+	modTime time.Time // for filter expressions
+}
+
+// GrepResult represents a grep search result
+type GrepResult struct {
+	Query     string            `json:"query"`
+	Matches   []GrepMatchResult `json:"matches"`
+	Error     *string           `json:"error,omitempty"`
+	Truncated bool              `json:"truncated,omitempty"`     // output hit a match or size cap
+	Backend   string            `json:"backend,omitempty"`       // native or ripgrep
+	Explain   *GrepExplain      `json:"explain,omitempty"`       // with the explain option
+	Total     *int              `json:"total_matches,omitempty"` // with count_only
+}
+
+// GrepMatchResult represents a single file match
+type GrepMatchResult struct {
+	FilePath string       `json:"file_path"`
+	Lines    []GrepLine   `json:"lines,omitempty"`
+	Spans    []MatchSpan  `json:"spans,omitempty"`       // lines of each match, for multiline queries
+	Count    int          `json:"match_count,omitempty"` // with count_only, in place of lines
+	Imports  *ImportBlock `json:"imports,omitempty"`
+}
+
+// GrepLine represents a line in grep results
+type GrepLine struct {
+	LineNumber int          `json:"line_number"`
+	Content    string       `json:"content"`
+	IsMatch    bool         `json:"is_match"`
+	Ranges     []MatchRange `json:"ranges,omitempty"` // where the pattern matched on a match line
+}
+
+// MatchRange is where one match lies within a line: its byte offsets, and
+// the 1-based column it starts at and its length, counted in characters
+type MatchRange struct {
+	Start  int `json:"start"`
+	End    int `json:"end"`
+	Column int `json:"column"`
+	Length int `json:"length"`
+}
+
+// MatchSpan is the first and last line of one match of a multiline query
+type MatchSpan struct {
+	StartLine int `json:"start_line"`
+	EndLine   int `json:"end_line"`
+}
+
+// Server represents our MCP server
+type Server struct {
+	config   *Config
+	server   *server.MCPServer
+	guard    *RootGuard
+	recorder *CallRecorder
+	auditLog *CallRecorder
+	// stateCipher encrypts recordings and audit logs; nil unless StateKey is set
+	stateCipher *StateCipher
+	// sessionReports is nil unless SessionReports is set
+	sessionReports *sessionReports
+	approvals      *approvalQueue // nil unless ApproveWrites is set
+	metrics        *Metrics
+	calls          *callRegistry
+	sessions       *sessionTracker // nil unless SessionIdleTimeout is set
+	access         *accessTracker
+	reservations   *reservationStore
+	watches        *watchStore
+	watchBudget    *watchBudget // shared by every root
+	artifacts      *artifactStore
+	repoMap        *repoMapCache
+	changes        *changeFeed
+	prefetch       *prefetcher   // nil unless prefetching is enabled
+	summaries      *summaryCache // nil unless SummarizeEndpoint is set
+	fsys           FileSystem
+	hidden         PathFilter // .mcpignore files and Ignore patterns, hidden from every tool
+	pathLists      PathFilter // paths refused by AllowPaths and DenyPaths, or nil
+	realBase       string     // base path with its symlinks resolved; empty unless files come from the OS
+	filter         PathFilter
+	ripgrep        string             // path of the rg binary, or empty to search natively
+	roots          []*Server          // one per root when serving several, the first being this server
+	root           string             // name of the root this server serves, when serving several
+	scope          []string           // paths an API key limits this server to; nil for all of them
+	keyScopes      map[string]*Server // servers of the API keys limited to paths, by key name
+	grants         *grantStore        // nil unless AccessGrants is set
+	granted        []*AccessGrant     // grants this server lets through AllowPaths, DenyPaths and its scope
+	backend        FileSystem         // files before faults and hidden paths, to open the root again with
+
+	middlewares []Middleware
+}
+
+// Option customizes a Server created by NewServer
+type Option func(*Server)
+
+// WithFileSystem replaces the backend used to access files
+func WithFileSystem(fsys FileSystem) Option {
+	return func(s *Server) {
+		s.fsys = fsys
+	}
+}
+
+// WithPathFilter hides paths matched by filter from file trees, in addition to .gitignore rules
+func WithPathFilter(filter PathFilter) Option {
+	return func(s *Server) {
+		s.filter = filter
+	}
+}
+
+// NewServer creates a new MCP server instance
+func NewServer(config *Config, opts ...Option) *Server {
+	s := &Server{
+		config:  config,
+		fsys:    OSFileSystem{},
+		metrics: NewMetrics(),
+		calls:   newCallRegistry(),
+		changes: newChangeFeed(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.watchBudget = newWatchBudget(config.MaxWatchDirs, s.metrics)
+	if config.SessionReports {
+		s.sessionReports = newSessionReports()
+	}
+	if config.ApproveWrites {
+		s.approvals = newApprovalQueue()
+	}
+	if config.AccessGrants {
+		s.grants = newGrantStore()
+	}
+	if config.SummarizeEndpoint != "" && !config.lowMemory() {
+		s.summaries = newSummaryCache()
+	}
+	if config.SessionIdleTimeout > 0 {
+		s.sessions = newSessionTracker(config.SessionIdleTimeout, s.metrics)
+		go s.sessions.run()
+	}
+	if len(config.StateKey) > 0 {
+		// ValidateConfig checked the key size, the only way this can fail
+		s.stateCipher, _ = NewStateCipher(config.StateKey)
+	}
+	fsys := s.fsys
+	s.openRoot(fsys)
+
+	// Serve every further root from a server of its own
+	if len(config.Roots) > 1 {
+		s.roots = []*Server{s}
+		s.root = config.Roots[0].Name
+		for _, root := range config.Roots[1:] {
+			rootConfig := *config
+			rootConfig.BasePath = root.Path
+			rs := &Server{config: &rootConfig, fsys: fsys, metrics: s.metrics, filter: s.filter, approvals: s.approvals, changes: s.changes, summaries: s.summaries, watchBudget: s.watchBudget, root: root.Name}
+			rs.openRoot(fsys)
+			s.roots = append(s.roots, rs)
+		}
+	}
+
+	// Sessions that end give up their reservations and watches
+	if s.sessions != nil {
+		s.sessions.onEnd(s.reservations.forget)
+		s.sessions.onEnd(s.watches.forget)
+		for _, rs := range s.roots[min(1, len(s.roots)):] {
+			s.sessions.onEnd(rs.reservations.forget)
+			s.sessions.onEnd(rs.watches.forget)
+		}
+		if s.grants != nil {
+			s.sessions.onEnd(s.grants.forget)
+		}
+	}
+	s.openKeyScopes(fsys)
+
+	// Note the request ID of each tool call, so the client can cancel it
+	hooks := &server.Hooks{}
+	hooks.AddBeforeCallTool(s.calls.note)
+	hooks.AddOnError(s.calls.forget)
+
+	// Create MCP server with proper capabilities
+	s.server = server.NewMCPServer(
+		serverName,
+		serverVersion,
+		server.WithToolCapabilities(true), // Enable tool capabilities
+		server.WithResourceCapabilities(false, false),
+		server.WithRecovery(), // Add error recovery
+		server.WithLogging(),  // Add logging
+		server.WithHooks(hooks),
+	)
+	s.server.AddNotificationHandler(methodCancelled, s.handleCancelled)
+
+	return s
+}
+
+// openRoot sets up access to the server's base path through fsys
+func (s *Server) openRoot(fsys FileSystem) {
+	// Use the fault-injecting backend when faults are configured
+	s.fsys, s.backend = fsys, fsys
+	if len(s.config.Faults) > 0 {
+		s.fsys = NewFaultyFileSystem(fsys, s.config.BasePath, s.config.Faults)
+	}
+	// Symlinks on disk must not lead out of the base path, which may itself
+	// be reached through one
+	s.realBase = ""
+	if _, ok := fsys.(OSFileSystem); ok {
+		s.realBase = s.config.BasePath
+		if realBase, err := filepath.EvalSymlinks(s.config.BasePath); err == nil {
+			s.realBase = realBase
+		}
+	}
+	// Paths are refused by what they are called and by what they lead to
+	resolved := func(filter PathFilter) PathFilter {
+		if s.realBase == "" {
+			return filter
+		}
+		return resolvedFilter{s.config.BasePath, s.realBase, filter}
+	}
+
+	s.hidden = newMCPIgnoreFilter(s.config.BasePath, s.config.Ignore)
+	s.pathLists = newPathListFilter(s.config.BasePath, s.config.AllowPaths, s.config.DenyPaths, fsys)
+	if s.pathLists != nil && s.granted != nil {
+		s.pathLists = grantFilter{s.config.BasePath, s.grants, s.granted, s.pathLists}
+	}
+	if s.pathLists != nil {
+		s.pathLists = resolved(s.pathLists)
+		s.hidden = multiFilter{s.hidden, s.pathLists}
+	}
+	if s.realBase != "" {
+		s.hidden = multiFilter{s.hidden, symlinkFilter{fsys, s.realBase}}
+	}
+	if s.scope != nil {
+		var scope PathFilter = scopeFilter{s.config.BasePath, s.scope}
+		if s.granted != nil {
+			scope = grantFilter{s.config.BasePath, s.grants, s.granted, scope}
+		}
+		s.hidden = multiFilter{s.hidden, resolved(scope)}
+	}
+	s.fsys = NewHiddenFileSystem(s.fsys, s.hidden)
+	s.guard = NewRootGuard(s.config.BasePath, s.fsys, s.config.FSTimeout)
+	s.access = newAccessTracker()
+	s.reservations = newReservationStore()
+	s.watches = newWatchStore()
+	s.artifacts = newArtifactStore()
+	if !s.config.lowMemory() {
+		s.repoMap = newRepoMapCache()
+	}
+	s.prefetch = newPrefetcher(s)
+
+	// ripgrep reads the disk directly, so it is only used when files come
+	// from the OS without injected faults
+	rg := s.config.externalTool("rg")
+	if _, ok := fsys.(OSFileSystem); ok && len(s.config.Faults) == 0 && s.config.SearchBackend != SearchBackendNative && rg.Available {
+		s.ripgrep = rg.Binary
+	}
+}
+
+// MCPServer returns the underlying MCP server
+func (s *Server) MCPServer() *server.MCPServer {
+	return s.server
+}
+
+// RegisterTools registers all available tools with the MCP server
+func (s *Server) RegisterTools() {
+	tools := s.Tools()
+	s.server.AddTools(tools...)
+
+	names := make([]string, len(tools))
+	for i, tool := range tools {
+		names[i] = tool.Tool.Name
+	}
+	log.Printf("Registered %d filesystem tools: %s", len(tools), strings.Join(names, ", "))
+}
+
+// RegisterResources registers the change feed with the MCP server
+func (s *Server) RegisterResources() {
+	s.server.AddResourceTemplates(s.ResourceTemplates()...)
+}
+
+// ResourceTemplates returns the resources of this server, the change feed, so
+// other programs can add them to their own MCP servers
+func (s *Server) ResourceTemplates() []server.ServerResourceTemplate {
+	return []server.ServerResourceTemplate{{
+		Template: mcp.NewResourceTemplate(changeFeedURI, "changes",
+			mcp.WithTemplateDescription("Changes made through the write tools, in order. Pass the cursor of a read as since to get the changes after it."),
+			mcp.WithTemplateMIMEType("application/json"),
+		),
+		Handler: s.handleChangeFeed,
+	}}
+}
+
+// Tools returns the filesystem tools bound to this server, so other programs
+// can add them to their own MCP servers with AddTools. Handlers are wrapped in
+// the middleware chain configured for this server.
+func (s *Server) Tools() []server.ServerTool {
+	tools := s.toolDefinitions()
+	if len(s.roots) > 1 {
+		tools = s.rootTools()
+	}
+	if len(s.keyScopes) > 0 {
+		s.keyScopeTools(tools)
+	}
+	if s.grants != nil {
+		s.grantTools(tools)
+	}
+
+	chain := s.handlerChain()
+	for i := range tools {
+		tools[i].Handler = chain(tools[i].Handler)
+	}
+
+	return tools
+}
+
+// toolDefinitions returns every tool with its bare handler
+func (s *Server) toolDefinitions() []server.ServerTool {
+	var tools []server.ServerTool
+
+	// 1. Register read_file_structure tool
+	fileStructureTool := mcp.NewTool(
+		"read_file_structure",
+		mcp.WithDescription("Read and return the file structure of the configured filesystem path"),
+		mcp.WithNumber("max_depth", mcp.Description("Maximum directory depth to traverse (capped by the server limit)")),
+		mcp.WithString("tags", mcp.Description("Comma-separated file tags; only files with one of them, and the directories holding them, are returned (tags: test, config, generated, documentation, asset, migration, plus any configured)")),
+		mcp.WithString("filter", mcp.Description("Filter expression; only matching files, and the directories holding them, are returned. Terms ext:, name:, path:, tag:, size (<, <=, >, >=, =) and modified (< or >, e.g. 7d or 2024-05-01), combined with AND, OR, NOT and parentheses, e.g. ext:go AND NOT path:vendor AND size<100kb AND modified>7d")),
+		s.viewOption(),
+		mcp.WithNumber("max_entries", mcp.Description(fmt.Sprintf("Return the tree in pages of this many entries, in depth-first order (default with cursor: %d)", defaultPageEntries))),
+		mcp.WithString("cursor", mcp.Description("next_cursor of the previous page, to read the next one")),
+	)
+	tools = append(tools, server.ServerTool{Tool: fileStructureTool, Handler: s.handleReadFileStructure})
+
+	// 2. Register read_file_contents tool
+	fileContentsTool := mcp.NewTool(
+		"read_file_contents",
+		mcp.WithDescription("Read and return the contents of a specific file"),
+		mcp.WithString("file_path", mcp.Required(), mcp.Description("Path to the file relative to the configured base path")),
+		mcp.WithNumber("start_line", mcp.Description("First line to return, 1-based (default: 1)")),
+		mcp.WithNumber("end_line", mcp.Description("Last line to return, inclusive (default: the last line). With a range, files over the size limit can be read in parts")),
+		mcp.WithNumber("head", mcp.Description("Return only the first N lines, e.g. of a log or generated file")),
+		mcp.WithNumber("tail", mcp.Description("Return only the last N lines, e.g. of a log or generated file")),
+		s.viewOption(),
+	)
+	tools = append(tools, server.ServerTool{Tool: fileContentsTool, Handler: s.handleReadFileContents})
+
+	// 3. Register grep_search tool
+	grepTool := mcp.NewTool(
+		"grep_search",
+		mcp.WithDescription("Search for regular expression patterns in files with context lines. Supports up to 20 search queries."),
+		mcp.WithArray("queries", mcp.Required(), mcp.Description("Search queries (max 20); a JSON string of the array is also accepted"), mcp.MaxItems(20), mcp.Items(grepQuerySchema)),
+		mcp.WithNumber("context_lines", mcp.Description("Number of lines before and after each match (default: 5)")),
+		mcp.WithNumber("before_lines", mcp.Description("Number of lines before each match, like grep -B (default: context_lines)")),
+		mcp.WithNumber("after_lines", mcp.Description("Number of lines after each match, like grep -A (default: context_lines)")),
+		mcp.WithString("exclude", mcp.Description("Comma-separated globs of files every query skips, on top of its own exclude, such as *_test.go,vendor/**")),
+		mcp.WithBoolean("include_imports", mcp.Description("Also return the import/include block of each file with matches (default: false)")),
+		mcp.WithBoolean("count_only", mcp.Description("Return only how many matches there are in each file and in total, without their content or context and without the match caps, to gauge how widespread a pattern is (default: false)")),
+		mcp.WithBoolean("explain", mcp.Description("Also report, per query, the backend used and why, how many files were scanned and skipped by reason, and time per phase, to debug a missing match (default: false)")),
+		s.viewOption(),
+	)
+	tools = append(tools, server.ServerTool{Tool: grepTool, Handler: s.handleGrepSearch})
+
+	// 4. Register write_file tool
+	writeFileTool := mcp.NewTool(
+		"write_file",
+		mcp.WithDescription("Create or overwrite a file with the given content. Missing parent directories are created; existing files keep their permissions and text encoding."),
+		mcp.WithString("file_path", mcp.Required(), mcp.Description("Path to the file relative to the base path")),
+		mcp.WithString("content", mcp.Required(), mcp.Description("Full new content of the file")),
+	)
+	tools = append(tools, server.ServerTool{Tool: writeFileTool, Handler: s.handleWriteFile})
+
+	// 5. Register edit_file tool
+	editFileTool := mcp.NewTool(
+		"edit_file",
+		mcp.WithDescription("Apply search/replace edits to a file and return a unified diff. Each old_text must match exactly once unless line or replace_all is given. Edits apply in order; if any fails, the file is left unchanged."),
+		mcp.WithString("file_path", mcp.Required(), mcp.Description("Path to the file relative to the base path")),
+		mcp.WithString("edits", mcp.Required(), mcp.Description(`JSON string containing array of edits: {"old_text": "...", "new_text": "...", "line": 12, "replace_all": false}`)),
+	)
+	tools = append(tools, server.ServerTool{Tool: editFileTool, Handler: s.handleEditFile})
+
+	// 6. Register move_file tool
+	moveFileTool := mcp.NewTool(
+		"move_file",
+		mcp.WithDescription("Move or rename a file or directory within the base path. Existing destinations are only replaced with overwrite set, and only file over file."),
+		mcp.WithString("source", mcp.Required(), mcp.Description("Path to move, relative to the base path")),
+		mcp.WithString("destination", mcp.Required(), mcp.Description("New path, relative to the base path; missing parent directories are created")),
+		mcp.WithBoolean("overwrite", mcp.Description("Replace an existing destination file (default: false)")),
+		mcp.WithBoolean("dry_run", mcp.Description("Only report what the move would affect: references to the source, reservations and git status (default: false)")),
+	)
+	tools = append(tools, server.ServerTool{Tool: moveFileTool, Handler: s.handleMoveFile})
+
+	// 7. Register find_file_usages tool
+	usagesTool := mcp.NewTool(
+		"find_file_usages",
+		mcp.WithDescription("Find references to a file from the rest of the tree: imports of it or its package/module, and its path or name in configs and build files. Use before moving, renaming or deleting a file."),
+		mcp.WithString("file_path", mcp.Required(), mcp.Description("Path to the file relative to the base path")),
+	)
+	tools = append(tools, server.ServerTool{Tool: usagesTool, Handler: s.handleFindFileUsages})
+
+	// 8. Register rename_file tool
+	renameFileTool := mcp.NewTool(
+		"rename_file",
+		mcp.WithDescription("Rename or move a file and rewrite references to it across the tree: Go, JS/TS and Python imports, include paths and paths in configs. Returns the changeset as a preview unless apply is set; references that cannot be rewritten safely are listed as skipped."),
+		mcp.WithString("source", mcp.Required(), mcp.Description("Path to the file relative to the base path")),
+		mcp.WithString("destination", mcp.Required(), mcp.Description("New path relative to the base path; must not exist")),
+		mcp.WithBoolean("apply", mcp.Description("Move the file and write the changes (default: false, preview only)")),
+	)
+	tools = append(tools, server.ServerTool{Tool: renameFileTool, Handler: s.handleRenameFile})
+
+	// 9. Register find_identifier tool
+	identifierTool := mcp.NewTool(
+		"find_identifier",
+		mcp.WithDescription("Find every whole-word occurrence of an identifier across the tree, grouped by confidence that it must change in a rename: high for code, medium for files of unknown syntax, low inside strings and comments. Use before renaming a symbol instead of a regex replace."),
+		mcp.WithString("identifier", mcp.Required(), mcp.Description("Identifier to look for, e.g. parseConfig")),
+		mcp.WithString("new_name", mcp.Description("If set, each occurrence includes a preview of its line after the rename")),
+		mcp.WithString("file_pattern", mcp.Description("Only search files whose name matches this glob, e.g. *.go")),
+	)
+	tools = append(tools, server.ServerTool{Tool: identifierTool, Handler: s.handleFindIdentifier})
+
+	// 10. Register read_docs tool
+	docsTool := mcp.NewTool(
+		"read_docs",
+		mcp.WithDescription("Read the documentation of a source file without its code: Go doc comments, Python docstrings or JSDoc. Returns the file's own doc and each documented declaration with its signature, or only the named symbol."),
+		mcp.WithString("file_path", mcp.Required(), mcp.Description("Path to a .go, .py, .js or .ts file relative to the base path")),
+		mcp.WithString("symbol", mcp.Description("Only return this declaration, e.g. Start or Server.Start; undocumented matches are included")),
+	)
+	tools = append(tools, server.ServerTool{Tool: docsTool, Handler: s.handleReadDocs})
+
+	// 11. Register list_directory tool
+	listDirTool := mcp.NewTool(
+		"list_directory",
+		mcp.WithDescription("List the immediate entries of one directory with their type, size and modification time. Cheaper than read_file_structure for exploring large trees level by level."),
+		mcp.WithString("path", mcp.Description("Directory relative to the base path (default: the base path itself)")),
+	)
+	tools = append(tools, server.ServerTool{Tool: listDirTool, Handler: s.handleListDirectory})
+
+	// 12. Register go_api_surface tool
+	apiTool := mcp.NewTool(
+		"go_api_surface",
+		mcp.WithDescription("List the exported identifiers of each Go package under a directory with their signatures. Pass a previous result as snapshot to get what was added, removed or changed since, e.g. to check a release for breaking changes."),
+		mcp.WithString("path", mcp.Description("Directory relative to the base path (default: the base path itself); packages below it are included")),
+		mcp.WithString("snapshot", mcp.Description("JSON of an earlier go_api_surface result to diff against")),
+	)
+	tools = append(tools, server.ServerTool{Tool: apiTool, Handler: s.handleGoAPISurface})
+
+	// 13. Register get_file_info tool
+	fileInfoTool := mcp.NewTool(
+		"get_file_info",
+		mcp.WithDescription("Get size, modification time, mode, type and a text-vs-binary guess for one path, to check a file before reading it."),
+		mcp.WithString("path", mcp.Required(), mcp.Description("Path relative to the base path")),
+	)
+	tools = append(tools, server.ServerTool{Tool: fileInfoTool, Handler: s.handleGetFileInfo})
+
+	// 14. Register find_files tool
+	findFilesTool := mcp.NewTool(
+		"find_files",
+		mcp.WithDescription("Find files whose paths match glob patterns, such as **/*.go or src/**/test_*.py, without fetching the whole tree. Returns paths with sizes; files hidden by .gitignore are skipped."),
+		mcp.WithString("patterns", mcp.Required(), mcp.Description("Comma-separated glob patterns relative to the base path; ** matches any number of directories, and patterns without a slash match file names at any depth")),
+		mcp.WithNumber("max_results", mcp.Description("Maximum files to return (default: 1000)")),
+		s.viewOption(),
+	)
+	tools = append(tools, server.ServerTool{Tool: findFilesTool, Handler: s.handleFindFiles})
+
+	// 15. Register fuzzy_find tool
+	fuzzyFindTool := mcp.NewTool(
+		"fuzzy_find",
+		mcp.WithDescription("Find files by an approximate name, as in fzf: the query's characters must appear in the path in order, and matches at word boundaries, in runs and in the file name rank first. Use it to resolve a name like userctrl to internal/controllers/user_controller.go."),
+		mcp.WithString("query", mcp.Required(), mcp.Description("Characters to look for in order; case is ignored unless the query has upper case")),
+		mcp.WithNumber("max_results", mcp.Description("Maximum files to return, best first (default: 20)")),
+		s.viewOption(),
+	)
+	tools = append(tools, server.ServerTool{Tool: fuzzyFindTool, Handler: s.handleFuzzyFind})
+
+	// 16. Register access_stats tool
+	accessTool := mcp.NewTool(
+		"access_stats",
+		mcp.WithDescription("Report which files have been read or returned by searches since the server started, most accessed first, and the directories nothing has been accessed in."),
+		mcp.WithNumber("limit", mcp.Description("Number of most accessed files to return (default: 20)")),
+	)
+	tools = append(tools, server.ServerTool{Tool: accessTool, Handler: s.handleAccessStats})
+
+	// 17. Register server_info tool
+	serverInfoTool := mcp.NewTool(
+		"server_info",
+		mcp.WithDescription("Report the server's name and version, the grep_search backend in use, and the external tools found at startup with their versions."),
+	)
+	tools = append(tools, server.ServerTool{Tool: serverInfoTool, Handler: s.handleServerInfo})
+
+	// 18. Register reserve_files, release_files and list_reservations tools
+	reserveTool := mcp.NewTool(
+		"reserve_files",
+		mcp.WithDescription("Announce that this session means to change files, so other agents in the workspace can keep clear of them. Reservations are advisory: nothing is locked, and they expire unless renewed by reserving again. Reports the reservations of other sessions that overlap, which should be settled before changing the same files."),
+		mcp.WithString("paths", mcp.Required(), mcp.Description("Comma-separated files or directories relative to the base path, which need not exist yet; a directory covers everything inside")),
+		mcp.WithNumber("ttl_seconds", mcp.Description(fmt.Sprintf("Seconds until the reservation expires (default: %d, at most %d)", int(defaultReservationTTL.Seconds()), int(maxReservationTTL.Seconds())))),
+		mcp.WithString("owner", mcp.Description("Name other agents see the reservation under, such as the agent's role")),
+		mcp.WithString("note", mcp.Description("What the session means to change")),
+	)
+	tools = append(tools, server.ServerTool{Tool: reserveTool, Handler: s.handleReserveFiles})
+
+	releaseTool := mcp.NewTool(
+		"release_files",
+		mcp.WithDescription("Release reservations of this session once its changes are done."),
+		mcp.WithString("paths", mcp.Description("Comma-separated reserved paths to release (default: every reservation of this session)")),
+	)
+	tools = append(tools, server.ServerTool{Tool: releaseTool, Handler: s.handleReleaseFiles})
+
+	listReservationsTool := mcp.NewTool(
+		"list_reservations",
+		mcp.WithDescription("List the live file reservations of every session, to check before changing files whether another agent is working on them."),
+		mcp.WithString("path", mcp.Description("Only list reservations of this file or directory, or of paths inside or above it")),
+	)
+	tools = append(tools, server.ServerTool{Tool: listReservationsTool, Handler: s.handleListReservations})
+
+	// 19. Register derived artifact tools
+	registerArtifactTool := mcp.NewTool(
+		"register_artifact",
+		mcp.WithDescription("Record that something was derived from a file, such as its outline, chunks or embeddings, with the hash of the content it was derived from. artifact_status then tells when the file changed and the artifact needs deriving again."),
+		mcp.WithString("file_path", mcp.Required(), mcp.Description("Path to the file relative to the base path")),
+		mcp.WithString("kind", mcp.Required(), mcp.Description("What was derived, such as outline, chunks, embeddings or thumbnail; registering a kind again replaces it")),
+		mcp.WithString("content_hash", mcp.Description("Hex digest of the content it was derived from, with the server's hash algorithm (default: the file's current content)")),
+		mcp.WithString("ref", mcp.Description("Where the artifact is kept, such as a vector store collection or ID, returned as is")),
+	)
+	tools = append(tools, server.ServerTool{Tool: registerArtifactTool, Handler: s.handleRegisterArtifact})
+
+	artifactStatusTool := mcp.NewTool(
+		"artifact_status",
+		mcp.WithDescription("Check whether derived artifacts still match their files: fresh, stale (the file changed or the artifact was invalidated, with the reason) or missing (the file is gone)."),
+		mcp.WithString("paths", mcp.Description("Comma-separated files or directories relative to the base path whose artifacts to check (default: all)")),
+		mcp.WithString("kind", mcp.Description("Only check artifacts of this kind")),
+		mcp.WithString("state", mcp.Enum(artifactFresh, artifactStale, artifactMissing), mcp.Description("Only list artifacts in this state; counts still cover all of them")),
+		mcp.WithNumber("max_results", mcp.Description(fmt.Sprintf("Maximum artifacts to list (default: %d)", defaultArtifactResults))),
+	)
+	tools = append(tools, server.ServerTool{Tool: artifactStatusTool, Handler: s.handleArtifactStatus})
+
+	invalidateArtifactsTool := mcp.NewTool(
+		"invalidate_artifacts",
+		mcp.WithDescription("Mark the artifacts of files stale, for changes the server cannot see, or forget them."),
+		mcp.WithString("paths", mcp.Required(), mcp.Description("Comma-separated files or directories relative to the base path; a directory covers everything inside it")),
+		mcp.WithString("kind", mcp.Description("Only invalidate artifacts of this kind")),
+		mcp.WithString("reason", mcp.Description("Why, reported by artifact_status")),
+		mcp.WithBoolean("forget", mcp.Description("Drop the artifacts instead of marking them stale (default: false)")),
+	)
+	tools = append(tools, server.ServerTool{Tool: invalidateArtifactsTool, Handler: s.handleInvalidateArtifacts})
+
+	// 20. Register delete tools, only when deletion is enabled
+	if s.config.AllowDelete {
+		deleteFileTool := mcp.NewTool(
+			"delete_file",
+			mcp.WithDescription("Delete a file under the base path."),
+			mcp.WithString("file_path", mcp.Required(), mcp.Description("Path to the file relative to the base path")),
+			mcp.WithBoolean("dry_run", mcp.Description("Only report what deleting the file would affect: references to it, reservations and git status (default: false)")),
+		)
+		tools = append(tools, server.ServerTool{Tool: deleteFileTool, Handler: s.handleDeleteFile})
+
+		deleteDirTool := mcp.NewTool(
+			"delete_directory",
+			mcp.WithDescription("Delete a directory under the base path. Non-empty directories are only deleted with recursive set."),
+			mcp.WithString("path", mcp.Required(), mcp.Description("Path to the directory relative to the base path")),
+			mcp.WithBoolean("recursive", mcp.Description("Also delete everything inside the directory (default: false)")),
+			mcp.WithBoolean("dry_run", mcp.Description("Only report what deleting the directory would affect: references to it, reservations and git status (default: false)")),
+		)
+		tools = append(tools, server.ServerTool{Tool: deleteDirTool, Handler: s.handleDeleteDirectory})
+	}
+
+	// 21. Register change_status tool, only when writes need approval
+	if s.config.ApproveWrites {
+		changeStatusTool := mcp.NewTool(
+			"change_status",
+			mcp.WithDescription("Check whether changes queued for approval were approved, applied or rejected, with the reviewer's comment. Lists every change of this session unless change_id is given."),
+			mcp.WithString("change_id", mcp.Description("ID returned when the change was queued")),
+		)
+		tools = append(tools, server.ServerTool{Tool: changeStatusTool, Handler: s.handleChangeStatus})
+	}
+
+	// 22. Register summarize_file tool, only when a summarization endpoint is configured
+	if s.config.SummarizeEndpoint != "" {
+		summarizeTool := mcp.NewTool(
+			"summarize_file",
+			mcp.WithDescription("Get a short summary of a text file from a language model instead of reading it whole: its purpose, main types and functions, and anything surprising. Secrets are masked before the content leaves the server, and summaries are cached by content hash."),
+			mcp.WithString("file_path", mcp.Required(), mcp.Description("Path to the file relative to the base path")),
+			mcp.WithString("focus", mcp.Description("What the summary should concentrate on, such as error handling or the public API")),
+		)
+		tools = append(tools, server.ServerTool{Tool: summarizeTool, Handler: s.handleSummarizeFile})
+	}
+
+	// 23. Register repo_map tool
+	repoMapTool := mcp.NewTool(
+		"repo_map",
+		mcp.WithDescription("Get a compact map of the repository for a system prompt: the key source files, each with its one-line description and the signatures of its exported symbols, cut to a token budget. Source files come before tests and generated files, and files with more API and documentation first. Unchanged files are not parsed again."),
+		mcp.WithString("path", mcp.Description("Directory to map, relative to the base path (default: the base path)")),
+		mcp.WithNumber("max_tokens", mcp.Description(fmt.Sprintf("Token budget of the map, estimated at four bytes a token (default: %d, at most %d)", defaultRepoMapTokens, maxRepoMapTokens))),
+	)
+	tools = append(tools, server.ServerTool{Tool: repoMapTool, Handler: s.handleRepoMap})
+
+	// 24. Register check_workspace tool
+	checkWorkspaceTool := mcp.NewTool(
+		"check_workspace",
+		mcp.WithDescription("Check whether the base path looks like a usable workspace before starting work: whether it is empty, under version control and has a project manifest, and whether large data, dependency or build directories are visible. Each check has a status (ok, info, warning or error) and, when not ok, guidance on what to do; ready is false when any check is an error."),
+	)
+	tools = append(tools, server.ServerTool{Tool: checkWorkspaceTool, Handler: s.handleCheckWorkspace})
+
+	// 25. Register search_and_replace tool
+	searchAndReplaceTool := mcp.NewTool(
+		"search_and_replace",
+		mcp.WithDescription("Replace every match of a regular expression in the files matching glob patterns, with $1 or ${name} in the replacement standing for capture groups. Reports the replacements and unified diff of each file changed; with dry_run, only reports what would change. Every file is changed in memory first, and files hidden by .gitignore, binary files and files over the size limit are left alone."),
+		mcp.WithString("pattern", mcp.Required(), mcp.Description("Regular expression in RE2 syntax, such as (\\w+)Handler; it must not match the empty string")),
+		mcp.WithString("replacement", mcp.Required(), mcp.Description("Text each match is replaced with; $1, ${1} or ${name} stand for capture groups and $$ for a dollar sign")),
+		mcp.WithString("files", mcp.Required(), mcp.Description("Comma-separated glob patterns of the files to change, as in find_files, such as **/*.go or src/**/*.ts")),
+		mcp.WithBoolean("ignore_case", mcp.Description("Match case-insensitively (default: false)")),
+		mcp.WithBoolean("literal", mcp.Description("Treat pattern and replacement as plain text, without regular expression syntax or capture groups (default: false)")),
+		mcp.WithBoolean("dry_run", mcp.Description("Only report the replacements and diffs, without writing anything (default: false)")),
+	)
+	tools = append(tools, server.ServerTool{Tool: searchAndReplaceTool, Handler: s.handleSearchAndReplace})
+
+	// 26. Register apply_patch tool
+	applyPatchTool := mcp.NewTool(
+		"apply_patch",
+		mcp.WithDescription("Apply a unified diff, as written by diff -u or git diff, to files under the base path. Each hunk applies where its context and removed lines match exactly, at the line its header gives or the nearest line they do; if any hunk does not apply cleanly, nothing is changed and the status of every hunk is returned. Files are created from /dev/null; deletions and renames are refused, as delete_file and move_file do them."),
+		mcp.WithString("patch", mcp.Required(), mcp.Description("Unified diff of one or more files, with --- and +++ headers and @@ hunks; paths are relative to the base path, with or without git's a/ and b/ prefixes")),
+		mcp.WithBoolean("dry_run", mcp.Description("Only check that every hunk applies and report the diffs, without writing anything (default: false)")),
+	)
+	tools = append(tools, server.ServerTool{Tool: applyPatchTool, Handler: s.handleApplyPatch})
+
+	// 27. Register checksum tool
+	checksumTool := mcp.NewTool(
+		"checksum",
+		mcp.WithDescription("Hash one or more files, so a client can tell whether a file changed since it last read it and reuse what it cached otherwise. Reports each file's hex digest, size and modification time; files that do not exist are reported with exists false."),
+		mcp.WithString("paths", mcp.Required(), mcp.Description("Comma-separated files relative to the base path")),
+		mcp.WithString("algorithm", mcp.Enum(HashSHA256, HashSHA384, HashSHA512, HashSHA1, HashMD5), mcp.Description(fmt.Sprintf("Hash algorithm (default: %s); sha1 and md5 need -allow-weak-hashes", s.config.HashAlgorithm))),
+	)
+	tools = append(tools, server.ServerTool{Tool: checksumTool, Handler: s.handleChecksum})
+
+	// 28. Register find_duplicates tool
+	findDuplicatesTool := mcp.NewTool(
+		"find_duplicates",
+		mcp.WithDescription("Group the files whose content is identical, such as copy-pasted assets or vendored copies, to clean them up or refer to one of them. Files are compared by size, then by hash; files hidden by .gitignore are skipped. Groups that free the most bytes come first."),
+		mcp.WithString("patterns", mcp.Description("Comma-separated glob patterns of the files to compare, as in find_files (default: every file)")),
+		mcp.WithNumber("min_size", mcp.Description("Smallest file to compare, in bytes (default: 1, which leaves out empty files)")),
+		mcp.WithNumber("max_results", mcp.Description(fmt.Sprintf("Maximum groups to return (default: %d)", defaultDuplicateGroups))),
+		s.viewOption(),
+	)
+	tools = append(tools, server.ServerTool{Tool: findDuplicatesTool, Handler: s.handleFindDuplicates})
+
+	// 29. Register disk_usage tool
+	diskUsageTool := mcp.NewTool(
+		"disk_usage",
+		mcp.WithDescription("Report how many bytes and files each directory holds, down to a depth, like du, to find where the bulk of the workspace lives before deciding what to read. Directories are listed largest first; .git and paths hidden by .mcpignore are not counted, and directories .gitignore hides are marked gitignored."),
+		mcp.WithString("path", mcp.Description("Directory relative to the base path (default: the base path)")),
+		mcp.WithNumber("max_depth", mcp.Description(fmt.Sprintf("Deepest directories to list, below path; deeper ones count toward their ancestor (default: %d)", defaultUsageDepth))),
+		mcp.WithNumber("max_results", mcp.Description(fmt.Sprintf("Maximum directories to list (default: %d)", defaultUsageResults))),
+	)
+	tools = append(tools, server.ServerTool{Tool: diskUsageTool, Handler: s.handleDiskUsage})
+
+	// 30. Register recently_modified tool
+	recentlyModifiedTool := mcp.NewTool(
+		"recently_modified",
+		mcp.WithDescription("List the most recently modified files, newest first, to see what changed lately while debugging. Filter by glob patterns and a time window; files hidden by .gitignore are skipped."),
+		mcp.WithString("patterns", mcp.Description("Comma-separated glob patterns of the files to list, as in find_files (default: every file)")),
+		mcp.WithString("modified_after", mcp.Description("Only list files modified after this time: RFC 3339, YYYY-MM-DD or a duration ago such as 24h")),
+		mcp.WithString("modified_before", mcp.Description("Only list files modified before this time, in the same forms")),
+		mcp.WithNumber("max_results", mcp.Description(fmt.Sprintf("Number of files to return (default: %d)", defaultRecentFiles))),
+		s.viewOption(),
+	)
+	tools = append(tools, server.ServerTool{Tool: recentlyModifiedTool, Handler: s.handleRecentlyModified})
+
+	// 31. Register watch_path, get_changes_since and unwatch_path tools
+	watchPathTool := mcp.NewTool(
+		"watch_path",
+		mcp.WithDescription("Start watching a file or directory for changes on disk, including edits made outside the server such as by an editor, a build or git, so an agent can react to them during the session. Returns a watch_id whose events get_changes_since reads; paths hidden by .gitignore and .git itself are not watched."),
+		mcp.WithString("path", mcp.Description("File or directory relative to the base path (default: the base path)")),
+		mcp.WithBoolean("recursive", mcp.Description("Also watch the directories below a directory, including those created later (default: true)")),
+	)
+	tools = append(tools, server.ServerTool{Tool: watchPathTool, Handler: s.handleWatchPath})
+
+	getChangesSinceTool := mcp.NewTool(
+		"get_changes_since",
+		mcp.WithDescription("Read the created, modified and deleted events a watch of this session saw after a cursor, oldest first. Pass the cursor of the previous read to get only newer events; truncated means events were dropped and what the watch covers should be read again."),
+		mcp.WithString("watch_id", mcp.Required(), mcp.Description("ID returned by watch_path")),
+		mcp.WithNumber("cursor", mcp.Description("Sequence number of the last event already read (default: 0, every event kept)")),
+		mcp.WithNumber("limit", mcp.Description(fmt.Sprintf("Maximum events to return (default: %d)", defaultChangeLimit))),
+		mcp.WithNumber("wait_seconds", mcp.Description(fmt.Sprintf("When there is no newer event, wait up to this long for one (default: 0, at most %d)", int(maxWatchWait.Seconds())))),
+	)
+	tools = append(tools, server.ServerTool{Tool: getChangesSinceTool, Handler: s.handleGetChangesSince})
+
+	unwatchPathTool := mcp.NewTool(
+		"unwatch_path",
+		mcp.WithDescription("Stop a watch of this session and drop its events."),
+		mcp.WithString("watch_id", mcp.Required(), mcp.Description("ID returned by watch_path")),
+	)
+	tools = append(tools, server.ServerTool{Tool: unwatchPathTool, Handler: s.handleUnwatchPath})
+
+	// 32. Register tail_follow tool
+	tailFollowTool := mcp.NewTool(
+		"tail_follow",
+		mcp.WithDescription("Follow the lines appended to a file, like tail -f, for a bounded time or number of lines, to monitor a log while a command runs elsewhere. Clients that send a progress token get each batch of lines in a progress notification as it arrives; the result lists them all, with the offset to resume from."),
+		mcp.WithString("file_path", mcp.Required(), mcp.Description("Path to the file relative to the base path")),
+		mcp.WithNumber("duration_seconds", mcp.Description(fmt.Sprintf("How long to follow the file (default: %d, at most %d)", int(defaultTailDuration.Seconds()), int(maxTailDuration.Seconds())))),
+		mcp.WithNumber("max_lines", mcp.Description(fmt.Sprintf("Stop after this many lines (default: %d, at most %d)", defaultTailLines, maxTailLines))),
+		mcp.WithNumber("offset", mcp.Description("Byte offset to start from, such as the offset an earlier call returned (default: the end of the file)")),
+	)
+	tools = append(tools, server.ServerTool{Tool: tailFollowTool, Handler: s.handleTailFollow})
+
+	// 33. Register read_archive_member tool
+	archiveMemberTool := mcp.NewTool(
+		"read_archive_member",
+		mcp.WithDescription("Read one file inside a zip, jar, wheel, tar or tar.gz archive without extracting it, such as dist.zip!/app/config.json, or list the archive's members when no member is given."),
+		mcp.WithString("file_path", mcp.Required(), mcp.Description("Path to the archive relative to the base path, optionally followed by !/ and the member, as in dist.zip!/app/config.json")),
+		mcp.WithString("member", mcp.Description("Path of the file inside the archive (default: list the members)")),
+		mcp.WithNumber("max_results", mcp.Description(fmt.Sprintf("Maximum members to list (default: %d)", defaultArchiveEntries))),
+	)
+	tools = append(tools, server.ServerTool{Tool: archiveMemberTool, Handler: s.handleReadArchiveMember})
+
+	// Read-only servers leave out every tool that could change files
+	if s.config.Mode == ModeReadOnly {
+		readOnly := tools[:0]
+		for _, tool := range tools {
+			if !writeTools[tool.Tool.Name] {
+				readOnly = append(readOnly, tool)
+			}
+		}
+		tools = readOnly
+	}
+
+	return tools
+}
+
+// Start serves the MCP server over the configured transport
+func (s *Server) Start() error {
+	// Claim the port first, so one already in use fails before anything is set up
+	var listener net.Listener
+	if s.config.httpTransport() != "" {
+		var err error
+		listener, err = net.Listen("tcp", s.config.Port)
+		if err != nil {
+			return fmt.Errorf("cannot listen on %s: %w", s.config.Port, err)
+		}
+		defer listener.Close()
+	}
+
+	// Register all tools and the change feed
+	s.RegisterTools()
+	s.RegisterResources()
+
+	// Open the call recording if requested
+	if s.config.RecordPath != "" {
+		recorder, err := NewCallRecorder(s.config.RecordPath)
+		if err != nil {
+			return fmt.Errorf("failed to open recording file: %w", err)
+		}
+		defer recorder.Close()
+		recorder.cipher = s.stateCipher
+		s.recorder = recorder
+		log.Printf("Recording tool calls to %s", s.config.RecordPath)
+	}
+
+	// Open the audit log if requested
+	if s.config.AuditLogPath != "" {
+		auditLog, err := NewCallRecorder(s.config.AuditLogPath)
+		if err != nil {
+			return fmt.Errorf("failed to open audit log: %w", err)
+		}
+		defer auditLog.Close()
+		auditLog.cipher = s.stateCipher
+		s.auditLog = auditLog
+		log.Printf("Writing audit log to %s", s.config.AuditLogPath)
+	}
+
+	if s.config.Transport == TransportStdio {
+		// stdout carries the protocol, so all logging stays on stderr
+		log.Printf("Starting MCP File Server on stdio")
+		s.logRoots()
+		s.logToolchain()
+		if listener != nil {
+			// A second client or a dashboard gets the same tools and state over HTTP
+			go func() {
+				if err := s.startHTTP(listener, s.config.AlsoServe); !errors.Is(err, net.ErrClosed) {
+					log.Printf("Stopped serving %s on %s: %v", s.config.AlsoServe, s.config.Port, err)
+				}
+			}()
+		}
+		return server.ServeStdio(s.server)
+	}
+
+	log.Printf("Starting MCP File Server on %s", s.config.Port)
+	s.logRoots()
+	s.logToolchain()
+	return s.startHTTP(listener, s.config.Transport)
+}
+
+// httpTransport returns the HTTP transport the server serves, http or sse,
+// or "" if it only speaks stdio
+func (c *Config) httpTransport() string {
+	if c.Transport != TransportStdio {
+		return c.Transport
+	}
+	return c.AlsoServe
+}
+
+// logRoots logs the served base paths
+func (s *Server) logRoots() {
+	if len(s.roots) <= 1 {
+		log.Printf("Configured base path: %s", s.config.BasePath)
+		return
+	}
+	for _, root := range s.config.Roots {
+		log.Printf("Configured root %s: %s", root.Name, root.Path)
+	}
+}
+
+// startHTTP serves the MCP endpoint over streamable HTTP or SSE together with
+// the readiness and metrics endpoints
+func (s *Server) startHTTP(listener net.Listener, transport string) error {
+	mux := http.NewServeMux()
+	if transport == TransportSSE {
+		// Legacy HTTP+SSE transport for clients without streamable HTTP.
+		// Message endpoints are sent as relative paths so they work behind proxies.
+		sseServer := server.NewSSEServer(s.server,
+			server.WithUseFullURLForMessageEndpoint(false),
+			server.WithKeepAlive(true),
+		)
+		mux.Handle("/sse", sseServer.SSEHandler())
+		mux.Handle("/message", sseServer.MessageHandler())
+		log.Printf("Server endpoint will be: %s/sse", s.baseURL())
+	} else {
+		// Create streamable HTTP server for modern MCP transport
+		var opts []server.StreamableHTTPOption
+		if s.sessions != nil {
+			opts = append(opts, server.WithSessionIdManager(&sessionIDManager{sessions: s.sessions}))
+		}
+		mux.Handle("/mcp", server.NewStreamableHTTPServer(s.server, opts...))
+		log.Printf("Server endpoint will be: %s/mcp", s.baseURL())
+	}
+	mux.HandleFunc("/readyz", s.handleReadiness)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	if s.sessionReports != nil {
+		mux.HandleFunc("/sessions", s.handleSessionReports)
+		mux.HandleFunc("/sessions/", s.handleSessionReports)
+	}
+	if s.approvals != nil {
+		mux.HandleFunc("/approvals", s.handleApprovals)
+		mux.HandleFunc("/approvals/", s.handleApprovals)
+	}
+	if s.grants != nil {
+		mux.HandleFunc("/grants", s.handleGrants)
+		mux.HandleFunc("/grants/", s.handleGrants)
+	}
+
+	// Start the server
+	handler := s.requireAuth(mux)
+	if s.config.TLSCertFile != "" {
+		return http.ServeTLS(listener, handler, s.config.TLSCertFile, s.config.TLSKeyFile)
+	}
+	return http.Serve(listener, handler)
+}
+
+// baseURL is where clients on this machine reach the HTTP server
+func (s *Server) baseURL() string {
+	host, port, _ := net.SplitHostPort(s.config.Port)
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	scheme := "http"
+	if s.config.TLSCertFile != "" {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
+
+// listenAddress turns a port number or host:port into an address to listen
+// on, such as 3001 into :3001
+func listenAddress(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("no address given")
+	}
+	host, port := "", value
+	if strings.Contains(value, ":") {
+		var err error
+		if host, port, err = net.SplitHostPort(value); err != nil {
+			return "", fmt.Errorf("use a port such as 3001 or host:port such as localhost:3001")
+		}
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("the port must be a number from 1 to 65535")
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// handleReadFileContents handles the read_file_contents tool
+func (s *Server) handleReadFileContents(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	filePath, err := request.RequireString("file_path")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+
+	// Validate and resolve path
+	fullPath, err := s.validateFilePath(filePath)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid file path: %v", err)), nil
+	}
+
+	// Check file size
+	stat, err := s.guard.Stat(fullPath)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("File not found: %v", err)), nil
+	}
+
+	// Optional line range, 1-based and inclusive
+	startLine, endLine := request.GetInt("start_line", 0), request.GetInt("end_line", 0)
+	if err := checkLineRange(startLine, endLine); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid line range: %v", err)), nil
+	}
+	head, tail := request.GetInt("head", 0), request.GetInt("tail", 0)
+	if head < 0 || tail < 0 {
+		return mcp.NewToolResultError("Invalid line range: head and tail must be positive"), nil
+	}
+	if (startLine > 0 || endLine > 0) && (head > 0 || tail > 0) || head > 0 && tail > 0 {
+		return mcp.NewToolResultError("Invalid line range: use only one of start_line/end_line, head and tail"), nil
+	}
+	if head > 0 {
+		startLine, endLine = 1, head
+	}
+	ranged := startLine > 0 || endLine > 0 || tail > 0
+	startLine = max(startLine, 1)
+
+	// Files over the size limit can only be read a line range at a time, and
+	// the low-memory profile reads every range that way
+	maxSize := s.config.maxFileSize(fullPath)
+	streamed := stat.Size() > maxSize || ranged && s.config.lowMemory()
+	if streamed && !ranged {
+		return mcp.NewToolResultError(fmt.Sprintf("File too large (%.2f MB > %.2f MB); read part of it with start_line and end_line",
+			float64(stat.Size())/1024/1024, float64(maxSize)/1024/1024)), nil
+	}
+
+	// Files outside the selected view are not visible
+	view, viewName, err := s.requestView(request)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid view: %v", err)), nil
+	}
+	if view != nil {
+		relPath, err := filepath.Rel(s.config.BasePath, fullPath)
+		if err != nil || !view.match(s.fileEntry(relPath, stat)) {
+			return mcp.NewToolResultError(fmt.Sprintf("File not in view %q: %s", viewName, filePath)), nil
+		}
+	}
+
+	var content []byte
+	var lines lineRange
+	if streamed {
+		// Scan to the range instead of loading the whole file
+		if tail > 0 {
+			lines, err = s.guard.ReadTail(ctx, fullPath, tail, maxSize)
+		} else {
+			lines, err = s.guard.ReadLines(ctx, fullPath, startLine, endLine, maxSize)
+		}
+		// Files within the limit that cannot be streamed are read whole
+		if stat.Size() <= maxSize && (errors.Is(err, errors.ErrUnsupported) || errors.Is(err, errStreamedUTF16)) {
+			streamed, err = false, nil
+		}
+	}
+	if streamed {
+		if err != nil {
+			if result := unavailableResult(err); result != nil {
+				return result, nil
+			}
+			switch {
+			case errors.Is(err, errors.ErrUnsupported):
+				return mcp.NewToolResultError(fmt.Sprintf("File too large (%.2f MB > %.2f MB) and the file system cannot stream it",
+					float64(stat.Size())/1024/1024, float64(maxSize)/1024/1024)), nil
+			case errors.Is(err, errLineRangeTooLarge):
+				return mcp.NewToolResultError(fmt.Sprintf("Line range too large (over %.2f MB); request fewer lines",
+					float64(maxSize)/1024/1024)), nil
+			}
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to read file: %v", err)), nil
+		}
+		content = lines.data
+	} else {
+		// Read file contents, unless they were read ahead and have not changed
+		var ok bool
+		if content, ok = s.prefetch.cachedContent(fullPath, stat); !ok {
+			if content, err = s.guard.ReadFile(fullPath); err != nil {
+				if result := unavailableResult(err); result != nil {
+					return result, nil
+				}
+				return mcp.NewToolResultError(fmt.Sprintf("Failed to read file: %v", err)), nil
+			}
+		}
+		s.prefetch.afterRead(fullPath, stat, content)
+	}
+
+	if relPath, err := filepath.Rel(s.config.BasePath, fullPath); err == nil {
+		s.recordAccess(accessRead, relPath)
+	}
+
+	// Decode legacy encodings to UTF-8 so the content survives JSON encoding
+	text := string(content)
+	encoding := TextEncoding{Name: EncodingUTF8}
+	mimeType := ""
+	if enc, ok := s.config.textEncoding(fullPath, content); ok {
+		decoded, err := decodeText(content, enc)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to decode file: %v", err)), nil
+		}
+		text = decoded
+		encoding = enc
+	} else {
+		// Binary content would be mangled in a JSON string, so send it base64-encoded
+		if ranged {
+			return mcp.NewToolResultError("Binary file: line ranges, head and tail only apply to text files"), nil
+		}
+		text = base64.StdEncoding.EncodeToString(content)
+		encoding = TextEncoding{Name: EncodingBase64}
+		mimeType = detectMIMEType(fullPath, content)
+	}
+
+	// Cut the range from the decoded text, so multi-byte encodings split correctly
+	switch {
+	case tail > 0 && !streamed:
+		lines = tailLines(text, tail)
+		text = string(lines.data)
+	case ranged && !streamed:
+		lines = sliceLines(text, startLine, endLine)
+		text = string(lines.data)
+	}
+	if ranged && tail == 0 && lines.end < startLine {
+		return mcp.NewToolResultError(fmt.Sprintf("start_line %d is past the end of the file (%d lines)", startLine, lines.total)), nil
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"file_path":  filePath,
+		"size_bytes": stat.Size(),
+		"encoding":   encoding.Name,
+		"bom":        encoding.BOM,
+		"content":    text,
+	}
+	if mimeType != "" {
+		result["mime_type"] = mimeType
+	}
+	if ranged {
+		// A tail read from the end of a large file has no line numbers
+		if lines.start > 0 {
+			result["start_line"] = lines.start
+			result["end_line"] = lines.end
+		}
+		if lines.total > 0 {
+			result["total_lines"] = lines.total
+		}
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// handleGrepSearch handles the grep_search tool
+func (s *Server) handleGrepSearch(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+
+	if args["queries"] == nil {
+		return mcp.NewToolResultError(`Missing required parameter: required argument "queries" not found`), nil
+	}
+	queries, err := parseGrepQueries(args["queries"])
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid queries JSON: %v", err)), nil
+	}
+
+	// Validate number of queries
+	if len(queries) == 0 {
+		return mcp.NewToolResultError("At least one search query is required"), nil
+	}
+	if len(queries) > 20 {
+		return mcp.NewToolResultError("Maximum 20 search queries allowed"), nil
+	}
+
+	view, _, err := s.requestView(request)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid view: %v", err)), nil
+	}
+	var exclude []string
+	if list := request.GetString("exclude", ""); strings.TrimSpace(list) != "" {
+		if exclude, err = parseGlobs(list); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid exclude: %v", err)), nil
+		}
+	}
+
+	// Set default context lines
+	contextLines := 5
+	if val, ok := args["context_lines"]; ok && val != nil {
+		if cl, ok := val.(float64); ok {
+			contextLines = int(cl)
+		}
+	}
+	// before_lines and after_lines override either side of context_lines
+	surrounding := grepContext{Before: contextLines, After: contextLines}
+	if val, ok := args["before_lines"].(float64); ok {
+		surrounding.Before = int(val)
+	}
+	if val, ok := args["after_lines"].(float64); ok {
+		surrounding.After = int(val)
+	}
+	// Counts need no context
+	countOnly := request.GetBool("count_only", false)
+	if countOnly {
+		surrounding = grepContext{}
+	}
+
+	// Execute searches
+	explain := request.GetBool("explain", false)
+	results := make([]GrepResult, len(queries))
+	for i, query := range queries {
+		query.Exclude = append(query.Exclude, exclude...)
+		// Reject malformed queries with a precise reason instead of searching
+		if err := query.Validate(i); err != nil {
+			errorMsg := err.Error()
+			results[i] = GrepResult{
+				Query:   query.Pattern,
+				Matches: []GrepMatchResult{},
+				Error:   &errorMsg,
+			}
+			continue
+		}
+
+		query.view, query.countOnly = view, countOnly
+		result, err := s.executeGrepQuery(ctx, query, surrounding)
+		if err != nil {
+			errorMsg := err.Error()
+			results[i] = GrepResult{
+				Query: query.Pattern,
+				Error: &errorMsg,
+			}
+		} else {
+			if !explain {
+				result.Explain = nil
+			}
+			results[i] = *result
+			for _, match := range result.Matches {
+				s.recordAccess(accessSearch, match.FilePath)
+			}
+		}
+	}
+
+	// Attach each matched file's import block, reading every file once
+	if request.GetBool("include_imports", false) {
+		imports := make(map[string]*ImportBlock)
+		for i := range results {
+			for j := range results[i].Matches {
+				match := &results[i].Matches[j]
+				block, ok := imports[match.FilePath]
+				if !ok {
+					block = s.fileImports(match.FilePath)
+					imports[match.FilePath] = block
+				}
+				match.Imports = block
+			}
+		}
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"base_path":     s.config.BasePath,
+		"context_lines": contextLines,
+		"before_lines":  surrounding.Before,
+		"after_lines":   surrounding.After,
+		"results":       results,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// Helper methods
+
+// validateFilePath validates and resolves a file path relative to base path
+func (s *Server) validateFilePath(filePath string) (string, error) {
+	// Clean the path
+	cleanPath := filepath.Clean(filePath)
+
+	// Prevent directory traversal attacks
+	if strings.Contains(cleanPath, "..") {
+		return "", fmt.Errorf("path traversal not allowed")
+	}
+
+	// Build full path
+	fullPath := filepath.Join(s.config.BasePath, cleanPath)
+
+	// Ensure the resolved path is still within base path
+	relPath, err := filepath.Rel(s.config.BasePath, fullPath)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		return "", fmt.Errorf("path outside of allowed directory")
+	}
+
+	// Refuse symlinks that lead out of the base path
+	if err := s.checkSymlinks(fullPath); err != nil {
+		return "", err
+	}
+
+	// Refuse paths the allow and deny lists leave out
+	if s.pathLists != nil && s.pathLists.ShouldIgnore(fullPath) {
+		return "", fmt.Errorf("path not allowed by the configured allow and deny lists")
+	}
+
+	return fullPath, nil
+}
+
+// fileImports reads the import block of a file relative to the base path.
+// Files that cannot be read simply have none.
+func (s *Server) fileImports(filePath string) *ImportBlock {
+	fullPath, err := s.validateFilePath(filePath)
+	if err != nil {
+		return nil
+	}
+	stat, err := s.guard.Stat(fullPath)
+	if err != nil || stat.Size() > s.config.maxFileSize(fullPath) {
+		return nil
+	}
+	content, err := s.guard.ReadFile(fullPath)
+	if err != nil {
+		return nil
+	}
+	return extractImports(s.config.sourceExtension(fullPath), content)
+}
+
+// ValidateConfig validates the server configuration and fills in defaults.
+// It must be called before NewServer.
+func ValidateConfig(config *Config) error {
+	// Validate transport
+	switch config.Transport {
+	case "":
+		config.Transport = TransportHTTP
+	case TransportHTTP, TransportSSE, TransportStdio:
+	default:
+		return fmt.Errorf("unsupported transport %q (use %s, %s or %s)", config.Transport, TransportHTTP, TransportSSE, TransportStdio)
+	}
+	switch config.AlsoServe {
+	case "":
+	case TransportHTTP, TransportSSE:
+		if config.Transport != TransportStdio {
+			return fmt.Errorf("a second transport can only be served alongside %s", TransportStdio)
+		}
+	default:
+		return fmt.Errorf("unsupported transport %q to serve alongside stdio (use %s or %s)", config.AlsoServe, TransportHTTP, TransportSSE)
+	}
+	if config.SessionReports && config.httpTransport() == "" {
+		return fmt.Errorf("session reports are served over HTTP and need the %s or %s transport", TransportHTTP, TransportSSE)
+	}
+	if config.ApproveWrites && config.httpTransport() == "" {
+		return fmt.Errorf("write approvals are served over HTTP and need the %s or %s transport", TransportHTTP, TransportSSE)
+	}
+	if config.AccessGrants && config.httpTransport() == "" {
+		return fmt.Errorf("access grants are served over HTTP and need the %s or %s transport", TransportHTTP, TransportSSE)
+	}
+
+	// Check the certificate now rather than on the first connection
+	if (config.TLSCertFile == "") != (config.TLSKeyFile == "") {
+		return fmt.Errorf("serving HTTPS needs both a TLS certificate and its key")
+	}
+	if config.TLSCertFile != "" {
+		if config.httpTransport() == "" {
+			return fmt.Errorf("TLS secures HTTP and needs the %s or %s transport", TransportHTTP, TransportSSE)
+		}
+		if _, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile); err != nil {
+			return fmt.Errorf("invalid TLS certificate or key: %w", err)
+		}
+	}
+	if config.AuthTokenFile != "" {
+		if config.AuthToken != "" {
+			return fmt.Errorf("give the auth token or a file holding it, not both")
+		}
+		token, err := loadAuthToken(config.AuthTokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to load auth token: %w", err)
+		}
+		config.AuthToken = token
+	}
+	if config.SessionIdleTimeout < 0 {
+		return fmt.Errorf("session idle timeout must not be negative")
+	}
+	if err := validateSummarize(config); err != nil {
+		return err
+	}
+
+	// Accept a bare port as well as host:port
+	if config.httpTransport() != "" {
+		if config.Port == "" {
+			config.Port = ":3001"
+		}
+		addr, err := listenAddress(config.Port)
+		if err != nil {
+			return fmt.Errorf("invalid port %q: %w", config.Port, err)
+		}
+		config.Port = addr
+	}
+
+	// Expand variables before any path is used
+	if err := expandConfigVariables(config); err != nil {
+		return err
+	}
+
+	// A single base path is a root named after its directory
+	if len(config.Roots) == 0 {
+		config.Roots = []Root{{Path: config.BasePath}}
+	}
+	seen := map[string]bool{}
+	for i := range config.Roots {
+		root := &config.Roots[i]
+
+		// Check if base path exists and is readable
+		if _, err := os.Stat(root.Path); os.IsNotExist(err) {
+			return fmt.Errorf("base path does not exist: %s", root.Path)
+		}
+
+		// Convert to absolute path
+		absPath, err := filepath.Abs(root.Path)
+		if err != nil {
+			return fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		root.Path = absPath
+
+		if root.Name == "" {
+			root.Name = filepath.Base(absPath)
+		}
+		if root.Name == "." || root.Name == ".." || strings.ContainsAny(root.Name, `/\`) {
+			return fmt.Errorf("invalid root name %q", root.Name)
+		}
+		if seen[root.Name] {
+			return fmt.Errorf("duplicate root name %q (name roots with name=path)", root.Name)
+		}
+		seen[root.Name] = true
+	}
+	config.BasePath = config.Roots[0].Path
+
+	// Validate max file size
+	if config.MaxFileSize <= 0 {
+		config.MaxFileSize = 10 * 1024 * 1024 // Default: 10MB
+	}
+	if config.MaxWriteSize <= 0 {
+		config.MaxWriteSize = 10 * 1024 * 1024 // Default: 10MB
+	}
+
+	// Validate walk concurrency
+	if config.WalkConcurrency <= 0 {
+		config.WalkConcurrency = 4 * runtime.NumCPU()
+	}
+
+	// Validate tree limits
+	if config.MaxTreeDepth <= 0 {
+		config.MaxTreeDepth = 64
+	}
+	if config.MaxTreeNodes <= 0 {
+		config.MaxTreeNodes = 100000
+	}
+	if config.MaxWatchDirs <= 0 {
+		config.MaxWatchDirs = defaultMaxWatchDirs
+	}
+	switch config.WatchBackend {
+	case "":
+		config.WatchBackend = WatchBackendAuto
+	case WatchBackendAuto, WatchBackendFSNotify, WatchBackendPoll:
+	default:
+		return fmt.Errorf("unsupported watch backend %q (use %s, %s or %s)", config.WatchBackend, WatchBackendAuto, WatchBackendFSNotify, WatchBackendPoll)
+	}
+	if config.WatchPollInterval <= 0 {
+		config.WatchPollInterval = defaultWatchPollInterval
+	}
+
+	// Validate filesystem timeout
+	if config.FSTimeout <= 0 {
+		config.FSTimeout = 10 * time.Second
+	}
+
+	// Validate search command limits
+	if config.GrepTimeout <= 0 {
+		config.GrepTimeout = 30 * time.Second
+	}
+	if config.MaxGrepOutput <= 0 {
+		config.MaxGrepOutput = 16 * 1024 * 1024 // Default: 16MB
+	}
+	if config.MaxMatches <= 0 {
+		config.MaxMatches = 10000
+	}
+	if config.MaxMatchesPerFile <= 0 {
+		config.MaxMatchesPerFile = 1000
+	}
+
+	// Lower the limits of a resource profile
+	if err := applyProfile(config); err != nil {
+		return err
+	}
+
+	// Read-only mode cannot be combined with the options of write tools
+	switch config.Mode {
+	case "":
+		config.Mode = ModeReadWrite
+	case ModeReadWrite:
+	case ModeReadOnly:
+		if config.AllowDelete {
+			return fmt.Errorf("deletion cannot be enabled in %s mode", ModeReadOnly)
+		}
+		if config.ApproveWrites {
+			return fmt.Errorf("write approvals cannot be enabled in %s mode, which has no write tools", ModeReadOnly)
+		}
+	default:
+		return fmt.Errorf("unsupported mode %q (use %s or %s)", config.Mode, ModeReadOnly, ModeReadWrite)
+	}
+
+	// Validate search backend, checking the tools it may run once here
+	// rather than failing at first use
+	config.Toolchain = probeToolchain()
+	switch config.SearchBackend {
+	case "":
+		config.SearchBackend = SearchBackendAuto
+	case SearchBackendAuto, SearchBackendNative:
+	case SearchBackendRipgrep:
+		if rg := config.externalTool("rg"); !rg.Available {
+			return fmt.Errorf("search backend %q needs a working rg in PATH: %s", config.SearchBackend, rg.Error)
+		}
+	default:
+		return fmt.Errorf("unsupported search backend %q (use %s, %s or %s)", config.SearchBackend, SearchBackendAuto, SearchBackendNative, SearchBackendRipgrep)
+	}
+
+	// Validate prefetch heuristics
+	if _, err := parsePrefetch(config.Prefetch); err != nil {
+		return err
+	}
+
+	// Load fault injection rules
+	if config.FaultConfigPath != "" {
+		faults, err := loadFaultRules(config.FaultConfigPath)
+		if err != nil {
+			return fmt.Errorf("failed to load fault config: %w", err)
+		}
+		config.Faults = faults
+	}
+	if err := validateFaultRules(config.Faults); err != nil {
+		return err
+	}
+
+	// Load file tag rules over the defaults
+	if config.TagConfigPath != "" {
+		tags, err := loadTagRules(config.TagConfigPath)
+		if err != nil {
+			return fmt.Errorf("failed to load tag config: %w", err)
+		}
+		config.Tags = tags
+	}
+	tags, err := mergeTagRules(config.Tags)
+	if err != nil {
+		return err
+	}
+	config.Tags = tags
+
+	// Load per-extension handling
+	if config.ExtensionConfigPath != "" {
+		extensions, err := loadExtensionHandling(config.ExtensionConfigPath)
+		if err != nil {
+			return fmt.Errorf("failed to load extension config: %w", err)
+		}
+		config.Extensions = extensions
+	}
+	extensions, err := normalizeExtensionHandling(config.Extensions)
+	if err != nil {
+		return err
+	}
+	config.Extensions = extensions
+
+	// Load named views, which may refer to the tags above
+	if config.ViewConfigPath != "" {
+		views, err := loadViews(config.ViewConfigPath)
+		if err != nil {
+			return fmt.Errorf("failed to load view config: %w", err)
+		}
+		config.Views = views
+	}
+	if err := validateViews(config.Views, config.Tags); err != nil {
+		return err
+	}
+
+	// Load translations over the built-in ones of the locale
+	if config.Locale == "" {
+		config.Locale = LocaleEnglish
+	}
+	config.Locale = normalizeLocale(config.Locale)
+	if config.LocaleConfigPath != "" {
+		messages, err := loadLocaleMessages(config.LocaleConfigPath)
+		if err != nil {
+			return fmt.Errorf("failed to load locale config: %w", err)
+		}
+		config.Messages = messages
+	}
+	messages, err := mergeLocaleMessages(config.Locale, config.Messages)
+	if err != nil {
+		return err
+	}
+	config.Messages = messages
+
+	// SHA-1 and MD5 only when explicitly enabled
+	if config.HashAlgorithm == "" {
+		config.HashAlgorithm = HashSHA256
+	}
+	if err := checkHashAlgorithm(config.HashAlgorithm, config.AllowWeakHashes); err != nil {
+		return err
+	}
+
+	// Load the key that encrypts persisted state
+	if config.StateKeyFile != "" {
+		key, err := LoadStateKey(config.StateKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load state key: %w", err)
+		}
+		config.StateKey = key
+	}
+	if len(config.StateKey) > 0 && len(config.StateKey) != 32 {
+		return fmt.Errorf("state key must be 32 bytes, got %d", len(config.StateKey))
+	}
+
+	// Load the write policy
+	if config.WritePolicyPath != "" {
+		policy, err := loadWritePolicy(config.WritePolicyPath)
+		if err != nil {
+			return fmt.Errorf("failed to load write policy: %w", err)
+		}
+		config.WritePolicy = policy
+	}
+	if config.WritePolicy != nil {
+		if err := config.WritePolicy.validate(); err != nil {
+			return err
+		}
+	}
+
+	// Load the API keys, whose paths may start with the root names above
+	if config.APIKeyConfigPath != "" {
+		keys, err := loadAPIKeys(config.APIKeyConfigPath)
+		if err != nil {
+			return fmt.Errorf("failed to load API keys: %w", err)
+		}
+		config.APIKeys = keys
+	}
+	if err := validateAPIKeys(config.APIKeys, config.Roots, config.AuthToken); err != nil {
+		return err
+	}
+	// Reviewers need a credential of their own, so agents cannot approve
+	// their own changes
+	if config.ApproveWrites && (config.AuthToken != "" || len(config.APIKeys) > 0) && config.ApprovalToken == "" {
+		return fmt.Errorf("with an auth token or API keys, write approvals need an approval token of their own so agents cannot approve their own changes")
+	}
+	if config.AccessGrants && (config.AuthToken != "" || len(config.APIKeys) > 0) && config.ApprovalToken == "" {
+		return fmt.Errorf("with an auth token or API keys, access grants need an approval token of their own so agents cannot grant themselves access")
+	}
+	if config.ApprovalToken != "" {
+		if config.ApprovalToken == config.AuthToken {
+			return fmt.Errorf("the approval token must differ from the auth token")
+		}
+		digest := sha256.Sum256([]byte(config.ApprovalToken))
+		for _, key := range config.APIKeys {
+			if key.digest == digest {
+				return fmt.Errorf("API key %q is the same as the approval token", key.Name)
+			}
+		}
+	}
+
+	// Check the ignore patterns, which are otherwise skipped when invalid
+	for _, pattern := range config.Ignore {
+		if _, ok := parseIgnoreRule(pattern); !ok {
+			return fmt.Errorf("invalid ignore pattern %q", pattern)
+		}
+	}
+	if err := validatePathGlobs("allow", config.AllowPaths); err != nil {
+		return err
+	}
+	if err := validatePathGlobs("deny", config.DenyPaths); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package mcpfiles
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// newTestServer serves a temporary directory holding files, by slash-separated
+// path, with config, which is validated first
+func newTestServer(t *testing.T, config *Config, files map[string]string) *Server {
+	t.Helper()
+	config.BasePath = t.TempDir()
+	for name, content := range files {
+		writeTestFile(t, filepath.Join(config.BasePath, filepath.FromSlash(name)), content)
+	}
+	if err := ValidateConfig(config); err != nil {
+		t.Fatalf("ValidateConfig: %v", err)
+	}
+	return NewServer(config)
+}
+
+// writeTestFile writes a file, creating its directories
+func writeTestFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTestFile returns the content of a file under the server's base path,
+// or "" when it is missing
+func readTestFile(t *testing.T, s *Server, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(s.config.BasePath, filepath.FromSlash(name)))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// callTool calls a tool through the server's middleware chain, as a client
+// would, and returns the text of its result and whether it is an error
+func callTool(t *testing.T, ctx context.Context, s *Server, name string, args map[string]interface{}) (string, bool) {
+	t.Helper()
+	for _, tool := range s.Tools() {
+		if tool.Tool.Name != name {
+			continue
+		}
+		request := mcp.CallToolRequest{}
+		request.Params.Name, request.Params.Arguments = name, args
+		result, err := tool.Handler(ctx, request)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return resultText(result), result.IsError
+	}
+	t.Fatalf("no tool %s", name)
+	return "", false
+}
+
+// testSession is a client session for calls made in tests
+type testSession struct {
+	id string
+}
+
+func (s testSession) Initialize()       {}
+func (s testSession) Initialized() bool { return true }
+func (s testSession) SessionID() string { return s.id }
+func (s testSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return make(chan mcp.JSONRPCNotification, 16)
+}
+
+// sessionContext returns a context whose calls are made by a session
+func sessionContext(s *Server, id string) context.Context {
+	return s.server.WithContext(context.Background(), testSession{id: id})
+}
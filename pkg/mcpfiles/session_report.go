@@ -0,0 +1,299 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// maxReportedCalls bounds the calls kept per session; later calls are still
+// counted but not listed
+const maxReportedCalls = 10000
+
+// writeTools are the tools that change files; every other tool only reads
+var writeTools = map[string]bool{
+	"write_file": true, "edit_file": true, "move_file": true, "rename_file": true,
+	"delete_file": true, "delete_directory": true, "search_and_replace": true, "apply_patch": true,
+}
+
+// IsWriteTool reports whether a tool may change files, and so is left out in
+// ModeReadOnly
+func IsWriteTool(name string) bool {
+	return writeTools[name]
+}
+
+// dryRunTools are the write tools that change nothing when called with
+// dry_run; the others ignore it
+var dryRunTools = map[string]bool{
+	"move_file": true, "delete_file": true, "delete_directory": true, "search_and_replace": true, "apply_patch": true,
+}
+
+// changesFiles reports whether a call changes files. Renames without apply
+// only preview the change, as do dry runs of the tools that offer them.
+func changesFiles(request mcp.CallToolRequest) bool {
+	tool := request.Params.Name
+	switch {
+	case !writeTools[tool]:
+		return false
+	case tool == "rename_file":
+		return request.GetBool("apply", false)
+	case dryRunTools[tool]:
+		return !request.GetBool("dry_run", false)
+	}
+	return true
+}
+
+// SessionSummary counts the calls of one session
+type SessionSummary struct {
+	Session     string         `json:"session"`
+	Started     time.Time      `json:"started"`
+	LastCall    time.Time      `json:"last_call"`
+	Calls       int            `json:"calls"`
+	Errors      int            `json:"errors"`
+	BytesServed int64          `json:"bytes_served"`
+	Tools       map[string]int `json:"tools"`
+}
+
+// SessionReport is everything one session accessed, for compliance review
+type SessionReport struct {
+	SessionSummary
+	FilesRead    []string      `json:"files_read"`
+	FilesWritten []string      `json:"files_written"`
+	FilesMatched []string      `json:"files_matched"` // files returned by searches
+	Queries      []string      `json:"queries"`
+	CallLog      []SessionCall `json:"call_log"`
+	Dropped      int           `json:"dropped_calls,omitempty"` // calls beyond maxReportedCalls
+
+	filesRead, filesWritten, filesMatched, queries map[string]bool
+}
+
+// SessionCall is one tool call of a session report
+type SessionCall struct {
+	Time        time.Time              `json:"time"`
+	Tool        string                 `json:"tool"`
+	Arguments   map[string]interface{} `json:"arguments"`
+	IsError     bool                   `json:"is_error"`
+	BytesServed int64                  `json:"bytes_served"`
+}
+
+// sessionReports collects a report per session while the server runs
+type sessionReports struct {
+	mu       sync.Mutex
+	sessions map[string]*SessionReport
+}
+
+func newSessionReports() *sessionReports {
+	return &sessionReports{sessions: make(map[string]*SessionReport)}
+}
+
+// sessionReportMiddleware adds every tool call to its session's report
+func (s *Server) sessionReportMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		start := time.Now()
+		result, err := next(ctx, request)
+
+		call := SessionCall{
+			Time:      start.UTC(),
+			Tool:      request.Params.Name,
+			Arguments: sanitizeArguments(request.GetArguments()),
+			IsError:   err != nil || (result != nil && result.IsError),
+		}
+		var listed []string
+		if result != nil {
+			for _, content := range result.Content {
+				if text, ok := content.(mcp.TextContent); ok {
+					call.BytesServed += int64(len(text.Text))
+					switch {
+					case call.IsError:
+					case call.Tool == "grep_search":
+						listed = append(listed, matchedFiles(text.Text)...)
+					case call.Tool == "search_and_replace" || call.Tool == "apply_patch":
+						listed = append(listed, replacedFiles(text.Text)...)
+					}
+				}
+			}
+		}
+		s.sessionReports.add(sessionID(ctx), call, listed)
+
+		return result, err
+	}
+}
+
+// add records a call in its session's report. listed are the files its
+// result lists: those grep_search matched or search_and_replace and
+// apply_patch changed.
+func (r *sessionReports) add(session string, call SessionCall, listed []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report, ok := r.sessions[session]
+	if !ok {
+		report = &SessionReport{
+			SessionSummary: SessionSummary{Session: session, Started: call.Time, Tools: map[string]int{}},
+			filesRead:      map[string]bool{},
+			filesWritten:   map[string]bool{},
+			filesMatched:   map[string]bool{},
+			queries:        map[string]bool{},
+		}
+		r.sessions[session] = report
+	}
+	report.LastCall = call.Time
+	report.Calls++
+	report.Tools[call.Tool]++
+	report.BytesServed += call.BytesServed
+	if call.IsError {
+		report.Errors++
+	}
+	if len(report.CallLog) < maxReportedCalls {
+		report.CallLog = append(report.CallLog, call)
+	} else {
+		report.Dropped++
+	}
+	if call.IsError {
+		return
+	}
+
+	// Renames without apply and dry runs only preview the change
+	request := mcp.CallToolRequest{}
+	request.Params.Name, request.Params.Arguments = call.Tool, call.Arguments
+	written := changesFiles(request)
+	files := report.filesRead
+	if written {
+		files = report.filesWritten
+	}
+	for _, key := range rootPathArgs {
+		if p, ok := call.Arguments[key].(string); ok && p != "" {
+			files[p] = true
+		}
+	}
+	for _, p := range listed {
+		if written {
+			report.filesWritten[p] = true
+		} else {
+			report.filesMatched[p] = true
+		}
+	}
+	if parsed, err := parseGrepQueries(call.Arguments["queries"]); err == nil {
+		for _, query := range parsed {
+			report.queries[query.Pattern] = true
+		}
+	}
+	if identifier, ok := call.Arguments["identifier"].(string); ok {
+		report.queries[identifier] = true
+	}
+}
+
+// replacedFiles lists the files a search_and_replace or apply_patch result
+// changed; a dry run changed none
+func replacedFiles(text string) []string {
+	var result struct {
+		Files  []ReplacedFile `json:"files"`
+		DryRun bool           `json:"dry_run"`
+	}
+	if json.Unmarshal([]byte(text), &result) != nil || result.DryRun {
+		return nil
+	}
+	files := make([]string, len(result.Files))
+	for i, file := range result.Files {
+		files[i] = file.FilePath
+	}
+	return files
+}
+
+// matchedFiles lists the files in a grep_search result
+func matchedFiles(text string) []string {
+	var result struct {
+		Results []GrepResult `json:"results"`
+	}
+	if json.Unmarshal([]byte(text), &result) != nil {
+		return nil
+	}
+	var files []string
+	for _, r := range result.Results {
+		for _, match := range r.Matches {
+			files = append(files, match.FilePath)
+		}
+	}
+	return files
+}
+
+// report returns a copy of a session's report with its sets as sorted lists
+func (r *sessionReports) report(session string) (SessionReport, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report, ok := r.sessions[session]
+	if !ok {
+		return SessionReport{}, false
+	}
+	out := *report
+	out.Tools = copyCounts(report.Tools)
+	out.CallLog = append([]SessionCall(nil), report.CallLog...)
+	out.FilesRead = sortedKeys(report.filesRead)
+	out.FilesWritten = sortedKeys(report.filesWritten)
+	out.FilesMatched = sortedKeys(report.filesMatched)
+	out.Queries = sortedKeys(report.queries)
+	return out, true
+}
+
+// summaries lists the summary of every session, oldest first
+func (r *sessionReports) summaries() []SessionSummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	summaries := make([]SessionSummary, 0, len(r.sessions))
+	for _, report := range r.sessions {
+		summary := report.SessionSummary
+		summary.Tools = copyCounts(report.Tools)
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Started.Before(summaries[j].Started) })
+	return summaries
+}
+
+// copyCounts copies a map of counts
+func copyCounts(counts map[string]int) map[string]int {
+	out := make(map[string]int, len(counts))
+	for key, n := range counts {
+		out[key] = n
+	}
+	return out
+}
+
+// sortedKeys returns the keys of a set in order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// handleSessionReports serves /sessions, listing sessions, and
+// /sessions/<id>, the full report of one
+func (s *Server) handleSessionReports(w http.ResponseWriter, r *http.Request) {
+	var body interface{}
+	if session := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/sessions"), "/"); session == "" {
+		body = map[string]interface{}{"sessions": s.sessionReports.summaries()}
+	} else {
+		report, ok := s.sessionReports.report(session)
+		if !ok {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+		body = report
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(body)
+}
@@ -0,0 +1,26 @@
+package mcpfiles
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSessionReportFilesDryRunsAsRead(t *testing.T) {
+	s := newTestServer(t, &Config{Transport: TransportHTTP, SessionReports: true}, map[string]string{"a.txt": "old\n", "b.txt": "b\n"})
+	ctx := sessionContext(s, "s1")
+
+	callTool(t, ctx, s, "move_file", map[string]interface{}{"source": "b.txt", "destination": "c.txt", "dry_run": true})
+	callTool(t, ctx, s, "apply_patch", map[string]interface{}{"patch": "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-old\n+new\n", "dry_run": true})
+	callTool(t, ctx, s, "write_file", map[string]interface{}{"file_path": "d.txt", "content": "d\n", "dry_run": true})
+
+	report, ok := s.sessionReports.report("s1")
+	if !ok {
+		t.Fatal("no report for the session")
+	}
+	if want := []string{"d.txt"}; !reflect.DeepEqual(report.FilesWritten, want) {
+		t.Errorf("files_written = %v, want %v", report.FilesWritten, want)
+	}
+	if want := []string{"b.txt", "c.txt"}; !reflect.DeepEqual(report.FilesRead, want) {
+		t.Errorf("files_read = %v, want %v", report.FilesRead, want)
+	}
+}
@@ -0,0 +1,148 @@
+package mcpfiles
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// maxEndedSessions bounds the ended session IDs remembered to refuse them;
+// the oldest are forgotten first
+const maxEndedSessions = 10000
+
+// sessionTracker notes when each session last called a tool and drops what
+// the server keeps for sessions idle longer than the timeout, so abandoned
+// sessions do not hold on to it while the server runs
+type sessionTracker struct {
+	timeout time.Duration
+	metrics *Metrics
+
+	mu       sync.Mutex
+	lastCall map[string]time.Time
+	ended    map[string]bool // streamable HTTP session IDs refused from now on
+	order    []string        // ended IDs, oldest first
+	cleanups []func(session string)
+}
+
+func newSessionTracker(timeout time.Duration, metrics *Metrics) *sessionTracker {
+	return &sessionTracker{
+		timeout:  timeout,
+		metrics:  metrics,
+		lastCall: make(map[string]time.Time),
+		ended:    make(map[string]bool),
+	}
+}
+
+// onEnd registers a function that drops what is kept for a session once it
+// expires or its client ends it
+func (t *sessionTracker) onEnd(cleanup func(session string)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cleanups = append(t.cleanups, cleanup)
+}
+
+// touch records a call of a session. Calls of a session that has ended, over
+// transports that keep it going, start it anew.
+func (t *sessionTracker) touch(session string) {
+	if session == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.ended, session)
+	t.lastCall[session] = time.Now()
+	t.metrics.Set("mcp_sessions_active", float64(len(t.lastCall)))
+}
+
+// run expires idle sessions until the process exits, checking a few times
+// per timeout
+func (t *sessionTracker) run() {
+	interval := max(t.timeout/4, time.Second)
+	for now := range time.Tick(interval) {
+		t.expire(now)
+	}
+}
+
+// expire ends the sessions whose last call was a timeout before now
+func (t *sessionTracker) expire(now time.Time) {
+	t.mu.Lock()
+	var idle []string
+	for session, last := range t.lastCall {
+		if now.Sub(last) >= t.timeout {
+			idle = append(idle, session)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, session := range idle {
+		if t.end(session) {
+			t.metrics.Add("mcp_sessions_expired_total", 1)
+			log.Printf("Session %s expired after %s idle", session, t.timeout)
+		}
+	}
+}
+
+// end forgets a session and runs the cleanups for it, reporting false if it
+// had already ended. Streamable HTTP clients that come back with its ID are
+// told the session is gone, so they start a new one.
+func (t *sessionTracker) end(session string) bool {
+	t.mu.Lock()
+	if t.ended[session] {
+		t.mu.Unlock()
+		return false
+	}
+	delete(t.lastCall, session)
+	t.metrics.Set("mcp_sessions_active", float64(len(t.lastCall)))
+	t.ended[session] = true
+	t.order = append(t.order, session)
+	for len(t.order) > maxEndedSessions {
+		delete(t.ended, t.order[0])
+		t.order = t.order[1:]
+	}
+	cleanups := t.cleanups
+	t.mu.Unlock()
+
+	for _, cleanup := range cleanups {
+		cleanup(session)
+	}
+	return true
+}
+
+// hasEnded reports whether a session expired or was ended by its client
+func (t *sessionTracker) hasEnded(session string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ended[session]
+}
+
+// activityMiddleware records every tool call as activity of its session
+func (s *Server) activityMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		s.sessions.touch(sessionID(ctx))
+		return next(ctx, request)
+	}
+}
+
+// sessionIDManager issues streamable HTTP session IDs like mcp-go's default
+// manager, but refuses the IDs of sessions that have ended
+type sessionIDManager struct {
+	server.InsecureStatefulSessionIdManager
+	sessions *sessionTracker
+}
+
+func (m *sessionIDManager) Validate(sessionID string) (bool, error) {
+	if _, err := m.InsecureStatefulSessionIdManager.Validate(sessionID); err != nil {
+		return false, err
+	}
+	return m.sessions.hasEnded(sessionID), nil
+}
+
+// Terminate ends a session its client deleted
+func (m *sessionIDManager) Terminate(sessionID string) (bool, error) {
+	m.sessions.end(sessionID)
+	return false, nil
+}
@@ -0,0 +1,94 @@
+package mcpfiles
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// sealedPrefix starts every record line encrypted with a state key
+const sealedPrefix = "sealed:"
+
+// errSealedRecord is returned when reading an encrypted record without a key
+var errSealedRecord = errors.New("record is encrypted; a state key is needed to read it")
+
+// LoadStateKey reads a 256-bit key, hex-encoded, from a file such as one
+// written by `openssl rand -hex 32`
+func LoadStateKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("state key must be hex-encoded: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("state key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// StateCipher encrypts the records the server persists, such as recordings
+// and audit logs, with AES-256-GCM, so they add no cleartext copies of
+// source code to disk. Each line is sealed on its own, so files stay
+// appendable and line-oriented.
+type StateCipher struct {
+	aead cipher.AEAD
+}
+
+// NewStateCipher returns a cipher for a 32-byte key
+func NewStateCipher(key []byte) (*StateCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &StateCipher{aead: aead}, nil
+}
+
+// Seal encrypts one record line
+func (c *StateCipher) Seal(line []byte) []byte {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(fmt.Sprintf("failed to read random nonce: %v", err))
+	}
+	sealed := c.aead.Seal(nonce, nonce, line, nil)
+	return []byte(sealedPrefix + base64.StdEncoding.EncodeToString(sealed))
+}
+
+// Open decrypts a record line written by Seal. Lines that were not sealed
+// are returned unchanged, so files started before encryption stay readable;
+// a nil cipher can only read those.
+func (c *StateCipher) Open(line []byte) ([]byte, error) {
+	encoded, ok := bytes.CutPrefix(line, []byte(sealedPrefix))
+	if !ok {
+		return line, nil
+	}
+	if c == nil {
+		return nil, errSealedRecord
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid sealed record: %w", err)
+	}
+	size := c.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, fmt.Errorf("invalid sealed record: too short")
+	}
+	plain, err := c.aead.Open(nil, sealed[:size], sealed[size:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt record (wrong state key?): %w", err)
+	}
+	return plain, nil
+}
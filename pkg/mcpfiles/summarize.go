@@ -0,0 +1,259 @@
+package mcpfiles
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Limits of summarize_file
+const (
+	maxSummaryInput   = 100 * 1024 // characters of a file sent to the endpoint
+	maxSummaryEntries = 1000       // summaries cached
+	maxSummaryReply   = 1 << 20    // bytes read from an endpoint response
+	summarizeTimeout  = 2 * time.Minute
+)
+
+// summarizePrompt is the system prompt summaries are asked for with
+const summarizePrompt = "You summarize source files for a developer who has not read them. " +
+	"Describe the file's purpose, its main types and functions and how they fit together, and anything surprising, in a few short paragraphs. " +
+	"Do not restate the code line by line."
+
+// summaryCache keeps summaries by content hash and focus, evicting the
+// oldest past maxSummaryEntries. A nil cache keeps nothing.
+type summaryCache struct {
+	mu      sync.Mutex
+	entries map[string]string
+	order   []string
+}
+
+func newSummaryCache() *summaryCache {
+	return &summaryCache{entries: map[string]string{}}
+}
+
+func (c *summaryCache) get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	summary, ok := c.entries[key]
+	return summary, ok
+}
+
+func (c *summaryCache) put(key, summary string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = summary
+	for len(c.order) > maxSummaryEntries {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// validateSummarize checks the summarization endpoint settings
+func validateSummarize(config *Config) error {
+	if config.SummarizeAPIKeyFile != "" {
+		if config.SummarizeAPIKey != "" {
+			return fmt.Errorf("give the summarization API key or a file holding it, not both")
+		}
+		key, err := loadAuthToken(config.SummarizeAPIKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load summarization API key: %w", err)
+		}
+		config.SummarizeAPIKey = key
+	}
+	if config.SummarizeEndpoint == "" {
+		return nil
+	}
+	endpoint, err := url.Parse(config.SummarizeEndpoint)
+	if err != nil || endpoint.Host == "" || endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return fmt.Errorf("invalid summarization endpoint %q: give an http or https URL such as https://api.openai.com/v1", config.SummarizeEndpoint)
+	}
+	if config.SummarizeModel == "" {
+		return fmt.Errorf("the summarization endpoint needs a model to ask")
+	}
+	return nil
+}
+
+// chatCompletionsURL returns the chat completions URL of an OpenAI-compatible
+// API, given its base URL or the completions URL itself
+func chatCompletionsURL(endpoint string) string {
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	if strings.HasSuffix(endpoint, "/chat/completions") {
+		return endpoint
+	}
+	return endpoint + "/chat/completions"
+}
+
+// handleSummarizeFile handles the summarize_file tool
+func (s *Server) handleSummarizeFile(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	filePath, err := request.RequireString("file_path")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	focus := strings.TrimSpace(request.GetString("focus", ""))
+
+	// Validate and resolve path
+	fullPath, err := s.validateFilePath(filePath)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid file path: %v", err)), nil
+	}
+
+	// Check file size
+	stat, err := s.guard.Stat(fullPath)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("File not found: %v", err)), nil
+	}
+	if stat.IsDir() {
+		return mcp.NewToolResultError("Cannot summarize file: path is a directory"), nil
+	}
+	if maxSize := s.config.maxFileSize(fullPath); stat.Size() > maxSize {
+		return mcp.NewToolResultError(fmt.Sprintf("File too large (%.2f MB > %.2f MB)",
+			float64(stat.Size())/1024/1024, float64(maxSize)/1024/1024)), nil
+	}
+
+	content, err := s.guard.ReadFile(fullPath)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read file: %v", err)), nil
+	}
+	encoding, ok := s.config.textEncoding(fullPath, content)
+	if !ok {
+		return mcp.NewToolResultError("Cannot summarize file: content is not text"), nil
+	}
+	text, err := decodeText(content, encoding)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to decode file: %v", err)), nil
+	}
+	if relPath, err := filepath.Rel(s.config.BasePath, fullPath); err == nil {
+		s.recordAccess(accessRead, relPath)
+	}
+
+	// The same content asked about the same way gets the same summary
+	h := hashAlgorithms[s.config.HashAlgorithm]()
+	h.Write(content)
+	contentHash := hex.EncodeToString(h.Sum(nil))
+	key := contentHash + "\x00" + focus
+	summary, cached := s.summaries.get(key)
+	truncated := len([]rune(text)) > maxSummaryInput
+	if !cached {
+		summary, err = s.requestSummary(ctx, filePath, text, focus)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to summarize file: %v", err)), nil
+		}
+		s.summaries.put(key, summary)
+	}
+	s.metrics.Add("mcp_summaries_total", 1, "cached", fmt.Sprint(cached))
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"file_path":    filePath,
+		"content_hash": contentHash,
+		"model":        s.config.SummarizeModel,
+		"summary":      summary,
+		"cached":       cached,
+		"truncated":    truncated,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// requestSummary asks the endpoint to summarize text, with secrets masked
+// and cut to maxSummaryInput characters
+func (s *Server) requestSummary(ctx context.Context, filePath, text, focus string) (string, error) {
+	for _, pattern := range secretPatterns {
+		text = pattern.ReplaceAllString(text, "[REDACTED]")
+	}
+	if runes := []rune(text); len(runes) > maxSummaryInput {
+		text = string(runes[:maxSummaryInput]) + "\n[truncated]"
+	}
+	prompt := "File: " + filePath + "\n"
+	if focus != "" {
+		prompt += "Focus on: " + focus + "\n"
+	}
+	prompt += "\n" + text
+
+	type message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"model": s.config.SummarizeModel,
+		"messages": []message{
+			{Role: "system", Content: summarizePrompt},
+			{Role: "user", Content: prompt},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, summarizeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, chatCompletionsURL(s.config.SummarizeEndpoint), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.config.SummarizeAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.config.SummarizeAPIKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSummaryReply))
+	if err != nil {
+		return "", err
+	}
+
+	var reply struct {
+		Choices []struct {
+			Message message `json:"message"`
+		} `json:"choices"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	decodeErr := json.Unmarshal(data, &reply)
+	switch {
+	case reply.Error != nil && reply.Error.Message != "":
+		return "", fmt.Errorf("endpoint returned %s: %s", resp.Status, reply.Error.Message)
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("endpoint returned %s", resp.Status)
+	case decodeErr != nil:
+		return "", fmt.Errorf("invalid endpoint response: %w", decodeErr)
+	case len(reply.Choices) == 0 || strings.TrimSpace(reply.Choices[0].Message.Content) == "":
+		return "", fmt.Errorf("endpoint returned no summary")
+	}
+	return strings.TrimSpace(reply.Choices[0].Message.Content), nil
+}
@@ -0,0 +1,93 @@
+package mcpfiles
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// errSymlinkEscape is returned for paths whose symlinks lead outside the
+// base path
+var errSymlinkEscape = errors.New("path escapes the base path through a symlink")
+
+// resolvePath resolves the symlinks of a path on disk, of which the last
+// elements need not exist yet, as for a file about to be written
+func resolvePath(p string) (string, error) {
+	rest := ""
+	for {
+		realPath, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(realPath, rest), nil
+		}
+		parent := filepath.Dir(p)
+		if !errors.Is(err, fs.ErrNotExist) || parent == p {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(p), rest)
+		p = parent
+	}
+}
+
+// withinPath reports whether a path is base or inside it
+func withinPath(base, p string) bool {
+	relPath, err := filepath.Rel(base, p)
+	return err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator))
+}
+
+// checkSymlinks verifies that a path under the base path stays there once
+// its symlinks are resolved. Only paths on disk are checked.
+func (s *Server) checkSymlinks(fullPath string) error {
+	if s.realBase == "" {
+		return nil
+	}
+	realPath, err := resolvePath(fullPath)
+	if err != nil {
+		return fmt.Errorf("cannot resolve symlinks: %w", err)
+	}
+	if !withinPath(s.realBase, realPath) {
+		return errSymlinkEscape
+	}
+	return nil
+}
+
+// symlinkFilter hides symlinks that lead outside the base path, so walks
+// neither list nor descend into what they point to. Paths given to tools
+// are checked in full by validateFilePath; walks only meet a path's last
+// element for the first time.
+type symlinkFilter struct {
+	fsys     FileSystem
+	realBase string
+}
+
+func (f symlinkFilter) ShouldIgnore(fullPath string) bool {
+	info, err := f.fsys.Lstat(fullPath)
+	if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+		return false
+	}
+	target, err := filepath.EvalSymlinks(fullPath)
+	return err == nil && !withinPath(f.realBase, target)
+}
+
+// resolvedFilter applies a filter to paths both as given and with their
+// symlinks resolved, so a link such as notes.txt -> .env cannot reach what
+// the filter refuses under its own name
+type resolvedFilter struct {
+	basePath string
+	realBase string
+	filter   PathFilter
+}
+
+func (f resolvedFilter) ShouldIgnore(fullPath string) bool {
+	if f.filter.ShouldIgnore(fullPath) {
+		return true
+	}
+	realPath, err := resolvePath(fullPath)
+	if err != nil || !withinPath(f.realBase, realPath) {
+		return false
+	}
+	relPath, _ := filepath.Rel(f.realBase, realPath)
+	resolved := filepath.Join(f.basePath, relPath)
+	return resolved != fullPath && f.filter.ShouldIgnore(resolved)
+}
@@ -0,0 +1,83 @@
+package mcpfiles
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSymlinksCannotEscapeTheBasePath(t *testing.T) {
+	outside := t.TempDir()
+	writeTestFile(t, filepath.Join(outside, "passwd"), "root\n")
+	s := newTestServer(t, &Config{}, map[string]string{"inside.txt": "ok\n"})
+	for link, target := range map[string]string{
+		"etc":       outside,
+		"passwd":    filepath.Join(outside, "passwd"),
+		"up":        "..",
+		"alias.txt": "inside.txt",
+	} {
+		if err := os.Symlink(target, filepath.Join(s.config.BasePath, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path    string
+		escapes bool
+	}{
+		{"passwd", true},
+		{"etc/passwd", true},
+		{"etc/new.txt", true}, // does not exist yet, as for a write
+		{"up", true},
+		{"alias.txt", false},
+		{"inside.txt", false},
+		{"missing/new.txt", false},
+	}
+	for _, tt := range tests {
+		_, err := s.validateFilePath(tt.path)
+		if escapes := errors.Is(err, errSymlinkEscape); escapes != tt.escapes {
+			t.Errorf("validateFilePath(%s) = %v, want escape %v", tt.path, err, tt.escapes)
+		}
+	}
+
+	ctx := context.Background()
+	text, isError := callTool(t, ctx, s, "write_file", map[string]interface{}{"file_path": "etc/new.txt", "content": "x"})
+	if !isError || !strings.Contains(text, "escapes the base path through a symlink") {
+		t.Errorf("write_file through a link out of the base path = %s", text)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new.txt")); err == nil {
+		t.Error("write_file wrote outside the base path")
+	}
+
+	// Escaping links are left out of trees; links within the base path stay
+	text, _ = callTool(t, ctx, s, "read_file_structure", map[string]interface{}{})
+	for _, name := range []string{`"etc"`, `"passwd"`, `"up"`} {
+		if strings.Contains(text, name) {
+			t.Errorf("read_file_structure lists %s: %s", name, text)
+		}
+	}
+	if !strings.Contains(text, `"alias.txt"`) {
+		t.Errorf("read_file_structure leaves out a link within the base path: %s", text)
+	}
+}
+
+func TestBasePathReachedThroughSymlink(t *testing.T) {
+	real := t.TempDir()
+	writeTestFile(t, filepath.Join(real, "a.txt"), "a\n")
+	link := filepath.Join(t.TempDir(), "project")
+	if err := os.Symlink(real, link); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{BasePath: link}
+	if err := ValidateConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(config)
+
+	if text, isError := callTool(t, context.Background(), s, "read_file_contents", map[string]interface{}{"file_path": "a.txt"}); isError {
+		t.Errorf("read_file_contents under a symlinked base path = %s", text)
+	}
+}
@@ -0,0 +1,126 @@
+package mcpfiles
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// defaultTagRules classify files by name. A pattern without a slash matches
+// the file name, one ending in a slash matches any directory the file is
+// under, and any other pattern matches the path relative to the base path.
+var defaultTagRules = map[string][]string{
+	"test": {
+		"*_test.go", "test_*.py", "*_test.py", "*.test.*", "*.spec.*", "*Test.java", "*Tests.cs",
+		"test/", "tests/", "__tests__/", "spec/", "testdata/",
+	},
+	"config": {
+		"*.yaml", "*.yml", "*.toml", "*.ini", "*.cfg", "*.conf", "*.properties", ".env", ".env.*",
+		".*rc", "*.config.js", "*.config.ts", "*.config.mjs", "tsconfig*.json", "package.json",
+		"go.mod", "Dockerfile", "*.dockerfile", "Makefile",
+	},
+	"generated": {
+		"*.pb.go", "*_gen.go", "*.gen.*", "*_generated.*", "*.generated.*", "*.min.js", "*.min.css",
+		"*.lock", "package-lock.json", "go.sum",
+	},
+	"documentation": {
+		"*.md", "*.markdown", "*.rst", "*.adoc", "LICENSE*", "CHANGELOG*", "docs/", "doc/",
+	},
+	"asset": {
+		"*.png", "*.jpg", "*.jpeg", "*.gif", "*.svg", "*.ico", "*.webp", "*.bmp",
+		"*.woff", "*.woff2", "*.ttf", "*.otf", "*.eot", "*.mp3", "*.mp4", "*.wav", "*.webm",
+		"assets/", "static/",
+	},
+	"migration": {
+		"migrations/", "migrate/", "*.migration.*", "*_migration.*",
+	},
+}
+
+// loadTagRules reads a tag configuration file of the form {"tags": {"tag": [patterns]}}
+func loadTagRules(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Tags map[string][]string `json:"tags"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid tag config: %w", err)
+	}
+
+	return file.Tags, nil
+}
+
+// mergeTagRules applies configured rules over the defaults: a configured tag
+// replaces the default patterns of the same name, and an empty list drops it
+func mergeTagRules(configured map[string][]string) (map[string][]string, error) {
+	rules := make(map[string][]string, len(defaultTagRules)+len(configured))
+	for tag, patterns := range defaultTagRules {
+		rules[tag] = patterns
+	}
+	for tag, patterns := range configured {
+		if len(patterns) == 0 {
+			delete(rules, tag)
+			continue
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(strings.TrimSuffix(pattern, "/"), ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q for tag %q: %w", pattern, tag, err)
+			}
+		}
+		rules[tag] = patterns
+	}
+	return rules, nil
+}
+
+// fileTags returns the sorted tags of a file, given its slash-separated path
+// relative to the base path
+func fileTags(rules map[string][]string, relPath string) []string {
+	var tags []string
+	for tag, patterns := range rules {
+		for _, pattern := range patterns {
+			if matchTagPattern(pattern, relPath) {
+				tags = append(tags, tag)
+				break
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// matchTagPattern matches one tag pattern against a relative file path
+func matchTagPattern(pattern, relPath string) bool {
+	switch {
+	case strings.HasSuffix(pattern, "/"):
+		dirPattern := strings.TrimSuffix(pattern, "/")
+		dirs := strings.Split(relPath, "/")
+		for _, dir := range dirs[:len(dirs)-1] {
+			if ok, _ := path.Match(dirPattern, dir); ok {
+				return true
+			}
+		}
+		return false
+	case strings.Contains(pattern, "/"):
+		ok, _ := path.Match(pattern, relPath)
+		return ok
+	default:
+		ok, _ := path.Match(pattern, path.Base(relPath))
+		return ok
+	}
+}
+
+// hasAnyTag reports whether tags include one of wanted
+func hasAnyTag(tags []string, wanted map[string]bool) bool {
+	for _, tag := range tags {
+		if wanted[tag] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+package mcpfiles
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	// defaultTailDuration is how long tail_follow follows a file unless asked
+	defaultTailDuration = 10 * time.Second
+	// maxTailDuration bounds how long one tail_follow call runs
+	maxTailDuration = 120 * time.Second
+	// defaultTailLines is how many lines tail_follow returns unless asked
+	defaultTailLines = 100
+	// maxTailLines bounds the lines one tail_follow call returns
+	maxTailLines = 10000
+	// tailPollInterval is how often tail_follow looks for appended lines
+	tailPollInterval = 250 * time.Millisecond
+	// tailReadSize bounds one read of appended bytes
+	tailReadSize = 1 << 20
+	// maxTailLineBytes bounds one line; longer ones are cut into pieces
+	maxTailLineBytes = 64 << 10
+)
+
+// fileTail follows the lines appended to a file. next is the offset after
+// the last line taken, and pending the bytes read past it that do not end a
+// line yet.
+type fileTail struct {
+	s        *Server
+	fullPath string
+	next     int64
+	pending  []byte
+	size     int64
+	rotated  bool
+}
+
+// handleTailFollow handles the tail_follow tool
+func (s *Server) handleTailFollow(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	filePath, err := request.RequireString("file_path")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	seconds := request.GetFloat("duration_seconds", defaultTailDuration.Seconds())
+	if seconds <= 0 || seconds > maxTailDuration.Seconds() {
+		return mcp.NewToolResultError(fmt.Sprintf("duration_seconds must be positive and at most %d", int(maxTailDuration.Seconds()))), nil
+	}
+	maxLines := request.GetInt("max_lines", defaultTailLines)
+	if maxLines <= 0 {
+		return mcp.NewToolResultError("max_lines must be positive"), nil
+	}
+	maxLines = min(maxLines, maxTailLines)
+
+	// Validate and resolve path
+	fullPath, err := s.validateFilePath(filePath)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid file path: %v", err)), nil
+	}
+	stat, err := s.guard.Stat(fullPath)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("File not found: %v", err)), nil
+	}
+	if stat.IsDir() {
+		return mcp.NewToolResultError(fmt.Sprintf("Cannot follow file: %s is a directory", filePath)), nil
+	}
+
+	// Start at the end unless resuming where an earlier call stopped
+	tail := &fileTail{s: s, fullPath: fullPath, next: stat.Size(), size: stat.Size()}
+	if _, ok := request.GetArguments()["offset"]; ok {
+		offset := int64(request.GetInt("offset", 0))
+		if offset < 0 || offset > stat.Size() {
+			return mcp.NewToolResultError(fmt.Sprintf("offset %d is outside the file (%d bytes)", offset, stat.Size())), nil
+		}
+		tail.next = offset
+	}
+	if relPath, err := filepath.Rel(s.config.BasePath, fullPath); err == nil {
+		s.recordAccess(accessRead, relPath)
+	}
+
+	// Clients that pass a progress token get each batch of lines as it
+	// arrives, in the message of a progress notification
+	var progressToken mcp.ProgressToken
+	if request.Params.Meta != nil {
+		progressToken = request.Params.Meta.ProgressToken
+	}
+	mcpServer := server.ServerFromContext(ctx)
+
+	lines := []string{}
+	stopped := "duration"
+	deadline := time.NewTimer(time.Duration(seconds * float64(time.Second)))
+	defer deadline.Stop()
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+follow:
+	for {
+		batch, err := tail.poll(ctx, maxLines-len(lines))
+		if errors.Is(err, fs.ErrNotExist) {
+			stopped = "deleted"
+			break
+		}
+		if err != nil {
+			if result := unavailableResult(err); result != nil {
+				return result, nil
+			}
+			if errors.Is(err, errBinaryTail) {
+				return mcp.NewToolResultError("Binary file: tail_follow only follows text files"), nil
+			}
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to read file: %v", err)), nil
+		}
+		lines = append(lines, batch...)
+		if len(batch) > 0 && progressToken != nil && mcpServer != nil {
+			mcpServer.SendNotificationToClient(ctx, "notifications/progress", map[string]any{
+				"progressToken": progressToken,
+				"progress":      len(lines),
+				"total":         maxLines,
+				"message":       strings.Join(batch, "\n"),
+			})
+		}
+		if len(lines) >= maxLines {
+			stopped = "max_lines"
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to read file: %v", ctx.Err())), nil
+		case <-deadline.C:
+			break follow
+		case <-ticker.C:
+		}
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"file_path":  filePath,
+		"lines":      lines,
+		"line_count": len(lines),
+		"offset":     tail.next,
+		"size_bytes": tail.size,
+		"stopped":    stopped,
+		"rotated":    tail.rotated,
+	}
+	// The last line is only taken once it ends; show what there is of it
+	if len(tail.pending) > 0 && bytes.IndexByte(tail.pending, '\n') < 0 {
+		result["partial"] = strings.ToValidUTF8(string(tail.pending), "\uFFFD")
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// errBinaryTail reports appended bytes that are not text
+var errBinaryTail = errors.New("binary content")
+
+// poll reads what was appended since the last poll and returns up to limit
+// complete lines of it. A file that shrank was truncated or replaced, and is
+// followed again from its start.
+func (t *fileTail) poll(ctx context.Context, limit int) ([]string, error) {
+	stat, err := t.s.guard.Stat(t.fullPath)
+	if err != nil {
+		return nil, err
+	}
+	t.size = stat.Size()
+	read := t.next + int64(len(t.pending))
+	if t.size < read {
+		t.next, t.pending, t.rotated = 0, nil, true
+		read = 0
+	}
+
+	var lines []string
+	for len(lines) < limit {
+		for len(lines) < limit {
+			end := bytes.IndexByte(t.pending, '\n')
+			taken := end + 1
+			if end < 0 {
+				if len(t.pending) < maxTailLineBytes {
+					break
+				}
+				end, taken = maxTailLineBytes, maxTailLineBytes
+			}
+			line := strings.TrimSuffix(string(t.pending[:end]), "\r")
+			lines = append(lines, strings.ToValidUTF8(line, "\uFFFD"))
+			t.next += int64(taken)
+			t.pending = t.pending[taken:]
+		}
+		if len(lines) >= limit || read >= t.size {
+			break
+		}
+		data, err := t.s.guard.ReadAt(ctx, t.fullPath, read, min(tailReadSize, t.size-read))
+		if err != nil {
+			return lines, err
+		}
+		if len(data) == 0 {
+			break
+		}
+		if bytes.IndexByte(data, 0) >= 0 {
+			return lines, errBinaryTail
+		}
+		read += int64(len(data))
+		t.pending = append(t.pending, data...)
+	}
+	return lines, nil
+}
@@ -0,0 +1,115 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// toolProbeTimeout bounds the version check of each external tool at startup
+const toolProbeTimeout = 5 * time.Second
+
+// ExternalTool is an external program the server can use, as found at startup
+type ExternalTool struct {
+	Name      string `json:"name"`
+	Binary    string `json:"binary,omitempty"` // resolved from PATH
+	Version   string `json:"version,omitempty"`
+	Available bool   `json:"available"`
+	Error     string `json:"error,omitempty"` // why it cannot be used
+	UsedBy    string `json:"used_by"`
+	Fallback  string `json:"fallback,omitempty"` // used in its place when unavailable
+}
+
+// probeToolchain checks the external tools the server can use. grep_search
+// falls back to its built-in search without ripgrep, and dry runs leave out
+// the git status without git.
+func probeToolchain() []ExternalTool {
+	return []ExternalTool{
+		probeTool(ExternalTool{Name: "rg", UsedBy: "grep_search", Fallback: "built-in search"}, "--version"),
+		probeTool(ExternalTool{Name: "git", UsedBy: "dry_run", Fallback: "impact report without git status"}, "--version"),
+	}
+}
+
+// probeTool finds a tool in PATH and runs it with versionArg, keeping the
+// first line it prints as its version. Tools that are missing or fail to run
+// are marked unavailable, with the reason.
+func probeTool(tool ExternalTool, versionArg string) ExternalTool {
+	binary, err := exec.LookPath(tool.Name)
+	if err != nil {
+		tool.Error = err.Error()
+		return tool
+	}
+	tool.Binary = binary
+
+	out, err := runCommand(context.Background(), commandLimits{Timeout: toolProbeTimeout, MaxOutput: 4096}, binary, versionArg)
+	if err == nil && out.ExitCode != 0 {
+		err = fmt.Errorf("%s %s exited with status %d", tool.Name, versionArg, out.ExitCode)
+	}
+	if err != nil {
+		tool.Error = err.Error()
+		return tool
+	}
+	tool.Version, _, _ = strings.Cut(strings.TrimSpace(string(out.Stdout)), "\n")
+	tool.Available = true
+	return tool
+}
+
+// externalTool returns the probe result of a tool by name
+func (c *Config) externalTool(name string) ExternalTool {
+	for _, tool := range c.Toolchain {
+		if tool.Name == name {
+			return tool
+		}
+	}
+	return ExternalTool{Name: name, Error: "not probed"}
+}
+
+// logToolchain logs what was found of each external tool
+func (s *Server) logToolchain() {
+	for _, tool := range s.config.Toolchain {
+		if tool.Available {
+			log.Printf("Found %s for %s: %s (%s)", tool.Name, tool.UsedBy, tool.Binary, tool.Version)
+			continue
+		}
+		log.Printf("%s unavailable, %s uses the %s: %s", tool.Name, tool.UsedBy, tool.Fallback, tool.Error)
+	}
+}
+
+// handleServerInfo handles the server_info tool
+func (s *Server) handleServerInfo(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	searchBackend := SearchBackendNative
+	if s.ripgrep != "" {
+		searchBackend = SearchBackendRipgrep
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"name":           serverName,
+		"version":        serverVersion,
+		"transport":      s.config.Transport,
+		"mode":           s.config.Mode,
+		"profile":        s.config.Profile,
+		"locale":         s.config.Locale,
+		"search_backend": searchBackend,
+		"toolchain":      s.config.Toolchain,
+	}
+	if s.config.AlsoServe != "" {
+		result["also_serve"] = s.config.AlsoServe
+	}
+	if len(s.config.Roots) > 1 {
+		result["roots"] = s.rootNames()
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
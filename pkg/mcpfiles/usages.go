@@ -0,0 +1,350 @@
+package mcpfiles
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxUsages caps the references returned by find_file_usages
+const maxUsages = 500
+
+// Reference kinds, from most to least specific
+const (
+	UsageImport   = "import"   // import of the file or its package/module
+	UsagePath     = "path"     // the file's path relative to the base path
+	UsageFilename = "filename" // the bare file name in a quoted string or path
+)
+
+// FileUsage is one line that refers to the target file
+type FileUsage struct {
+	FilePath   string `json:"file_path"`
+	LineNumber int    `json:"line_number"`
+	Content    string `json:"content"`
+	Kind       string `json:"kind"`
+}
+
+// usageNeedle is a string whose presence on a line suggests a reference
+type usageNeedle struct {
+	text  string
+	kind  string
+	match func(line string) bool // optional further check
+}
+
+var (
+	pythonImportLine = regexp.MustCompile(`^\s*(from|import)\s`)
+	quotedStrings    = regexp.MustCompile(`["'` + "`" + `]([^"'` + "`" + `\n]+)["'` + "`" + `]`)
+)
+
+// handleFindFileUsages handles the find_file_usages tool
+func (s *Server) handleFindFileUsages(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	filePath, err := request.RequireString("file_path")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+
+	// Validate and resolve path
+	fullPath, err := s.validateFilePath(filePath)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid file path: %v", err)), nil
+	}
+	stat, err := s.guard.Stat(fullPath)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("File not found: %v", err)), nil
+	}
+
+	usages, truncated, err := s.findFileUsages(ctx, fullPath, stat.IsDir())
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to search for usages: %v", err)), nil
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"file_path": filePath,
+		"usages":    usages,
+		"truncated": truncated,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// findFileUsages walks the tree for references to the file or directory at
+// fullPath, returning at most maxUsages and whether more were cut off. Files
+// inside a directory do not count.
+func (s *Server) findFileUsages(ctx context.Context, fullPath string, isDir bool) ([]FileUsage, bool, error) {
+	relTarget, _ := filepath.Rel(s.config.BasePath, fullPath)
+	relTarget = filepath.ToSlash(relTarget)
+
+	needles := s.usageNeedles(relTarget)
+	if isDir {
+		// A directory of Go files is imported as a package
+		if importPath := s.goImportPath(relTarget); importPath != "" {
+			needles = append([]usageNeedle{{text: `"` + importPath + `"`, kind: UsageImport}}, needles...)
+		}
+	}
+
+	usages := []FileUsage{}
+	truncated := false
+	err := s.walkTextFiles(ctx, func(p, relPath string, content []byte) error {
+		if p == fullPath || strings.HasPrefix(p, fullPath+string(filepath.Separator)) {
+			return nil
+		}
+		for _, usage := range scanUsages(content, relPath, relTarget, needles) {
+			if len(usages) == maxUsages {
+				truncated = true
+				return filepath.SkipAll
+			}
+			usages = append(usages, usage)
+		}
+		return nil
+	})
+	return usages, truncated, err
+}
+
+// walkTextFiles calls visit with the contents of each text file under the
+// base path that is not ignored and within -max-file-size. relPath is
+// slash-separated; visit may return filepath.SkipAll to stop early.
+func (s *Server) walkTextFiles(ctx context.Context, visit func(fullPath, relPath string, content []byte) error) error {
+	filter := s.pathFilter()
+	return s.guard.WalkDir(ctx, s.config.BasePath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if p != s.config.BasePath && filter.ShouldIgnore(p) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		stat, err := s.guard.Stat(p)
+		if err != nil || stat.Size() > s.config.maxFileSize(p) {
+			return ignoreUnlessUnavailable(err)
+		}
+		content, err := s.guard.ReadFile(p)
+		if err != nil {
+			return ignoreUnlessUnavailable(err)
+		}
+		if bytes.IndexByte(content, 0) >= 0 {
+			return nil // binary
+		}
+
+		relPath, _ := filepath.Rel(s.config.BasePath, p)
+		return visit(p, filepath.ToSlash(relPath), content)
+	})
+}
+
+// usageNeedles lists the spellings other files may use to refer to target, a
+// slash-separated path relative to the base path
+func (s *Server) usageNeedles(target string) []usageNeedle {
+	base := path.Base(target)
+	ext := path.Ext(target)
+	withoutExt := strings.TrimSuffix(target, ext)
+
+	var needles []usageNeedle
+
+	// Go files are imported through their package's import path
+	if ext == ".go" {
+		if importPath := s.goImportPath(path.Dir(target)); importPath != "" {
+			quoted := `"` + importPath + `"`
+			needles = append(needles, usageNeedle{text: quoted, kind: UsageImport})
+		}
+	}
+
+	// Python modules are imported by dotted name; match the full name and
+	// its suffixes, since the import root is unknown
+	if ext == ".py" {
+		parts := strings.Split(withoutExt, "/")
+		if parts[len(parts)-1] == "__init__" {
+			parts = parts[:len(parts)-1]
+		}
+		for i := range parts {
+			module := strings.Join(parts[i:], ".")
+			needles = append(needles, usageNeedle{text: module, kind: UsageImport, match: pythonImportLine.MatchString})
+		}
+	}
+
+	needles = append(needles, usageNeedle{text: target, kind: UsagePath})
+	if ext != "" {
+		needles = append(needles, usageNeedle{text: withoutExt, kind: UsagePath})
+	}
+
+	// The bare name only counts inside a quoted string or after a separator,
+	// as in config and build files
+	needles = append(needles, usageNeedle{text: base, kind: UsageFilename, match: func(line string) bool {
+		for _, m := range quotedStrings.FindAllStringSubmatch(line, -1) {
+			if m[1] == base || strings.HasSuffix(m[1], "/"+base) || strings.HasSuffix(m[1], `\`+base) {
+				return true
+			}
+		}
+		return false
+	}})
+
+	return needles
+}
+
+// goImportPath returns the import path of the Go package in dir (relative to
+// the base path), using the nearest go.mod inside the base path
+func (s *Server) goImportPath(dir string) string {
+	modDir, module := s.goModuleRoot(dir)
+	if module == "" {
+		return ""
+	}
+	rel := strings.TrimPrefix(strings.TrimPrefix(dir, modDir), "/")
+	if modDir == "." {
+		rel = dir
+	}
+	if rel == "." || rel == "" {
+		return module
+	}
+	return module + "/" + rel
+}
+
+// goModuleRoot returns the directory (relative to the base path) and module
+// path of the nearest go.mod at or above dir, or an empty module path
+func (s *Server) goModuleRoot(dir string) (string, string) {
+	for modDir := dir; ; modDir = path.Dir(modDir) {
+		data, err := s.guard.ReadFile(filepath.Join(s.config.BasePath, filepath.FromSlash(modDir), "go.mod"))
+		if err == nil {
+			return modDir, goModulePath(data)
+		}
+		if modDir == "." || modDir == "/" {
+			return "", ""
+		}
+	}
+}
+
+// goModulePath extracts the module path from go.mod contents
+func goModulePath(data []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
+
+// scanUsages reports the lines of one file that refer to the target
+func scanUsages(content []byte, relPath, target string, needles []usageNeedle) []FileUsage {
+	isScript := isJavaScriptLike(relPath)
+	var usages []FileUsage
+	for i, line := range strings.Split(string(content), "\n") {
+		kind := ""
+		if isScript && importsRelative(line, path.Dir(relPath), target) {
+			kind = UsageImport
+		}
+		for _, needle := range needles {
+			if kind != "" {
+				break
+			}
+			if containsWord(line, needle.text) && (needle.match == nil || needle.match(line)) {
+				kind = needle.kind
+			}
+		}
+		if kind != "" {
+			usages = append(usages, FileUsage{
+				FilePath:   relPath,
+				LineNumber: i + 1,
+				Content:    strings.TrimRight(line, "\r"),
+				Kind:       kind,
+			})
+		}
+	}
+	return usages
+}
+
+// containsWord reports whether needle occurs in line without being part of a
+// longer identifier, so "util" does not match "utility"
+func containsWord(line, needle string) bool {
+	for start := 0; ; {
+		i := strings.Index(line[start:], needle)
+		if i < 0 {
+			return false
+		}
+		i += start
+		end := i + len(needle)
+		if (i == 0 || !isIdentByte(line[i-1])) && (end == len(line) || !isIdentByte(line[end])) {
+			return true
+		}
+		start = i + 1
+	}
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// ignoreUnlessUnavailable drops ordinary read errors so one unreadable file
+// does not fail the search, but keeps errors from an unresponsive root
+func ignoreUnlessUnavailable(err error) error {
+	if err != nil && unavailableResult(err) != nil {
+		return err
+	}
+	return nil
+}
+
+// isJavaScriptLike reports whether relative imports in the file resolve like Node modules
+func isJavaScriptLike(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".mts", ".cts", ".vue", ".svelte":
+		return true
+	}
+	return false
+}
+
+// importsRelative reports whether a line of a JS/TS file in dir imports
+// target through a relative specifier such as "../lib/util"
+func importsRelative(line, dir, target string) bool {
+	for _, m := range quotedStrings.FindAllStringSubmatch(line, -1) {
+		if resolvesTo(m[1], dir, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvesTo reports whether a relative JS/TS import specifier used in dir
+// refers to target. Scripts may also be imported without their extension or
+// as their directory's index.
+func resolvesTo(spec, dir, target string) bool {
+	if !strings.HasPrefix(spec, "./") && !strings.HasPrefix(spec, "../") {
+		return false
+	}
+	resolved := path.Join(dir, spec)
+	if resolved == target {
+		return true
+	}
+	if !isJavaScriptLike(target) {
+		return false
+	}
+	targetNoExt := strings.TrimSuffix(target, path.Ext(target))
+	return resolved == targetNoExt || path.Base(targetNoExt) == "index" && resolved == path.Dir(target)
+}
@@ -0,0 +1,117 @@
+package mcpfiles
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// variableName is the form of the names ${NAME} refers to
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// builtinVariable returns the value of a variable every config can use:
+// HOME is the user's home directory and WORKSPACE is $WORKSPACE, as CI
+// systems set it, or else the working directory. Other names are looked up
+// in the environment.
+func builtinVariable(name string) (string, bool) {
+	switch name {
+	case "HOME":
+		home, err := os.UserHomeDir()
+		return home, err == nil
+	case "WORKSPACE":
+		if workspace := os.Getenv("WORKSPACE"); workspace != "" {
+			return workspace, true
+		}
+		dir, err := os.Getwd()
+		return dir, err == nil
+	}
+	return os.LookupEnv(name)
+}
+
+// expandVariables replaces each ${NAME} in text with the value of the
+// variable, taking custom variables before the built-in ones and the
+// environment. $${ stands for a literal ${. An unknown name is an error,
+// so a path never silently loses a part.
+func expandVariables(text string, variables map[string]string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(text, "${")
+		if i < 0 {
+			b.WriteString(text)
+			return b.String(), nil
+		}
+		if i > 0 && text[i-1] == '$' {
+			b.WriteString(text[:i])
+			b.WriteString("{")
+			text = text[i+2:]
+			continue
+		}
+		end := strings.IndexByte(text[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unclosed ${ in %q", text)
+		}
+		name := text[i+2 : i+end]
+		value, ok := variables[name]
+		if !ok {
+			value, ok = builtinVariable(name)
+		}
+		if !ok {
+			return "", fmt.Errorf("undefined variable ${%s}", name)
+		}
+		b.WriteString(text[:i])
+		b.WriteString(value)
+		text = text[i+end+1:]
+	}
+}
+
+// expandConfigVariables expands variables in the settings that hold paths
+// and path patterns. Custom variables may themselves use the built-in
+// variables and the environment, but not each other.
+func expandConfigVariables(config *Config) error {
+	variables := make(map[string]string, len(config.Variables))
+	for name, value := range config.Variables {
+		if !variableName.MatchString(name) {
+			return fmt.Errorf("invalid variable name %q", name)
+		}
+		expanded, err := expandVariables(value, nil)
+		if err != nil {
+			return fmt.Errorf("variable %s: %w", name, err)
+		}
+		variables[name] = expanded
+	}
+	config.Variables = variables
+
+	expand := func(setting string, value *string) error {
+		expanded, err := expandVariables(*value, variables)
+		if err != nil {
+			return fmt.Errorf("%s: %w", setting, err)
+		}
+		*value = expanded
+		return nil
+	}
+	if err := expand("base_path", &config.BasePath); err != nil {
+		return err
+	}
+	for i := range config.Roots {
+		if err := expand("roots", &config.Roots[i].Path); err != nil {
+			return err
+		}
+	}
+	lists := []struct {
+		setting string
+		values  []string
+	}{
+		{"ignore", config.Ignore},
+		{"allow_paths", config.AllowPaths},
+		{"deny_paths", config.DenyPaths},
+	}
+	for _, list := range lists {
+		for i := range list.values {
+			if err := expand(list.setting, &list.values[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package mcpfiles
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// loadViews reads a view configuration file of the form {"views": {"name": "filter"}}
+func loadViews(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Views map[string]string `json:"views"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid view config: %w", err)
+	}
+
+	return file.Views, nil
+}
+
+// validateViews checks that every view is a filter expression over the
+// configured tags
+func validateViews(views map[string]string, tags map[string][]string) error {
+	for name, expr := range views {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("view names must not be empty")
+		}
+		if _, err := parseFilter(expr, tags, time.Now()); err != nil {
+			return fmt.Errorf("invalid view %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// viewNames lists the configured views in sorted order
+func (s *Server) viewNames() []string {
+	names := make([]string, 0, len(s.config.Views))
+	for name := range s.config.Views {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// viewOption adds the view parameter to a tool when views are configured
+func (s *Server) viewOption() mcp.ToolOption {
+	if len(s.config.Views) == 0 {
+		return func(*mcp.Tool) {}
+	}
+	names := s.viewNames()
+	return mcp.WithString("view", mcp.Enum(names...),
+		mcp.Description(fmt.Sprintf("Named view limiting which files are visible: %s", strings.Join(names, ", "))),
+	)
+}
+
+// requestView parses the view a request selects, or returns nil when it
+// selects none. Views are parsed per request so relative times stay current.
+func (s *Server) requestView(request mcp.CallToolRequest) (fileFilter, string, error) {
+	name := request.GetString("view", "")
+	if name == "" {
+		return nil, "", nil
+	}
+	expr, ok := s.config.Views[name]
+	if !ok {
+		return nil, name, fmt.Errorf("unknown view %q (views: %s)", name, strings.Join(s.viewNames(), ", "))
+	}
+	view, err := parseFilter(expr, s.config.Tags, time.Now())
+	return view, name, err
+}
+
+// fileEntry describes a file under the base path for matching against a filter
+func (s *Server) fileEntry(relPath string, info fs.FileInfo) filterEntry {
+	relPath = filepath.ToSlash(relPath)
+	return filterEntry{
+		relPath: relPath,
+		size:    info.Size(),
+		modTime: info.ModTime(),
+		tags:    fileTags(s.config.Tags, relPath),
+	}
+}
@@ -0,0 +1,677 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	// maxWatches bounds the watches held at once, by all sessions
+	maxWatches = 64
+	// maxWatchDirs bounds the directories one watch follows, each of which
+	// takes an inotify watch or a file descriptor
+	maxWatchDirs = 4096
+	// defaultMaxWatchDirs is the default of MaxWatchDirs, the directories
+	// all watches of the server follow at once, which fits the smallest
+	// inotify limit Linux ships with
+	defaultMaxWatchDirs = 8192
+	// defaultWatchPollInterval is how often polled directories are read
+	// unless WatchPollInterval says otherwise
+	defaultWatchPollInterval = 2 * time.Second
+	// maxWatchEvents bounds the events a watch keeps; older ones are dropped
+	// and readers behind them are told to resync
+	maxWatchEvents = 10000
+	// maxWatchWait bounds how long get_changes_since waits for an event
+	maxWatchWait = 30 * time.Second
+)
+
+// WatchEvent is one change a watch saw on disk, made by the server or
+// anything else. Sequence numbers start at 1 and increase by one per event.
+type WatchEvent struct {
+	Seq   uint64    `json:"seq"`
+	Time  time.Time `json:"time"`
+	Op    string    `json:"op"` // created, modified or deleted; a rename deletes one name and creates another
+	Path  string    `json:"path"`
+	IsDir bool      `json:"is_dir,omitempty"`
+}
+
+// pathWatch follows the changes below one path for a session
+type pathWatch struct {
+	id        string
+	session   string
+	path      string // as shown, relative to the base path
+	target    string // full path of the watched file; empty when watching a directory
+	dir       string // full path of the watched directory, or of the watched file's
+	recursive bool
+	server    *Server
+	filter    PathFilter
+	watcher   *fsnotify.Watcher // nil when every directory is polled
+	done      chan struct{}     // closed when the watch stops
+
+	mu      sync.Mutex
+	seq     uint64
+	events  []WatchEvent                // oldest first, at most maxWatchEvents
+	dirs    map[string]bool             // the directories the watcher follows, by full path
+	polled  map[string]map[string]stamp // the directories polled instead, with their entries as last seen
+	stopped bool
+	partial string        // why some directories are not followed, when they are not
+	failed  string        // the last problem the watch had, such as events lost to an overflow
+	wake    chan struct{} // closed at the next event
+}
+
+// watchBudget bounds the directories the watches of every root follow with
+// the watcher at once, which share the system's inotify watches or file
+// descriptors, and counts the directories polled instead
+type watchBudget struct {
+	mu      sync.Mutex
+	limit   int
+	used    int
+	polled  int
+	metrics *Metrics
+}
+
+func newWatchBudget(limit int, metrics *Metrics) *watchBudget {
+	metrics.Set("mcp_watch_dirs_budget", float64(limit))
+	metrics.Set("mcp_watch_dirs", 0)
+	metrics.Set("mcp_watch_dirs_polled", 0)
+	return &watchBudget{limit: limit, metrics: metrics}
+}
+
+// take reserves one directory, reporting false when the budget is used up
+func (b *watchBudget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.used >= b.limit {
+		return false
+	}
+	b.used++
+	b.metrics.Set("mcp_watch_dirs", float64(b.used))
+	return true
+}
+
+// give returns n directories to the budget
+func (b *watchBudget) give(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	b.metrics.Set("mcp_watch_dirs", float64(b.used))
+}
+
+// addPolled counts n more directories polled, or fewer when negative
+func (b *watchBudget) addPolled(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.polled += n
+	b.metrics.Set("mcp_watch_dirs_polled", float64(b.polled))
+}
+
+// watchStore holds the live watches of one root, by ID
+type watchStore struct {
+	mu      sync.Mutex
+	next    int
+	watches map[string]*pathWatch
+}
+
+func newWatchStore() *watchStore {
+	return &watchStore{watches: make(map[string]*pathWatch)}
+}
+
+// add registers a watch under a new ID
+func (ws *watchStore) add(w *pathWatch) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if len(ws.watches) >= maxWatches {
+		return fmt.Errorf("too many watches (%d); stop some with unwatch_path first", maxWatches)
+	}
+	ws.next++
+	w.id = strconv.Itoa(ws.next)
+	ws.watches[w.id] = w
+	return nil
+}
+
+// get returns a session's watch
+func (ws *watchStore) get(session, id string) (*pathWatch, bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	w, ok := ws.watches[id]
+	if !ok || w.session != session {
+		return nil, false
+	}
+	return w, true
+}
+
+// remove stops a session's watch, reporting whether it had one by that ID
+func (ws *watchStore) remove(session, id string) bool {
+	ws.mu.Lock()
+	w, ok := ws.watches[id]
+	if ok && w.session == session {
+		delete(ws.watches, id)
+	}
+	ws.mu.Unlock()
+	if !ok || w.session != session {
+		return false
+	}
+	w.stop()
+	return true
+}
+
+// forget stops every watch of a session that ended
+func (ws *watchStore) forget(session string) {
+	ws.mu.Lock()
+	var ended []*pathWatch
+	for id, w := range ws.watches {
+		if w.session == session {
+			ended = append(ended, w)
+			delete(ws.watches, id)
+		}
+	}
+	ws.mu.Unlock()
+	for _, w := range ended {
+		w.stop()
+	}
+}
+
+// stop closes the watcher and gives its directories back to the budget
+func (w *pathWatch) stop() {
+	w.mu.Lock()
+	if w.stopped {
+		w.mu.Unlock()
+		return
+	}
+	n, polled := len(w.dirs), len(w.polled)
+	w.stopped, w.dirs, w.polled = true, nil, nil
+	w.mu.Unlock()
+	close(w.done)
+	if w.watcher != nil {
+		w.watcher.Close()
+	}
+	w.server.watchBudget.give(n)
+	w.server.watchBudget.addPolled(-polled)
+}
+
+// run turns the watcher's events, and the changes found in the polled
+// directories, into watch events until the watch stops
+func (w *pathWatch) run() {
+	var events chan fsnotify.Event
+	var errs chan error
+	if w.watcher != nil {
+		events, errs = w.watcher.Events, w.watcher.Errors
+	}
+	ticker := time.NewTicker(w.server.config.WatchPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.scan()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			w.handle(event)
+		case err, ok := <-errs:
+			if !ok {
+				return
+			}
+			w.mu.Lock()
+			w.failed = err.Error()
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				w.failed = "the system dropped events it could not queue; changes may be missing"
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+// handle records one event of the watcher, following new directories of a
+// recursive watch
+func (w *pathWatch) handle(event fsnotify.Event) {
+	if w.target != "" && event.Name != w.target || !w.visible(event.Name) {
+		return
+	}
+	switch {
+	case event.Has(fsnotify.Create):
+		info, err := w.server.guard.Stat(event.Name)
+		isDir := err == nil && info.IsDir()
+		w.record(changeCreated, event.Name, isDir)
+		if isDir && w.recursive {
+			// Files made before the directory was watched were missed
+			w.addTree(event.Name, true)
+		}
+	case event.Has(fsnotify.Write):
+		w.record(changeModified, event.Name, false)
+	case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+		w.record(changeDeleted, event.Name, w.dropTree(event.Name))
+	}
+}
+
+// dropTree stops following a directory that was removed or renamed and the
+// directories below it, so they no longer count toward maxWatchDirs, and
+// reports whether the path was a followed directory. A renamed directory is
+// followed again under its new name when its Create arrives.
+func (w *pathWatch) dropTree(dir string) bool {
+	below := func(p string) bool { return p == dir || strings.HasPrefix(p, dir+string(filepath.Separator)) }
+	w.mu.Lock()
+	var dropped []string
+	for p := range w.dirs {
+		if below(p) {
+			delete(w.dirs, p)
+			dropped = append(dropped, p)
+		}
+	}
+	polled := 0
+	for p := range w.polled {
+		if below(p) {
+			delete(w.polled, p)
+			polled++
+		}
+	}
+	w.mu.Unlock()
+	// The watcher already forgot removed directories; renamed ones would
+	// report their changes under the old name
+	for _, p := range dropped {
+		w.watcher.Remove(p)
+	}
+	w.server.watchBudget.give(len(dropped))
+	w.server.watchBudget.addPolled(-polled)
+	return len(dropped) > 0 || polled > 0
+}
+
+// visible reports whether changes to a path are shown: not in .git or a
+// path hidden from trees
+func (w *pathWatch) visible(fullPath string) bool {
+	for p := fullPath; p != w.server.config.BasePath && p != filepath.Dir(p); p = filepath.Dir(p) {
+		if filepath.Base(p) == ".git" {
+			return false
+		}
+	}
+	return !w.filter.ShouldIgnore(fullPath)
+}
+
+// record adds an event, folding writes into the event just before them for
+// the same file, which editors and compilers send in bursts
+func (w *pathWatch) record(op, fullPath string, isDir bool) {
+	relPath, _ := filepath.Rel(w.server.config.BasePath, fullPath)
+	relPath = filepath.ToSlash(relPath)
+	now := time.Now().UTC()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if n := len(w.events); op == changeModified && n > 0 && w.events[n-1].Path == relPath && w.events[n-1].Op != changeDeleted {
+		w.events[n-1].Time = now
+		return
+	}
+	w.seq++
+	if len(w.events) == maxWatchEvents {
+		w.events = w.events[1:]
+	}
+	w.events = append(w.events, WatchEvent{Seq: w.seq, Time: now, Op: op, Path: relPath, IsDir: isDir})
+	close(w.wake)
+	w.wake = make(chan struct{})
+}
+
+// addTree watches dir and, for recursive watches, the directories below it
+// that are shown. With report, the entries found are recorded as created.
+// The directories get the watcher in the order of byPriority, and those past
+// what the budget allows are polled.
+func (w *pathWatch) addTree(dir string, report bool) error {
+	w.mu.Lock()
+	room := maxWatchDirs - len(w.dirs) - len(w.polled)
+	w.mu.Unlock()
+	var dirs []string
+	err := w.server.guard.WalkDir(context.Background(), dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if p != dir && !w.visible(p) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() && len(dirs) >= room {
+			w.cutShort("watch", fmt.Sprintf("the watch has more than %d directories", maxWatchDirs))
+			return filepath.SkipAll
+		}
+		if report && p != dir {
+			w.record(changeCreated, p, d.IsDir())
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		dirs = append(dirs, p)
+		if !w.recursive {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range w.byPriority(dirs) {
+		if err := w.follow(p); err != nil {
+			return ignoreSkipAll(err)
+		}
+	}
+	return nil
+}
+
+// ignoreSkipAll passes on errors other than filepath.SkipAll
+func ignoreSkipAll(err error) error {
+	if errors.Is(err, filepath.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+// byPriority orders directories by which should get the watcher first when
+// there is not budget for all: the watched directory, which was asked for,
+// then those whose files were read or searched most recently, then the
+// shallowest, in walk order otherwise
+func (w *pathWatch) byPriority(dirs []string) []string {
+	recent := w.server.access.recentDirs()
+	lastAccess := func(p string) time.Time {
+		relPath, _ := filepath.Rel(w.server.config.BasePath, p)
+		return recent[filepath.ToSlash(relPath)]
+	}
+	sort.SliceStable(dirs, func(i, j int) bool {
+		a, b := dirs[i], dirs[j]
+		if (a == w.dir) != (b == w.dir) {
+			return a == w.dir
+		}
+		if ta, tb := lastAccess(a), lastAccess(b); !ta.Equal(tb) {
+			return ta.After(tb)
+		}
+		return strings.Count(a, string(filepath.Separator)) < strings.Count(b, string(filepath.Separator))
+	})
+	return dirs
+}
+
+// follow starts following one directory with the watcher, or by polling it
+// when the watch polls or the watcher is out of budget
+func (w *pathWatch) follow(p string) error {
+	w.mu.Lock()
+	_, polled := w.polled[p]
+	followed := w.dirs[p] || polled
+	w.mu.Unlock()
+	if followed {
+		return nil
+	}
+	if w.watcher == nil {
+		return w.poll(p)
+	}
+	if !w.server.watchBudget.take() {
+		w.spill("server", fmt.Sprintf("the server already follows its -max-watch-dirs of %d directories", w.server.config.MaxWatchDirs))
+		return w.poll(p)
+	}
+	if err := w.watcher.Add(p); err != nil {
+		w.server.watchBudget.give(1)
+		// The system ran out of inotify watches or file descriptors
+		if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EMFILE) {
+			w.spill("system", "the system's limit on watched directories was reached (on Linux, raise fs.inotify.max_user_watches)")
+			return w.poll(p)
+		}
+		return err
+	}
+	w.mu.Lock()
+	if w.stopped {
+		// The watch was stopped while the tree was walked
+		w.mu.Unlock()
+		w.server.watchBudget.give(1)
+		return filepath.SkipAll
+	}
+	w.dirs[p] = true
+	w.mu.Unlock()
+	return nil
+}
+
+// cutShort notes that a watch does not follow every directory, having more
+// than maxWatchDirs
+func (w *pathWatch) cutShort(limit, reason string) {
+	w.mu.Lock()
+	w.partial, w.failed = reason, reason+"; directories past the limit are not watched"
+	w.mu.Unlock()
+	w.server.metrics.Add("mcp_watch_budget_exhausted_total", 1, "limit", limit)
+}
+
+// spill notes that a directory is polled for want of the watcher's budget
+// of limit, the server's or the system's
+func (w *pathWatch) spill(limit, reason string) {
+	w.mu.Lock()
+	w.failed = fmt.Sprintf("%s; directories past the limit are polled every %s", reason, w.server.config.WatchPollInterval)
+	w.mu.Unlock()
+	w.server.metrics.Add("mcp_watch_budget_exhausted_total", 1, "limit", limit)
+}
+
+// since returns up to limit events after the cursor, the sequence number of
+// the oldest event kept and of the latest, and a channel closed at the next
+// event
+func (w *pathWatch) since(cursor uint64, limit int) ([]WatchEvent, uint64, uint64, chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	oldest := w.seq + 1
+	if len(w.events) > 0 {
+		oldest = w.events[0].Seq
+	}
+	start := 0
+	if cursor >= oldest {
+		start = int(cursor - oldest + 1)
+	}
+	events := append([]WatchEvent{}, w.events[min(start, len(w.events)):]...)
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, oldest, w.seq, w.wake
+}
+
+// handleWatchPath handles the watch_path tool
+func (s *Server) handleWatchPath(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	watchPath := request.GetString("path", ".")
+	recursive := request.GetBool("recursive", true)
+	if s.realBase == "" && s.config.WatchBackend == WatchBackendFSNotify {
+		return mcp.NewToolResultError("Cannot watch: the files are not served from the OS filesystem; use the poll watch backend"), nil
+	}
+
+	// Validate and resolve path
+	fullPath, err := s.validateFilePath(watchPath)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid path: %v", err)), nil
+	}
+	stat, err := s.guard.Stat(fullPath)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("File not found: %v", err)), nil
+	}
+	filter := s.pathFilter()
+	if fullPath != s.config.BasePath && filter.ShouldIgnore(fullPath) {
+		return mcp.NewToolResultError("Cannot watch: path is ignored"), nil
+	}
+
+	relPath, _ := filepath.Rel(s.config.BasePath, fullPath)
+	w := &pathWatch{
+		session:   sessionID(ctx),
+		path:      filepath.ToSlash(relPath),
+		recursive: recursive && stat.IsDir(),
+		server:    s,
+		filter:    filter,
+		done:      make(chan struct{}),
+		dirs:      make(map[string]bool),
+		polled:    make(map[string]map[string]stamp),
+		wake:      make(chan struct{}),
+	}
+
+	// Filesystems whose changes the system cannot report are polled for
+	// changes in their entries' sizes and modification times instead
+	backend, reason := s.config.WatchBackend, ""
+	if backend == WatchBackendAuto {
+		backend = WatchBackendFSNotify
+		if s.realBase == "" {
+			backend, reason = WatchBackendPoll, "the files are not served from the OS filesystem"
+		} else if name, ok := needsPolling(fullPath); ok {
+			backend, reason = WatchBackendPoll, fmt.Sprintf("the path is on a %s filesystem", name)
+		}
+	}
+	if backend == WatchBackendFSNotify {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to watch: %v", err)), nil
+		}
+		w.watcher = watcher
+	}
+
+	// A file is watched through its directory, which sees it replaced too
+	dir := fullPath
+	if !stat.IsDir() {
+		w.target, dir = fullPath, filepath.Dir(fullPath)
+	}
+	w.dir = dir
+	if err := w.addTree(dir, false); err != nil {
+		w.stop()
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to watch: %v", err)), nil
+	}
+	// Once added, the watch can be stopped by another call
+	w.mu.Lock()
+	dirs, polled, partial, warning := len(w.dirs)+len(w.polled), len(w.polled), w.partial, w.failed
+	w.mu.Unlock()
+	if err := s.watches.add(w); err != nil {
+		w.stop()
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	go w.run()
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"watch_id":    w.id,
+		"path":        w.path,
+		"recursive":   w.recursive,
+		"directories": dirs,
+		"backend":     backend,
+		"cursor":      0,
+	}
+	if reason != "" {
+		result["backend_reason"] = reason
+	}
+	if polled > 0 && backend != WatchBackendPoll {
+		result["polled_directories"] = polled
+	}
+	if partial != "" {
+		result["partial"] = true
+	}
+	if warning != "" {
+		result["warning"] = warning
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// handleGetChangesSince handles the get_changes_since tool
+func (s *Server) handleGetChangesSince(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, err := request.RequireString("watch_id")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	cursor := request.GetInt("cursor", 0)
+	if cursor < 0 {
+		return mcp.NewToolResultError("Invalid cursor: must not be negative"), nil
+	}
+	limit := request.GetInt("limit", defaultChangeLimit)
+	if limit <= 0 {
+		return mcp.NewToolResultError("limit must be positive"), nil
+	}
+	wait := time.Duration(request.GetFloat("wait_seconds", 0) * float64(time.Second))
+	wait = min(max(wait, 0), maxWatchWait)
+
+	w, ok := s.watches.get(sessionID(ctx), id)
+	if !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("Unknown watch: %s", id)), nil
+	}
+
+	// Wait for the first event after the cursor, if asked to
+	events, oldest, latest, wake := w.since(uint64(cursor), limit)
+	if len(events) == 0 && wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-wake:
+			events, oldest, latest, _ = w.since(uint64(cursor), limit)
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+	}
+	next := uint64(cursor)
+	if len(events) > 0 {
+		next = events[len(events)-1].Seq
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"watch_id": id,
+		"events":   events,
+		"cursor":   next,
+		"latest":   latest,
+		// Events after the cursor were dropped, or it is not from this
+		// watch; either way rescan what the watch covers
+		"truncated": uint64(cursor)+1 < oldest || uint64(cursor) > latest,
+		"more":      next < latest,
+	}
+	w.mu.Lock()
+	if w.partial != "" {
+		result["partial"] = true
+	}
+	if w.failed != "" {
+		result["warning"] = w.failed
+	}
+	w.mu.Unlock()
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// handleUnwatchPath handles the unwatch_path tool
+func (s *Server) handleUnwatchPath(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, err := request.RequireString("watch_id")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	if !s.watches.remove(sessionID(ctx), id) {
+		return mcp.NewToolResultError(fmt.Sprintf("Unknown watch: %s", id)), nil
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"watch_id": id,
+		"stopped":  true,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
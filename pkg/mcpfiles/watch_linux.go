@@ -0,0 +1,28 @@
+//go:build linux
+
+package mcpfiles
+
+import "syscall"
+
+// pollFilesystems are the filesystems, by statfs magic number, whose changes
+// made elsewhere inotify does not see: network filesystems, changed by other
+// machines, and FUSE, changed by whatever serves it
+var pollFilesystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x01021997: "9p",
+	0x65735546: "fuse",
+}
+
+// needsPolling reports whether path is on a filesystem inotify cannot
+// follow, and which
+func needsPolling(path string) (string, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", false
+	}
+	name, ok := pollFilesystems[uint32(st.Type)]
+	return name, ok
+}
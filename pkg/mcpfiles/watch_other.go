@@ -0,0 +1,9 @@
+//go:build !linux
+
+package mcpfiles
+
+// needsPolling reports whether path is on a filesystem the watcher cannot
+// follow, which is only detected on Linux
+func needsPolling(path string) (string, bool) {
+	return "", false
+}
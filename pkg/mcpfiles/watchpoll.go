@@ -0,0 +1,182 @@
+package mcpfiles
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// stamp is what polling remembers of a directory entry to tell that it
+// changed: its size and modification time
+type stamp struct {
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+// poll starts polling one directory, remembering its entries as they are
+// now so that only later changes are reported
+func (w *pathWatch) poll(dir string) error {
+	entries, err := w.snapshot(dir)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	if w.stopped {
+		w.mu.Unlock()
+		return filepath.SkipAll
+	}
+	_, known := w.polled[dir]
+	w.polled[dir] = entries
+	w.mu.Unlock()
+	if !known {
+		w.server.watchBudget.addPolled(1)
+	}
+	return nil
+}
+
+// snapshot reads the entries of a directory through the guard
+func (w *pathWatch) snapshot(dir string) (map[string]stamp, error) {
+	entries, err := w.server.guard.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	stamps := make(map[string]stamp, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		stamps[entry.Name()] = stamp{size: info.Size(), modTime: info.ModTime(), isDir: entry.IsDir()}
+	}
+	return stamps, nil
+}
+
+// scan reads each polled directory again and turns what changed since the
+// last scan into the events the watcher would have sent, so polled and
+// watched directories are handled alike
+func (w *pathWatch) scan() {
+	w.mu.Lock()
+	dirs := make([]string, 0, len(w.polled))
+	for dir := range w.polled {
+		dirs = append(dirs, dir)
+	}
+	w.mu.Unlock()
+	// Parents first, so a directory removed with its parent is dropped
+	// before it is read
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		w.mu.Lock()
+		before, ok := w.polled[dir]
+		w.mu.Unlock()
+		if !ok {
+			continue
+		}
+		after, err := w.snapshot(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			// The scan of its parent reports it, unless its parent is not
+			// polled, as for the watched directory itself
+			w.mu.Lock()
+			_, parentPolled := w.polled[filepath.Dir(dir)]
+			w.mu.Unlock()
+			if !parentPolled {
+				w.handle(fsnotify.Event{Name: dir, Op: fsnotify.Remove})
+				w.dropTree(dir)
+			}
+			continue
+		}
+		if err != nil {
+			relPath, _ := filepath.Rel(w.server.config.BasePath, dir)
+			w.mu.Lock()
+			w.failed = fmt.Sprintf("cannot poll %s: %v", filepath.ToSlash(relPath), err)
+			w.mu.Unlock()
+			continue
+		}
+		w.mu.Lock()
+		if _, ok := w.polled[dir]; ok {
+			w.polled[dir] = after
+		}
+		w.mu.Unlock()
+		w.compare(dir, before, after)
+	}
+	w.promote()
+}
+
+// compare sends the events for what changed in a directory between two
+// listings of it
+func (w *pathWatch) compare(dir string, before, after map[string]stamp) {
+	names := make([]string, 0, len(before)+len(after))
+	for name := range before {
+		names = append(names, name)
+	}
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		old, existed := before[name]
+		cur, exists := after[name]
+		p := filepath.Join(dir, name)
+		switch {
+		case !exists:
+			w.handle(fsnotify.Event{Name: p, Op: fsnotify.Remove})
+		case !existed:
+			w.handle(fsnotify.Event{Name: p, Op: fsnotify.Create})
+		case cur.isDir != old.isDir:
+			w.handle(fsnotify.Event{Name: p, Op: fsnotify.Remove})
+			w.handle(fsnotify.Event{Name: p, Op: fsnotify.Create})
+		case !cur.isDir && (cur.size != old.size || !cur.modTime.Equal(old.modTime)):
+			w.handle(fsnotify.Event{Name: p, Op: fsnotify.Write})
+		}
+	}
+}
+
+// promote moves polled directories of a watch that has a watcher back to
+// it, in the order of byPriority, while the budget allows, as other watches
+// stop or their directories go away. Each directory is compared with its
+// last listing once it is watched, so no change falls between the two.
+func (w *pathWatch) promote() {
+	if w.watcher == nil {
+		return
+	}
+	w.mu.Lock()
+	dirs := make([]string, 0, len(w.polled))
+	for dir := range w.polled {
+		dirs = append(dirs, dir)
+	}
+	w.mu.Unlock()
+	for _, dir := range w.byPriority(dirs) {
+		if !w.server.watchBudget.take() {
+			return
+		}
+		if err := w.watcher.Add(dir); err != nil {
+			w.server.watchBudget.give(1)
+			return
+		}
+		w.mu.Lock()
+		before, ok := w.polled[dir]
+		if ok {
+			delete(w.polled, dir)
+			w.dirs[dir] = true
+		}
+		w.mu.Unlock()
+		if !ok {
+			// Dropped or stopped meanwhile
+			w.watcher.Remove(dir)
+			w.server.watchBudget.give(1)
+			continue
+		}
+		w.server.watchBudget.addPolled(-1)
+		if after, err := w.snapshot(dir); err == nil {
+			w.compare(dir, before, after)
+		}
+	}
+}
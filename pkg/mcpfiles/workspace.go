@@ -0,0 +1,305 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Statuses of a workspace check, from fine to unusable
+const (
+	checkOK      = "ok"
+	checkInfo    = "info"
+	checkWarning = "warning"
+	checkError   = "error"
+)
+
+// A visible directory this large is reported as one agents should not see
+const (
+	largeDirectoryBytes = 512 * 1024 * 1024
+	largeDirectoryFiles = 20000
+)
+
+// vcsDirectories mark the root of a version-controlled tree
+var vcsDirectories = []string{".git", ".hg", ".svn", ".jj"}
+
+// dependencyDirectories are names of directories that hold installed
+// dependencies, build output or caches rather than the project's sources
+var dependencyDirectories = map[string]bool{
+	"node_modules": true, "bower_components": true, ".venv": true, "venv": true, "__pycache__": true,
+	".tox": true, ".mypy_cache": true, ".pytest_cache": true, "target": true, ".gradle": true,
+	".next": true, ".nuxt": true, ".terraform": true, ".cache": true, "Pods": true,
+}
+
+// manifestFiles mark the top of a project in some language or build tool
+var manifestFiles = []string{
+	"go.mod", "package.json", "pyproject.toml", "setup.py", "requirements.txt", "Cargo.toml",
+	"pom.xml", "build.gradle", "build.gradle.kts", "Gemfile", "composer.json", "Package.swift",
+	"CMakeLists.txt", "Makefile", "mix.exs", "deno.json",
+}
+
+// WorkspaceCheck is one finding of check_workspace, with what to do about it
+type WorkspaceCheck struct {
+	Check    string             `json:"check"`
+	Status   string             `json:"status"` // ok, info, warning or error
+	Message  string             `json:"message"`
+	Guidance string             `json:"guidance,omitempty"`
+	Paths    []WorkspaceDirSize `json:"paths,omitempty"`
+}
+
+// WorkspaceDirSize is a directory a check points at, with what it holds
+type WorkspaceDirSize struct {
+	Path       string `json:"path"`
+	Files      int    `json:"files"`
+	Bytes      int64  `json:"bytes"`
+	Gitignored bool   `json:"gitignored,omitempty"` // hidden from trees, but still searched
+}
+
+// workspaceScan is what a walk of the base path found
+type workspaceScan struct {
+	entries   int
+	files     int
+	bytes     int64
+	oversized int
+	truncated bool
+	top       map[string]*WorkspaceDirSize // top-level directories
+	deps      []*WorkspaceDirSize          // dependency directories, outermost only
+}
+
+// handleCheckWorkspace handles the check_workspace tool
+func (s *Server) handleCheckWorkspace(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	scan, err := s.scanWorkspace(ctx)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read directory: %v", err)), nil
+	}
+
+	checks := []WorkspaceCheck{s.checkEmpty(scan), s.checkVCS(), s.checkManifest()}
+	checks = append(checks, s.checkLargeDirectories(scan), s.checkDependencyDirectories(scan), s.checkOversizedFiles(scan))
+	if scan.truncated {
+		checks = append(checks, WorkspaceCheck{
+			Check:    "scan",
+			Status:   checkInfo,
+			Message:  fmt.Sprintf("Stopped after %d entries; directories past them were not checked", s.config.MaxTreeNodes),
+			Guidance: "Hide generated and data directories with .mcpignore so the workspace is smaller",
+		})
+	}
+	ready := true
+	for _, check := range checks {
+		if check.Status == checkError {
+			ready = false
+		}
+	}
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"base_path": s.config.BasePath,
+		"ready":     ready,
+		"files":     scan.files,
+		"bytes":     scan.bytes,
+		"truncated": scan.truncated,
+		"checks":    checks,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// scanWorkspace walks what agents can see of the base path, up to
+// MaxTreeNodes entries, totalling each top-level and dependency directory
+func (s *Server) scanWorkspace(ctx context.Context) (*workspaceScan, error) {
+	if err := s.guard.Check("walk", s.config.BasePath); err != nil {
+		return nil, err
+	}
+	scan := &workspaceScan{top: map[string]*WorkspaceDirSize{}}
+	gitignore := NewGitignoreFilter(s.config.BasePath)
+	var dep *WorkspaceDirSize
+	err := s.guard.WalkDir(ctx, s.config.BasePath, func(path string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil || path == s.config.BasePath {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if s.hidden.ShouldIgnore(path) || s.pathLists != nil && s.pathLists.ShouldIgnore(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if scan.entries == s.config.MaxTreeNodes {
+			scan.truncated = true
+			return filepath.SkipAll
+		}
+		scan.entries++
+
+		relPath, _ := filepath.Rel(s.config.BasePath, path)
+		relPath = filepath.ToSlash(relPath)
+		top, _, nested := strings.Cut(relPath, "/")
+		if dep != nil && !strings.HasPrefix(relPath, dep.Path+"/") {
+			dep = nil
+		}
+		if d.IsDir() {
+			if !nested {
+				scan.top[top] = &WorkspaceDirSize{Path: relPath, Gitignored: gitignore.ShouldIgnore(path)}
+			}
+			if dep == nil && dependencyDirectories[d.Name()] {
+				dep = &WorkspaceDirSize{Path: relPath, Gitignored: gitignore.ShouldIgnore(path)}
+				scan.deps = append(scan.deps, dep)
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		scan.files++
+		scan.bytes += info.Size()
+		if info.Size() > s.config.maxFileSize(path) {
+			scan.oversized++
+		}
+		for _, dir := range []*WorkspaceDirSize{scan.top[top], dep} {
+			if dir != nil {
+				dir.Files++
+				dir.Bytes += info.Size()
+			}
+		}
+		return nil
+	})
+	return scan, err
+}
+
+// checkEmpty reports a workspace with nothing to work on
+func (s *Server) checkEmpty(scan *workspaceScan) WorkspaceCheck {
+	if scan.entries == 0 {
+		return WorkspaceCheck{
+			Check:    "empty",
+			Status:   checkError,
+			Message:  "The workspace has no files",
+			Guidance: "Clone or create the project in the base path, or start the server with -base-path at the directory that holds it",
+		}
+	}
+	if scan.files == 0 {
+		return WorkspaceCheck{
+			Check:    "empty",
+			Status:   checkError,
+			Message:  "The workspace has directories but no files",
+			Guidance: "Check that the project was checked out completely, or point -base-path at the directory that holds it",
+		}
+	}
+	return WorkspaceCheck{Check: "empty", Status: checkOK, Message: fmt.Sprintf("Files in the workspace: %d", scan.files)}
+}
+
+// checkVCS looks for version control in the base path or a directory above
+// it, without which an agent's changes cannot be reviewed or undone
+func (s *Server) checkVCS() WorkspaceCheck {
+	for dir := s.config.BasePath; ; dir = filepath.Dir(dir) {
+		for _, name := range vcsDirectories {
+			if _, err := s.guard.Stat(filepath.Join(dir, name)); err == nil {
+				message := fmt.Sprintf("Version control found: %s", name)
+				if dir != s.config.BasePath {
+					message = fmt.Sprintf("Version control found: %s in %s, above the base path", name, dir)
+				}
+				return WorkspaceCheck{Check: "vcs", Status: checkOK, Message: message}
+			}
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	return WorkspaceCheck{
+		Check:    "vcs",
+		Status:   checkWarning,
+		Message:  "The workspace is not under version control",
+		Guidance: "Run git init and commit the current state before an agent starts, so its changes can be reviewed and undone",
+	}
+}
+
+// checkManifest looks for a project manifest at the top of the workspace
+func (s *Server) checkManifest() WorkspaceCheck {
+	var found []string
+	for _, name := range manifestFiles {
+		if _, err := s.guard.Stat(filepath.Join(s.config.BasePath, name)); err == nil && !s.hidden.ShouldIgnore(filepath.Join(s.config.BasePath, name)) {
+			found = append(found, name)
+		}
+	}
+	if len(found) > 0 {
+		return WorkspaceCheck{Check: "manifest", Status: checkOK, Message: fmt.Sprintf("Project manifest found: %s", strings.Join(found, ", "))}
+	}
+	return WorkspaceCheck{
+		Check:    "manifest",
+		Status:   checkInfo,
+		Message:  "No project manifest such as go.mod or package.json at the top of the workspace",
+		Guidance: "If the project lives in a subdirectory, start the server with -base-path at it, so paths are relative to the project and tools such as go_api_surface find its manifest",
+	}
+}
+
+// checkLargeDirectories reports visible top-level directories big enough to
+// slow down searches and flood trees
+func (s *Server) checkLargeDirectories(scan *workspaceScan) WorkspaceCheck {
+	var large []WorkspaceDirSize
+	for _, dir := range scan.top {
+		if dir.Bytes >= largeDirectoryBytes || dir.Files >= largeDirectoryFiles {
+			large = append(large, *dir)
+		}
+	}
+	if len(large) == 0 {
+		return WorkspaceCheck{Check: "large_directories", Status: checkOK, Message: "No top-level directory is unusually large"}
+	}
+	sort.Slice(large, func(i, j int) bool { return large[i].Bytes > large[j].Bytes })
+	return WorkspaceCheck{
+		Check:    "large_directories",
+		Status:   checkWarning,
+		Message:  fmt.Sprintf("Top-level directories with over %d files or %d MB: %d", largeDirectoryFiles, largeDirectoryBytes/1024/1024, len(large)),
+		Guidance: "If they hold data or generated files rather than sources, list them in .mcpignore (or pass -ignore) so searches skip them; .gitignore only hides them from trees",
+		Paths:    large,
+	}
+}
+
+// checkDependencyDirectories reports visible directories of installed
+// dependencies, build output and caches
+func (s *Server) checkDependencyDirectories(scan *workspaceScan) WorkspaceCheck {
+	if len(scan.deps) == 0 {
+		return WorkspaceCheck{Check: "dependency_directories", Status: checkOK, Message: "No dependency or build directories are visible"}
+	}
+	paths := make([]WorkspaceDirSize, len(scan.deps))
+	for i, dir := range scan.deps {
+		paths[i] = *dir
+	}
+	sort.Slice(paths, func(i, j int) bool { return paths[i].Bytes > paths[j].Bytes })
+	return WorkspaceCheck{
+		Check:    "dependency_directories",
+		Status:   checkWarning,
+		Message:  fmt.Sprintf("Dependency, build or cache directories visible to agents: %d", len(paths)),
+		Guidance: "List them in .mcpignore (or pass -ignore) so searches and trees skip them; .gitignore only hides them from trees",
+		Paths:    paths,
+	}
+}
+
+// checkOversizedFiles reports files agents can see but not read whole
+func (s *Server) checkOversizedFiles(scan *workspaceScan) WorkspaceCheck {
+	if scan.oversized == 0 {
+		return WorkspaceCheck{Check: "large_files", Status: checkOK, Message: "Every file is within the size limit"}
+	}
+	return WorkspaceCheck{
+		Check:    "large_files",
+		Status:   checkInfo,
+		Message:  fmt.Sprintf("Files over the size limit, which are not searched and can only be read a line range at a time: %d", scan.oversized),
+		Guidance: "Raise -max-file-size, or a max_size in -extension-config for their extension, if agents need them",
+	}
+}
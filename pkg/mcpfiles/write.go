@@ -0,0 +1,605 @@
+package mcpfiles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Permissions for files and directories created by write tools
+const (
+	newFileMode = 0o644
+	newDirMode  = 0o755
+)
+
+// handleWriteFile handles the write_file tool
+func (s *Server) handleWriteFile(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	filePath, err := request.RequireString("file_path")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	content, err := request.RequireString("content")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+
+	// Validate and resolve path
+	fullPath, err := s.validateFilePath(filePath)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid file path: %v", err)), nil
+	}
+	if fullPath == s.config.BasePath {
+		return mcp.NewToolResultError("Invalid file path: cannot write to the base path itself"), nil
+	}
+
+	// Overwrites keep the file's mode and text encoding; new files take the
+	// encoding configured for their extension
+	encoding := TextEncoding{Name: EncodingUTF8}
+	if forced := s.config.extensionHandling(fullPath).Encoding; forced != "" {
+		encoding.Name = forced
+	}
+	file := &textFile{encoding: encoding, perm: newFileMode}
+	created := false
+	stat, err := s.guard.Stat(fullPath)
+	switch {
+	case err == nil:
+		if stat.IsDir() {
+			return mcp.NewToolResultError(fmt.Sprintf("Cannot write file: %s is a directory", filePath)), nil
+		}
+		file.perm = stat.Mode().Perm()
+		existing, ok, err := s.existingEncoding(ctx, fullPath, stat.Size())
+		if err != nil {
+			if result := unavailableResult(err); result != nil {
+				return result, nil
+			}
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to read file to keep its encoding: %v", err)), nil
+		}
+		if ok {
+			file.encoding = existing
+		}
+	case errors.Is(err, fs.ErrNotExist):
+		created = true
+	default:
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to stat file: %v", err)), nil
+	}
+
+	// Create missing parent directories, unless storeTextFile will reject
+	// the content as too large anyway (new files are plain UTF-8)
+	if created && int64(len(content)) <= s.config.MaxWriteSize {
+		if err := s.guard.MkdirAll(filepath.Dir(fullPath), newDirMode); err != nil {
+			if result := unavailableResult(err); result != nil {
+				return result, nil
+			}
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to create directory: %v", err)), nil
+		}
+	}
+
+	size, errResult := s.storeTextFile(fullPath, file, content)
+	if errResult != nil {
+		return errResult, nil
+	}
+	op := changeModified
+	if created {
+		op = changeCreated
+	}
+	s.recordChange("write_file", op, fullPath, "", false)
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"file_path":  filePath,
+		"size_bytes": size,
+		"encoding":   file.encoding.Name,
+		"bom":        file.encoding.BOM,
+		"created":    created,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// encodingPrefixSize is how much of a file too large to read whole is read
+// to detect its encoding
+const encodingPrefixSize = 64 << 10
+
+// existingEncoding detects the text encoding of a file about to be replaced,
+// from its first bytes when it is too large to read whole. Returns false for
+// files that are empty or not text.
+func (s *Server) existingEncoding(ctx context.Context, fullPath string, size int64) (TextEncoding, bool, error) {
+	if size == 0 {
+		return TextEncoding{}, false, nil
+	}
+	if size <= s.config.maxFileSize(fullPath) {
+		existing, err := s.guard.ReadFile(fullPath)
+		if err != nil {
+			return TextEncoding{}, false, err
+		}
+		encoding, ok := s.config.textEncoding(fullPath, existing)
+		return encoding, ok, nil
+	}
+
+	prefix, err := s.guard.ReadAt(ctx, fullPath, 0, encodingPrefixSize)
+	if err != nil {
+		return TextEncoding{}, false, err
+	}
+	// The prefix may end partway through a UTF-8 character
+	if trimmed := trimPartialRune(prefix); !utf8.Valid(prefix) && utf8.Valid(trimmed) {
+		prefix = trimmed
+	}
+	encoding, ok := s.config.textEncoding(fullPath, prefix)
+	return encoding, ok, nil
+}
+
+// FileEdit replaces old_text with new_text in edit_file
+type FileEdit struct {
+	OldText    string `json:"old_text"`
+	NewText    string `json:"new_text"`
+	ReplaceAll *bool  `json:"replace_all,omitempty"`
+	Line       *int   `json:"line,omitempty"` // picks the occurrence starting on this line
+}
+
+// handleEditFile handles the edit_file tool
+func (s *Server) handleEditFile(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	filePath, err := request.RequireString("file_path")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	editsStr, err := request.RequireString("edits")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+
+	var edits []FileEdit
+	if err := json.Unmarshal([]byte(editsStr), &edits); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid edits JSON: %v", err)), nil
+	}
+	if len(edits) == 0 {
+		return mcp.NewToolResultError("At least one edit is required"), nil
+	}
+
+	// Validate and resolve path
+	fullPath, err := s.validateFilePath(filePath)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid file path: %v", err)), nil
+	}
+
+	file, errResult := s.loadTextFile(fullPath)
+	if errResult != nil {
+		return errResult, nil
+	}
+
+	// Apply every edit in memory first so a failing edit leaves the file untouched
+	text, replacements, err := applyEdits(file.text, edits)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to apply edits: %v", err)), nil
+	}
+
+	size, errResult := s.storeTextFile(fullPath, file, text)
+	if errResult != nil {
+		return errResult, nil
+	}
+	s.recordChange("edit_file", changeModified, fullPath, "", false)
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"file_path":    filePath,
+		"replacements": replacements,
+		"size_bytes":   size,
+		"encoding":     file.encoding.Name,
+		"bom":          file.encoding.BOM,
+		"diff":         unifiedDiff(filepath.ToSlash(filePath), file.text, text),
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// textFile is an existing file decoded for modification
+type textFile struct {
+	text     string
+	encoding TextEncoding
+	perm     fs.FileMode
+}
+
+// loadTextFile reads and decodes an existing file for modification.
+// Failures are returned as tool results.
+func (s *Server) loadTextFile(fullPath string) (*textFile, *mcp.CallToolResult) {
+	stat, err := s.guard.Stat(fullPath)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return nil, result
+		}
+		return nil, mcp.NewToolResultError(fmt.Sprintf("File not found: %v", err))
+	}
+	if stat.IsDir() {
+		return nil, mcp.NewToolResultError("Cannot edit file: path is a directory")
+	}
+	if maxSize := s.config.maxFileSize(fullPath); stat.Size() > maxSize {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("File too large (%.2f MB > %.2f MB)",
+			float64(stat.Size())/1024/1024, float64(maxSize)/1024/1024))
+	}
+
+	content, err := s.guard.ReadFile(fullPath)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return nil, result
+		}
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Failed to read file: %v", err))
+	}
+
+	encoding, ok := s.config.textEncoding(fullPath, content)
+	if !ok {
+		return nil, mcp.NewToolResultError("Cannot edit file: content is not text")
+	}
+	text, err := decodeText(content, encoding)
+	if err != nil {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Failed to decode file: %v", err))
+	}
+
+	return &textFile{text: text, encoding: encoding, perm: stat.Mode().Perm()}, nil
+}
+
+// storeTextFile re-encodes text like the file it replaces and writes it
+// atomically, returning the size written. Failures are returned as tool results.
+func (s *Server) storeTextFile(fullPath string, file *textFile, text string) (int, *mcp.CallToolResult) {
+	data, err := encodeText(text, file.encoding)
+	if err != nil {
+		return 0, mcp.NewToolResultError(fmt.Sprintf("Failed to encode content: %v", err))
+	}
+	if int64(len(data)) > s.config.MaxWriteSize {
+		return 0, mcp.NewToolResultError(fmt.Sprintf("Content too large (%.2f MB > %.2f MB)",
+			float64(len(data))/1024/1024, float64(s.config.MaxWriteSize)/1024/1024))
+	}
+
+	if err := s.guard.WriteFile(fullPath, data, file.perm); err != nil {
+		if result := unavailableResult(err); result != nil {
+			return 0, result
+		}
+		return 0, mcp.NewToolResultError(fmt.Sprintf("Failed to write file: %v", err))
+	}
+	return len(data), nil
+}
+
+// applyEdits applies edits in order, each to the result of the previous one,
+// and returns the new text with the total number of replacements
+func applyEdits(text string, edits []FileEdit) (string, int, error) {
+	// Agents usually send LF; match files that use CRLF line endings
+	crlf := strings.Contains(text, "\r\n")
+
+	replacements := 0
+	for i, edit := range edits {
+		if edit.OldText == "" {
+			return "", 0, fmt.Errorf("edit %d: old_text must not be empty", i)
+		}
+		oldText, newText := edit.OldText, edit.NewText
+		if crlf && !strings.Contains(text, oldText) {
+			oldText, newText = toCRLF(oldText), toCRLF(newText)
+		}
+
+		offsets := occurrences(text, oldText)
+		lines := make([]int, len(offsets))
+		for j, offset := range offsets {
+			lines[j] = strings.Count(text[:offset], "\n") + 1
+		}
+
+		switch {
+		case len(offsets) == 0:
+			return "", 0, fmt.Errorf("edit %d: old_text not found", i)
+		case edit.Line != nil:
+			found := -1
+			for j, line := range lines {
+				if line == *edit.Line {
+					found = j
+					break
+				}
+			}
+			if found < 0 {
+				return "", 0, fmt.Errorf("edit %d: no occurrence of old_text starts on line %d (found on lines %s)", i, *edit.Line, joinInts(lines))
+			}
+			offsets = offsets[found : found+1]
+		case edit.ReplaceAll != nil && *edit.ReplaceAll:
+		case len(offsets) > 1:
+			return "", 0, fmt.Errorf("edit %d: old_text matches %d times (lines %s); add context, set line, or set replace_all", i, len(offsets), joinInts(lines))
+		}
+
+		// Splice from the end so earlier offsets stay valid
+		for j := len(offsets) - 1; j >= 0; j-- {
+			text = text[:offsets[j]] + newText + text[offsets[j]+len(oldText):]
+		}
+		replacements += len(offsets)
+	}
+
+	return text, replacements, nil
+}
+
+// occurrences returns the byte offsets of non-overlapping matches of sub in text
+func occurrences(text, sub string) []int {
+	var offsets []int
+	for start := 0; ; {
+		i := strings.Index(text[start:], sub)
+		if i < 0 {
+			return offsets
+		}
+		offsets = append(offsets, start+i)
+		start += i + len(sub)
+	}
+}
+
+// toCRLF converts bare LF line endings to CRLF
+func toCRLF(text string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", "\r\n")
+}
+
+// joinInts formats numbers as a comma-separated list
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprint(v)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// handleDeleteFile handles the delete_file tool
+func (s *Server) handleDeleteFile(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	filePath, err := request.RequireString("file_path")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+
+	fullPath, errResult := s.deletablePath(filePath, false)
+	if errResult != nil {
+		return errResult, nil
+	}
+	if request.GetBool("dry_run", false) {
+		return s.impactResult(ctx, map[string]interface{}{"file_path": filePath, "deleted": false}, fullPath, false, "")
+	}
+
+	if err := s.guard.Remove(fullPath); err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to delete file: %v", err)), nil
+	}
+	s.recordChange("delete_file", changeDeleted, fullPath, "", false)
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"file_path": filePath,
+		"deleted":   true,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// handleDeleteDirectory handles the delete_directory tool
+func (s *Server) handleDeleteDirectory(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	dirPath, err := request.RequireString("path")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	recursive := request.GetBool("recursive", false)
+
+	fullPath, errResult := s.deletablePath(dirPath, true)
+	if errResult != nil {
+		return errResult, nil
+	}
+	if request.GetBool("dry_run", false) {
+		if !recursive {
+			entries, err := s.guard.ReadDir(fullPath)
+			if err != nil {
+				if result := unavailableResult(err); result != nil {
+					return result, nil
+				}
+				return mcp.NewToolResultError(fmt.Sprintf("Failed to read directory: %v", err)), nil
+			}
+			if len(entries) > 0 {
+				return mcp.NewToolResultError("Failed to delete directory: directory is not empty; set recursive to delete its contents"), nil
+			}
+		}
+		return s.impactResult(ctx, map[string]interface{}{"path": dirPath, "recursive": recursive, "deleted": false}, fullPath, true, "")
+	}
+
+	remove := s.guard.Remove
+	if recursive {
+		remove = s.guard.RemoveAll
+	}
+	if err := remove(fullPath); err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		if !recursive && errors.Is(err, syscall.ENOTEMPTY) {
+			return mcp.NewToolResultError("Failed to delete directory: directory is not empty; set recursive to delete its contents"), nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to delete directory: %v", err)), nil
+	}
+	s.recordChange("delete_directory", changeDeleted, fullPath, "", true)
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"path":      dirPath,
+		"recursive": recursive,
+		"deleted":   true,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// deletablePath validates a path for deletion and checks that it exists and
+// is a directory (or not) as expected. Failures are returned as tool results.
+func (s *Server) deletablePath(path string, wantDir bool) (string, *mcp.CallToolResult) {
+	fullPath, err := s.validateFilePath(path)
+	if err != nil {
+		return "", mcp.NewToolResultError(fmt.Sprintf("Invalid file path: %v", err))
+	}
+	if fullPath == s.config.BasePath {
+		return "", mcp.NewToolResultError("Invalid file path: cannot delete the base path itself")
+	}
+
+	stat, err := s.guard.Stat(fullPath)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return "", result
+		}
+		return "", mcp.NewToolResultError(fmt.Sprintf("File not found: %v", err))
+	}
+	switch {
+	case wantDir && !stat.IsDir():
+		return "", mcp.NewToolResultError("Cannot delete directory: path is a file; use delete_file")
+	case !wantDir && stat.IsDir():
+		return "", mcp.NewToolResultError("Cannot delete file: path is a directory; use delete_directory")
+	}
+	return fullPath, nil
+}
+
+// handleMoveFile handles the move_file tool
+func (s *Server) handleMoveFile(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	source, err := request.RequireString("source")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	destination, err := request.RequireString("destination")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Missing required parameter: %v", err)), nil
+	}
+	overwrite := request.GetBool("overwrite", false)
+
+	// Validate and resolve both paths
+	fullSource, err := s.validateFilePath(source)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid source path: %v", err)), nil
+	}
+	fullDest, err := s.validateFilePath(destination)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid destination path: %v", err)), nil
+	}
+	if fullSource == s.config.BasePath || fullDest == s.config.BasePath {
+		return mcp.NewToolResultError("Invalid file path: cannot move the base path or replace it"), nil
+	}
+	if fullSource == fullDest {
+		return mcp.NewToolResultError("Source and destination are the same path"), nil
+	}
+	if strings.HasPrefix(fullDest, fullSource+string(filepath.Separator)) {
+		return mcp.NewToolResultError("Cannot move a directory into itself"), nil
+	}
+
+	srcStat, err := s.guard.Stat(fullSource)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Source not found: %v", err)), nil
+	}
+
+	// Refuse to replace an existing destination unless asked to, and never
+	// replace directories, which would silently discard their contents
+	overwritten := false
+	destStat, err := s.guard.Stat(fullDest)
+	switch {
+	case err == nil:
+		if !overwrite {
+			return mcp.NewToolResultError(fmt.Sprintf("Destination already exists: %s (set overwrite to replace it)", destination)), nil
+		}
+		if destStat.IsDir() || srcStat.IsDir() {
+			return mcp.NewToolResultError("Cannot overwrite: only a file can replace an existing file"), nil
+		}
+		overwritten = true
+	case !errors.Is(err, fs.ErrNotExist):
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to stat destination: %v", err)), nil
+	}
+
+	entryType := "file"
+	if srcStat.IsDir() {
+		entryType = "directory"
+	}
+	if request.GetBool("dry_run", false) {
+		result := map[string]interface{}{"source": source, "destination": destination, "type": entryType, "overwritten": overwritten}
+		return s.impactResult(ctx, result, fullSource, srcStat.IsDir(), fullDest)
+	}
+
+	// Create missing parent directories
+	if !overwritten {
+		if err := s.guard.MkdirAll(filepath.Dir(fullDest), newDirMode); err != nil {
+			if result := unavailableResult(err); result != nil {
+				return result, nil
+			}
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to create directory: %v", err)), nil
+		}
+	}
+
+	if err := s.guard.Rename(fullSource, fullDest); err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to move: %v", err)), nil
+	}
+	s.recordChange("move_file", changeMoved, fullDest, fullSource, srcStat.IsDir())
+
+	// Create result as JSON text
+	result := map[string]interface{}{
+		"source":      source,
+		"destination": destination,
+		"type":        entryType,
+		"overwritten": overwritten,
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
+
+// impactResult answers a dry run of a move or delete with the result the call
+// would have given and what it would affect, changing nothing
+func (s *Server) impactResult(ctx context.Context, result map[string]interface{}, fullPath string, isDir bool, dest string) (*mcp.CallToolResult, error) {
+	impact, err := s.impact(ctx, fullPath, isDir, dest)
+	if err != nil {
+		if result := unavailableResult(err); result != nil {
+			return result, nil
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to search for references: %v", err)), nil
+	}
+
+	// Create result as JSON text
+	result["dry_run"] = true
+	result["impact"] = impact
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to marshal result: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(string(resultJSON)), nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"filesystem-mcp-server/pkg/mcpfiles"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// replayOutput is one line printed by the replay subcommand
+type replayOutput struct {
+	Index   int    `json:"index"` // line of the call in the recording, from 1
+	Tool    string `json:"tool"`
+	IsError bool   `json:"is_error"`
+	Changed bool   `json:"changed"`
+	Skipped bool   `json:"skipped,omitempty"` // a write tool, not replayed without -allow-writes
+	Result  string `json:"result"`
+}
+
+// runReplay implements the `replay` subcommand: it re-executes a recording
+// against a workspace and prints each result as a JSON line, flagging results
+// that differ from the recorded ones. The workspace is only changed with
+// -allow-writes.
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	basePath := fs.String("base-path", ".", "Workspace to replay the calls against")
+	onlyChanged := fs.Bool("only-changed", false, "Only print calls whose result differs from the recording")
+	stateKeyFile := fs.String("state-key-file", "", "Key the recording was encrypted with, if any")
+	allowWrites := fs.Bool("allow-writes", false, "Replay calls to write tools too, changing the workspace; they are skipped otherwise")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s replay [flags] recording.jsonl\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("a recording file is required")
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to read recording: %w", err)
+	}
+	stateCipher, err := loadStateCipher(*stateKeyFile)
+	if err != nil {
+		return err
+	}
+
+	config := &mcpfiles.Config{BasePath: *basePath, Mode: mcpfiles.ModeReadOnly}
+	if *allowWrites {
+		config.Mode = mcpfiles.ModeReadWrite
+	}
+	if err := mcpfiles.ValidateConfig(config); err != nil {
+		return err
+	}
+	fileServer := mcpfiles.NewServer(config)
+	fileServer.RegisterTools()
+
+	ctx := context.Background()
+	c, err := startBenchClient(ctx, func() (*client.Client, error) {
+		return client.NewInProcessClient(fileServer.MCPServer())
+	})
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	encoder := json.NewEncoder(os.Stdout)
+	for index, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		plain, err := stateCipher.Open([]byte(line))
+		if err != nil {
+			return fmt.Errorf("invalid call on line %d: %w", index+1, err)
+		}
+		var call mcpfiles.RecordedCall
+		if err := json.Unmarshal(plain, &call); err != nil {
+			return fmt.Errorf("invalid call on line %d: %w", index+1, err)
+		}
+
+		request := mcp.CallToolRequest{}
+		request.Params.Name = call.Tool
+		request.Params.Arguments = call.Arguments
+
+		output := replayOutput{Index: index + 1, Tool: call.Tool}
+		if !*allowWrites && mcpfiles.IsWriteTool(call.Tool) {
+			output.Skipped = true
+			if !*onlyChanged {
+				if err := encoder.Encode(output); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		result, err := c.CallTool(ctx, request)
+		if err != nil {
+			output.IsError = true
+			output.Result = err.Error()
+		} else {
+			output.IsError = result.IsError
+			for _, content := range result.Content {
+				if text, ok := content.(mcp.TextContent); ok {
+					output.Result += text.Text
+				}
+			}
+			switch {
+			case call.ResultSHA256 != "":
+				output.Changed = call.ResultSHA256 != mcpfiles.ResultDigest(result)
+			case call.ResultHash != "":
+				digest, err := mcpfiles.ResultDigestWith(result, call.HashAlgorithm)
+				if err != nil {
+					return fmt.Errorf("invalid call on line %d: %w", index+1, err)
+				}
+				output.Changed = call.ResultHash != digest
+			}
+		}
+
+		if *onlyChanged && !output.Changed {
+			continue
+		}
+		if err := encoder.Encode(output); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadStateCipher returns the cipher for a state key file, or nil when no
+// file is given, which still reads records that are not encrypted
+func loadStateCipher(path string) (*mcpfiles.StateCipher, error) {
+	if path == "" {
+		return nil, nil
+	}
+	key, err := mcpfiles.LoadStateKey(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state key: %w", err)
+	}
+	return mcpfiles.NewStateCipher(key)
+}